@@ -0,0 +1,12 @@
+// Package api holds the OpenAPI 3.1 description of the REST API, and the JSON Schema
+// of album exports it refers to. Both are maintained by hand next to the handlers; tests
+// in internal/handlers fail when a registered route or an exported field is missing.
+package api
+
+import _ "embed"
+
+//go:embed openapi.json
+var OpenAPI []byte
+
+//go:embed export.schema.json
+var ExportSchema []byte
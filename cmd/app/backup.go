@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"vinyl-vault/internal/backup"
+	"vinyl-vault/internal/config"
+	"vinyl-vault/internal/database"
+	"vinyl-vault/internal/services"
+)
+
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	configFlags := config.BindFlags(fs)
+	output := fs.String("o", "", "archive to write (required)")
+	base := fs.String("incremental", "", "previous backup archive; only media missing from it is included")
+	fs.Parse(args)
+
+	if *output == "" {
+		fs.Usage()
+		return fmt.Errorf("-o is required")
+	}
+
+	var baseManifest *backup.Manifest
+	if *base != "" {
+		manifest, err := backup.ReadManifest(*base)
+		if err != nil {
+			return err
+		}
+		baseManifest = manifest
+	}
+
+	cfg, err := configFlags.Load()
+	if err != nil {
+		return err
+	}
+	db, err := database.Open(cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+
+	// write next to the target and rename, so a failed backup never looks complete
+	tmp, err := os.CreateTemp(filepath.Dir(*output), ".backup-*")
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	manifest, err := backup.Create(context.Background(), db, services.NewFileServiceWithConfig(cfg), tmp, baseManifest)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), *output); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+
+	included := 0
+	for _, file := range manifest.Files {
+		if file.Included {
+			included++
+		}
+	}
+	fmt.Printf("Backup written to %s: %d users, %d albums, %d tracks, %d/%d media files included\n",
+		*output, manifest.Counts["users"], manifest.Counts["albums"], manifest.Counts["tracks"], included, len(manifest.Files))
+	return nil
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	configFlags := config.BindFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: app restore [flags] <full.tar> [incremental.tar ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no archives given")
+	}
+
+	cfg, err := configFlags.Load()
+	if err != nil {
+		return err
+	}
+	db, err := database.Open(cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+
+	// a fresh instance has no tables yet
+	migrator, err := newMigrator(db, cfg)
+	if err != nil {
+		return err
+	}
+	if err = migrateUp(context.Background(), migrator); err != nil {
+		return err
+	}
+
+	fileService := services.NewFileServiceWithConfig(cfg)
+	if err = fileService.EnsureDirectoriesExist(); err != nil {
+		return err
+	}
+
+	if err = backup.Restore(context.Background(), db, fileService, fs.Args()); err != nil {
+		return err
+	}
+	fmt.Println("Restore completed successfully.")
+	return nil
+}
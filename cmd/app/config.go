@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"vinyl-vault/internal/config"
+)
+
+func runConfig(args []string) error {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	configFlags := config.BindFlags(fs)
+	format := fs.String("format", "yaml", "output format, yaml or toml")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: app config [flags] print")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || fs.Arg(0) != "print" {
+		fs.Usage()
+		return fmt.Errorf("expected print")
+	}
+
+	cfg, err := configFlags.Load()
+	if err != nil {
+		return err
+	}
+	return cfg.Print(os.Stdout, *format)
+}
@@ -1,8 +1,54 @@
 package main
 
+import (
+	"fmt"
+	"os"
+)
+
 func main() {
 
-	// TODO:
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "backup":
+		err = runBackup(os.Args[2:])
+	case "restore":
+		err = runRestore(os.Args[2:])
+	case "migrate":
+		err = runMigrate(os.Args[2:])
+	case "config":
+		err = runConfig(os.Args[2:])
+	case "help", "-h", "--help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+
+	// TODO: serve
 
 	// setup_admin
 }
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: app <command> [flags]
+
+commands:
+  backup    write a snapshot of the database and media to a tar archive
+  restore   repopulate an empty instance from backup archives
+  migrate   apply, revert or list schema migrations (up|down|status)
+  config    show the effective configuration with secrets redacted (print)
+
+every command accepts -config <file> and a flag per setting, run "app <command> -h" to list them`)
+}
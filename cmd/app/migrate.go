@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"vinyl-vault/internal/config"
+	"vinyl-vault/internal/database"
+	"vinyl-vault/internal/migrations"
+	"vinyl-vault/internal/services"
+
+	"gorm.io/gorm"
+)
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	configFlags := config.BindFlags(fs)
+	steps := fs.Int("steps", 1, "number of migrations to revert (down only)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: app migrate [flags] up|down|status")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one of up, down or status")
+	}
+
+	cfg, err := configFlags.Load()
+	if err != nil {
+		return err
+	}
+	db, err := database.Open(cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	migrator, err := newMigrator(db, cfg)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch fs.Arg(0) {
+	case "up":
+		return migrateUp(ctx, migrator)
+	case "down":
+		if *steps < 1 {
+			return fmt.Errorf("-steps must be at least 1")
+		}
+		reverted, err := migrator.Down(ctx, *steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No migrations to revert.")
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", status.Version, status.Name, applied)
+		}
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command %q", fs.Arg(0))
+	}
+	return nil
+}
+
+// migrateUp brings the schema up to date before commands that need it
+func migrateUp(ctx context.Context, migrator *migrations.Migrator) error {
+	applied, err := migrator.Up(ctx)
+	for _, migration := range applied {
+		fmt.Printf("applied  %04d_%s\n", migration.Version, migration.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Println("Schema is up to date.")
+	}
+	return nil
+}
+
+// newMigrator sets up the migrations of db, which import the media files of an instance
+// from before the blob store into the one of cfg
+func newMigrator(db *gorm.DB, cfg *config.Config) (*migrations.Migrator, error) {
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		return nil, err
+	}
+	migrator.SetBlobImporter(blobImporter{fileService: services.NewFileServiceWithConfig(cfg)})
+	return migrator, nil
+}
+
+// blobImporter copies files into the blob store the way uploads are written to it
+type blobImporter struct {
+	fileService *services.FileService
+}
+
+func (i blobImporter) Import(path string) (migrations.ImportedBlob, error) {
+	fullPath := i.fileService.GetFullPath(path)
+	if err := i.fileService.ValidateFilePath(fullPath); err != nil {
+		return migrations.ImportedBlob{}, err
+	}
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return migrations.ImportedBlob{}, err
+	}
+	defer file.Close()
+
+	result, err := i.fileService.WriteBlob(file, filepath.Ext(path))
+	if err != nil {
+		return migrations.ImportedBlob{}, err
+	}
+	relativePath, err := i.fileService.GetRelativePath(result.Path)
+	if err != nil {
+		return migrations.ImportedBlob{}, err
+	}
+	return migrations.ImportedBlob{Hash: result.Hash, Size: int64(result.Size), Path: relativePath}, nil
+}
+
+func (i blobImporter) Remove(path string) error {
+	fullPath := i.fileService.GetFullPath(path)
+	if _, err := os.Lstat(fullPath); os.IsNotExist(err) {
+		return nil
+	}
+	if err := i.fileService.ValidateFilePath(fullPath); err != nil {
+		return err
+	}
+	return os.Remove(fullPath)
+}
@@ -3,33 +3,43 @@ package main
 import (
 	"bufio"
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"strings"
 	"syscall"
 	"vinyl-vault/internal/config"
+	"vinyl-vault/internal/database"
+	"vinyl-vault/internal/logging"
 	"vinyl-vault/internal/repositories"
 	"vinyl-vault/internal/services"
 
 	"golang.org/x/term"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
 func main() {
 
 	fmt.Println("******* Vinyl Vault Admin Setup *******")
 
-	cfg := config.Load()
+	configFlags := config.BindFlags(flag.CommandLine)
+	flag.Parse()
 
-	db, err := gorm.Open(postgres.Open(cfg.DatabaseURL), &gorm.Config{})
+	cfg, err := configFlags.Load()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		log.Fatal(err)
+	}
+	slog.SetDefault(logging.New(os.Stderr, cfg))
+
+	db, err := database.Open(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	userRepo := repositories.NewGormUserRepository(db)
 	userService := services.NewUserService(userRepo)
+	userService.SetPasswordCost(cfg.Security.BcryptCost)
 
 	reader := bufio.NewReader(os.Stdin)
 
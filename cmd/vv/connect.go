@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+	"vinyl-vault/pkg/client"
+
+	"golang.org/x/term"
+)
+
+type connectionFlags struct {
+	url, user, token *string
+}
+
+func bindConnection(fs *flag.FlagSet) *connectionFlags {
+	return &connectionFlags{
+		url:   fs.String("url", envOr("VV_URL", "http://localhost:8080"), "server URL (VV_URL)"),
+		user:  fs.String("user", os.Getenv("VV_USER"), "username (VV_USER)"),
+		token: fs.String("token", os.Getenv("VV_TOKEN"), "bearer token instead of a login (VV_TOKEN)"),
+	}
+}
+
+// connect builds a client and, unless a token is given, logs in
+func (f *connectionFlags) connect(ctx context.Context) (*client.Client, error) {
+	if *f.token != "" {
+		return client.New(*f.url, client.WithToken(*f.token))
+	}
+	if *f.user == "" {
+		return nil, fmt.Errorf("set -user or VV_USER, or a token")
+	}
+
+	password := os.Getenv("VV_PASSWORD")
+	if password == "" {
+		if !term.IsTerminal(int(syscall.Stdin)) {
+			return nil, fmt.Errorf("set VV_PASSWORD, stdin is not a terminal to prompt on")
+		}
+		fmt.Fprintf(os.Stderr, "Password for %s: ", *f.user)
+		passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password: %w", err)
+		}
+		password = string(passwordBytes)
+	}
+
+	c, err := client.New(*f.url)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.Login(ctx, *f.user, password); err != nil {
+		return nil, fmt.Errorf("login failed: %w", err)
+	}
+	return c, nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// retry runs fn up to attempts times, backing off between tries, as long as the failure
+// looks transient: a network error, a timeout, or a 5xx or 429 from the server
+func retry(ctx context.Context, attempts int, fn func(attempt int) error) error {
+	backoff := time.Second
+	var err error
+	for attempt := range attempts {
+		if err = fn(attempt); err == nil || !isTransient(err) || attempt == attempts-1 {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return err
+}
+
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode == http.StatusRequestTimeout
+	}
+	return true
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"vinyl-vault/pkg/client"
+)
+
+func runDownload(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("download", flag.ExitOnError)
+	conn := bindConnection(fs)
+	outDir := fs.String("o", ".", "directory to save into")
+	track := fs.Bool("track", false, "the id is a track, not an album")
+	retries := fs.Int("retries", 3, "attempts before giving up")
+	replayGain := fs.Bool("replaygain", false, "write ReplayGain tags into analyzed tracks")
+	spectrogram := fs.Bool("spectrogram", false, "save the track's spectrogram as a PNG instead of its audio")
+	original := fs.Bool("original", false, "save the track as it was uploaded, untagged, even if the server stored it as FLAC")
+	preset := fs.String("preset", "", "convert the track with this server preset, e.g. cd, mp3 or opus; none saves it as stored whatever your default")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vv download [flags] <album-id>\n       vv download [flags] -track <track-id>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one id")
+	}
+	id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid id %q", fs.Arg(0))
+	}
+	if *retries < 1 {
+		return fmt.Errorf("-retries must be at least 1")
+	}
+	if *spectrogram && !*track {
+		return fmt.Errorf("-spectrogram needs -track")
+	}
+	if *original && !*track {
+		return fmt.Errorf("-original needs -track")
+	}
+	if *preset != "" && (!*track || *original || *spectrogram) {
+		return fmt.Errorf("-preset needs -track, and can't be combined with -original or -spectrogram")
+	}
+
+	c, err := conn.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	open := c.DownloadAlbum
+	switch {
+	case *spectrogram:
+		open = func(ctx context.Context, id uint64) (*client.Download, error) {
+			return c.Spectrogram(ctx, id, 0, "")
+		}
+	case *original:
+		open = c.DownloadTrackOriginal
+	case *preset != "":
+		open = func(ctx context.Context, id uint64) (*client.Download, error) {
+			return c.DownloadTrackWithPreset(ctx, id, *preset, *replayGain)
+		}
+	case *track && *replayGain:
+		open = c.DownloadTrackWithReplayGain
+	case *track:
+		open = c.DownloadTrack
+	case *replayGain:
+		open = c.DownloadAlbumWithReplayGain
+	}
+
+	bars := newProgress()
+	var path string
+	var b *bar
+	err = retry(ctx, *retries, func(attempt int) error {
+		download, err := open(ctx, id)
+		if err != nil {
+			return err
+		}
+		defer download.Body.Close()
+
+		if b == nil {
+			b = bars.add(download.Filename, download.ContentLength)
+		} else {
+			b.restart()
+		}
+		path, err = save(*outDir, download, b)
+		return err
+	})
+	if b != nil {
+		if err != nil {
+			b.finish("failed")
+		} else {
+			b.finish("done")
+		}
+	}
+	bars.wait()
+	if err != nil {
+		return err
+	}
+	fmt.Println(path)
+	return nil
+}
+
+// save writes the download under its suggested name, going through a temporary file
+// so an interrupted transfer never leaves a truncated file behind
+func save(dir string, download *client.Download, b *bar) (string, error) {
+	name := filepath.Base(download.Filename)
+	if name == "." || name == string(filepath.Separator) || name == "" {
+		name = "download"
+	}
+	path := filepath.Join(dir, name)
+
+	tmp, err := os.CreateTemp(dir, ".vv-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, b.reader(download.Body)); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"vinyl-vault/pkg/client"
+)
+
+func runList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	conn := bindConnection(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vv ls [flags] [album-id]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return fmt.Errorf("expected at most one album id")
+	}
+
+	c, err := conn.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		albums, err := c.MyAlbums(ctx)
+		if err != nil {
+			return err
+		}
+		printAlbums(albums)
+		return nil
+	}
+
+	id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid album id %q", fs.Arg(0))
+	}
+	album, err := c.Album(ctx, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s - %s (%s)\n", album.Metadata.Artist, album.Metadata.Album, album.Metadata.Format)
+	printTracks(album.Tracks)
+	return nil
+}
+
+// runSearch asks the server for matching albums, and lists the tracks of those whose
+// title holds every word of the query as well
+func runSearch(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	conn := bindConnection(fs)
+	genre := fs.String("genre", "", "only albums of this genre")
+	style := fs.String("style", "", "only albums of this style")
+	credit := fs.String("credit", "", "only albums crediting this name on a track")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vv search [flags] [query]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	query := client.AlbumQuery{Text: strings.TrimSpace(strings.Join(fs.Args(), " ")), Genre: *genre, Style: *style, Credit: *credit}
+	if query == (client.AlbumQuery{}) {
+		fs.Usage()
+		return fmt.Errorf("expected a query, -genre, -style or -credit")
+	}
+
+	c, err := conn.connect(ctx)
+	if err != nil {
+		return err
+	}
+	albums, err := c.SearchAlbums(ctx, query)
+	if err != nil {
+		return err
+	}
+	if len(albums) == 0 {
+		fmt.Println("No matches")
+		return nil
+	}
+	printAlbums(albums)
+
+	if trackMatches := matchingTracks(albums, query.Text); len(trackMatches) > 0 {
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TRACK\tALBUM\t#\tTITLE")
+		for _, match := range trackMatches {
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", match.ID, match.AlbumID, match.Position(), match.Title)
+		}
+		w.Flush()
+	}
+	return nil
+}
+
+// matchingTracks returns the tracks whose title contains every word of text, case-insensitively
+func matchingTracks(albums []client.Album, text string) []client.Track {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 {
+		return nil
+	}
+	var matches []client.Track
+	for _, album := range albums {
+		for _, track := range album.Tracks {
+			title := strings.ToLower(track.Title)
+			if !slices.ContainsFunc(words, func(word string) bool { return !strings.Contains(title, word) }) {
+				matches = append(matches, track)
+			}
+		}
+	}
+	return matches
+}
+
+func printAlbums(albums []client.Album) {
+	sort.Slice(albums, func(i, j int) bool {
+		a, b := albums[i].Metadata, albums[j].Metadata
+		if !strings.EqualFold(a.Artist, b.Artist) {
+			return strings.ToLower(a.Artist) < strings.ToLower(b.Artist)
+		}
+		return strings.ToLower(a.Album) < strings.ToLower(b.Album)
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tARTIST\tALBUM\tFORMAT\tTRACKS")
+	for _, album := range albums {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\n", album.ID, album.Metadata.Artist, album.Metadata.Album,
+			album.Metadata.Format, len(album.Tracks))
+	}
+	w.Flush()
+}
+
+// printTracks lists tracks in the order given; albums come with theirs in play order
+func printTracks(tracks []client.Track) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\t#\tTITLE\tLENGTH\tSIZE\tQUALITY")
+	for _, track := range tracks {
+		size := ""
+		if track.IsStub() {
+			size = "no audio"
+		} else if track.Blob != nil {
+			size = fmt.Sprintf("%.1f MB", float64(track.Blob.Size)/1e6)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", track.ID, track.Position(), track.Title, track.Duration, size, quality(track))
+	}
+	w.Flush()
+}
+
+// quality reads like "24/96 upsampled": the bit depth and kHz the file claims, then
+// anything analysis found wrong with the rip
+func quality(track client.Track) string {
+	q := track.AudioQuality
+	var parts []string
+	if q.BitDepth > 0 && q.SampleRate > 0 {
+		parts = append(parts, fmt.Sprintf("%d/%g", q.BitDepth, float64(q.SampleRate)/1000))
+	} else if q.Bitrate > 0 {
+		parts = append(parts, fmt.Sprintf("%d kbps", q.Bitrate))
+	}
+	if track.RipQuality != nil {
+		parts = append(parts, track.RipQuality.Flags...)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"vinyl-vault/pkg/client"
+)
+
+func runLookup(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("lookup", flag.ExitOnError)
+	conn := bindConnection(fs)
+	var query client.ReleaseQuery
+	fs.StringVar(&query.Barcode, "barcode", "", "UPC or EAN code")
+	fs.StringVar(&query.CatalogNumber, "catno", "", "catalog number")
+	fs.StringVar(&query.Artist, "artist", "", "artist name, or part of it")
+	fs.StringVar(&query.Title, "title", "", "release title, or part of it")
+	fs.StringVar(&query.Provider, "provider", "", "only ask this provider")
+	apply := fs.Int("apply", 0, "fill an album in from the release with this number in the results")
+	albumID := fs.Uint64("album", 0, "album to apply the release to; a new album is created without it")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vv lookup [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if query.Barcode == "" && query.CatalogNumber == "" && query.Artist == "" && query.Title == "" {
+		fs.Usage()
+		return fmt.Errorf("expected -barcode, -catno, -artist or -title")
+	}
+
+	c, err := conn.connect(ctx)
+	if err != nil {
+		return err
+	}
+	candidates, err := c.SearchReleases(ctx, query)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		fmt.Println("No matches")
+		return nil
+	}
+
+	if *apply == 0 {
+		printCandidates(candidates)
+		return nil
+	}
+	if *apply < 1 || *apply > len(candidates) {
+		return fmt.Errorf("-apply %d: there are %d results", *apply, len(candidates))
+	}
+	candidate := &candidates[*apply-1]
+	album, err := c.ApplyRelease(ctx, *albumID, candidate)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Album %d: %s - %s\n", album.ID, album.Metadata.Artist, album.Metadata.Album)
+	printTracks(album.Tracks)
+	if len(candidate.CoverURLs) > 0 {
+		fmt.Println("\nCover art:", candidate.CoverURLs[0])
+	}
+	return nil
+}
+
+// printCandidates lists releases with their tracklists, numbered for -apply
+func printCandidates(candidates []client.ReleaseCandidate) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, candidate := range candidates {
+		metadata := candidate.Metadata
+		details := []string{metadata.Format, metadata.ReleaseDate, metadata.CatalogNumber}
+		if metadata.Label != nil {
+			details = append(details, *metadata.Label)
+		}
+		if metadata.Country != nil {
+			details = append(details, *metadata.Country)
+		}
+		fmt.Fprintf(w, "%d.\t%s - %s\t%s\t[%s %s]\n", i+1, metadata.Artist, metadata.Album,
+			strings.Join(nonEmpty(details), ", "), candidate.Provider, candidate.ID)
+		for _, track := range candidate.Tracks {
+			position := track.Side + fmt.Sprint(track.TrackNumber)
+			if track.DiscNumber > 1 && track.Side == "" {
+				position = fmt.Sprintf("%d-%d", track.DiscNumber, track.TrackNumber)
+			}
+			fmt.Fprintf(w, "\t  %s\t%s\t%s\n", position, track.Title, track.Duration)
+		}
+	}
+	w.Flush()
+}
+
+func nonEmpty(values []string) []string {
+	var kept []string
+	for _, value := range values {
+		if value != "" {
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,60 @@
+// Command vv talks to a vinyl-vault server: it uploads album folders, downloads
+// albums and tracks, lists or searches the library, and looks release details up.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "upload":
+		err = runUpload(ctx, os.Args[2:])
+	case "download":
+		err = runDownload(ctx, os.Args[2:])
+	case "ls":
+		err = runList(ctx, os.Args[2:])
+	case "search":
+		err = runSearch(ctx, os.Args[2:])
+	case "lookup":
+		err = runLookup(ctx, os.Args[2:])
+	case "help", "-h", "--help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: vv <command> [flags]
+
+commands:
+  upload    create an album from a folder of AIFF, FLAC or WAV files and a cover image
+  download  download an album as a zip, or a single track
+  ls        list your albums, or the tracks of one album
+  search    find albums by their details, genre, style or credits, and tracks by title
+  lookup    look a release up by barcode, catalog number or name, and fill an album in from it
+
+the server and credentials come from -url, -user and -token, or VV_URL, VV_USER,
+VV_PASSWORD and VV_TOKEN; without a password or token vv prompts for one`)
+}
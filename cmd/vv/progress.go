@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const (
+	barWidth        = 30
+	refreshInterval = 200 * time.Millisecond
+)
+
+// progress draws one bar per transfer on a terminal. Elsewhere, e.g. when stderr is
+// piped to a log, it prints a line as each transfer finishes.
+type progress struct {
+	out         io.Writer
+	interactive bool
+
+	mu    sync.Mutex
+	bars  []*bar
+	drawn int // lines drawn last time, to move the cursor back over them
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type bar struct {
+	p     *progress
+	label string
+	total int64
+	sent  atomic.Int64
+	state atomic.Value // string: "", "done", "skipped", "retrying" or an error
+}
+
+func newProgress() *progress {
+	p := &progress{
+		out:         os.Stderr,
+		interactive: term.IsTerminal(int(os.Stderr.Fd())),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if !p.interactive {
+		close(p.done)
+		return p
+	}
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.draw()
+			case <-p.stop:
+				p.draw()
+				return
+			}
+		}
+	}()
+	return p
+}
+
+func (p *progress) add(label string, total int64) *bar {
+	b := &bar{p: p, label: label, total: total}
+	b.state.Store("")
+	p.mu.Lock()
+	p.bars = append(p.bars, b)
+	p.mu.Unlock()
+	return b
+}
+
+// wait stops redrawing after a final frame
+func (p *progress) wait() {
+	if p.interactive {
+		close(p.stop)
+	}
+	<-p.done
+}
+
+func (p *progress) draw() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var sb strings.Builder
+	if p.drawn > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dA", p.drawn)
+	}
+	for _, b := range p.bars {
+		sb.WriteString("\x1b[2K")
+		sb.WriteString(b.line())
+		sb.WriteByte('\n')
+	}
+	p.drawn = len(p.bars)
+	io.WriteString(p.out, sb.String())
+}
+
+func (b *bar) line() string {
+	sent, total := b.sent.Load(), b.total
+	filled := barWidth
+	percent := 100.0
+	if total > 0 {
+		filled = int(min(sent, total) * barWidth / total)
+		percent = float64(sent) * 100 / float64(total)
+	}
+	status := fmt.Sprintf("%5.1f%%", min(percent, 100))
+	if state := b.state.Load().(string); state != "" {
+		status = state
+	}
+	return fmt.Sprintf("%-40s [%s%s] %s", truncate(b.label, 40),
+		strings.Repeat("=", filled), strings.Repeat(" ", barWidth-filled), status)
+}
+
+// reader counts bytes read through r towards the bar
+func (b *bar) reader(r io.Reader) io.Reader {
+	return &countingReader{r: r, bar: b}
+}
+
+// restart clears the count before a retry resends the file
+func (b *bar) restart() {
+	b.sent.Store(0)
+	b.state.Store("retrying")
+}
+
+func (b *bar) finish(state string) {
+	b.state.Store(state)
+	if !b.p.interactive {
+		fmt.Fprintf(b.p.out, "%s: %s\n", b.label, state)
+	}
+}
+
+type countingReader struct {
+	r   io.Reader
+	bar *bar
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.bar.sent.Add(int64(n))
+	if n > 0 && c.bar.state.Load().(string) == "retrying" {
+		c.bar.state.Store("")
+	}
+	return n, err
+}
+
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var audioExtensions = map[string]bool{".aiff": true, ".aif": true, ".flac": true, ".wav": true}
+
+var imageExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+
+// coverNames are preferred, in order, when a folder holds several images
+var coverNames = []string{"cover", "front", "folder"}
+
+// localTrack is an audio file about to be uploaded
+type localTrack struct {
+	Path  string
+	Title string
+	// place on the release, assigned after ordering: Number counts from 1 on each side,
+	// or on each disc when the files name no sides
+	Disc   int
+	Side   string
+	Number int
+	Size   int64 // bytes
+	SHA256 string
+
+	// from tags, when the file has them
+	Artist, Album string
+
+	position *filePosition // nil when neither tags nor the filename give one
+}
+
+// filePosition is where a file's name or tags put it on the release
+type filePosition struct {
+	Disc   int    // 0 when not given
+	Side   string // A, B...; empty when not given
+	Number int    // 0 for a whole side
+}
+
+func (p *filePosition) compare(o *filePosition) int {
+	return cmp.Or(
+		cmp.Compare(max(p.Disc, 1), max(o.Disc, 1)),
+		cmp.Compare(len(p.Side), len(o.Side)),
+		strings.Compare(p.Side, o.Side),
+		cmp.Compare(p.Number, o.Number),
+	)
+}
+
+// Label is the track's position as printed: A1, or the number on releases without sides
+func (t *localTrack) Label() string {
+	if t.Side == "" {
+		return strconv.Itoa(t.Number)
+	}
+	return t.Side + strconv.Itoa(t.Number)
+}
+
+// albumFolder is the result of scanning a folder
+type albumFolder struct {
+	Tracks []*localTrack
+	Cover  string // empty when the folder has no image
+}
+
+// Filename patterns, tried in order. Vinyl rips are often named by side ("Side A.flac")
+// or by position ("A1 Title.flac"); digital ones by number ("01 - Title.flac", "1-01 Title.flac").
+var (
+	sidePattern     = regexp.MustCompile(`(?i)^side[\s_-]*([a-z])(?:[\s._-]+(.*))?$`)
+	positionPattern = regexp.MustCompile(`^([A-Za-z])(\d{1,2})(?:[\s._-]+(.*))?$`)
+	discPattern     = regexp.MustCompile(`^(\d{1,2})[-.](\d{1,3})(?:[\s._-]+(.*))?$`)
+	numberPattern   = regexp.MustCompile(`^(\d{1,3})(?:[\s._-]+(.*))?$`)
+)
+
+func scanFolder(dir string) (*albumFolder, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	folder := &albumFolder{}
+	var images []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		switch {
+		case audioExtensions[ext]:
+			track, err := readLocalTrack(path)
+			if err != nil {
+				return nil, err
+			}
+			folder.Tracks = append(folder.Tracks, track)
+		case imageExtensions[ext]:
+			images = append(images, path)
+		}
+	}
+	if len(folder.Tracks) == 0 {
+		return nil, fmt.Errorf("no AIFF, FLAC or WAV files in %s", dir)
+	}
+
+	orderTracks(folder.Tracks)
+	folder.Cover = pickCover(images)
+	return folder, nil
+}
+
+func readLocalTrack(path string) (*localTrack, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	track := &localTrack{Path: path, Size: info.Size()}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	track.Title, track.position = parseFilename(name)
+
+	if strings.EqualFold(filepath.Ext(path), ".flac") {
+		tags, err := readFLACTags(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		applyTags(track, tags)
+	}
+	return track, nil
+}
+
+// parseFilename returns the title and position from a filename without extension,
+// or the whole name and nil when it carries no position
+func parseFilename(name string) (string, *filePosition) {
+	if m := sidePattern.FindStringSubmatch(name); m != nil {
+		return cleanTitle(m[2], "Side "+strings.ToUpper(m[1])), &filePosition{Side: strings.ToUpper(m[1])}
+	}
+	if m := positionPattern.FindStringSubmatch(name); m != nil {
+		number, _ := strconv.Atoi(m[2])
+		return cleanTitle(m[3], name), &filePosition{Side: strings.ToUpper(m[1]), Number: number}
+	}
+	if m := discPattern.FindStringSubmatch(name); m != nil {
+		disc, _ := strconv.Atoi(m[1])
+		number, _ := strconv.Atoi(m[2])
+		return cleanTitle(m[3], name), &filePosition{Disc: disc, Number: number}
+	}
+	if m := numberPattern.FindStringSubmatch(name); m != nil {
+		number, _ := strconv.Atoi(m[1])
+		return cleanTitle(m[2], name), &filePosition{Number: number}
+	}
+	return cleanTitle(name, name), nil
+}
+
+func cleanTitle(title, fallback string) string {
+	title = strings.TrimSpace(strings.ReplaceAll(title, "_", " "))
+	if title == "" {
+		return fallback
+	}
+	return title
+}
+
+// applyTags prefers tag values over what the filename suggested
+func applyTags(track *localTrack, tags map[string]string) {
+	if title := tags["TITLE"]; title != "" {
+		track.Title = title
+	}
+	track.Artist = firstNonEmpty(tags["ALBUMARTIST"], tags["ARTIST"])
+	track.Album = tags["ALBUM"]
+
+	// TRACKNUMBER may be "3", "3/10", or a vinyl position like "A3"
+	trackNumber := strings.TrimSpace(strings.Split(tags["TRACKNUMBER"], "/")[0])
+	side := ""
+	if m := tagPositionPattern.FindStringSubmatch(trackNumber); m != nil {
+		side, trackNumber = m[1], m[2]
+	} else if track.position != nil {
+		side = track.position.Side
+	}
+	number, err := strconv.Atoi(trackNumber)
+	if err != nil || number <= 0 {
+		return
+	}
+	disc, _ := strconv.Atoi(strings.TrimSpace(strings.Split(tags["DISCNUMBER"], "/")[0]))
+	track.position = &filePosition{Disc: disc, Side: side, Number: number}
+}
+
+var tagPositionPattern = regexp.MustCompile(`^([A-Z]{1,2})(\d+)$`)
+
+// orderTracks sorts by position and numbers the tracks from 1 on each side, or each
+// disc when there are no sides. If any file has no position they are all ordered by
+// filename and numbered through instead, since mixing the two is a guess.
+func orderTracks(tracks []*localTrack) {
+	byName := false
+	for _, track := range tracks {
+		if track.position == nil {
+			byName = true
+		}
+	}
+
+	sort.SliceStable(tracks, func(i, j int) bool {
+		if !byName {
+			if c := tracks[i].position.compare(tracks[j].position); c != 0 {
+				return c < 0
+			}
+		}
+		return filepath.Base(tracks[i].Path) < filepath.Base(tracks[j].Path)
+	})
+	for i, track := range tracks {
+		track.Disc, track.Side = 1, ""
+		if !byName {
+			track.Disc, track.Side = max(track.position.Disc, 1), track.position.Side
+		}
+		track.Number = 1
+		if previous := tracks[max(i-1, 0)]; i > 0 && previous.Disc == track.Disc && previous.Side == track.Side {
+			track.Number = previous.Number + 1
+		}
+	}
+}
+
+func pickCover(images []string) string {
+	for _, name := range coverNames {
+		for _, image := range images {
+			base := strings.ToLower(strings.TrimSuffix(filepath.Base(image), filepath.Ext(image)))
+			if base == name {
+				return image
+			}
+		}
+	}
+	if len(images) == 1 {
+		return images[0]
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// flacVorbisComment is the metadata block type holding FLAC tags
+const flacVorbisComment = 4
+
+// readFLACTags returns the Vorbis comments of a FLAC file with upper-cased keys
+func readFLACTags(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+
+	magic := make([]byte, 4)
+	if _, err = io.ReadFull(r, magic); err != nil || string(magic) != "fLaC" {
+		return nil, fmt.Errorf("not a FLAC file")
+	}
+
+	for {
+		var header [4]byte
+		if _, err = io.ReadFull(r, header[:]); err != nil {
+			return nil, fmt.Errorf("truncated FLAC metadata: %w", err)
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		if blockType == flacVorbisComment {
+			block := make([]byte, length)
+			if _, err = io.ReadFull(r, block); err != nil {
+				return nil, fmt.Errorf("truncated FLAC tags: %w", err)
+			}
+			return parseVorbisComment(block)
+		}
+		if last {
+			return map[string]string{}, nil
+		}
+		if _, err = r.Discard(length); err != nil {
+			return nil, fmt.Errorf("truncated FLAC metadata: %w", err)
+		}
+	}
+}
+
+// parseVorbisComment reads a vendor string then KEY=value pairs, all length-prefixed little-endian
+func parseVorbisComment(block []byte) (map[string]string, error) {
+	next := func() (string, bool) {
+		if len(block) < 4 {
+			return "", false
+		}
+		n := binary.LittleEndian.Uint32(block)
+		if uint64(n) > uint64(len(block)-4) {
+			return "", false
+		}
+		value := string(block[4 : 4+n])
+		block = block[4+n:]
+		return value, true
+	}
+
+	if _, ok := next(); !ok {
+		return nil, fmt.Errorf("malformed FLAC tags")
+	}
+	if len(block) < 4 {
+		return nil, fmt.Errorf("malformed FLAC tags")
+	}
+	count := binary.LittleEndian.Uint32(block)
+	block = block[4:]
+
+	tags := make(map[string]string)
+	for range count {
+		comment, ok := next()
+		if !ok {
+			return nil, fmt.Errorf("malformed FLAC tags")
+		}
+		if key, value, found := strings.Cut(comment, "="); found {
+			key = strings.ToUpper(key)
+			if _, seen := tags[key]; !seen {
+				tags[key] = value
+			}
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"vinyl-vault/pkg"
+)
+
+func TestParseFilename(t *testing.T) {
+	tests := []struct {
+		name         string
+		wantTitle    string
+		wantPosition *filePosition
+	}{
+		{"01 - Paperhouse", "Paperhouse", &filePosition{Number: 1}},
+		{"1-03 Oh Yeah", "Oh Yeah", &filePosition{Disc: 1, Number: 3}},
+		{"A1 Paperhouse", "Paperhouse", &filePosition{Side: "A", Number: 1}},
+		{"B2_Halleluhwah", "Halleluhwah", &filePosition{Side: "B", Number: 2}},
+		{"Side B", "Side B", &filePosition{Side: "B"}},
+		{"side_c - Aumgn", "Aumgn", &filePosition{Side: "C"}},
+		{"Paperhouse", "Paperhouse", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, position := parseFilename(tt.name)
+			if title != tt.wantTitle || !reflect.DeepEqual(position, tt.wantPosition) {
+				t.Errorf("parseFilename(%q) = %q, %+v; want %q, %+v", tt.name, title, position, tt.wantTitle, tt.wantPosition)
+			}
+		})
+	}
+}
+
+func TestOrderTracks(t *testing.T) {
+	t.Run("by position", func(t *testing.T) {
+		tracks := []*localTrack{
+			{Path: "B1 Aumgn.flac", position: &filePosition{Side: "B", Number: 1}},
+			{Path: "A2 Mushroom.flac", position: &filePosition{Side: "A", Number: 2}},
+			{Path: "A1 Paperhouse.flac", position: &filePosition{Side: "A", Number: 1}},
+		}
+		orderTracks(tracks)
+		want := []struct{ path, label string }{
+			{"A1 Paperhouse.flac", "A1"}, {"A2 Mushroom.flac", "A2"}, {"B1 Aumgn.flac", "B1"},
+		}
+		for i, track := range tracks {
+			if track.Path != want[i].path || track.Label() != want[i].label {
+				t.Errorf("track %d = %s %s, want %s %s", i, track.Path, track.Label(), want[i].path, want[i].label)
+			}
+		}
+	})
+
+	t.Run("by name when a position is missing", func(t *testing.T) {
+		tracks := []*localTrack{
+			{Path: "b.wav", position: &filePosition{Number: 1}},
+			{Path: "a.wav"},
+		}
+		orderTracks(tracks)
+		if tracks[0].Path != "a.wav" || tracks[1].Path != "b.wav" {
+			t.Errorf("order = %s, %s; want a.wav, b.wav", tracks[0].Path, tracks[1].Path)
+		}
+	})
+}
+
+func TestParseVorbisComment(t *testing.T) {
+	var block []byte
+	appendString := func(s string) {
+		block = binary.LittleEndian.AppendUint32(block, uint32(len(s)))
+		block = append(block, s...)
+	}
+	appendString("reference libFLAC 1.4.3")
+	block = binary.LittleEndian.AppendUint32(block, 3)
+	appendString("title=Paperhouse")
+	appendString("TRACKNUMBER=1/7")
+	appendString("TITLE=ignored, the first value wins")
+
+	tags, err := parseVorbisComment(block)
+	if err != nil {
+		t.Fatalf("parseVorbisComment() error = %v", err)
+	}
+	if tags["TITLE"] != "Paperhouse" || tags["TRACKNUMBER"] != "1/7" {
+		t.Errorf("parseVorbisComment() = %v", tags)
+	}
+
+	if _, err = parseVorbisComment(block[:len(block)-3]); err == nil {
+		t.Error("parseVorbisComment() of a truncated block succeeded")
+	}
+}
+
+func TestFillMetadata(t *testing.T) {
+	metadata := pkg.Metadata{Format: "LP"}
+	fillMetadata(&metadata, "/music/Can - Tago Mago/", nil)
+	if metadata.Artist != "Can" || metadata.Album != "Tago Mago" {
+		t.Errorf("fillMetadata() from folder = %q, %q; want Can, Tago Mago", metadata.Artist, metadata.Album)
+	}
+
+	metadata = pkg.Metadata{Artist: "Neu!"}
+	fillMetadata(&metadata, "/music/Can - Tago Mago", []*localTrack{{Album: "Neu! 75"}})
+	if metadata.Artist != "Neu!" || metadata.Album != "Neu! 75" {
+		t.Errorf("fillMetadata() = %q, %q; want the flag artist and tag album", metadata.Artist, metadata.Album)
+	}
+}
+
+func TestUploadName(t *testing.T) {
+	if got := uploadName("/rips/A1 Paperhouse.AIF"); got != "A1 Paperhouse.aiff" {
+		t.Errorf("uploadName() = %q, want A1 Paperhouse.aiff", got)
+	}
+}
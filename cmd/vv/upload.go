@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"vinyl-vault/pkg"
+	"vinyl-vault/pkg/client"
+)
+
+func runUpload(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("upload", flag.ExitOnError)
+	conn := bindConnection(fs)
+	artist := fs.String("artist", "", "album artist (default from tags, or the folder name as \"Artist - Album\")")
+	title := fs.String("album", "", "album title (default from tags or the folder name)")
+	format := fs.String("format", "LP", "release format, e.g. LP, 2xLP, 7\"")
+	releaseDate := fs.String("release-date", "", "release date")
+	jobs := fs.Int("j", 4, "tracks uploaded at once")
+	retries := fs.Int("retries", 3, "attempts per request before giving up")
+	dryRun := fs.Bool("n", false, "show what would be uploaded without uploading")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: vv upload [flags] <folder>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one folder")
+	}
+	if *jobs < 1 || *retries < 1 {
+		return fmt.Errorf("-j and -retries must be at least 1")
+	}
+
+	dir := fs.Arg(0)
+	folder, err := scanFolder(dir)
+	if err != nil {
+		return err
+	}
+	metadata := pkg.Metadata{Artist: *artist, Album: *title, Format: *format, ReleaseDate: *releaseDate}
+	fillMetadata(&metadata, dir, folder.Tracks)
+	if metadata.Artist == "" || metadata.Album == "" {
+		return fmt.Errorf("could not tell the artist and album from tags or the folder name, pass -artist and -album")
+	}
+
+	fmt.Printf("%s - %s (%s), %d tracks\n", metadata.Artist, metadata.Album, metadata.Format, len(folder.Tracks))
+	for _, track := range folder.Tracks {
+		fmt.Printf("  %3s. %s  [%s]\n", track.Label(), track.Title, filepath.Base(track.Path))
+	}
+	if folder.Cover != "" {
+		fmt.Printf("  cover: %s\n", filepath.Base(folder.Cover))
+	}
+	if *dryRun {
+		return nil
+	}
+
+	c, err := conn.connect(ctx)
+	if err != nil {
+		return err
+	}
+
+	album, err := findOrCreateAlbum(ctx, c, metadata, albumMedia(folder.Tracks), folder.Cover, *retries)
+	if err != nil {
+		return err
+	}
+	return uploadTracks(ctx, c, album, folder.Tracks, *jobs, *retries)
+}
+
+// fillMetadata completes what flags left empty, from tags then from an "Artist - Album" folder name
+func fillMetadata(metadata *pkg.Metadata, dir string, tracks []*localTrack) {
+	for _, track := range tracks {
+		if metadata.Artist == "" {
+			metadata.Artist = track.Artist
+		}
+		if metadata.Album == "" {
+			metadata.Album = track.Album
+		}
+	}
+
+	base := filepath.Base(filepath.Clean(dir))
+	folderArtist, folderAlbum, found := strings.Cut(base, " - ")
+	if !found {
+		folderAlbum = base
+	}
+	if metadata.Artist == "" && found {
+		metadata.Artist = strings.TrimSpace(folderArtist)
+	}
+	if metadata.Album == "" {
+		metadata.Album = strings.TrimSpace(folderAlbum)
+	}
+}
+
+// albumMedia lists the discs the tracks are on, or nil for a single disc, which the
+// server sizes after the album format itself
+func albumMedia(tracks []*localTrack) []client.Medium {
+	discs := 1
+	for _, track := range tracks {
+		discs = max(discs, track.Disc)
+	}
+	if discs == 1 {
+		return nil
+	}
+	media := make([]client.Medium, discs)
+	for i := range media {
+		media[i].Number = i + 1
+	}
+	return media
+}
+
+// findOrCreateAlbum reuses an album of ours with the same artist and title, so a
+// re-run after a failure only uploads what is missing
+func findOrCreateAlbum(
+	ctx context.Context, c *client.Client, metadata pkg.Metadata, media []client.Medium, cover string, retries int,
+) (*client.Album, error) {
+	album, err := findAlbum(ctx, c, metadata)
+	if err != nil {
+		return nil, err
+	}
+	if album != nil {
+		fmt.Printf("Album exists (id %d), uploading missing tracks\n", album.ID)
+		if album.CoverBlobID == nil && cover != "" {
+			if err = setCover(ctx, c, album, cover, retries); err != nil {
+				return nil, err
+			}
+		}
+		if err = addMedia(ctx, c, album, media, retries); err != nil {
+			return nil, err
+		}
+		return c.Album(ctx, album.ID)
+	}
+
+	err = retry(ctx, retries, func(attempt int) error {
+		if attempt > 0 {
+			// the last attempt may have created it before the connection failed
+			if found, err := findAlbum(ctx, c, metadata); found != nil || err != nil {
+				album = found
+				return err
+			}
+		}
+		upload, closeCover, err := openUpload(cover)
+		if err != nil {
+			return err
+		}
+		defer closeCover()
+		album, err = c.CreateAlbum(ctx, metadata, media, upload)
+		if errors.Is(err, client.ErrCoverArtRejected) {
+			fmt.Fprintln(os.Stderr, "warning:", err)
+			err = nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create album: %w", err)
+	}
+	fmt.Printf("Created album %d\n", album.ID)
+	return album, nil
+}
+
+func findAlbum(ctx context.Context, c *client.Client, metadata pkg.Metadata) (*client.Album, error) {
+	albums, err := c.MyAlbums(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, album := range albums {
+		if strings.EqualFold(album.Metadata.Artist, metadata.Artist) && strings.EqualFold(album.Metadata.Album, metadata.Album) {
+			return &album, nil
+		}
+	}
+	return nil, nil
+}
+
+func setCover(ctx context.Context, c *client.Client, album *client.Album, cover string, retries int) error {
+	err := retry(ctx, retries, func(int) error {
+		upload, closeCover, err := openUpload(cover)
+		if err != nil {
+			return err
+		}
+		defer closeCover()
+		_, err = c.UpdateAlbum(ctx, album.ID, album.Metadata, nil, upload)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add cover art: %w", err)
+	}
+	return nil
+}
+
+// addMedia adds the discs an existing album is missing, keeping the ones it has
+func addMedia(ctx context.Context, c *client.Client, album *client.Album, media []client.Medium, retries int) error {
+	merged := slices.Clone(album.Media)
+	for _, medium := range media {
+		if !slices.ContainsFunc(merged, func(m client.Medium) bool { return m.Number == medium.Number }) {
+			merged = append(merged, medium)
+		}
+	}
+	if len(merged) == len(album.Media) {
+		return nil
+	}
+	err := retry(ctx, retries, func(int) error {
+		_, err := c.UpdateAlbum(ctx, album.ID, album.Metadata, merged, nil)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add discs: %w", err)
+	}
+	return nil
+}
+
+// openUpload opens path for upload under a name the server accepts; an empty path is no upload
+func openUpload(path string) (*client.Upload, func(), error) {
+	if path == "" {
+		return nil, func() {}, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &client.Upload{Filename: uploadName(path), Body: file}, func() { file.Close() }, nil
+}
+
+// uploadName lower-cases the extension and spells AIFF out, as the server matches extensions exactly
+func uploadName(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".aif" {
+		ext = ".aiff"
+	}
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ext
+}
+
+func uploadTracks(ctx context.Context, c *client.Client, album *client.Album, tracks []*localTrack, jobs, retries int) error {
+	existingPositions := make(map[string]bool)
+	existingHashes := make(map[string]bool)
+	for _, track := range album.Tracks {
+		// stubs from a release lookup are there to be filled
+		if track.IsStub() {
+			continue
+		}
+		existingPositions[positionKey(track.DiscNumber, track.Side, track.TrackNumber)] = true
+		if track.Blob != nil {
+			existingHashes[track.Blob.Hash] = true
+		}
+	}
+
+	bars := newProgress()
+	queue := make(chan *localTrack)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed []string
+
+	for range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for track := range queue {
+				b := bars.add(fmt.Sprintf("%3s. %s", track.Label(), track.Title), track.Size)
+				err := uploadTrack(ctx, c, album.ID, track, b, retries, existingPositions, existingHashes)
+				if err != nil {
+					b.finish("failed: " + err.Error())
+					mu.Lock()
+					failed = append(failed, fmt.Sprintf("%s. %s: %v", track.Label(), track.Title, err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, track := range tracks {
+		select {
+		case queue <- track:
+		case <-ctx.Done():
+		}
+	}
+	close(queue)
+	wg.Wait()
+	bars.wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d tracks failed, run the same command again to retry them:\n  %s",
+			len(failed), len(tracks), strings.Join(failed, "\n  "))
+	}
+	fmt.Printf("Album %d is complete\n", album.ID)
+	return nil
+}
+
+func uploadTrack(
+	ctx context.Context, c *client.Client, albumID uint64, track *localTrack, b *bar, retries int,
+	existingPositions, existingHashes map[string]bool,
+) error {
+	hash, err := hashFile(track.Path)
+	if err != nil {
+		return err
+	}
+	track.SHA256 = hash
+
+	// the maps are only read once workers start
+	if existingPositions[positionKey(track.Disc, track.Side, track.Number)] || existingHashes[hash] {
+		b.finish("skipped, already uploaded")
+		return nil
+	}
+
+	req := client.CreateTrackRequest{
+		AlbumID: albumID, DiscNumber: track.Disc, Side: track.Side, TrackNumber: track.Number, Title: track.Title, SHA256: hash,
+	}
+	err = retry(ctx, retries, func(attempt int) error {
+		if attempt > 0 {
+			b.restart()
+			// the last attempt may have gone through before the connection failed
+			if exists, err := trackExists(ctx, c, albumID, track); exists || err != nil {
+				return err
+			}
+		}
+		file, err := os.Open(track.Path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = c.CreateTrack(ctx, req, &client.Upload{Filename: uploadName(track.Path), Body: b.reader(file)})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	b.finish("done")
+	return nil
+}
+
+func trackExists(ctx context.Context, c *client.Client, albumID uint64, local *localTrack) (bool, error) {
+	album, err := c.Album(ctx, albumID)
+	if err != nil {
+		return false, err
+	}
+	for _, track := range album.Tracks {
+		if !track.IsStub() && track.DiscNumber == local.Disc && track.Side == local.Side && track.TrackNumber == local.Number {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func positionKey(disc int, side string, number int) string {
+	return fmt.Sprintf("%d/%s/%d", disc, side, number)
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
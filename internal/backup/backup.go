@@ -0,0 +1,245 @@
+// Package backup writes and restores consistent snapshots of a vault:
+// every database row as versioned JSON plus the media files, packed in a tar archive.
+package backup
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+	"vinyl-vault/internal/services"
+
+	"gorm.io/gorm"
+)
+
+// FormatVersion is bumped whenever the archive layout or row encoding changes
+const FormatVersion = 1
+
+const (
+	manifestName = "manifest.json"
+	dbDir        = "db/"
+	mediaDir     = "media/"
+)
+
+type Manifest struct {
+	FormatVersion int            `json:"format_version"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Incremental   bool           `json:"incremental"`
+	Counts        map[string]int `json:"counts"`
+	Files         []FileEntry    `json:"files"`
+}
+
+// FileEntry is a media file in the snapshot. Files already present in the
+// base archive of an incremental backup are listed but not included.
+type FileEntry struct {
+	Name     string `json:"name"` // archive member name: media/<sha256><ext>
+	Hash     string `json:"hash"`
+	Size     int64  `json:"size"`
+	Included bool   `json:"included"`
+}
+
+// userRecord, blobRecord and trackRecord export the fields the API hides from JSON
+type userRecord struct {
+	services.User
+	PasswordHash string `json:"password_hash"`
+}
+
+type blobRecord struct {
+	services.Blob
+	Path   string               `json:"path"`
+	Source *services.BlobSource `json:"source,omitempty"`
+}
+
+type trackRecord struct {
+	services.Track
+	LoudnessBlocks *services.LoudnessBlocks `json:"loudness_blocks,omitempty"`
+}
+
+type snapshot struct {
+	Users            []userRecord               `json:"users"`
+	RegistrationKeys []services.RegistrationKey `json:"registration_keys"`
+	Blobs            []blobRecord               `json:"blobs"`
+	Albums           []services.Album           `json:"albums"`
+	Tracks           []trackRecord              `json:"tracks"`
+}
+
+// Create writes a snapshot to w. When base is set only media missing from it is archived.
+func Create(ctx context.Context, db *gorm.DB, fileService *services.FileService, w io.Writer, base *Manifest) (*Manifest, error) {
+	snap, err := loadSnapshot(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	inBase := make(map[string]bool)
+	if base != nil {
+		for _, file := range base.Files {
+			inBase[file.Hash] = true
+		}
+	}
+
+	manifest := &Manifest{
+		FormatVersion: FormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Incremental:   base != nil,
+		Counts: map[string]int{
+			"users":             len(snap.Users),
+			"registration_keys": len(snap.RegistrationKeys),
+			"blobs":             len(snap.Blobs),
+			"albums":            len(snap.Albums),
+			"tracks":            len(snap.Tracks),
+		},
+	}
+
+	tw := tar.NewWriter(w)
+
+	if err = writeRows(tw, snap); err != nil {
+		return nil, err
+	}
+
+	for _, blob := range snap.Blobs {
+		entry := FileEntry{
+			Name: mediaDir + blob.Hash + filepath.Ext(blob.Path),
+			Hash: blob.Hash,
+			Size: blob.Size,
+		}
+		if !inBase[blob.Hash] {
+			if err = writeMedia(tw, fileService.GetFullPath(blob.Path), entry); err != nil {
+				return nil, err
+			}
+			entry.Included = true
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	// the manifest goes last so it only lists media that was verified while copying
+	if err = writeJSON(tw, manifestName, manifest); err != nil {
+		return nil, err
+	}
+	if err = tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// loadSnapshot reads every table in one read-only transaction so the rows are consistent
+func loadSnapshot(ctx context.Context, db *gorm.DB) (*snapshot, error) {
+	var snap snapshot
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// trashed rows are part of the vault too; the session gives each query below
+		// a statement of its own instead of piling onto a shared one
+		tx = tx.Unscoped().Session(&gorm.Session{})
+
+		var users []services.User
+		if err := tx.Order("id").Find(&users).Error; err != nil {
+			return fmt.Errorf("failed to read users: %w", err)
+		}
+		for _, user := range users {
+			snap.Users = append(snap.Users, userRecord{User: user, PasswordHash: user.PasswordHash})
+		}
+
+		if err := tx.Order("id").Find(&snap.RegistrationKeys).Error; err != nil {
+			return fmt.Errorf("failed to read registration keys: %w", err)
+		}
+
+		var blobs []services.Blob
+		if err := tx.Order("id").Find(&blobs).Error; err != nil {
+			return fmt.Errorf("failed to read blobs: %w", err)
+		}
+		for _, blob := range blobs {
+			snap.Blobs = append(snap.Blobs, blobRecord{Blob: blob, Path: blob.Path, Source: blob.Source})
+		}
+
+		// albums carry their media, which have no IDs of their own
+		withMedia := func(db *gorm.DB) *gorm.DB { return db.Order("number") }
+		if err := tx.Preload("Media", withMedia).Order("id").Find(&snap.Albums).Error; err != nil {
+			return fmt.Errorf("failed to read albums: %w", err)
+		}
+		var tracks []services.Track
+		if err := tx.Order("id").Find(&tracks).Error; err != nil {
+			return fmt.Errorf("failed to read tracks: %w", err)
+		}
+		for _, track := range tracks {
+			snap.Tracks = append(snap.Tracks, trackRecord{Track: track, LoudnessBlocks: track.LoudnessBlocks})
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+func writeRows(tw *tar.Writer, snap *snapshot) error {
+	tables := []struct {
+		name string
+		rows any
+	}{
+		{"users", snap.Users},
+		{"registration_keys", snap.RegistrationKeys},
+		{"blobs", snap.Blobs},
+		{"albums", snap.Albums},
+		{"tracks", snap.Tracks},
+	}
+	for _, table := range tables {
+		if err := writeJSON(tw, dbDir+table.name+".json", table.rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(tw *tar.Writer, name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+
+	header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+	if err = tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err = tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func writeMedia(tw *tar.Writer, fullPath string, entry FileEntry) error {
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", fullPath, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", fullPath, err)
+	}
+	if info.Size() != entry.Size {
+		return fmt.Errorf("%s: size is %d, expected %d", fullPath, info.Size(), entry.Size)
+	}
+
+	header := &tar.Header{Name: entry.Name, Mode: 0644, Size: info.Size(), ModTime: info.ModTime()}
+	if err = tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", entry.Name, err)
+	}
+
+	hasher := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(tw, hasher), file); err != nil {
+		return fmt.Errorf("failed to write %s: %w", entry.Name, err)
+	}
+
+	// refuse to back up a corrupted master as if it were good
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != entry.Hash {
+		return fmt.Errorf("%s: checksum mismatch (expected %s, got %s)", fullPath, entry.Hash, actual)
+	}
+	return nil
+}
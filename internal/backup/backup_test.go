@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"vinyl-vault/internal/database"
+	"vinyl-vault/internal/migrations"
+	"vinyl-vault/internal/repositories"
+	"vinyl-vault/internal/services"
+	"vinyl-vault/pkg"
+
+	"gorm.io/gorm"
+)
+
+func newInstance(t *testing.T, dir string) (*gorm.DB, *services.FileService) {
+	t.Helper()
+	db, err := database.Open("sqlite://" + filepath.Join(dir, "vault.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	fileService := services.NewFileService(dir, filepath.Join(dir, "covers"), filepath.Join(dir, "audio"))
+	if err = fileService.EnsureDirectoriesExist(); err != nil {
+		t.Fatal(err)
+	}
+	return db, fileService
+}
+
+// backupInstance backs up an instance of one album with a FLAC track on its second disc
+func backupInstance(t *testing.T) (archive string, album *services.Album) {
+	t.Helper()
+	ctx := context.Background()
+	db, fileService := newInstance(t, t.TempDir())
+
+	user := &services.User{Username: "alice", Email: "alice@example.com", PasswordHash: "hash"}
+	if err := repositories.NewGormUserRepository(db).Save(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	album = &services.Album{
+		UserID:   user.ID,
+		Metadata: pkg.Metadata{Artist: "Can", Album: "Tago Mago", Format: "2xLP", Genres: []string{"Rock"}},
+		Media:    []services.Medium{{Number: 1, Format: `12"`, Speed: 33}, {Number: 2, Format: `12"`, Speed: 33}},
+	}
+	if err := repositories.NewGormAlbumRepository(db).Save(ctx, album); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(fileService.GetFullPath("audio"), "aumgn.flac"), []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	blob := &services.Blob{Hash: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", Size: 3, Path: "audio/aumgn.flac", RefCount: 1,
+		SourceHash: "aiff", Source: &services.BlobSource{Ext: ".aiff", Encoder: "pcm_s24be", Header: []byte("FORM")}}
+	if err := repositories.NewGormBlobRepository(db).Save(ctx, blob); err != nil {
+		t.Fatal(err)
+	}
+	track := &services.Track{AlbumID: album.ID, DiscNumber: 2, Side: "C", TrackNumber: 1, Title: "Aumgn", BlobID: &blob.ID,
+		LoudnessBlocks: &services.LoudnessBlocks{Momentary: services.LoudnessHistogram{-150: {Blocks: 2, Energy: 0.02}}}}
+	if err := repositories.NewGormTrackRepository(db).Save(ctx, track); err != nil {
+		t.Fatal(err)
+	}
+
+	archive = filepath.Join(t.TempDir(), "backup.tar")
+	file, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := Create(ctx, db, fileService, file, nil)
+	file.Close()
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if manifest.Counts["users"] != 1 || manifest.Counts["blobs"] != 1 || manifest.Counts["albums"] != 1 || manifest.Counts["tracks"] != 1 {
+		t.Errorf("Create() counts = %v, want one of each", manifest.Counts)
+	}
+	return archive, album
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	archive, album := backupInstance(t)
+
+	restored, restoredFiles := newInstance(t, t.TempDir())
+	if err := Restore(ctx, restored, restoredFiles, []string{archive}); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	found, err := repositories.NewGormAlbumRepository(restored).FindByID(ctx, album.ID)
+	if err != nil {
+		t.Fatalf("FindByID() after Restore error = %v", err)
+	}
+	if found.Metadata.Album != "Tago Mago" || len(found.Media) != 2 || len(found.Tracks) != 1 || found.Tracks[0].Position() != "C1" {
+		t.Errorf("restored album = %+v", found)
+	}
+	if found.Tracks[0].Blob == nil || !restoredFiles.FileExists(restoredFiles.GetFullPath(found.Tracks[0].Blob.Path)) {
+		t.Errorf("restored track has no audio file")
+	}
+	// the API leaves them out of track JSON, but album loudness is measured from them
+	if blocks := found.Tracks[0].LoudnessBlocks; blocks == nil || blocks.Momentary[-150].Blocks != 2 {
+		t.Errorf("restored track LoudnessBlocks = %+v, want those backed up", blocks)
+	}
+	// and the upload a FLAC blob was made from is rebuilt from its source
+	if source := found.Tracks[0].Blob.Source; source == nil || source.Encoder != "pcm_s24be" || string(source.Header) != "FORM" {
+		t.Errorf("restored blob Source = %+v, want the one backed up", source)
+	}
+}
+
+func TestRestoreRemovesMediaOnFailure(t *testing.T) {
+	archive, _ := backupInstance(t)
+	restored, restoredFiles := newInstance(t, t.TempDir())
+	// the album's media can't be inserted, once its blob is
+	if err := restored.Exec(`DROP TABLE media`).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Restore(context.Background(), restored, restoredFiles, []string{archive}); err == nil {
+		t.Fatal("Restore() without a media table succeeded")
+	}
+	var blobs int64
+	if err := restored.Model(&services.Blob{}).Count(&blobs).Error; err != nil || blobs != 0 {
+		t.Errorf("blobs after a failed Restore() = %d, %v; want none", blobs, err)
+	}
+	if files, err := restoredFiles.ListBlobFiles(); err != nil || len(files) != 0 {
+		t.Errorf("blob files after a failed Restore() = %v, %v; want none", files, err)
+	}
+}
+
+func TestCheckReferences(t *testing.T) {
+	blobID, missingID := uint64(1), uint64(2)
+	manifest := &Manifest{Files: []FileEntry{{Name: "media/a.flac", Hash: "a"}}}
+	tests := []struct {
+		name    string
+		albums  []services.Album
+		tracks  []trackRecord
+		wantErr string
+	}{
+		{
+			name:   "every blob is in the archive",
+			albums: []services.Album{{ID: 1, CoverBlobID: &blobID}},
+			tracks: []trackRecord{{Track: services.Track{ID: 1, BlobID: &blobID}}, {Track: services.Track{ID: 2}}},
+		},
+		{
+			name:    "track of a missing blob",
+			tracks:  []trackRecord{{Track: services.Track{ID: 3, BlobID: &missingID}}},
+			wantErr: "track 3 references missing blob 2",
+		},
+		{
+			name:    "cover of a missing blob",
+			albums:  []services.Album{{ID: 4, CoverBlobID: &missingID}},
+			wantErr: "album 4 references missing cover blob 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snap := &snapshot{
+				Blobs:  []blobRecord{{Blob: services.Blob{ID: blobID, Hash: "a"}}},
+				Albums: tt.albums,
+				Tracks: tt.tracks,
+			}
+			err := checkReferences(snap, manifest)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("checkReferences() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
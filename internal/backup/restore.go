@@ -0,0 +1,343 @@
+package backup
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"vinyl-vault/internal/services"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReadManifest returns the manifest of the archive at path, e.g. to use as the base of an incremental backup
+func ReadManifest(path string) (*Manifest, error) {
+	var manifest *Manifest
+
+	err := walkArchive(path, func(header *tar.Header, r io.Reader) error {
+		if header.Name != manifestName {
+			return nil
+		}
+		manifest = &Manifest{}
+		return json.NewDecoder(r).Decode(manifest)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("%s: no manifest, not a vinyl-vault backup", path)
+	}
+	return manifest, nil
+}
+
+// Restore repopulates an empty instance from archives given oldest first: a full
+// backup followed by any incrementals. Rows come from the newest archive, media
+// from whichever archive contains it. Everything is validated before anything is written,
+// and the media written is removed again if the restore fails.
+func Restore(ctx context.Context, db *gorm.DB, fileService *services.FileService, archivePaths []string) error {
+	if len(archivePaths) == 0 {
+		return fmt.Errorf("no archives given")
+	}
+
+	if err := ensureEmpty(ctx, db); err != nil {
+		return err
+	}
+
+	latest := archivePaths[len(archivePaths)-1]
+	manifest, err := ReadManifest(latest)
+	if err != nil {
+		return err
+	}
+	if manifest.FormatVersion != FormatVersion {
+		return fmt.Errorf("unsupported backup format version %d (expected %d)", manifest.FormatVersion, FormatVersion)
+	}
+
+	snap, err := readSnapshot(latest)
+	if err != nil {
+		return err
+	}
+
+	// locate and verify every media file the newest manifest needs
+	sources, err := verifyMedia(archivePaths, manifest)
+	if err != nil {
+		return err
+	}
+	if err = checkReferences(snap, manifest); err != nil {
+		return err
+	}
+
+	// media first: paths are remapped to wherever this instance keeps its blobs
+	paths := make(map[string]string, len(manifest.Files))
+	for archive, entries := range sources {
+		if err = extractMedia(fileService, archive, entries, paths); err != nil {
+			return errors.Join(err, removeMedia(fileService, paths))
+		}
+	}
+
+	blobPaths := make(map[uint64]string, len(snap.Blobs))
+	for i := range snap.Blobs {
+		snap.Blobs[i].Blob.Path = paths[snap.Blobs[i].Hash]
+		snap.Blobs[i].Blob.Source = snap.Blobs[i].Source
+		blobPaths[snap.Blobs[i].ID] = snap.Blobs[i].Blob.Path
+	}
+	for i := range snap.Albums {
+		if cover := snap.Albums[i].CoverBlobID; cover != nil {
+			snap.Albums[i].Metadata.CoverArtPath = blobPaths[*cover]
+		}
+	}
+
+	if err = insertSnapshot(ctx, db, snap); err != nil {
+		return errors.Join(err, removeMedia(fileService, paths))
+	}
+	return nil
+}
+
+func ensureEmpty(ctx context.Context, db *gorm.DB) error {
+	models := []any{&services.User{}, &services.Album{}, &services.Track{}, &services.Blob{}, &services.RegistrationKey{}}
+	for _, model := range models {
+		var count int64
+		if err := db.WithContext(ctx).Unscoped().Model(model).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to inspect target database: %w", err)
+		}
+		if count > 0 {
+			return fmt.Errorf("target instance is not empty, refusing to restore")
+		}
+	}
+	return nil
+}
+
+func readSnapshot(path string) (*snapshot, error) {
+	var snap snapshot
+
+	targets := map[string]any{
+		dbDir + "users.json":             &snap.Users,
+		dbDir + "registration_keys.json": &snap.RegistrationKeys,
+		dbDir + "blobs.json":             &snap.Blobs,
+		dbDir + "albums.json":            &snap.Albums,
+		dbDir + "tracks.json":            &snap.Tracks,
+	}
+	found := 0
+
+	err := walkArchive(path, func(header *tar.Header, r io.Reader) error {
+		target, ok := targets[header.Name]
+		if !ok {
+			return nil
+		}
+		found++
+		if err := json.NewDecoder(r).Decode(target); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", header.Name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found != len(targets) {
+		return nil, fmt.Errorf("%s: archive is missing database tables", path)
+	}
+
+	for i := range snap.Users {
+		snap.Users[i].User.PasswordHash = snap.Users[i].PasswordHash
+	}
+	for i := range snap.Tracks {
+		snap.Tracks[i].Track.LoudnessBlocks = snap.Tracks[i].LoudnessBlocks
+	}
+	return &snap, nil
+}
+
+// verifyMedia hashes every media member and maps each archive to the entries it provides
+func verifyMedia(archivePaths []string, manifest *Manifest) (map[string][]FileEntry, error) {
+	wanted := make(map[string]FileEntry, len(manifest.Files))
+	for _, file := range manifest.Files {
+		wanted[file.Name] = file
+	}
+
+	sources := make(map[string][]FileEntry)
+	seen := make(map[string]bool)
+
+	for _, archive := range archivePaths {
+		err := walkArchive(archive, func(header *tar.Header, r io.Reader) error {
+			entry, ok := wanted[header.Name]
+			if !ok || seen[header.Name] {
+				return nil
+			}
+
+			hasher := sha256.New()
+			if _, err := io.Copy(hasher, r); err != nil {
+				return fmt.Errorf("failed to read %s: %w", header.Name, err)
+			}
+			if actual := hex.EncodeToString(hasher.Sum(nil)); actual != entry.Hash {
+				return fmt.Errorf("%s in %s: checksum mismatch", header.Name, archive)
+			}
+
+			seen[header.Name] = true
+			sources[archive] = append(sources[archive], entry)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for name := range wanted {
+		if !seen[name] {
+			return nil, fmt.Errorf("media file %s is missing, pass the base archive(s) of this incremental backup", name)
+		}
+	}
+	return sources, nil
+}
+
+func checkReferences(snap *snapshot, manifest *Manifest) error {
+	hashes := make(map[string]bool, len(manifest.Files))
+	for _, file := range manifest.Files {
+		hashes[file.Hash] = true
+	}
+
+	blobs := make(map[uint64]bool, len(snap.Blobs))
+	for _, blob := range snap.Blobs {
+		if !hashes[blob.Hash] {
+			return fmt.Errorf("blob %d has no media file in the archive", blob.ID)
+		}
+		blobs[blob.ID] = true
+	}
+	for _, track := range snap.Tracks {
+		if track.BlobID != nil && !blobs[*track.BlobID] {
+			return fmt.Errorf("track %d references missing blob %d", track.ID, *track.BlobID)
+		}
+	}
+	for _, album := range snap.Albums {
+		if album.CoverBlobID != nil && !blobs[*album.CoverBlobID] {
+			return fmt.Errorf("album %d references missing cover blob %d", album.ID, *album.CoverBlobID)
+		}
+	}
+	return nil
+}
+
+func extractMedia(fileService *services.FileService, archive string, entries []FileEntry, paths map[string]string) error {
+	byName := make(map[string]FileEntry, len(entries))
+	for _, entry := range entries {
+		byName[entry.Name] = entry
+	}
+
+	return walkArchive(archive, func(header *tar.Header, r io.Reader) error {
+		entry, ok := byName[header.Name]
+		if !ok {
+			return nil
+		}
+		delete(byName, header.Name)
+
+		result, err := fileService.WriteBlob(r, filepath.Ext(header.Name))
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", header.Name, err)
+		}
+		if result.Hash != entry.Hash {
+			fileService.DeleteBlobFile(result.Path)
+			return fmt.Errorf("failed to restore %s: checksum mismatch", header.Name)
+		}
+
+		relativePath, err := fileService.GetRelativePath(result.Path)
+		if err != nil {
+			return fmt.Errorf("failed to restore %s: %w", header.Name, err)
+		}
+		paths[entry.Hash] = relativePath
+		return nil
+	})
+}
+
+// removeMedia deletes the media files extractMedia wrote, by hash
+func removeMedia(fileService *services.FileService, paths map[string]string) error {
+	var errs []error
+	for _, path := range paths {
+		if err := fileService.DeleteBlobFile(fileService.GetFullPath(path)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func insertSnapshot(ctx context.Context, db *gorm.DB, snap *snapshot) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// rows keep their original IDs so references stay valid
+		for _, user := range snap.Users {
+			if err := tx.Create(&user.User).Error; err != nil {
+				return fmt.Errorf("failed to restore user %d: %w", user.ID, err)
+			}
+		}
+		for i := range snap.RegistrationKeys {
+			if err := tx.Create(&snap.RegistrationKeys[i]).Error; err != nil {
+				return fmt.Errorf("failed to restore registration key %d: %w", snap.RegistrationKeys[i].ID, err)
+			}
+		}
+		for _, blob := range snap.Blobs {
+			if err := tx.Create(&blob.Blob).Error; err != nil {
+				return fmt.Errorf("failed to restore blob %d: %w", blob.ID, err)
+			}
+		}
+		for i := range snap.Albums {
+			snap.Albums[i].Tracks = nil
+			if err := tx.Omit(clause.Associations).Create(&snap.Albums[i]).Error; err != nil {
+				return fmt.Errorf("failed to restore album %d: %w", snap.Albums[i].ID, err)
+			}
+			media := snap.Albums[i].Media
+			for j := range media {
+				media[j].AlbumID = snap.Albums[i].ID
+			}
+			if len(media) > 0 {
+				if err := tx.Create(&media).Error; err != nil {
+					return fmt.Errorf("failed to restore media of album %d: %w", snap.Albums[i].ID, err)
+				}
+			}
+		}
+		for i := range snap.Tracks {
+			snap.Tracks[i].Blob = nil
+			if err := tx.Omit(clause.Associations).Create(&snap.Tracks[i].Track).Error; err != nil {
+				return fmt.Errorf("failed to restore track %d: %w", snap.Tracks[i].ID, err)
+			}
+		}
+
+		return resetSequences(tx)
+	})
+}
+
+// resetSequences moves ID sequences past the restored rows so new inserts don't collide
+func resetSequences(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, table := range []string{"users", "registration_keys", "blobs", "albums", "tracks"} {
+		query := fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', 'id'), COALESCE((SELECT MAX(id) FROM %s), 0) + 1, false)", table, table)
+		if err := tx.Exec(query).Error; err != nil {
+			return fmt.Errorf("failed to reset %s sequence: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func walkArchive(path string, fn func(header *tar.Header, r io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: corrupt archive: %w", path, err)
+		}
+		if err = fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
@@ -1,24 +1,171 @@
+// Package config loads the instance configuration. Settings are layered, later
+// layers winning: built-in defaults, a YAML or TOML file, environment variables,
+// then command-line flags. Each setting declares its file key, env var and flag in tags.
 package config
 
-import "os"
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
 
 type Config struct {
-	DatabaseURL string
-	Port        string
-	Environment string
+	DatabaseURL string `yaml:"database_url" toml:"database_url" env:"DATABASE_URL" flag:"database-url" secret:"url" help:"Postgres DSN or sqlite:///path/to/vault.db"`
+	Port        string `yaml:"port" toml:"port" env:"PORT" flag:"port" help:"HTTP listen port"`
+	Environment string `yaml:"environment" toml:"environment" env:"ENV" flag:"env" help:"development, test or production"`
+
+	Storage     StorageConfig     `yaml:"storage" toml:"storage"`
+	Limits      LimitsConfig      `yaml:"limits" toml:"limits"`
+	Sessions    SessionsConfig    `yaml:"sessions" toml:"sessions"`
+	Conversion  ConversionConfig  `yaml:"conversion" toml:"conversion"`
+	Spectrogram SpectrogramConfig `yaml:"spectrogram" toml:"spectrogram"`
+	Security    SecurityConfig    `yaml:"security" toml:"security"`
+	Maintenance MaintenanceConfig `yaml:"maintenance" toml:"maintenance"`
+	Metrics     MetricsConfig     `yaml:"metrics" toml:"metrics"`
+	Lookup      LookupConfig      `yaml:"lookup" toml:"lookup"`
+}
+
+type StorageConfig struct {
+	UploadDir   string `yaml:"upload_dir" toml:"upload_dir" env:"UPLOAD_DIR" flag:"upload-dir" help:"root directory of stored media"`
+	CoverArtDir string `yaml:"cover_art_dir" toml:"cover_art_dir" env:"COVER_ART_DIR" flag:"cover-art-dir" help:"cover art directory (default <upload-dir>/covers)"`
+	AudioDir    string `yaml:"audio_dir" toml:"audio_dir" env:"AUDIO_DIR" flag:"audio-dir" help:"audio directory (default <upload-dir>/audio)"`
+	TempDir     string `yaml:"temp_dir" toml:"temp_dir" env:"TEMP_DIR" flag:"temp-dir" help:"scratch space for conversions and archives"`
+	CacheDir    string `yaml:"cache_dir" toml:"cache_dir" env:"CACHE_DIR" flag:"cache-dir" help:"rendered images such as spectrograms, safe to clear (default <upload-dir>/cache)"`
+}
+
+type LimitsConfig struct {
+	MaxAudioFileSize    ByteSize `yaml:"max_audio_file_size" toml:"max_audio_file_size" env:"MAX_AUDIO_FILE_SIZE" flag:"max-audio-file-size" help:"largest accepted audio upload"`
+	MaxCoverArtSize     ByteSize `yaml:"max_cover_art_size" toml:"max_cover_art_size" env:"MAX_COVER_ART_SIZE" flag:"max-cover-art-size" help:"largest accepted cover art upload"`
+	DefaultStorageQuota ByteSize `yaml:"default_storage_quota" toml:"default_storage_quota" env:"DEFAULT_STORAGE_QUOTA" flag:"default-storage-quota" help:"per-user quota when none is set, 0 for unlimited"`
+	MinFreeDiskSpace    ByteSize `yaml:"min_free_disk_space" toml:"min_free_disk_space" env:"MIN_FREE_DISK_SPACE" flag:"min-free-disk-space" help:"free space below which the instance reports itself not ready"`
+}
+
+type SessionsConfig struct {
+	Secret string   `yaml:"secret" toml:"secret" env:"SESSION_SECRET" flag:"session-secret" secret:"true" help:"key signing session cookies"`
+	Name   string   `yaml:"name" toml:"name" env:"SESSION_NAME" flag:"session-name" help:"session cookie name"`
+	MaxAge Duration `yaml:"max_age" toml:"max_age" env:"SESSION_MAX_AGE" flag:"session-max-age" help:"session lifetime"`
+	Secure bool     `yaml:"secure" toml:"secure" env:"SESSION_SECURE" flag:"session-secure" help:"only send the session cookie over HTTPS"`
+}
+
+type ConversionConfig struct {
+	FFmpegPath string `yaml:"ffmpeg_path" toml:"ffmpeg_path" env:"FFMPEG_PATH" flag:"ffmpeg-path" help:"ffmpeg binary"`
+	IngestFLAC bool   `yaml:"ingest_flac" toml:"ingest_flac" env:"INGEST_FLAC" flag:"ingest-flac" help:"store AIFF and WAV uploads as FLAC once it is verified to decode to the same samples"`
+	Resampler  string `yaml:"resampler" toml:"resampler" env:"RESAMPLER" flag:"resampler" help:"ffmpeg resampler for sample rate conversions: soxr, or swr for builds without libsoxr"`
+	// Presets are offered alongside the built-in ones, replacing any of the same name.
+	// They are only read from the config file.
+	Presets map[string]PresetConfig `yaml:"presets,omitempty" toml:"presets,omitempty"`
+}
+
+// PresetConfig is a named way of converting audio. Zero values match the source: its
+// bit depth, sample rate and channels.
+type PresetConfig struct {
+	Format     string `yaml:"format" toml:"format"`                               // wav, aiff, flac, alac, mp3 or opus
+	BitDepth   int    `yaml:"bit_depth,omitempty" toml:"bit_depth,omitempty"`     // 16, 24 or 32, lossless formats only
+	SampleRate int    `yaml:"sample_rate,omitempty" toml:"sample_rate,omitempty"` // Hz
+	Channels   int    `yaml:"channels,omitempty" toml:"channels,omitempty"`
+	Dither     string `yaml:"dither,omitempty" toml:"dither,omitempty"`   // ffmpeg dither method used going down to 16 bits, or none
+	Bitrate    int    `yaml:"bitrate,omitempty" toml:"bitrate,omitempty"` // kbps, lossy formats only
+	VBR        bool   `yaml:"vbr,omitempty" toml:"vbr,omitempty"`         // vary the bitrate around Bitrate
+}
+
+// SpectrogramConfig sets how track spectrograms are drawn when a request doesn't say
+type SpectrogramConfig struct {
+	FFTSize int `yaml:"fft_size" toml:"fft_size" env:"SPECTROGRAM_FFT_SIZE" flag:"spectrogram-fft-size" help:"samples per FFT, a power of two from 256 to 32768"`
+	Width   int `yaml:"width" toml:"width" env:"SPECTROGRAM_WIDTH" flag:"spectrogram-width" help:"image width in pixels"`
+	Height  int `yaml:"height" toml:"height" env:"SPECTROGRAM_HEIGHT" flag:"spectrogram-height" help:"image height in pixels"`
+}
+
+type SecurityConfig struct {
+	BcryptCost int `yaml:"bcrypt_cost" toml:"bcrypt_cost" env:"BCRYPT_COST" flag:"bcrypt-cost" help:"password hashing cost (4-31)"`
 }
 
-func Load() *Config {
+type MaintenanceConfig struct {
+	TrashRetention      Duration `yaml:"trash_retention" toml:"trash_retention" env:"TRASH_RETENTION" flag:"trash-retention" help:"how long trashed items are kept before purging, 0 keeps them until purged by hand"`
+	ScrubInterval       Duration `yaml:"scrub_interval" toml:"scrub_interval" env:"SCRUB_INTERVAL" flag:"scrub-interval" help:"time between integrity scrubs"`
+	ScrubBytesPerSecond ByteSize `yaml:"scrub_bytes_per_second" toml:"scrub_bytes_per_second" env:"SCRUB_BYTES_PER_SECOND" flag:"scrub-bytes-per-second" help:"scrub read rate limit, 0 for unlimited"`
+}
+
+// MetricsConfig controls the Prometheus endpoint. With a listen address it gets its own
+// listener, which can stay on a private interface; otherwise it is served on the main
+// port and, in production, only to scrapers presenting the token.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled" env:"METRICS_ENABLED" flag:"metrics-enabled" help:"expose Prometheus metrics at /metrics"`
+	Listen  string `yaml:"listen" toml:"listen" env:"METRICS_LISTEN" flag:"metrics-listen" help:"separate address for /metrics, e.g. 127.0.0.1:9090"`
+	Token   string `yaml:"token" toml:"token" env:"METRICS_TOKEN" flag:"metrics-token" secret:"true" help:"bearer token required to scrape /metrics"`
+}
+
+// LookupConfig sets up the providers release details are looked up from. The release
+// directory holds files in the export format, searched before MusicBrainz and usable offline.
+type LookupConfig struct {
+	MusicBrainzURL string `yaml:"musicbrainz_url" toml:"musicbrainz_url" env:"MUSICBRAINZ_URL" flag:"musicbrainz-url" help:"MusicBrainz web service, empty to not use it"`
+	UserAgent      string `yaml:"user_agent" toml:"user_agent" env:"LOOKUP_USER_AGENT" flag:"lookup-user-agent" help:"User-Agent sent to MusicBrainz, which asks for an application name and a contact"`
+	ReleaseDir     string `yaml:"release_dir" toml:"release_dir" env:"RELEASE_DIR" flag:"release-dir" help:"directory of release files to look up"`
+}
+
+func Default() *Config {
 	return &Config{
-		DatabaseURL: getEnv("DATABASE_URL", "host:localhost user=postgres password=postgres dbname=vinylvault port=5432 sslmode=disable"),
-		Port:        getEnv("PORT", "8080"),
-		Environment: getEnv("ENV", "development"),
+		DatabaseURL: "host=localhost user=postgres password=postgres dbname=vinylvault port=5432 sslmode=disable",
+		Port:        "8080",
+		Environment: "development",
+		Storage: StorageConfig{
+			UploadDir: "uploads",
+			TempDir:   filepath.Join(os.TempDir(), "vinyl-vault"),
+		},
+		Limits: LimitsConfig{
+			MaxAudioFileSize: 500 * MiB,
+			MaxCoverArtSize:  10 * MiB,
+			MinFreeDiskSpace: GiB,
+		},
+		Sessions: SessionsConfig{
+			Name:   "vinylvault_session",
+			MaxAge: Duration(7 * 24 * time.Hour),
+		},
+		Conversion: ConversionConfig{
+			FFmpegPath: "ffmpeg",
+			Resampler:  "soxr",
+		},
+		Spectrogram: SpectrogramConfig{
+			FFTSize: 4096,
+			Width:   1024,
+			Height:  512,
+		},
+		Security: SecurityConfig{
+			BcryptCost: 10,
+		},
+		Maintenance: MaintenanceConfig{
+			TrashRetention: Duration(30 * 24 * time.Hour),
+			ScrubInterval:  Duration(7 * 24 * time.Hour),
+		},
+		Lookup: LookupConfig{
+			MusicBrainzURL: "https://musicbrainz.org/ws/2",
+			UserAgent:      "vinyl-vault/1.0",
+		},
+	}
+}
+
+// CoverArtPath, AudioPath and CachePath resolve the media directories, which default to
+// subdirectories of the upload dir
+func (s StorageConfig) CoverArtPath() string {
+	if s.CoverArtDir != "" {
+		return s.CoverArtDir
 	}
+	return filepath.Join(s.UploadDir, "covers")
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+func (s StorageConfig) AudioPath() string {
+	if s.AudioDir != "" {
+		return s.AudioDir
 	}
-	return defaultValue
+	return filepath.Join(s.UploadDir, "audio")
+}
+
+func (s StorageConfig) CachePath() string {
+	if s.CacheDir != "" {
+		return s.CacheDir
+	}
+	return filepath.Join(s.UploadDir, "cache")
+}
+
+func (c *Config) IsProduction() bool {
+	return c.Environment == "production"
 }
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vault.yaml")
+	err := os.WriteFile(path, []byte(`
+port: "9000"
+storage:
+  upload_dir: /srv/media
+limits:
+  max_audio_file_size: 1GiB
+maintenance:
+  trash_retention: 14d
+conversion:
+  presets:
+    hires:
+      format: flac
+      bit_depth: 24
+      sample_rate: 96000
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PORT", "9001")
+	t.Setenv("MAX_COVER_ART_SIZE", "2MB")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := BindFlags(fs)
+	if err = fs.Parse([]string{"-config", path, "-port", "9002", "-session-secure"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := flags.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"flag beats env and file", cfg.Port, "9002"},
+		{"file beats default", cfg.Storage.UploadDir, "/srv/media"},
+		{"derived dir follows upload dir", cfg.Storage.AudioPath(), filepath.Join("/srv/media", "audio")},
+		{"file size", cfg.Limits.MaxAudioFileSize, GiB},
+		{"env size", cfg.Limits.MaxCoverArtSize, 2 * MiB},
+		{"days", cfg.Maintenance.TrashRetention, Duration(14 * 24 * time.Hour)},
+		{"bool flag", cfg.Sessions.Secure, true},
+		{"default kept", cfg.Conversion.FFmpegPath, "ffmpeg"},
+		{"file-only preset", cfg.Conversion.Presets["hires"], PresetConfig{Format: "flac", BitDepth: 24, SampleRate: 96000}},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.toml")
+	if err := os.WriteFile(path, []byte("[storage]\nupload_dri = \"/srv\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "upload_dri") {
+		t.Errorf("Load() error = %v, want one naming the unknown key", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Environment = "production"
+	cfg.Security.BcryptCost = 2
+	cfg.Port = "http"
+	cfg.Lookup.MusicBrainzURL = "musicbrainz.org"
+	cfg.Spectrogram.FFTSize = 1000
+	cfg.Maintenance.TrashRetention = Duration(-time.Hour)
+	cfg.Conversion.Presets = map[string]PresetConfig{"small": {Format: "mp3", BitDepth: 16, Bitrate: 8}, "none": {Format: "flac"}}
+
+	var validationErr *ValidationError
+	if err := cfg.Validate(); !errors.As(err, &validationErr) {
+		t.Fatalf("Validate() error = %v, want a ValidationError", err)
+	}
+
+	for _, key := range []string{"port", "sessions.secret", "sessions.secure", "spectrogram.fft_size", "conversion.presets.small", "conversion.presets.none", "security.bcrypt_cost", "lookup.musicbrainz_url", "maintenance.trash_retention"} {
+		found := false
+		for _, problem := range validationErr.Problems {
+			found = found || strings.HasPrefix(problem, key+":")
+		}
+		if !found {
+			t.Errorf("Validate() did not report %s, got %v", key, validationErr.Problems)
+		}
+	}
+
+	if err := Default().Validate(); err != nil {
+		t.Errorf("Validate() on defaults error = %v", err)
+	}
+
+	// no retention turns automatic purging off
+	cfg = Default()
+	cfg.Maintenance.TrashRetention = 0
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() with trash_retention 0 error = %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	tests := []struct {
+		databaseURL string
+		want        string
+	}{
+		{"host=db user=vault password=hunter2 dbname=vault", "host=db user=vault password=[redacted] dbname=vault"},
+		{"postgres://vault:hunter2@db:5432/vault", "postgres://vault:xxxxx@db:5432/vault"},
+		{"sqlite:///var/lib/vault.db", "sqlite:///var/lib/vault.db"},
+	}
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.DatabaseURL = tt.databaseURL
+		cfg.Sessions.Secret = "very-secret"
+
+		redacted := cfg.Redacted()
+		if redacted.DatabaseURL != tt.want {
+			t.Errorf("Redacted().DatabaseURL = %q, want %q", redacted.DatabaseURL, tt.want)
+		}
+		if redacted.Sessions.Secret != "[redacted]" {
+			t.Errorf("Redacted().Sessions.Secret = %q", redacted.Sessions.Secret)
+		}
+		if cfg.Sessions.Secret != "very-secret" {
+			t.Error("Redacted() modified the original config")
+		}
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ByteSize
+	}{
+		{"1024", KiB},
+		{"500MB", 500 * MiB},
+		{"512KiB", 512 * KiB},
+		{"2 g", 2 * GiB},
+	}
+	for _, tt := range tests {
+		var got ByteSize
+		if err := got.UnmarshalText([]byte(tt.in)); err != nil || got != tt.want {
+			t.Errorf("UnmarshalText(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+
+	var size ByteSize
+	if err := size.UnmarshalText([]byte("lots")); err == nil {
+		t.Error("UnmarshalText(lots) expected error")
+	}
+	if s := (500 * MiB).String(); s != "500MiB" {
+		t.Errorf("String() = %q, want 500MiB", s)
+	}
+}
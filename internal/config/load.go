@@ -0,0 +1,247 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// PathEnv names the config file when no -config flag is given
+const PathEnv = "VINYL_VAULT_CONFIG"
+
+// Load reads the config file at path (if any) and the environment, then validates the result
+func Load(path string) (*Config, error) {
+	cfg, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path == "" {
+		path = os.Getenv(PathEnv)
+	}
+	if path != "" {
+		if err := readFile(cfg, path); err != nil {
+			return nil, err
+		}
+	}
+
+	err := walk(cfg, func(s setting) error {
+		value, ok := os.LookupEnv(s.env)
+		if !ok || s.env == "" {
+			return nil
+		}
+		if err := s.set(value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", s.env, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func readFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// unknown keys are rejected so a typo doesn't silently fall back to a default
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(cfg)
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(cfg)
+
+		var strict *toml.StrictMissingError
+		if errors.As(err, &strict) {
+			var keys []string
+			for _, missing := range strict.Errors {
+				keys = append(keys, strings.Join(missing.Key(), "."))
+			}
+			err = fmt.Errorf("unknown keys %s", strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("config file %s: unsupported format %q, use .yaml or .toml", path, ext)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Flags binds a flag for every setting, plus -config, to a command's flag set
+type Flags struct {
+	fs     *flag.FlagSet
+	path   string
+	values map[string]*flagValue
+}
+
+func BindFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{fs: fs, values: make(map[string]*flagValue)}
+	fs.StringVar(&f.path, "config", "", "config file (.yaml or .toml), also read from $"+PathEnv)
+
+	// defaults are shown in -h, so they are redacted too
+	walk(Default().Redacted(), func(s setting) error {
+		if s.flag == "" {
+			return nil // only read from the file, like conversion.presets
+		}
+		value := &flagValue{text: s.String(), isBool: s.value.Kind() == reflect.Bool}
+		f.values[s.flag] = value
+		fs.Var(value, s.flag, s.help)
+		return nil
+	})
+	return f
+}
+
+// Load builds the config once the flag set has been parsed. Only flags given
+// on the command line override the file and environment.
+func (f *Flags) Load() (*Config, error) {
+	cfg, err := load(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	given := make(map[string]bool)
+	f.fs.Visit(func(fl *flag.Flag) { given[fl.Name] = true })
+
+	err = walk(cfg, func(s setting) error {
+		if !given[s.flag] {
+			return nil
+		}
+		if err := s.set(f.values[s.flag].text); err != nil {
+			return fmt.Errorf("flag -%s: %w", s.flag, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// flagValue keeps the raw text; it is parsed with the other layers in Load
+type flagValue struct {
+	text   string
+	isBool bool
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.text
+}
+
+func (v *flagValue) Set(text string) error {
+	v.text = text
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// setting is one leaf field of the config with its names from the struct tags
+type setting struct {
+	key    string // dotted file key, e.g. storage.upload_dir
+	env    string
+	flag   string
+	help   string
+	secret string
+	value  reflect.Value
+}
+
+func walk(cfg *Config, fn func(s setting) error) error {
+	return walkStruct(reflect.ValueOf(cfg).Elem(), "", fn)
+}
+
+func walkStruct(v reflect.Value, prefix string, fn func(s setting) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := prefix + field.Tag.Get("yaml")
+
+		if field.Type.Kind() == reflect.Struct && field.Tag.Get("env") == "" {
+			if err := walkStruct(v.Field(i), key+".", fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		err := fn(setting{
+			key:    key,
+			env:    field.Tag.Get("env"),
+			flag:   field.Tag.Get("flag"),
+			help:   field.Tag.Get("help"),
+			secret: field.Tag.Get("secret"),
+			value:  v.Field(i),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s setting) set(text string) error {
+	if u, ok := s.value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(text))
+	}
+
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", text)
+		}
+		s.value.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", text)
+		}
+		s.value.SetInt(int64(n))
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+	return nil
+}
+
+func (s setting) String() string {
+	if m, ok := s.value.Interface().(encoding.TextMarshaler); ok {
+		text, _ := m.MarshalText()
+		return string(text)
+	}
+	return fmt.Sprint(s.value.Interface())
+}
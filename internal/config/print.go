@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[redacted]"
+
+// passwordParam matches the password of a key=value Postgres DSN
+var passwordParam = regexp.MustCompile(`(password=)('[^']*'|\S*)`)
+
+// Redacted returns a copy safe to print: secrets are masked and database URLs lose their password
+func (c *Config) Redacted() *Config {
+	copied := *c
+
+	walk(&copied, func(s setting) error {
+		text := s.value.String()
+		if text == "" {
+			return nil
+		}
+		switch s.secret {
+		case "true":
+			s.value.SetString(redacted)
+		case "url":
+			s.value.SetString(redactURL(text))
+		}
+		return nil
+	})
+	return &copied
+}
+
+func redactURL(raw string) string {
+	if u, err := url.Parse(raw); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return passwordParam.ReplaceAllString(raw, "${1}"+redacted)
+}
+
+// Print writes the redacted config as YAML or TOML
+func (c *Config) Print(w io.Writer, format string) error {
+	var data []byte
+	var err error
+
+	switch format {
+	case "yaml", "yml":
+		data, err = yaml.Marshal(c.Redacted())
+	case "toml":
+		data, err = toml.Marshal(c.Redacted())
+	default:
+		return fmt.Errorf("unsupported format %q, use yaml or toml", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
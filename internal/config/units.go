@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ByteSize is a size in bytes, written as a plain number or with a binary
+// unit: "512KiB", "500MB" and "1G" all count in powers of 1024
+type ByteSize int64
+
+const (
+	B   ByteSize = 1
+	KiB          = 1024 * B
+	MiB          = 1024 * KiB
+	GiB          = 1024 * MiB
+	TiB          = 1024 * GiB
+)
+
+var sizeUnits = []struct {
+	size     ByteSize
+	suffixes []string
+}{
+	{TiB, []string{"TIB", "TB", "T"}},
+	{GiB, []string{"GIB", "GB", "G"}},
+	{MiB, []string{"MIB", "MB", "M"}},
+	{KiB, []string{"KIB", "KB", "K"}},
+	{B, []string{"B"}},
+}
+
+func (s *ByteSize) UnmarshalText(text []byte) error {
+	number, unit := splitUnit(strings.ToUpper(strings.TrimSpace(string(text))))
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid size %q, expected e.g. 500MiB", string(text))
+	}
+	*s = ByteSize(n) * unit
+	return nil
+}
+
+func splitUnit(value string) (string, ByteSize) {
+	for _, u := range sizeUnits {
+		for _, suffix := range u.suffixes {
+			if number, ok := strings.CutSuffix(value, suffix); ok {
+				return strings.TrimSpace(number), u.size
+			}
+		}
+	}
+	return value, B
+}
+
+func (s ByteSize) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s ByteSize) String() string {
+	for _, u := range sizeUnits {
+		if s != 0 && s%u.size == 0 {
+			return fmt.Sprintf("%d%s", s/u.size, unitName(u.size))
+		}
+	}
+	return "0"
+}
+
+func unitName(size ByteSize) string {
+	switch size {
+	case TiB:
+		return "TiB"
+	case GiB:
+		return "GiB"
+	case MiB:
+		return "MiB"
+	case KiB:
+		return "KiB"
+	}
+	return "B"
+}
+
+// Duration is a time.Duration that also accepts whole days, e.g. "30d"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	value := strings.TrimSpace(string(text))
+
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*d = Duration(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, expected e.g. 90m or 30d", value)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d Duration) String() string {
+	day := 24 * time.Hour
+	if td := time.Duration(d); td != 0 && td%day == 0 {
+		return fmt.Sprintf("%dd", td/day)
+	}
+	return time.Duration(d).String()
+}
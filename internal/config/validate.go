@@ -0,0 +1,171 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// minSessionSecretLength is the shortest signing key accepted in production
+const minSessionSecretLength = 32
+
+// ValidationError lists every invalid setting, so startup reports them all at once
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(key, format string, args ...any) {
+		problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+	}
+
+	if c.DatabaseURL == "" {
+		add("database_url", "is required")
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		add("port", "%q is not a valid port", c.Port)
+	}
+	switch c.Environment {
+	case "development", "test", "production":
+	default:
+		add("environment", "%q must be development, test or production", c.Environment)
+	}
+
+	if c.Storage.UploadDir == "" {
+		add("storage.upload_dir", "is required")
+	}
+	if c.Storage.TempDir == "" {
+		add("storage.temp_dir", "is required")
+	}
+
+	if c.Limits.MaxAudioFileSize <= 0 {
+		add("limits.max_audio_file_size", "must be greater than 0")
+	}
+	if c.Limits.MaxCoverArtSize <= 0 {
+		add("limits.max_cover_art_size", "must be greater than 0")
+	}
+	if c.Limits.MinFreeDiskSpace < 0 {
+		add("limits.min_free_disk_space", "must not be negative")
+	}
+
+	if c.Sessions.Name == "" {
+		add("sessions.name", "is required")
+	}
+	if c.Sessions.MaxAge <= 0 {
+		add("sessions.max_age", "must be greater than 0")
+	}
+	if c.IsProduction() {
+		if len(c.Sessions.Secret) < minSessionSecretLength {
+			add("sessions.secret", "must be at least %d characters in production", minSessionSecretLength)
+		}
+		if !c.Sessions.Secure {
+			add("sessions.secure", "must be enabled in production")
+		}
+	}
+
+	if c.Conversion.FFmpegPath == "" {
+		add("conversion.ffmpeg_path", "is required")
+	}
+	if c.Conversion.Resampler != "soxr" && c.Conversion.Resampler != "swr" {
+		add("conversion.resampler", "%q must be soxr or swr", c.Conversion.Resampler)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Conversion.Presets)) {
+		if strings.EqualFold(name, "none") {
+			add("conversion.presets.none", "is reserved for downloading tracks as they are stored")
+		}
+		for _, problem := range c.Conversion.Presets[name].problems() {
+			add("conversion.presets."+name, "%s", problem)
+		}
+	}
+
+	if n := c.Spectrogram.FFTSize; n < 256 || n > 32768 || n&(n-1) != 0 {
+		add("spectrogram.fft_size", "%d must be a power of two from 256 to 32768", n)
+	}
+	if c.Spectrogram.Width < 16 || c.Spectrogram.Width > 8192 {
+		add("spectrogram.width", "%d must be between 16 and 8192", c.Spectrogram.Width)
+	}
+	if c.Spectrogram.Height < 16 || c.Spectrogram.Height > 8192 {
+		add("spectrogram.height", "%d must be between 16 and 8192", c.Spectrogram.Height)
+	}
+
+	if c.Security.BcryptCost < 4 || c.Security.BcryptCost > 31 {
+		add("security.bcrypt_cost", "%d must be between 4 and 31", c.Security.BcryptCost)
+	}
+
+	// 0 keeps trashed items until they are purged by hand
+	if c.Maintenance.TrashRetention < 0 {
+		add("maintenance.trash_retention", "must not be negative")
+	}
+	if c.Maintenance.ScrubInterval <= 0 {
+		add("maintenance.scrub_interval", "must be greater than 0")
+	}
+
+	if c.Metrics.Enabled && c.Metrics.Listen == "" && c.Metrics.Token == "" && c.IsProduction() {
+		add("metrics.token", "is required in production unless metrics.listen moves /metrics off the main port")
+	}
+
+	if c.Lookup.MusicBrainzURL != "" {
+		if u, err := url.Parse(c.Lookup.MusicBrainzURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("lookup.musicbrainz_url", "%q is not an http or https URL", c.Lookup.MusicBrainzURL)
+		} else if c.Lookup.UserAgent == "" {
+			add("lookup.user_agent", "is required to use MusicBrainz")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ditherMethods are the dither_method values of ffmpeg's resampler, plus none
+var ditherMethods = []string{
+	"none", "rectangular", "triangular", "triangular_hp", "lipshitz", "shibata",
+	"low_shibata", "high_shibata", "f_weighted", "e_weighted", "modified_e_weighted", "improved_e_weighted",
+}
+
+// problems lists what is wrong with a preset, as Validate reports it
+func (p PresetConfig) problems() []string {
+	var problems []string
+	lossy := p.Format == "mp3" || p.Format == "opus"
+	switch p.Format {
+	case "wav", "aiff", "flac", "alac", "mp3", "opus":
+	default:
+		problems = append(problems, fmt.Sprintf("format %q must be wav, aiff, flac, alac, mp3 or opus", p.Format))
+	}
+	switch {
+	case p.BitDepth != 0 && lossy:
+		problems = append(problems, "bit_depth only applies to lossless formats")
+	case p.BitDepth != 0 && p.BitDepth != 16 && p.BitDepth != 24 && (p.BitDepth != 32 || p.Format == "flac" || p.Format == "alac"):
+		problems = append(problems, fmt.Sprintf("bit_depth %d must be 16 or 24, or 32 for WAV and AIFF", p.BitDepth))
+	}
+	switch {
+	case p.Format == "opus" && p.SampleRate != 0 && !slices.Contains([]int{8000, 12000, 16000, 24000, 48000}, p.SampleRate):
+		problems = append(problems, fmt.Sprintf("sample_rate %d must be 8000, 12000, 16000, 24000 or 48000 for Opus", p.SampleRate))
+	case p.Format == "mp3" && p.SampleRate > 48000:
+		problems = append(problems, fmt.Sprintf("sample_rate %d must be at most 48000 for MP3", p.SampleRate))
+	case p.SampleRate != 0 && (p.SampleRate < 8000 || p.SampleRate > 384000):
+		problems = append(problems, fmt.Sprintf("sample_rate %d must be between 8000 and 384000", p.SampleRate))
+	}
+	if p.Channels < 0 || p.Channels > 8 {
+		problems = append(problems, fmt.Sprintf("channels %d must be between 1 and 8", p.Channels))
+	}
+	if p.Dither != "" && !slices.Contains(ditherMethods, p.Dither) {
+		problems = append(problems, fmt.Sprintf("dither %q must be one of %s", p.Dither, strings.Join(ditherMethods, ", ")))
+	}
+	switch {
+	case (p.Bitrate != 0 || p.VBR) && !lossy:
+		problems = append(problems, "bitrate and vbr only apply to MP3 and Opus")
+	case p.Bitrate != 0 && (p.Bitrate < 32 || p.Bitrate > 512):
+		problems = append(problems, fmt.Sprintf("bitrate %d must be between 32 and 512 kbps", p.Bitrate))
+	}
+	return problems
+}
@@ -0,0 +1,72 @@
+// Package database opens the configured database. A DatabaseURL starting with
+// sqlite:// selects the embedded SQLite backend; anything else is handed to Postgres.
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const sqliteScheme = "sqlite://"
+
+// sqlitePragmas are applied to every SQLite connection: foreign keys are off by
+// default in SQLite, and WAL plus a busy timeout let streaming reads overlap writes
+var sqlitePragmas = []string{"foreign_keys(1)", "journal_mode(WAL)", "busy_timeout(5000)"}
+
+func Open(databaseURL string) (*gorm.DB, error) {
+	dialector, err := Dialector(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// TranslateError turns driver-specific constraint violations into gorm.ErrDuplicatedKey
+	// and friends, so repositories can map them without knowing the backend
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// Driver names the backend a DatabaseURL selects, "sqlite" or "postgres"
+func Driver(databaseURL string) string {
+	if strings.HasPrefix(databaseURL, sqliteScheme) {
+		return "sqlite"
+	}
+	return "postgres"
+}
+
+// Dialector picks the gorm driver for a DatabaseURL
+func Dialector(databaseURL string) (gorm.Dialector, error) {
+	if Driver(databaseURL) != "sqlite" {
+		return postgres.Open(databaseURL), nil
+	}
+
+	dsn, err := sqliteDSN(strings.TrimPrefix(databaseURL, sqliteScheme))
+	if err != nil {
+		return nil, err
+	}
+	return sqlite.Open(dsn), nil
+}
+
+// sqliteDSN turns "path/to/vault.db?opts" into a driver DSN with the required pragmas
+func sqliteDSN(rest string) (string, error) {
+	path, rawQuery, _ := strings.Cut(rest, "?")
+	if path == "" {
+		return "", fmt.Errorf("sqlite database URL needs a file path, e.g. sqlite:///var/lib/vinylvault/vault.db")
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", fmt.Errorf("invalid sqlite database URL: %w", err)
+	}
+	for _, pragma := range sqlitePragmas {
+		query.Add("_pragma", pragma)
+	}
+	return path + "?" + query.Encode(), nil
+}
@@ -1,32 +1,69 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"vinyl-vault/internal/metrics"
 	"vinyl-vault/internal/services"
 	"vinyl-vault/pkg"
 
 	"github.com/gin-gonic/gin"
 )
 
+// CreateAlbumRequest comes as multipart form fields next to the optional cover_art
+// upload, metadata and media as JSON. Media lists the discs of the release, e.g.
+// [{"number": 1, "format": "12\"", "speed": 33}, {"number": 2, "format": "12\"", "speed": 33}].
 type CreateAlbumRequest struct {
 	Metadata pkg.Metadata `form:"metadata"`
+	Media    mediaParam   `form:"media"`
 }
 
+// UpdateAlbumRequest replaces the album's metadata, its media when media is sent, and
+// the credits of tracks listed in credits, a JSON object by track ID such as
+// {"12": [{"role": "performer", "name": "Jaki Liebezeit", "detail": "drums"}]}.
 type UpdateAlbumRequest struct {
 	Metadata pkg.Metadata `form:"metadata"`
+	Media    mediaParam   `form:"media"`
+	Credits  creditsParam `form:"credits"`
+}
+
+// mediaParam is a JSON array of media in a form field
+type mediaParam []services.Medium
+
+func (m *mediaParam) UnmarshalParam(param string) error {
+	return json.Unmarshal([]byte(param), (*[]services.Medium)(m))
+}
+
+// creditsParam is a JSON object of track credits by track ID in a form field
+type creditsParam map[uint64][]pkg.Credit
+
+func (m *creditsParam) UnmarshalParam(param string) error {
+	return json.Unmarshal([]byte(param), (*map[uint64][]pkg.Credit)(m))
 }
 
 type AlbumHandler struct {
 	albumService *services.AlbumService
 	fileService  *services.FileService
+	blobService  *services.BlobService
+	splitService *services.SplitService
 }
 
-func NewAlbumHandler(albumService *services.AlbumService, fileService *services.FileService) *AlbumHandler {
+func NewAlbumHandler(
+	albumService *services.AlbumService,
+	fileService *services.FileService,
+	blobService *services.BlobService,
+	splitService *services.SplitService,
+) *AlbumHandler {
 	return &AlbumHandler{
 		albumService: albumService,
 		fileService:  fileService,
+		blobService:  blobService,
+		splitService: splitService,
 	}
 }
 
@@ -34,35 +71,38 @@ func (h *AlbumHandler) RegisterAlbumRoutes(router *gin.RouterGroup) {
 	router.POST("/album", h.CreateAlbum)
 	router.GET("/album/:id", h.GetAlbum)
 	router.GET("/albums/me", h.GetMyAlbums)
+	router.GET("/albums/me/export", h.ExportMyAlbums)
+	router.GET("/albums/search", h.SearchAlbums)
 	router.PUT("/album/:id", h.UpdateAlbum)
 	router.DELETE("/album/:id", h.DeleteAlbum)
 	router.GET("/album/:id/download", h.DownloadAlbum) // download as zip
+	router.GET("/album/:id/export", h.ExportAlbum)
 }
 
 func (h *AlbumHandler) CreateAlbum(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	var req CreateAlbumRequest
 	if err := c.ShouldBind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	// create album first without coverart
-	album, err := h.albumService.CreateAlbum(c.Request.Context(), userID.(uint64), req.Metadata)
+	album, err := h.albumService.CreateAlbum(c.Request.Context(), userID.(uint64), req.Metadata, req.Media)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 
 	// then we handle coverart if provided
 	coverFile, err := c.FormFile("cover_art")
 	if err == nil {
-		result, err := h.fileService.SaveCoverArt(coverFile, album.ID)
+		blob, err := h.saveCoverArt(c, userID.(uint64), coverFile)
 		if err != nil {
 			c.JSON(http.StatusCreated, gin.H{
 				"album":   album,
@@ -70,18 +110,10 @@ func (h *AlbumHandler) CreateAlbum(c *gin.Context) {
 			})
 			return
 		}
-		relativePath, err := h.fileService.GetRelativePath(result.Path)
-		if err != nil {
-			h.fileService.DeleteCoverArt(result.Path)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process file path"})
-			return
-		}
 
-		req.Metadata.CoverArtPath = relativePath
-		album, err = h.albumService.UpdateAlbumInfo(c.Request.Context(), userID.(uint64), album.ID, req.Metadata)
+		album, err = h.albumService.SetCoverArt(c.Request.Context(), userID.(uint64), album.ID, blob)
 		if err != nil {
-			h.fileService.DeleteCoverArt(result.Path)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update album"})
+			RespondError(c, err)
 			return
 		}
 	}
@@ -93,13 +125,13 @@ func (h *AlbumHandler) GetAlbum(c *gin.Context) {
 
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		respondInvalidParam(c, "id")
 		return
 	}
 
 	album, err := h.albumService.GetAlbum(c.Request.Context(), uint64(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, album)
@@ -108,126 +140,228 @@ func (h *AlbumHandler) GetAlbum(c *gin.Context) {
 func (h *AlbumHandler) GetMyAlbums(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	albums, err := h.albumService.GetAlbumsByUser(c.Request.Context(), userID.(uint64))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, albums)
+}
+
+// SearchAlbums finds the user's albums by text, genre, style or credited name
+func (h *AlbumHandler) SearchAlbums(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	albums, err := h.albumService.SearchAlbums(c.Request.Context(), userID.(uint64), services.AlbumQuery{
+		Text:   c.Query("q"),
+		Genre:  c.Query("genre"),
+		Style:  c.Query("style"),
+		Credit: c.Query("credit"),
+	})
+	if err != nil {
+		RespondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, albums)
 }
 
+// ExportAlbum returns the album's metadata in the format of api/export.schema.json
+func (h *AlbumHandler) ExportAlbum(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondInvalidParam(c, "id")
+		return
+	}
+
+	export, err := h.albumService.ExportAlbum(c.Request.Context(), uint64(id))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="album_%d.json"`, id))
+	c.JSON(http.StatusOK, export)
+}
+
+// ExportMyAlbums returns the metadata of all the user's albums in the format of api/export.schema.json
+func (h *AlbumHandler) ExportMyAlbums(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	export, err := h.albumService.ExportAlbums(c.Request.Context(), userID.(uint64))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="albums.json"`)
+	c.JSON(http.StatusOK, export)
+}
+
 // DownloadAlbum creates a zip of all tracks and returns it
 func (h *AlbumHandler) DownloadAlbum(c *gin.Context) {
 	_, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	albumID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		respondInvalidParam(c, "id")
 		return
 	}
 
 	// Get album to verify ownership
 	album, err := h.albumService.GetAlbum(c.Request.Context(), uint64(albumID))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "album not found"})
+		RespondError(c, err)
 		return
 	}
 
-	// Get all track file paths
-	var trackPaths []string
+	// Get all track files in play order, named after their position and title
+	multiDisc := len(album.Media) > 1
 	for _, track := range album.Tracks {
-		fullPath := h.fileService.GetFullPath(track.FilePath)
-		trackPaths = append(trackPaths, fullPath)
+		multiDisc = multiDisc || track.DiscNumber > 1
+	}
+	// and tagged from the album as they are added
+	replayGain, err := queryReplayGain(c)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	cover, err := h.fileService.ReadCoverArt(album)
+	if err != nil {
+		cover = nil // tag the tracks without it
+	}
+	var entries []services.ArchiveEntry
+	for _, track := range album.Tracks {
+		if track.Blob == nil {
+			continue
+		}
+		fullPath := h.fileService.GetFullPath(track.Blob.Path)
+		entries = append(entries, services.ArchiveEntry{
+			Path: fullPath,
+			Name: fmt.Sprintf("%s_%s%s", archivePosition(&track, multiDisc), services.SanitizeFilename(track.Title), filepath.Ext(fullPath)),
+			Open: func() (io.ReadCloser, error) {
+				tags := services.NewTags(album, &track, cover)
+				if replayGain {
+					tags.ReplayGain = services.NewReplayGain(album, &track)
+				}
+				return h.splitService.OpenDownload(c.Request.Context(), &track, tags)
+			},
+		})
 	}
 
-	if len(trackPaths) == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "album has no tracks"})
+	if len(entries) == 0 {
+		respondProblem(c, http.StatusBadRequest, "album_empty", "album has no tracks")
 		return
 	}
 
 	// Create zip
 	zipName := fmt.Sprintf("album_%d_%s.zip", albumID, services.SanitizeFilename(album.Metadata.Album))
-	zipPath, err := h.fileService.ArchiveAudioFilesToZip(trackPaths, zipName)
+	zipPath, err := h.fileService.ArchiveAudioFilesToZip(entries, zipName)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create archive"})
+		RespondError(c, fmt.Errorf("failed to create archive: %w", err))
 		return
 	}
 
 	// Send file and cleanup
 	defer h.fileService.DeleteZipFile(zipPath)
 	c.FileAttachment(zipPath, zipName)
+	metrics.BytesServed.WithLabelValues("archive").Add(float64(max(c.Writer.Size(), 0)))
 }
 
 func (h *AlbumHandler) UpdateAlbum(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		respondInvalidParam(c, "id")
 		return
 	}
 
 	var req UpdateAlbumRequest
 	if err = c.ShouldBind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
+		return
+	}
+
+	album, err := h.albumService.UpdateAlbumInfo(c.Request.Context(), userID.(uint64), uint64(id), req.Metadata, req.Media, req.Credits)
+	if err != nil {
+		RespondError(c, err)
 		return
 	}
 
 	// Handle optional new cover art
 	coverFile, err := c.FormFile("cover_art")
 	if err == nil {
-		result, err := h.fileService.SaveCoverArt(coverFile, uint64(id))
+		blob, err := h.saveCoverArt(c, userID.(uint64), coverFile)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			RespondError(c, err)
 			return
 		}
 
-		relativePath, err := h.fileService.GetRelativePath(result.Path)
-
+		album, err = h.albumService.SetCoverArt(c.Request.Context(), userID.(uint64), uint64(id), blob)
 		if err != nil {
-			h.fileService.DeleteCoverArt(result.Path)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process file path"})
+			RespondError(c, err)
 			return
 		}
-		req.Metadata.CoverArtPath = relativePath
 	}
+	c.JSON(http.StatusOK, album)
+}
 
-	album, err := h.albumService.UpdateAlbumInfo(c.Request.Context(), userID.(uint64), uint64(id), req.Metadata)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+// archivePosition prefixes file names in album zips so they sort in play order:
+// 01, 02... or A1, B1... with the disc in front on releases of several, as in 2-C1
+func archivePosition(track *services.Track, multiDisc bool) string {
+	position := fmt.Sprintf("%02d", track.TrackNumber)
+	if track.Side != "" {
+		position = track.Position()
 	}
-	c.JSON(http.StatusOK, album)
+	if multiDisc {
+		position = fmt.Sprintf("%d-%s", track.DiscNumber, position)
+	}
+	return position
 }
 
 func (h *AlbumHandler) DeleteAlbum(c *gin.Context) {
 
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		respondInvalidParam(c, "id")
 		return
 	}
 	if err = h.albumService.DeleteAlbum(c.Request.Context(), userID.(uint64), uint64(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 	c.Status(http.StatusNoContent)
 }
+
+// saveCoverArt stores the uploaded image in the blob store and takes a reference to it
+func (h *AlbumHandler) saveCoverArt(c *gin.Context, userID uint64, coverFile *multipart.FileHeader) (*services.Blob, error) {
+	result, err := h.fileService.SaveCoverArt(c.Request.Context(), userID, coverFile)
+	if err != nil {
+		return nil, err
+	}
+	return h.blobService.Acquire(c.Request.Context(), userID, result)
+}
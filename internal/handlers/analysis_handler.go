@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"vinyl-vault/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AnalysisHandler struct {
+	analysisService *services.AnalysisService
+}
+
+func NewAnalysisHandler(analysisService *services.AnalysisService) *AnalysisHandler {
+	return &AnalysisHandler{
+		analysisService: analysisService,
+	}
+}
+
+func (h *AnalysisHandler) RegisterAnalysisRoutes(router *gin.RouterGroup) {
+	router.POST("/track/:id/analyze", h.AnalyzeTrack)
+	router.POST("/album/:id/analyze", h.AnalyzeAlbum)
+}
+
+// AnalyzeTrack measures a track's loudness while the caller waits, and returns the track
+func (h *AnalysisHandler) AnalyzeTrack(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	trackID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondInvalidParam(c, "id")
+		return
+	}
+
+	track, err := h.analysisService.AnalyzeTrack(c.Request.Context(), userID.(uint64), uint64(trackID))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, track)
+}
+
+// AnalyzeAlbum queues the album's tracks for analysis, which takes a while for a whole album
+func (h *AnalysisHandler) AnalyzeAlbum(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	albumID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondInvalidParam(c, "id")
+		return
+	}
+
+	queued, err := h.analysisService.AnalyzeAlbum(c.Request.Context(), userID.(uint64), uint64(albumID))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"queued": queued})
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"vinyl-vault/internal/logging"
+	"vinyl-vault/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is the body of every error response, modelled on RFC 9457 problem details.
+// Code is stable and meant for programs, Detail is meant for people.
+type Problem struct {
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// errorMapping ties a service sentinel to the response it produces
+type errorMapping struct {
+	err    error
+	status int
+	code   string
+}
+
+var errorMappings = []errorMapping{
+	{services.ErrUnauthorized, http.StatusUnauthorized, "unauthorized"},
+	{services.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+	{services.ErrNotOwner, http.StatusForbidden, "not_owner"},
+	{services.ErrAdminOnly, http.StatusForbidden, "admin_only"},
+
+	{services.ErrUserNotFound, http.StatusNotFound, "user_not_found"},
+	{services.ErrAlbumNotFound, http.StatusNotFound, "album_not_found"},
+	{services.ErrTrackNotFound, http.StatusNotFound, "track_not_found"},
+	{services.ErrKeyNotFound, http.StatusNotFound, "registration_key_not_found"},
+	{services.ErrBlobNotFound, http.StatusNotFound, "blob_not_found"},
+	{services.ErrScrubNotFound, http.StatusNotFound, "scrub_report_not_found"},
+	{services.ErrReleaseNotFound, http.StatusNotFound, "release_not_found"},
+	{services.ErrFileNotFound, http.StatusNotFound, "file_not_found"},
+	{services.ErrNotFound, http.StatusNotFound, "not_found"},
+
+	{services.ErrUserExists, http.StatusConflict, "user_exists"},
+	{services.ErrScrubRunning, http.StatusConflict, "scrub_running"},
+
+	{services.ErrInvalidKey, http.StatusBadRequest, "invalid_registration_key"},
+	{services.ErrKeyAlreadyUsed, http.StatusBadRequest, "registration_key_used"},
+	{services.ErrKeyExpired, http.StatusBadRequest, "registration_key_expired"},
+
+	{services.ErrQuotaExceeded, http.StatusRequestEntityTooLarge, "quota_exceeded"},
+	{services.ErrFileTooLarge, http.StatusRequestEntityTooLarge, "file_too_large"},
+	{services.ErrUnsupportedFormat, http.StatusUnsupportedMediaType, "unsupported_format"},
+
+	{services.ErrFFmpegUnavailable, http.StatusServiceUnavailable, "conversion_unavailable"},
+	{services.ErrLookupUnavailable, http.StatusBadGateway, "lookup_unavailable"},
+
+	{services.ErrInvalidInput, http.StatusBadRequest, "invalid_input"},
+	{services.ErrInvalidEmail, http.StatusBadRequest, "invalid_email"},
+	{services.ErrPasswordTooShort, http.StatusBadRequest, "password_too_short"},
+	{services.ErrRequiredField, http.StatusBadRequest, "required_field"},
+}
+
+func init() {
+	// report binding errors under the names clients send, not the Go field names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(requestFieldName)
+	}
+}
+
+// RespondError renders err as a problem and aborts the request. Typed service errors
+// get their own status and code; anything else is reported as a bare 500 so that
+// internal details (SQL, paths) never reach the client. The full error is recorded
+// on the context, where the access log picks it up.
+func RespondError(c *gin.Context, err error) {
+	c.Error(err)
+
+	var validationErrs services.ValidationErrors
+	var validationErr *services.ValidationError
+	switch {
+	case errors.As(err, &validationErrs):
+		respondValidation(c, validationErrs)
+		return
+	case errors.As(err, &validationErr):
+		respondValidation(c, services.ValidationErrors{validationErr})
+		return
+	}
+
+	for _, mapping := range errorMappings {
+		if errors.Is(err, mapping.err) {
+			detail := mapping.err.Error()
+			var serviceErr *services.ServiceError
+			if errors.As(err, &serviceErr) && serviceErr.Msg != "" {
+				detail = serviceErr.Msg
+			}
+			respondProblem(c, mapping.status, mapping.code, detail)
+			return
+		}
+	}
+
+	respondProblem(c, http.StatusInternalServerError, "internal_error", "internal server error")
+}
+
+// respondBindError reports a request body or query that failed to bind
+func respondBindError(c *gin.Context, err error) {
+	c.Error(err)
+
+	var fieldErrs validator.ValidationErrors
+	if !errors.As(err, &fieldErrs) {
+		respondProblem(c, http.StatusBadRequest, "malformed_request", "malformed request body")
+		return
+	}
+
+	errs := make(services.ValidationErrors, len(fieldErrs))
+	for i, fieldErr := range fieldErrs {
+		errs[i] = services.NewValidationError(fieldErr.Field(), validationMessage(fieldErr))
+	}
+	respondValidation(c, errs)
+}
+
+// respondInvalidParam reports a malformed path parameter such as a non-numeric id
+func respondInvalidParam(c *gin.Context, name string) {
+	RespondError(c, services.NewValidationError(name, "must be a positive integer"))
+}
+
+func respondValidation(c *gin.Context, errs services.ValidationErrors) {
+	problem := newProblem(c, http.StatusBadRequest, "validation_failed", errs.Error())
+	for _, err := range errs {
+		problem.Errors = append(problem.Errors, FieldError{Field: err.Field, Message: err.Message})
+	}
+	writeProblem(c, problem)
+}
+
+func respondProblem(c *gin.Context, status int, code, detail string) {
+	writeProblem(c, newProblem(c, status, code, detail))
+}
+
+func newProblem(c *gin.Context, status int, code, detail string) Problem {
+	return Problem{
+		Title:     http.StatusText(status),
+		Status:    status,
+		Code:      code,
+		Detail:    detail,
+		RequestID: logging.RequestID(c.Request.Context()),
+	}
+}
+
+func writeProblem(c *gin.Context, problem Problem) {
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+func validationMessage(err validator.FieldError) string {
+	switch err.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return fmt.Sprintf("must be at least %s", err.Param())
+	case "max":
+		return fmt.Sprintf("must be at most %s", err.Param())
+	default:
+		return fmt.Sprintf("failed the %s check", err.Tag())
+	}
+}
+
+// requestFieldName names a struct field after its json tag, falling back to the form tag
+func requestFieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
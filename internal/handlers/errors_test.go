@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"vinyl-vault/internal/logging"
+	"vinyl-vault/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func renderError(t *testing.T, err error) (*httptest.ResponseRecorder, Problem) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/album/1", nil)
+	c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), "req-123"))
+
+	RespondError(c, err)
+
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("response is not a problem: %v (%s)", err, w.Body.String())
+	}
+	return w, problem
+}
+
+func TestRespondError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{
+			name:       "wrapped not found",
+			err:        fmt.Errorf("failed to get album: %w", fmt.Errorf("album with id 1: %w", services.ErrAlbumNotFound)),
+			wantStatus: http.StatusNotFound,
+			wantCode:   "album_not_found",
+			wantDetail: "album not found",
+		},
+		{
+			name:       "not owner",
+			err:        fmt.Errorf("album 1: %w", services.ErrNotOwner),
+			wantStatus: http.StatusForbidden,
+			wantCode:   "not_owner",
+			wantDetail: services.ErrNotOwner.Error(),
+		},
+		{
+			name:       "admin only",
+			err:        fmt.Errorf("set storage quotas: %w", services.ErrAdminOnly),
+			wantStatus: http.StatusForbidden,
+			wantCode:   "admin_only",
+			wantDetail: services.ErrAdminOnly.Error(),
+		},
+		{
+			name:       "service error message",
+			err:        services.NewServiceError("FileService.ValidateAudioFile", services.ErrFileTooLarge, "file too large: maximum size is 500MB"),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   "file_too_large",
+			wantDetail: "file too large: maximum size is 500MB",
+		},
+		{
+			name:       "quota exceeded",
+			err:        fmt.Errorf("cannot store file: %w", services.ErrQuotaExceeded),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   "quota_exceeded",
+			wantDetail: services.ErrQuotaExceeded.Error(),
+		},
+		{
+			name:       "conflict",
+			err:        services.ErrScrubRunning,
+			wantStatus: http.StatusConflict,
+			wantCode:   "scrub_running",
+			wantDetail: services.ErrScrubRunning.Error(),
+		},
+		{
+			name:       "internal error is hidden",
+			err:        fmt.Errorf("failed to find album: %w", errors.New(`pq: relation "albums" does not exist`)),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   "internal_error",
+			wantDetail: "internal server error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, problem := renderError(t, tt.err)
+
+			if w.Code != tt.wantStatus || problem.Status != tt.wantStatus {
+				t.Errorf("status = %d (body %d), want %d", w.Code, problem.Status, tt.wantStatus)
+			}
+			if problem.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", problem.Code, tt.wantCode)
+			}
+			if problem.Detail != tt.wantDetail {
+				t.Errorf("detail = %q, want %q", problem.Detail, tt.wantDetail)
+			}
+			if problem.RequestID != "req-123" {
+				t.Errorf("request_id = %q, want req-123", problem.RequestID)
+			}
+			if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, problemContentType) {
+				t.Errorf("Content-Type = %q, want %s", got, problemContentType)
+			}
+		})
+	}
+}
+
+func TestRespondErrorValidation(t *testing.T) {
+	err := services.ValidationErrors{
+		services.NewValidationError("artist", "is required"),
+		services.NewValidationError("format", "is required"),
+	}
+	w, problem := renderError(t, fmt.Errorf("invalid album: %w", err))
+
+	if w.Code != http.StatusBadRequest || problem.Code != "validation_failed" {
+		t.Errorf("got %d %q, want 400 validation_failed", w.Code, problem.Code)
+	}
+	want := []FieldError{{"artist", "is required"}, {"format", "is required"}}
+	if len(problem.Errors) != len(want) {
+		t.Fatalf("errors = %+v, want %+v", problem.Errors, want)
+	}
+	for i := range want {
+		if problem.Errors[i] != want[i] {
+			t.Errorf("errors[%d] = %+v, want %+v", i, problem.Errors[i], want[i])
+		}
+	}
+}
+
+func TestRespondBindError(t *testing.T) {
+	router := gin.New()
+	router.POST("/register", func(c *gin.Context) {
+		var req RegisterRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantCode   string
+		wantFields []string
+	}{
+		{
+			name:       "missing and invalid fields",
+			body:       `{"username": "alice", "email": "not-an-email"}`,
+			wantCode:   "validation_failed",
+			wantFields: []string{"registration_key", "email", "password"},
+		},
+		{
+			name:     "malformed body",
+			body:     `{"username": `,
+			wantCode: "malformed_request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			var problem Problem
+			if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("response is not a problem: %v", err)
+			}
+			if w.Code != http.StatusBadRequest || problem.Code != tt.wantCode {
+				t.Errorf("got %d %q, want 400 %q", w.Code, problem.Code, tt.wantCode)
+			}
+
+			var fields []string
+			for _, fieldErr := range problem.Errors {
+				fields = append(fields, fieldErr.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
@@ -1,30 +1,44 @@
 package handlers
 
 import (
+	"fmt"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"vinyl-vault/internal/logging"
+	"vinyl-vault/internal/metrics"
 	"vinyl-vault/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 type FileHandler struct {
-	fileService  *services.FileService
-	trackService *services.TrackService
-	albumService *services.AlbumService
+	fileService       *services.FileService
+	trackService      *services.TrackService
+	albumService      *services.AlbumService
+	splitService      *services.SplitService
+	userService       *services.UserService
+	conversionService *services.ConversionService
 }
 
 func NewFileHandler(
 	fileService *services.FileService,
 	trackService *services.TrackService,
 	albumService *services.AlbumService,
+	splitService *services.SplitService,
+	userService *services.UserService,
+	conversionService *services.ConversionService,
 ) *FileHandler {
 	return &FileHandler{
-		fileService:  fileService,
-		trackService: trackService,
-		albumService: albumService,
+		fileService:       fileService,
+		trackService:      trackService,
+		albumService:      albumService,
+		splitService:      splitService,
+		userService:       userService,
+		conversionService: conversionService,
 	}
 }
 
@@ -32,49 +46,64 @@ func (h *FileHandler) RegisterFileRoutes(router *gin.RouterGroup) {
 	router.GET("/track/:id/stream", h.StreamTrack)
 	router.GET("/track/:id/download", h.DownloadTrack)
 	router.GET("/album/:id/cover", h.ServeCoverArt)
+	router.GET("/conversion/presets", h.ListConversionPresets)
 }
 
 func (h *FileHandler) StreamTrack(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+	// any authenticated user may stream, as they may download
+	if _, exists := c.Get("user_id"); !exists {
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	trackID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid track id"})
+		respondInvalidParam(c, "id")
 		return
 	}
 
 	// Get track
 	track, err := h.trackService.GetTrack(c.Request.Context(), uint64(trackID))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "track not found"})
+		RespondError(c, err)
 		return
 	}
 
 	// Get album
 	album, err := h.albumService.GetAlbum(c.Request.Context(), track.AlbumID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "album not found"})
+		RespondError(c, err)
 		return
 	}
 
-	_ = userID
-	_ = album
-
-	fullPath := h.fileService.GetFullPath(track.FilePath)
+	if track.Blob == nil {
+		RespondError(c, services.ErrFileNotFound)
+		return
+	}
+	mode, err := services.ParseNormalization(c.Query("normalize"))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	if mode != "" {
+		countStream(c, func() { h.serveNormalizedTrack(c, album, track, mode) })
+		return
+	}
+	if track.IsSplit() {
+		countStream(c, func() { h.serveSplitTrack(c, track) })
+		return
+	}
+	fullPath := h.fileService.GetFullPath(track.Blob.Path)
 
 	if !h.fileService.FileExists(fullPath) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "audio file not found"})
+		RespondError(c, services.ErrFileNotFound)
 		return
 	}
 
 	// Get file info
 	fileInfo, err := os.Stat(fullPath)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to access file"})
+		RespondError(c, fmt.Errorf("failed to access file: %w", err))
 		return
 	}
 
@@ -84,82 +113,238 @@ func (h *FileHandler) StreamTrack(c *gin.Context) {
 	c.Header("Accept-Ranges", "bytes")
 	c.Header("Cache-Control", "no-cache")
 
-	// Handle range requests for seeking
-	rangeHeader := c.GetHeader("Range")
-	if rangeHeader != "" {
-		// Serve partial content for range requests
-		c.File(fullPath)
-		return
-	}
+	// c.File answers Range requests with partial content, which is what seeking relies on
+	countStream(c, func() { c.File(fullPath) })
+}
 
-	// Serve full file
-	c.File(fullPath)
+// countStream runs serve as an active stream, counting the bytes it sent
+func countStream(c *gin.Context, serve func()) {
+	metrics.ActiveStreams.Inc()
+	defer metrics.ActiveStreams.Dec()
+	serve()
+	metrics.BytesServed.WithLabelValues("stream").Add(float64(max(c.Writer.Size(), 0)))
 }
 
 func (h *FileHandler) DownloadTrack(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	trackID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid track id"})
+		respondInvalidParam(c, "id")
 		return
 	}
 
 	// Get track
 	track, err := h.trackService.GetTrack(c.Request.Context(), uint64(trackID))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "track not found"})
+		RespondError(c, err)
 		return
 	}
 
 	// Get album to verify access
 	album, err := h.albumService.GetAlbum(c.Request.Context(), track.AlbumID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "album not found"})
+		RespondError(c, err)
 		return
 	}
 
 	// Check access (allowing all authenticated users per project goal)
-	_ = userID
-	_ = album
 
-	fullPath := h.fileService.GetFullPath(track.FilePath)
+	if track.Blob == nil {
+		RespondError(c, services.ErrFileNotFound)
+		return
+	}
+	original, err := queryBool(c, "original")
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	if original {
+		if c.Query("preset") != "" {
+			RespondError(c, services.NewValidationError("preset", "can't be combined with original"))
+			return
+		}
+		h.serveOriginal(c, album, track)
+		return
+	}
+	preset, err := h.downloadPreset(c, userID.(uint64))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	replayGain, err := queryReplayGain(c)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	cover, err := h.fileService.ReadCoverArt(album)
+	if err != nil {
+		cover = nil // the cover is a nicety; download the track without it
+	}
+	tags := services.NewTags(album, track, cover)
+	if replayGain {
+		tags.ReplayGain = services.NewReplayGain(album, track)
+	}
+	var audio *services.TrackAudio
+	if preset != nil {
+		audio, err = h.splitService.OpenConverted(c.Request.Context(), track, *preset, tags)
+	} else {
+		audio, err = h.splitService.OpenDownload(c.Request.Context(), track, tags)
+	}
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	defer audio.Close()
+
+	// The tags are written in as the file is read, so the stored file stays as it was
+	downloadName := services.SanitizeFilename(track.Title) + audio.Ext
+	c.Header("Content-Type", getContentType(audio.Ext))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": downloadName}))
+	modified := track.UpdatedAt
+	if album.UpdatedAt.After(modified) {
+		modified = album.UpdatedAt
+	}
+	http.ServeContent(c.Writer, c.Request, "", modified, audio)
+	metrics.BytesServed.WithLabelValues("download").Add(float64(max(c.Writer.Size(), 0)))
+}
 
-	// Verify file exists
-	if !h.fileService.FileExists(fullPath) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "audio file not found"})
+// downloadPreset picks the conversion preset a download asks for, or else the user's
+// default. It is nil for the stored file, which preset=none asks for whatever the
+// default; a default that is no longer configured is passed over.
+func (h *FileHandler) downloadPreset(c *gin.Context, userID uint64) (*services.ConversionPreset, error) {
+	name := c.Query("preset")
+	if strings.EqualFold(name, "none") {
+		return nil, nil
+	}
+	if name != "" {
+		preset, err := h.conversionService.Preset(name)
+		if err != nil {
+			return nil, err
+		}
+		return &preset, nil
+	}
+
+	user, err := h.userService.GetUser(c.Request.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.ConversionPreset == "" {
+		return nil, nil
+	}
+	preset, err := h.conversionService.Preset(user.ConversionPreset)
+	if err != nil {
+		logging.FromContext(c.Request.Context()).Warn("downloading track as stored, default conversion preset is gone",
+			"user_id", userID, "preset", user.ConversionPreset)
+		return nil, nil
+	}
+	return &preset, nil
+}
+
+// ListConversionPresets lists the presets downloads can be converted with
+func (h *FileHandler) ListConversionPresets(c *gin.Context) {
+	if _, exists := c.Get("user_id"); !exists {
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
+	c.JSON(http.StatusOK, gin.H{"presets": h.conversionService.Presets()})
+}
 
-	// Create a safe filename for download
-	ext := filepath.Ext(fullPath)
-	downloadName := services.SanitizeFilename(track.Title) + ext
+// serveOriginal serves a track as it was uploaded, rebuilding it from FLAC if it was
+// stored as one. Its tags are those of the upload.
+func (h *FileHandler) serveOriginal(c *gin.Context, album *services.Album, track *services.Track) {
+	audio, err := h.splitService.OpenOriginal(c.Request.Context(), track)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	defer audio.Close()
+
+	downloadName := services.SanitizeFilename(track.Title) + audio.Ext
+	c.Header("Content-Type", getContentType(audio.Ext))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": downloadName}))
+	modified := track.UpdatedAt
+	if album.UpdatedAt.After(modified) {
+		modified = album.UpdatedAt
+	}
+	http.ServeContent(c.Writer, c.Request, "", modified, audio)
+	metrics.BytesServed.WithLabelValues("download").Add(float64(max(c.Writer.Size(), 0)))
+}
 
-	// Serve file as attachment
-	c.FileAttachment(fullPath, downloadName)
+// serveSplitTrack cuts a track out of its side-long recording. http.ServeContent
+// answers Range requests on the cut just as c.File does on whole files.
+func (h *FileHandler) serveSplitTrack(c *gin.Context, track *services.Track) {
+	audio, err := h.splitService.OpenTrackAudio(c.Request.Context(), track)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	defer audio.Close()
+
+	c.Header("Content-Type", getContentType(audio.Ext))
+	c.Header("Cache-Control", "no-cache")
+	http.ServeContent(c.Writer, c.Request, "", track.UpdatedAt, audio)
+}
+
+// serveNormalizedTrack serves a track adjusted by its ReplayGain. The gain is applied
+// as the file is read, or into a temp file for formats that have to be re-encoded.
+func (h *FileHandler) serveNormalizedTrack(c *gin.Context, album *services.Album, track *services.Track, mode services.Normalization) {
+	audio, err := h.splitService.OpenNormalized(c.Request.Context(), album, track, mode)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	defer audio.Close()
+
+	modified := track.UpdatedAt
+	if album.UpdatedAt.After(modified) {
+		modified = album.UpdatedAt
+	}
+	c.Header("Content-Type", getContentType(audio.Ext))
+	c.Header("Cache-Control", "no-cache")
+	http.ServeContent(c.Writer, c.Request, "", modified, audio)
+}
+
+// queryReplayGain reads the replaygain parameter of a download, which asks for
+// ReplayGain tags alongside the album's
+func queryReplayGain(c *gin.Context) (bool, error) {
+	return queryBool(c, "replaygain")
+}
+
+// queryBool reads an optional true or false parameter
+func queryBool(c *gin.Context, name string) (bool, error) {
+	value := c.Query(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, services.NewValidationError(name, "must be true or false")
+	}
+	return b, nil
 }
 
 func (h *FileHandler) ServeCoverArt(c *gin.Context) {
 	albumID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid album id"})
+		respondInvalidParam(c, "id")
 		return
 	}
 
 	// Get album
 	album, err := h.albumService.GetAlbum(c.Request.Context(), uint64(albumID))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "album not found"})
+		RespondError(c, err)
 		return
 	}
 
 	// Check if album has cover art
 	if album.Metadata.CoverArtPath == "" {
-		c.JSON(http.StatusNotFound, gin.H{"error": "no cover art available"})
+		RespondError(c, services.ErrFileNotFound)
 		return
 	}
 
@@ -167,7 +352,7 @@ func (h *FileHandler) ServeCoverArt(c *gin.Context) {
 
 	// Verify file exists
 	if !h.fileService.FileExists(fullCoverArtPath) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "cover art file not found"})
+		RespondError(c, services.ErrFileNotFound)
 		return
 	}
 
@@ -195,6 +380,8 @@ func getContentType(filePath string) string {
 		return "audio/mp4"
 	case ".aiff":
 		return "audio/aiff"
+	case ".opus":
+		return "audio/ogg"
 	case ".alac":
 		return "audio/mp4"
 	default:
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"vinyl-vault/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	healthService *services.HealthService
+}
+
+func NewHealthHandler(healthService *services.HealthService) *HealthHandler {
+	return &HealthHandler{
+		healthService: healthService,
+	}
+}
+
+// RegisterHealthRoutes mounts the probes, which must stay outside the auth middleware,
+// and the diagnostics report, which must not
+func (h *HealthHandler) RegisterHealthRoutes(router *gin.Engine) {
+	router.GET("/healthz", h.Liveness)
+	router.GET("/readyz", h.Readiness)
+	router.GET("/admin/diagnostics", h.Diagnostics)
+}
+
+// Liveness answers as long as the process can serve requests at all
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness reports 503 while any dependency check fails. Errors are only logged,
+// the probe is unauthenticated and they mention paths.
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	report := h.healthService.Readiness(c.Request.Context())
+
+	checks := make(gin.H, len(report.Checks))
+	for _, check := range report.Checks {
+		checks[check.Name] = check.Status
+	}
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{"ready": report.Ready, "checks": checks})
+}
+
+// Diagnostics returns versions, settings, encoder support and library counts (admin only)
+func (h *HealthHandler) Diagnostics(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	diagnostics, err := h.healthService.Diagnostics(c.Request.Context(), userID.(uint64))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diagnostics)
+}
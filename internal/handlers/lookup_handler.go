@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"vinyl-vault/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ApplyReleaseRequest fills an album in from a release found by /releases/search,
+// creating a new album when album_id is left out
+type ApplyReleaseRequest struct {
+	Provider string `json:"provider" binding:"required"`
+	ID       string `json:"id" binding:"required"`
+	AlbumID  uint64 `json:"album_id"`
+}
+
+type LookupHandler struct {
+	lookupService *services.LookupService
+}
+
+func NewLookupHandler(lookupService *services.LookupService) *LookupHandler {
+	return &LookupHandler{
+		lookupService: lookupService,
+	}
+}
+
+func (h *LookupHandler) RegisterLookupRoutes(router *gin.RouterGroup) {
+	router.GET("/releases/providers", h.GetProviders)
+	router.GET("/releases/search", h.SearchReleases)
+	router.POST("/releases/apply", h.ApplyRelease)
+}
+
+// GetProviders lists the configured metadata providers, in the order they are searched
+func (h *LookupHandler) GetProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.lookupService.Providers()})
+}
+
+// SearchReleases looks releases up by barcode, catalog number, artist or title
+func (h *LookupHandler) SearchReleases(c *gin.Context) {
+	candidates, err := h.lookupService.SearchReleases(c.Request.Context(), services.ReleaseQuery{
+		Barcode:       c.Query("barcode"),
+		CatalogNumber: c.Query("catalog_number"),
+		Artist:        c.Query("artist"),
+		Title:         c.Query("title"),
+	}, c.Query("provider"))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, candidates)
+}
+
+func (h *LookupHandler) ApplyRelease(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	var req ApplyReleaseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	album, err := h.lookupService.ApplyRelease(c.Request.Context(), userID.(uint64), req.AlbumID, req.Provider, req.ID)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	status := http.StatusOK
+	if req.AlbumID == 0 {
+		status = http.StatusCreated
+	}
+	c.JSON(status, album)
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+	"vinyl-vault/api"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RegisterOpenAPIRoutes(router *gin.Engine) {
+	router.GET("/openapi.json", ServeOpenAPI)
+	router.GET("/export.schema.json", ServeExportSchema)
+}
+
+// ServeOpenAPI returns the API description, public so tooling can fetch it before logging in
+func ServeOpenAPI(c *gin.Context) {
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/json", api.OpenAPI)
+}
+
+// ServeExportSchema returns the JSON Schema of album exports, next to the API description
+// that refers to it
+func ServeExportSchema(c *gin.Context) {
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/schema+json", api.ExportSchema)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"vinyl-vault/api"
+	"vinyl-vault/internal/services"
+	"vinyl-vault/pkg"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pathParam turns gin's :id into OpenAPI's {id}
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(api.OpenAPI, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.1") {
+		t.Errorf("openapi = %q, want 3.1.x", spec.OpenAPI)
+	}
+
+	// handlers only touch their services when serving, so nil ones are enough to register
+	router := gin.New()
+	(&UserHandler{}).RegisterUserRoutes(router)
+	(&RegistrationKeyHandler{}).RegisterKeyRoutes(router)
+	(&ScrubHandler{}).RegisterScrubRoutes(router)
+	(&HealthHandler{}).RegisterHealthRoutes(router)
+	RegisterOpenAPIRoutes(router)
+	group := router.Group("")
+	(&AlbumHandler{}).RegisterAlbumRoutes(group)
+	(&TrackHandler{}).RegisterTrackRoutes(group)
+	(&FileHandler{}).RegisterFileRoutes(group)
+	(&TrashHandler{}).RegisterTrashRoutes(group)
+	(&LookupHandler{}).RegisterLookupRoutes(group)
+	(&AnalysisHandler{}).RegisterAnalysisRoutes(group)
+	(&SpectrogramHandler{}).RegisterSpectrogramRoutes(group)
+
+	documented := 0
+	for _, operations := range spec.Paths {
+		documented += len(operations)
+	}
+	routes := router.Routes()
+	if documented != len(routes) {
+		t.Errorf("openapi.json documents %d operations, the router has %d routes", documented, len(routes))
+	}
+
+	for _, route := range routes {
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		if _, ok := spec.Paths[path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("openapi.json does not document %s %s", route.Method, path)
+		}
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	router := gin.New()
+	RegisterOpenAPIRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("GET /openapi.json = %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w.Body.Len() != len(api.OpenAPI) {
+		t.Errorf("served %d bytes, want %d", w.Body.Len(), len(api.OpenAPI))
+	}
+}
+
+func TestExportSchemaCoversExport(t *testing.T) {
+	type object struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	var schema struct {
+		object
+		Defs map[string]object `json:"$defs"`
+	}
+	if err := json.Unmarshal(api.ExportSchema, &schema); err != nil {
+		t.Fatalf("export.schema.json is not valid JSON: %v", err)
+	}
+
+	for name, value := range map[string]any{
+		"":        services.Export{},
+		"Release": services.ExportRelease{},
+		"Matrix":  pkg.Matrix{},
+		"Medium":  services.Medium{},
+		"Track":   services.ExportTrack{},
+		"Credit":  pkg.Credit{},
+	} {
+		properties := schema.Properties
+		if name != "" {
+			properties = schema.Defs[name].Properties
+		}
+		typ := reflect.TypeOf(value)
+		for i := range typ.NumField() {
+			tag, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			if tag == "-" {
+				continue
+			}
+			if _, ok := properties[tag]; !ok {
+				t.Errorf("export.schema.json does not describe %s.%s", typ.Name(), tag)
+			}
+		}
+		if len(properties) > typ.NumField() {
+			t.Errorf("export.schema.json describes %d properties of %s, it has %d fields", len(properties), typ.Name(), typ.NumField())
+		}
+	}
+}
@@ -37,13 +37,13 @@ func (h *RegistrationKeyHandler) RegisterKeyRoutes(router *gin.Engine) {
 func (h *RegistrationKeyHandler) ValidateKey(c *gin.Context) {
 	var req ValidateKeyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	key, err := h.keyService.ValidateKey(c.Request.Context(), req.Key)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "valid": false})
+		RespondError(c, err)
 		return
 	}
 
@@ -58,19 +58,19 @@ func (h *RegistrationKeyHandler) ValidateKey(c *gin.Context) {
 func (h *RegistrationKeyHandler) GenerateKey(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	var req GenerateKeyRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	key, err := h.keyService.GenerateKey(c.Request.Context(), userID.(uint64), req.ExpirationHours)
 	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 
@@ -85,13 +85,13 @@ func (h *RegistrationKeyHandler) GenerateKey(c *gin.Context) {
 func (h *RegistrationKeyHandler) GetMyKeys(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	keys, err := h.keyService.GetKeysByCreator(c.Request.Context(), userID.(uint64))
 	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 
@@ -102,18 +102,18 @@ func (h *RegistrationKeyHandler) GetMyKeys(c *gin.Context) {
 func (h *RegistrationKeyHandler) DeleteKey(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	keyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid key id"})
+		respondInvalidParam(c, "id")
 		return
 	}
 
 	if err = h.keyService.DeleteKey(c.Request.Context(), uint64(keyID), userID.(uint64)); err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"vinyl-vault/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScrubHandler struct {
+	scrubService *services.ScrubService
+}
+
+func NewScrubHandler(scrubService *services.ScrubService) *ScrubHandler {
+	return &ScrubHandler{
+		scrubService: scrubService,
+	}
+}
+
+func (h *ScrubHandler) RegisterScrubRoutes(router *gin.Engine) {
+	router.GET("/admin/scrub", h.GetLastReport)
+	router.POST("/admin/scrub", h.StartScrub)
+}
+
+// GetLastReport returns the latest library integrity report (admin only)
+func (h *ScrubHandler) GetLastReport(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	report, err := h.scrubService.GetLastReport(c.Request.Context(), userID.(uint64))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// StartScrub kicks off an on-demand scrub in the background (admin only)
+func (h *ScrubHandler) StartScrub(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	if err := h.scrubService.StartScrub(c.Request.Context(), userID.(uint64)); err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "scrub started"})
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"mime"
+	"strconv"
+	"vinyl-vault/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SpectrogramHandler struct {
+	trackService       *services.TrackService
+	albumService       *services.AlbumService
+	spectrogramService *services.SpectrogramService
+}
+
+func NewSpectrogramHandler(
+	trackService *services.TrackService,
+	albumService *services.AlbumService,
+	spectrogramService *services.SpectrogramService,
+) *SpectrogramHandler {
+	return &SpectrogramHandler{
+		trackService:       trackService,
+		albumService:       albumService,
+		spectrogramService: spectrogramService,
+	}
+}
+
+func (h *SpectrogramHandler) RegisterSpectrogramRoutes(router *gin.RouterGroup) {
+	router.GET("/track/:id/spectrogram", h.ServeSpectrogram)
+}
+
+// ServeSpectrogram serves a PNG spectrogram of a track to anyone who may stream it,
+// drawing it first if it isn't cached, which takes as long as decoding the track
+func (h *SpectrogramHandler) ServeSpectrogram(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	trackID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondInvalidParam(c, "id")
+		return
+	}
+	opts, err := services.ParseSpectrogramOptions(c.Query("fft_size"), c.Query("scale"))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	track, err := h.trackService.GetTrack(c.Request.Context(), uint64(trackID))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	// Get album to verify access, as streaming does
+	if _, err = h.albumService.GetAlbum(c.Request.Context(), track.AlbumID); err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	_ = userID
+
+	path, err := h.spectrogramService.Render(c.Request.Context(), track, opts)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	filename := services.SanitizeFilename(track.Title) + ".png"
+	c.Header("Content-Type", "image/png")
+	c.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+	c.Header("Cache-Control", "no-cache")
+	c.File(path)
+}
@@ -1,43 +1,90 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"vinyl-vault/internal/services"
 	"vinyl-vault/pkg"
 
 	"github.com/gin-gonic/gin"
 )
 
+// CreateTrackRequest comes as multipart form fields next to the audio_file upload,
+// or as JSON when sha256 names content the user already stores. In a form,
+// audio_quality is a JSON object.
 type CreateTrackRequest struct {
-	AlbumID      uint64           `json:"album_id" binding:"required"`
-	TrackNumber  int              `json:"track_number" binding:"required"`
-	Title        string           `json:"title" binding:"required"`
-	Duration     pkg.Duration     `json:"duration"`
-	AudioQuality pkg.AudioQuality `json:"audio_quality"`
+	AlbumID      uint64           `json:"album_id" form:"album_id" binding:"required"`
+	DiscNumber   int              `json:"disc_number" form:"disc_number"` // defaults to the first disc
+	Side         string           `json:"side" form:"side"`
+	TrackNumber  int              `json:"track_number" form:"track_number" binding:"required"`
+	Title        string           `json:"title" form:"title" binding:"required"`
+	Duration     pkg.Duration     `json:"duration" form:"duration"`
+	AudioQuality pkg.AudioQuality `json:"audio_quality" form:"audio_quality"`
+	SHA256       string           `json:"sha256" form:"sha256"` // skips the upload when the user already stores this content
 }
 
+// maxCueSheetSize is far beyond any real sheet, which is a few kilobytes
+const maxCueSheetSize = 1 << 20
+
 type UpdateTrackRequest struct {
+	DiscNumber   *int              `json:"disc_number,omitempty"`
+	Side         *string           `json:"side,omitempty"`
 	TrackNumber  *int              `json:"track_number,omitempty"`
 	Title        *string           `json:"title,omitempty"`
 	Duration     *int              `json:"duration,omitempty"`
 	AudioQuality *pkg.AudioQuality `json:"audio_quality,omitempty"`
+	Credits      []pkg.Credit      `json:"credits,omitempty"` // replaces them; [] clears them
+}
+
+// SplitTracksRequest comes as multipart form fields next to the audio_file upload of
+// a side-long recording. The tracks start at the times of either a CUE sheet, sent
+// as text or as a cue_sheet file, or of points, a JSON array such as
+// [{"title": "Paperhouse", "start": "0:00"}, {"title": "Mushroom", "start": "7:28.2"}].
+type SplitTracksRequest struct {
+	AlbumID          uint64 `form:"album_id" binding:"required"`
+	SHA256           string `form:"sha256"`
+	CueSheet         string `form:"cue_sheet"`
+	Points           string `form:"points"`
+	DiscNumber       int    `form:"disc_number"` // of the recording, with side
+	Side             string `form:"side"`
+	FirstTrackNumber int    `form:"first_track_number"` // defaults to after the last track on the side
+	Materialize      bool   `form:"materialize"`        // store each track as a file of its own
+}
+
+type splitPointRequest struct {
+	Title string `json:"title"`
+	Start string `json:"start"`
 }
 
 type TrackHandler struct {
 	trackService *services.TrackService
 	fileService  *services.FileService
+	blobService  *services.BlobService
+	splitService *services.SplitService
 }
 
-func NewTrackHandler(trackService *services.TrackService, fileService *services.FileService) *TrackHandler {
+func NewTrackHandler(
+	trackService *services.TrackService,
+	fileService *services.FileService,
+	blobService *services.BlobService,
+	splitService *services.SplitService,
+) *TrackHandler {
 	return &TrackHandler{
 		trackService: trackService,
 		fileService:  fileService,
+		blobService:  blobService,
+		splitService: splitService,
 	}
 }
 
 func (h *TrackHandler) RegisterTrackRoutes(router *gin.RouterGroup) {
 	router.POST("/track", h.CreateTrack)
+	router.POST("/track/split", h.SplitTracks)
 	router.GET("/track/:id", h.GetTrack)
 	router.PUT("/track/:id", h.UpdateTrack)
 	router.DELETE("/track/:id", h.DeleteTrack)
@@ -47,35 +94,19 @@ func (h *TrackHandler) CreateTrack(c *gin.Context) {
 
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	var req CreateTrackRequest
 	if err := c.ShouldBind(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// get uploaded audio file
-	file, err := c.FormFile("audio_file")
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "audio file required"})
-		return
-	}
-
-	// save audio file
-	result, err := h.fileService.SaveTrackAudioFile(file, req.AlbumID, req.TrackNumber, req.Title)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
-	// conversion to relative path before storing
-	relativePath, err := h.fileService.GetRelativePath(result.Path)
+	blob, err := h.resolveAudioBlob(c, userID.(uint64), req.SHA256)
 	if err != nil {
-		h.fileService.DeleteAudioFile(result.Path)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to process file path"})
+		RespondError(c, err)
 		return
 	}
 
@@ -83,31 +114,140 @@ func (h *TrackHandler) CreateTrack(c *gin.Context) {
 		c.Request.Context(),
 		userID.(uint64),
 		req.AlbumID,
-		req.TrackNumber,
+		services.TrackPosition{DiscNumber: req.DiscNumber, Side: req.Side, TrackNumber: req.TrackNumber},
 		req.Title,
 		req.Duration,
-		relativePath,
+		blob.ID,
 		req.AudioQuality,
 	)
 	if err != nil {
-		// cleanup file if track creation fails
-		h.fileService.DeleteAudioFile(result.Path)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		// drop our reference if track creation fails
+		h.blobService.ReleaseBlob(c.Request.Context(), userID.(uint64), blob.ID)
+		RespondError(c, err)
 		return
 	}
+	track.Blob = blob
 	c.JSON(http.StatusCreated, track)
 }
 
+// resolveAudioBlob reuses content the user already stores when the client sends its hash,
+// otherwise it stores the uploaded audio file.
+func (h *TrackHandler) resolveAudioBlob(c *gin.Context, userID uint64, hash string) (*services.Blob, error) {
+	if hash != "" {
+		blob, err := h.blobService.AcquireOwnedByHash(c.Request.Context(), userID, strings.ToLower(hash))
+		if err == nil {
+			return blob, nil
+		}
+		if !errors.Is(err, services.ErrBlobNotFound) {
+			return nil, err
+		}
+	}
+
+	file, err := c.FormFile("audio_file")
+	if err != nil {
+		return nil, services.NewValidationError("audio_file", "is required")
+	}
+
+	result, err := h.fileService.SaveTrackAudioFile(c.Request.Context(), userID, file)
+	if err != nil {
+		return nil, err
+	}
+	return h.blobService.Acquire(c.Request.Context(), userID, result)
+}
+
+// SplitTracks creates several tracks from one recording of a whole side
+func (h *TrackHandler) SplitTracks(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	var req SplitTracksRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	points, err := splitPoints(c, &req)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	blob, err := h.resolveAudioBlob(c, userID.(uint64), req.SHA256)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	// the split service releases the blob if it fails
+	tracks, err := h.splitService.Split(c.Request.Context(), userID.(uint64), req.AlbumID, blob, points,
+		services.SplitOptions{
+			DiscNumber:       req.DiscNumber,
+			Side:             req.Side,
+			FirstTrackNumber: req.FirstTrackNumber,
+			Materialize:      req.Materialize,
+		})
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, tracks)
+}
+
+// splitPoints reads the track start times from the CUE sheet or the points field
+func splitPoints(c *gin.Context, req *SplitTracksRequest) ([]services.SplitPoint, error) {
+	if file, err := c.FormFile("cue_sheet"); err == nil {
+		src, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open CUE sheet: %w", err)
+		}
+		defer src.Close()
+		content, err := io.ReadAll(io.LimitReader(src, maxCueSheetSize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CUE sheet: %w", err)
+		}
+		req.CueSheet = string(content)
+	}
+
+	switch {
+	case req.CueSheet != "" && req.Points != "":
+		return nil, services.NewValidationError("points", "send either a CUE sheet or points, not both")
+	case req.CueSheet != "":
+		sheet, err := services.ParseCueSheet(strings.NewReader(req.CueSheet))
+		if err != nil {
+			return nil, err
+		}
+		return sheet.SplitPoints(), nil
+	case req.Points != "":
+		var raw []splitPointRequest
+		if err := json.Unmarshal([]byte(req.Points), &raw); err != nil {
+			return nil, services.NewValidationError("points", "must be a JSON array of {title, start}")
+		}
+		points := make([]services.SplitPoint, len(raw))
+		for i, point := range raw {
+			start, err := services.ParseTimestamp(point.Start)
+			if err != nil {
+				return nil, services.NewValidationError("points", fmt.Sprintf("track %d: %v", i+1, err))
+			}
+			points[i] = services.SplitPoint{Title: point.Title, Start: start}
+		}
+		return points, nil
+	}
+	return nil, services.NewValidationError("cue_sheet", "a CUE sheet or points are required")
+}
+
 func (h *TrackHandler) GetTrack(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		respondInvalidParam(c, "id")
 		return
 	}
 
 	track, err := h.trackService.GetTrack(c.Request.Context(), uint64(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, track)
@@ -116,13 +256,13 @@ func (h *TrackHandler) GetTrack(c *gin.Context) {
 func (h *TrackHandler) GetAlbumTracks(c *gin.Context) {
 	albumID, err := strconv.ParseInt(c.Param("album_id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid album id"})
+		respondInvalidParam(c, "album_id")
 		return
 	}
 
 	tracks, err := h.trackService.GetTracksByAlbum(c.Request.Context(), uint64(albumID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, tracks)
@@ -132,19 +272,19 @@ func (h *TrackHandler) UpdateTrack(c *gin.Context) {
 
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		respondInvalidParam(c, "id")
 		return
 	}
 
 	var req UpdateTrackRequest
 	if err = c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -152,13 +292,16 @@ func (h *TrackHandler) UpdateTrack(c *gin.Context) {
 		c.Request.Context(),
 		userID.(uint64),
 		uint64(id),
+		req.DiscNumber,
+		req.Side,
 		req.TrackNumber,
 		req.Title,
 		req.Duration,
 		req.AudioQuality,
+		req.Credits,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, track)
@@ -168,18 +311,18 @@ func (h *TrackHandler) DeleteTrack(c *gin.Context) {
 
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		respondInvalidParam(c, "id")
 		return
 	}
 	err = h.trackService.DeleteTrack(c.Request.Context(), userID.(uint64), uint64(id))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 	c.Status(http.StatusNoContent)
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"vinyl-vault/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TrashHandler struct {
+	trashService *services.TrashService
+}
+
+func NewTrashHandler(trashService *services.TrashService) *TrashHandler {
+	return &TrashHandler{
+		trashService: trashService,
+	}
+}
+
+func (h *TrashHandler) RegisterTrashRoutes(router *gin.RouterGroup) {
+	router.GET("/trash", h.GetTrash)
+	router.POST("/trash/album/:id/restore", h.RestoreAlbum)
+	router.POST("/trash/track/:id/restore", h.RestoreTrack)
+	router.DELETE("/trash/album/:id", h.PurgeAlbum)
+	router.DELETE("/trash/track/:id", h.PurgeTrack)
+}
+
+// GetTrash lists the current user's deleted albums and tracks
+func (h *TrashHandler) GetTrash(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	trash, err := h.trashService.GetTrash(c.Request.Context(), userID.(uint64))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, trash)
+}
+
+func (h *TrashHandler) RestoreAlbum(c *gin.Context) {
+	h.handleTrashAction(c, h.trashService.RestoreAlbum, http.StatusOK)
+}
+
+func (h *TrashHandler) RestoreTrack(c *gin.Context) {
+	h.handleTrashAction(c, h.trashService.RestoreTrack, http.StatusOK)
+}
+
+// PurgeAlbum permanently deletes a trashed album, its tracks and their media
+func (h *TrashHandler) PurgeAlbum(c *gin.Context) {
+	h.handleTrashAction(c, h.trashService.PurgeAlbum, http.StatusNoContent)
+}
+
+// PurgeTrack permanently deletes a trashed track and its media
+func (h *TrashHandler) PurgeTrack(c *gin.Context) {
+	h.handleTrashAction(c, h.trashService.PurgeTrack, http.StatusNoContent)
+}
+
+func (h *TrashHandler) handleTrashAction(
+	c *gin.Context, action func(ctx context.Context, userID, id uint64) error, successStatus int,
+) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondInvalidParam(c, "id")
+		return
+	}
+
+	if err = action(c.Request.Context(), userID.(uint64), uint64(id)); err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	if successStatus == http.StatusNoContent {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	c.JSON(successStatus, gin.H{"message": "restored successfully"})
+}
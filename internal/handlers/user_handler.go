@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
 	"vinyl-vault/internal/services"
 
 	"github.com/gin-contrib/sessions"
@@ -25,7 +27,7 @@ type UpdateUsernameRequest struct {
 }
 
 type UpdateEmailRequest struct {
-	Email string `json:"email" binding:"required, email"`
+	Email string `json:"email" binding:"required,email"`
 }
 
 type ChangePasswordRequest struct {
@@ -33,15 +35,31 @@ type ChangePasswordRequest struct {
 	NewPassword string `json:"new_password" binding:"required"`
 }
 
+type UpdateConversionPresetRequest struct {
+	// Preset names the conversion preset downloads default to, empty for the stored file
+	Preset string `json:"preset"`
+}
+
+type SetQuotaRequest struct {
+	// Quota in bytes, null reverts the user to the instance default
+	Quota *int64 `json:"quota"`
+}
+
 type UserHandler struct {
-	userService *services.UserService
-	keyService  *services.RegistrationKeyService
+	userService  *services.UserService
+	keyService   *services.RegistrationKeyService
+	quotaService *services.QuotaService
 }
 
-func NewUserHandler(userService *services.UserService, keyService *services.RegistrationKeyService) *UserHandler {
+func NewUserHandler(
+	userService *services.UserService,
+	keyService *services.RegistrationKeyService,
+	quotaService *services.QuotaService,
+) *UserHandler {
 	return &UserHandler{
-		userService: userService,
-		keyService:  keyService,
+		userService:  userService,
+		keyService:   keyService,
+		quotaService: quotaService,
 	}
 }
 
@@ -54,30 +72,33 @@ func (h *UserHandler) RegisterUserRoutes(router *gin.Engine) {
 	// impl. dans main
 	router.POST("/logout", h.Logout)
 	router.GET("/user/me", h.GetCurrentUser)
+	router.GET("/user/me/usage", h.GetStorageUsage)
 	router.PUT("/user/username", h.UpdateUsername)
 	router.PUT("/user/email", h.UpdateEmail)
 	router.PUT("/user/password", h.ChangePassword)
+	router.PUT("/user/conversion-preset", h.UpdateConversionPreset)
 	router.DELETE("/user", h.DeleteUser)
+	router.PUT("/admin/user/:id/quota", h.SetQuota)
 }
 
 func (h *UserHandler) Register(c *gin.Context) {
 	var req RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	// key validation
 	regKey, err := h.keyService.ValidateKey(c.Request.Context(), req.RegistrationKey)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 
 	// create user
 	user, err := h.userService.Register(c.Request.Context(), req.Username, req.Email, req.Password)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 
@@ -96,13 +117,13 @@ func (h *UserHandler) Register(c *gin.Context) {
 func (h *UserHandler) Login(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	user, err := h.userService.Login(c.Request.Context(), req.Username, req.Password)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		RespondError(c, err)
 		return
 	}
 
@@ -111,7 +132,7 @@ func (h *UserHandler) Login(c *gin.Context) {
 	session.Set("is_admin", user.IsAdmin)
 
 	if err = session.Save(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
+		RespondError(c, fmt.Errorf("failed to create session: %w", err))
 		return
 	}
 
@@ -122,7 +143,7 @@ func (h *UserHandler) Logout(c *gin.Context) {
 	session := sessions.Default(c)
 	session.Clear()
 	if err := session.Save(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to logout"})
+		RespondError(c, fmt.Errorf("failed to logout: %w", err))
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "logged out successfully"})
@@ -131,13 +152,13 @@ func (h *UserHandler) Logout(c *gin.Context) {
 func (h *UserHandler) GetCurrentUser(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	user, err := h.userService.GetUser(c.Request.Context(), userID.(uint64))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 
@@ -147,19 +168,19 @@ func (h *UserHandler) GetCurrentUser(c *gin.Context) {
 func (h *UserHandler) UpdateUsername(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	var req UpdateUsernameRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	user, err := h.userService.UpdateUsername(c.Request.Context(), userID.(uint64), req.Username)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 
@@ -169,19 +190,19 @@ func (h *UserHandler) UpdateUsername(c *gin.Context) {
 func (h *UserHandler) UpdateEmail(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	var req UpdateEmailRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	user, err := h.userService.UpdateEmail(c.Request.Context(), userID.(uint64), req.Email)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 
@@ -191,34 +212,57 @@ func (h *UserHandler) UpdateEmail(c *gin.Context) {
 func (h *UserHandler) ChangePassword(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 
 	var req ChangePasswordRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
 	err := h.userService.ChangePassword(c.Request.Context(), userID.(uint64), req.OldPassword, req.NewPassword)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "password changed successfully"})
 }
 
+// UpdateConversionPreset sets the conversion preset the current user's downloads default to
+func (h *UserHandler) UpdateConversionPreset(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	var req UpdateConversionPresetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	user, err := h.userService.UpdateConversionPreset(c.Request.Context(), userID.(uint64), req.Preset)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
+
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not authenticated"})
+		RespondError(c, services.ErrUnauthorized)
 		return
 	}
 	if err := h.userService.DeleteUser(c.Request.Context(), userID.(uint64)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		RespondError(c, err)
 		return
 	}
 	session := sessions.Default(c)
@@ -227,3 +271,49 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// GetStorageUsage reports the current user's storage usage by album and format
+func (h *UserHandler) GetStorageUsage(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	usage, err := h.quotaService.GetUsage(c.Request.Context(), userID.(uint64))
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// SetQuota overrides a user's storage quota (admin only)
+func (h *UserHandler) SetQuota(c *gin.Context) {
+	adminID, exists := c.Get("user_id")
+	if !exists {
+		RespondError(c, services.ErrUnauthorized)
+		return
+	}
+
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		respondInvalidParam(c, "id")
+		return
+	}
+
+	var req SetQuotaRequest
+	if err = c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	user, err := h.quotaService.SetQuota(c.Request.Context(), adminID.(uint64), uint64(userID), req.Quota)
+	if err != nil {
+		RespondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
+}
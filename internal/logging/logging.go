@@ -0,0 +1,52 @@
+// Package logging builds the application's slog logger and carries it through
+// contexts, together with the ID of the request being served.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"vinyl-vault/internal/config"
+)
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestIDKey
+)
+
+// New returns a JSON logger in production, where logs are collected by machines,
+// and a human-readable text logger everywhere else
+func New(w io.Writer, cfg *config.Config) *slog.Logger {
+	options := &slog.HandlerOptions{Level: slog.LevelInfo}
+	if cfg.IsProduction() {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+	options.Level = slog.LevelDebug
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// WithLogger returns a copy of ctx that carries logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// WithRequestID returns a copy of ctx that carries the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the ID of the request ctx belongs to, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
@@ -0,0 +1,180 @@
+// Package metrics defines the Prometheus metrics vinyl-vault exports. The collectors
+// are package-level so services and handlers can record without having them injected;
+// they live in their own registry, served by Handler.
+package metrics
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "vinylvault"
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time spent serving HTTP requests, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	// BytesServed counts media sent to clients, by kind: stream, download or archive
+	BytesServed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "served_bytes_total",
+		Help:      "Media bytes sent to clients, by kind (stream, download, archive).",
+	}, []string{"kind"})
+
+	ActiveStreams = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_streams",
+		Help:      "Tracks currently being streamed.",
+	})
+
+	ConversionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "conversion_duration_seconds",
+		Help:      "Time taken by successful ffmpeg conversions, by target format.",
+		Buckets:   []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"format"})
+
+	ConversionFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conversion_failures_total",
+		Help:      "Failed ffmpeg conversions, by target format.",
+	}, []string{"format"})
+
+	AnalysisDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "analysis_duration_seconds",
+		Help:      "Time taken to analyze a track's audio after ingest.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	})
+
+	AnalysisFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "analysis_failures_total",
+		Help:      "Track analyses that failed, or were dropped with the queue full.",
+	})
+
+	ArchiveBuildDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "archive_build_duration_seconds",
+		Help:      "Time taken to build album zip archives.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPRequestDuration,
+		BytesServed,
+		ActiveStreams,
+		ConversionDuration,
+		ConversionFailures,
+		AnalysisDuration,
+		AnalysisFailures,
+		ArchiveBuildDuration,
+	)
+}
+
+// RegisterDatabase exports the connection pool stats of db
+func RegisterDatabase(db *sql.DB) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// StorageStats reports how many blobs the store holds and their total size
+type StorageStats func(ctx context.Context) (blobs int64, bytes int64, err error)
+
+// RegisterStorage exports the blob store's usage, read from stats on every scrape
+func RegisterStorage(stats StorageStats) error {
+	return Registry.Register(&storageCollector{stats: stats})
+}
+
+// storageQueryTimeout bounds the usage query so a slow database can't stall scrapes
+const storageQueryTimeout = 5 * time.Second
+
+type storageCollector struct {
+	stats StorageStats
+}
+
+var (
+	storageBlobsDesc = prometheus.NewDesc(namespace+"_storage_blobs", "Files in the blob store.", nil, nil)
+	storageBytesDesc = prometheus.NewDesc(namespace+"_storage_bytes", "Total size of the blob store.", nil, nil)
+)
+
+func (s *storageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- storageBlobsDesc
+	ch <- storageBytesDesc
+}
+
+func (s *storageCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), storageQueryTimeout)
+	defer cancel()
+
+	blobs, bytes, err := s.stats(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(storageBlobsDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(storageBlobsDesc, prometheus.GaugeValue, float64(blobs))
+	ch <- prometheus.MustNewConstMetric(storageBytesDesc, prometheus.GaugeValue, float64(bytes))
+}
+
+// Handler serves the registry in the Prometheus format. A non-empty token
+// must be presented as a bearer token.
+func Handler(token string) http.Handler {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Serve runs a dedicated /metrics listener on addr until ctx is cancelled
+func Serve(ctx context.Context, addr, token string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler(token))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
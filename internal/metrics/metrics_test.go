@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, token, authorization string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	Handler(token).ServeHTTP(w, req)
+	return w
+}
+
+func TestHandlerToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "open", wantStatus: http.StatusOK},
+		{name: "valid token", token: "s3cret", authorization: "Bearer s3cret", wantStatus: http.StatusOK},
+		{name: "missing token", token: "s3cret", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", token: "s3cret", authorization: "Bearer guess", wantStatus: http.StatusUnauthorized},
+		{name: "wrong scheme", token: "s3cret", authorization: "Basic s3cret", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := scrape(t, tt.token, tt.authorization); w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestExposition(t *testing.T) {
+	ConversionFailures.WithLabelValues("flac").Inc()
+	BytesServed.WithLabelValues("stream").Add(1024)
+	err := RegisterStorage(func(ctx context.Context) (int64, int64, error) {
+		return 3, 4096, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterStorage() error = %v", err)
+	}
+
+	body := scrape(t, "", "").Body.String()
+	for _, want := range []string{
+		`vinylvault_conversion_failures_total{format="flac"} 1`,
+		`vinylvault_served_bytes_total{kind="stream"} 1024`,
+		"vinylvault_storage_blobs 3",
+		"vinylvault_storage_bytes 4096",
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output is missing %q", want)
+		}
+	}
+}
@@ -1,8 +1,7 @@
 package middleware
 
 import (
-	"context"
-	"net/http"
+	"vinyl-vault/internal/handlers"
 	"vinyl-vault/internal/services"
 
 	"github.com/gin-contrib/sessions"
@@ -16,8 +15,7 @@ func AuthRequired() gin.HandlerFunc {
 		userID := session.Get("user_id")
 
 		if userID == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
-			c.Abort()
+			handlers.RespondError(c, services.ErrUnauthorized)
 			return
 		}
 
@@ -36,15 +34,17 @@ func AdminRequired(userRepo services.UserRepository) gin.HandlerFunc {
 
 			userID, exists := c.Get("user_id")
 			if !exists {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
-				c.Abort()
+				handlers.RespondError(c, services.ErrUnauthorized)
 				return
 			}
 
-			user, err := userRepo.FindByID(context.Background(), userID.(uint64))
-			if err != nil || !user.IsAdmin {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
-				c.Abort()
+			user, err := userRepo.FindByID(c.Request.Context(), userID.(uint64))
+			if err != nil {
+				handlers.RespondError(c, err)
+				return
+			}
+			if !user.IsAdmin {
+				handlers.RespondError(c, services.ErrAdminOnly)
 				return
 			}
 
@@ -0,0 +1,22 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+	"vinyl-vault/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics records the count and latency of requests per route
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := routeLabel(c)
+		method := c.Request.Method
+		metrics.HTTPRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"vinyl-vault/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestRouter(logs *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewJSONHandler(logs, nil))
+
+	router := gin.New()
+	router.Use(RequestID(logger), AccessLog())
+	router.GET("/album/:id", func(c *gin.Context) {
+		c.Set("user_id", uint64(7))
+		c.String(http.StatusOK, logging.RequestID(c.Request.Context()))
+	})
+	return router
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		wantSame bool
+	}{
+		{name: "generated", incoming: ""},
+		{name: "caller supplied", incoming: "edge-4f2a", wantSame: true},
+		{name: "unprintable replaced", incoming: "bad\nid"},
+		{name: "too long replaced", incoming: strings.Repeat("x", maxRequestIDLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/album/1", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			newTestRouter(&logs).ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if id == "" {
+				t.Fatal("response has no request ID")
+			}
+			if tt.wantSame != (id == tt.incoming) {
+				t.Errorf("request ID = %q, incoming %q", id, tt.incoming)
+			}
+			if body := w.Body.String(); body != id {
+				t.Errorf("context request ID = %q, header %q", body, id)
+			}
+		})
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var logs bytes.Buffer
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/album/42", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	newTestRouter(&logs).ServeHTTP(w, req)
+
+	var line map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("access log is not one JSON line: %v (%s)", err, logs.String())
+	}
+
+	want := map[string]any{
+		"msg":        "request",
+		"request_id": "req-1",
+		"method":     "GET",
+		"route":      "/album/:id",
+		"path":       "/album/42",
+		"status":     float64(http.StatusOK),
+		"bytes":      float64(len("req-1")),
+		"user_id":    float64(7),
+	}
+	for key, value := range want {
+		if line[key] != value {
+			t.Errorf("%s = %v, want %v", key, line[key], value)
+		}
+	}
+	if _, ok := line["latency"]; !ok {
+		t.Error("access log has no latency")
+	}
+}
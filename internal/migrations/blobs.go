@@ -0,0 +1,200 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+	"vinyl-vault/internal/logging"
+)
+
+// blobsVersion is the migration that moves media files into the blob store
+const blobsVersion = 2
+
+// BlobImporter copies the media files of an instance from before the blob store into it.
+// Paths are relative to the upload dir.
+type BlobImporter interface {
+	// Import copies a file into the blob store, failing with fs.ErrNotExist when it is missing
+	Import(path string) (ImportedBlob, error)
+	// Remove deletes an imported original once the migration is committed, or a copy of
+	// content the store already has under another name
+	Remove(path string) error
+}
+
+// ImportedBlob is a file copied into the blob store
+type ImportedBlob struct {
+	Hash string
+	Size int64
+	Path string
+}
+
+// SetBlobImporter has the blob store migration import the files of existing tracks and
+// covers. Without one it refuses to run while there are any.
+func (m *Migrator) SetBlobImporter(importer BlobImporter) {
+	m.importer = importer
+}
+
+// checkFiles stops the blob store migration while tracks or covers still point at files
+// outside it, which would be left with no blob
+func checkFiles(ctx context.Context, tx *sql.Tx) error {
+	var files int64
+	err := tx.QueryRowContext(ctx, `SELECT
+		(SELECT COUNT(*) FROM tracks WHERE blob_id IS NULL AND file_path <> '') +
+		(SELECT COUNT(*) FROM albums WHERE cover_blob_id IS NULL AND COALESCE(metadata_cover_art_path, '') <> '')`).Scan(&files)
+	if err != nil {
+		return fmt.Errorf("failed to count media files: %w", err)
+	}
+	if files > 0 {
+		return fmt.Errorf("%d tracks and album covers have files outside the blob store", files)
+	}
+	return nil
+}
+
+// fileImport moves the files of tracks and covers into the blob store within the
+// transaction of the blob store migration
+type fileImport struct {
+	tx       *sql.Tx
+	dialect  dialect
+	importer BlobImporter
+	blobs    map[string]uint64 // by original path, for files referenced more than once
+	imported []string          // original paths, to remove once committed
+}
+
+// importFiles gives every track and cover with a file a blob, counting one reference
+// each. Missing track files fail the import, as a track without a blob is taken for a
+// stub waiting for its audio; clearing a track's file_path keeps it as one on purpose.
+func importFiles(ctx context.Context, tx *sql.Tx, dialect dialect, importer BlobImporter) ([]string, error) {
+	i := &fileImport{tx: tx, dialect: dialect, importer: importer, blobs: make(map[string]uint64)}
+
+	tracks, err := i.paths(ctx, `SELECT id, file_path FROM tracks WHERE blob_id IS NULL AND file_path <> '' ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	var missing []uint64
+	for _, track := range tracks {
+		blobID, err := i.importFile(ctx, track.path)
+		if err != nil {
+			return nil, err
+		}
+		if blobID == 0 {
+			logging.FromContext(ctx).Error("track file is missing", "track_id", track.id, "path", track.path)
+			missing = append(missing, track.id)
+			continue
+		}
+		if _, err = tx.ExecContext(ctx, dialect.rebind(`UPDATE tracks SET blob_id = ? WHERE id = ?`), blobID, track.id); err != nil {
+			return nil, fmt.Errorf("failed to link track %d to its blob: %w", track.id, err)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("the files of tracks %v are missing: restore them, or clear the tracks' file_path to keep them without audio", missing)
+	}
+
+	covers, err := i.paths(ctx, `SELECT id, metadata_cover_art_path FROM albums
+		WHERE cover_blob_id IS NULL AND COALESCE(metadata_cover_art_path, '') <> '' ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	for _, album := range covers {
+		blobID, err := i.importFile(ctx, album.path)
+		if err != nil {
+			return nil, err
+		}
+		if blobID == 0 {
+			logging.FromContext(ctx).Warn("cover art file is missing", "album_id", album.id, "path", album.path)
+			continue
+		}
+		_, err = tx.ExecContext(ctx, dialect.rebind(`UPDATE albums SET cover_blob_id = ?,
+			metadata_cover_art_path = (SELECT path FROM blobs WHERE id = ?) WHERE id = ?`), blobID, blobID, album.id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to link album %d to its cover: %w", album.id, err)
+		}
+	}
+	return i.imported, nil
+}
+
+type pathRow struct {
+	id   uint64
+	path string
+}
+
+// paths reads a query's rows up front, as a transaction can't run statements while
+// it is reading rows on Postgres
+func (i *fileImport) paths(ctx context.Context, query string) ([]pathRow, error) {
+	rows, err := i.tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find media files: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []pathRow
+	for rows.Next() {
+		var row pathRow
+		if err = rows.Scan(&row.id, &row.path); err != nil {
+			return nil, fmt.Errorf("failed to find media files: %w", err)
+		}
+		paths = append(paths, row)
+	}
+	return paths, rows.Err()
+}
+
+// importFile adds a reference to the blob of the file at path, storing it first if its
+// content is new, and returns the blob's ID or 0 when the file is missing
+func (i *fileImport) importFile(ctx context.Context, path string) (uint64, error) {
+	if id, ok := i.blobs[path]; ok {
+		_, err := i.tx.ExecContext(ctx, i.dialect.rebind(`UPDATE blobs SET ref_count = ref_count + 1 WHERE id = ?`), id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to reference blob %d: %w", id, err)
+		}
+		return id, nil
+	}
+
+	blob, err := i.importer.Import(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to import %s: %w", path, err)
+	}
+
+	var id uint64
+	var storedPath string
+	err = i.tx.QueryRowContext(ctx, i.dialect.rebind(`SELECT id, path FROM blobs WHERE hash = ?`), blob.Hash).Scan(&id, &storedPath)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		now := time.Now().UTC()
+		err = i.tx.QueryRowContext(ctx, i.dialect.rebind(`INSERT INTO blobs (hash, size, path, ref_count, created_at, updated_at)
+			VALUES (?, ?, ?, 1, ?, ?) RETURNING id`), blob.Hash, blob.Size, blob.Path, now, now).Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to save blob of %s: %w", path, err)
+		}
+	case err != nil:
+		return 0, fmt.Errorf("failed to find blob of %s: %w", path, err)
+	default:
+		// the same content stored with another extension is kept once
+		if storedPath != blob.Path {
+			if err = i.importer.Remove(blob.Path); err != nil {
+				return 0, fmt.Errorf("failed to remove duplicate of %s: %w", path, err)
+			}
+		}
+		_, err = i.tx.ExecContext(ctx, i.dialect.rebind(`UPDATE blobs SET ref_count = ref_count + 1 WHERE id = ?`), id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to reference blob %d: %w", id, err)
+		}
+	}
+
+	i.blobs[path] = id
+	i.imported = append(i.imported, path)
+	return id, nil
+}
+
+// removeImported deletes the original files of a committed import, which are only left
+// behind if that fails
+func (m *Migrator) removeImported(ctx context.Context, paths []string) {
+	for _, path := range paths {
+		if err := m.importer.Remove(path); err != nil {
+			logging.FromContext(ctx).Warn("failed to remove imported file", "path", path, "error", err)
+		}
+	}
+}
@@ -0,0 +1,524 @@
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"vinyl-vault/internal/database"
+
+	"gorm.io/gorm"
+)
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load("postgres")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("Load() returned no migrations")
+	}
+	if migrations[0].Version != 1 {
+		t.Errorf("first migration version = %d, want 1", migrations[0].Version)
+	}
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			t.Errorf("migration %d is not ordered after %d", migrations[i].Version, migrations[i-1].Version)
+		}
+	}
+
+	initial := migrations[0].Up
+	for _, index := range []string{
+		"idx_albums_user_id",
+		"idx_registration_keys_key",
+		"idx_registration_keys_is_used",
+		"idx_registration_keys_expires_at",
+	} {
+		if !strings.Contains(initial, index) {
+			t.Errorf("initial migration is missing index %s", index)
+		}
+	}
+}
+
+func TestLoadDialectsMatch(t *testing.T) {
+	postgres, err := Load("postgres")
+	if err != nil {
+		t.Fatalf("Load(postgres) error = %v", err)
+	}
+	sqlite, err := Load("sqlite")
+	if err != nil {
+		t.Fatalf("Load(sqlite) error = %v", err)
+	}
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("postgres has %d migrations, sqlite has %d", len(postgres), len(sqlite))
+	}
+	for i := range postgres {
+		if postgres[i].Version != sqlite[i].Version || postgres[i].Name != sqlite[i].Name {
+			t.Errorf("migration %d_%s has no sqlite counterpart", postgres[i].Version, postgres[i].Name)
+		}
+	}
+}
+
+func TestLoadUnknownDialect(t *testing.T) {
+	if _, err := Load("oracle"); err == nil {
+		t.Error("Load() expected error for unknown dialect")
+	}
+}
+
+func TestMigratorSQLite(t *testing.T) {
+	db, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "vault.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	ctx := context.Background()
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	if len(applied) == 0 {
+		t.Fatal("Up() applied no migrations")
+	}
+	if applied, err = migrator.Up(ctx); err != nil || len(applied) != 0 {
+		t.Errorf("second Up() = %d applied, %v; want none", len(applied), err)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("migration %d not reported as applied", status.Version)
+		}
+	}
+
+	reverted, err := migrator.Down(ctx, len(statuses))
+	if err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+	if len(reverted) != len(statuses) {
+		t.Errorf("Down() reverted %d migrations, want %d", len(reverted), len(statuses))
+	}
+	if db.Migrator().HasTable("albums") {
+		t.Error("albums table still exists after reverting every migration")
+	}
+}
+
+func TestMediaMigration(t *testing.T) {
+	db, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "vault.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	ctx := context.Background()
+	if _, err = migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	// back to before media, with an album from that time
+	for db.Migrator().HasTable("media") {
+		if _, err = migrator.Down(ctx, 1); err != nil {
+			t.Fatalf("Down() error = %v", err)
+		}
+	}
+	for _, statement := range []string{
+		`INSERT INTO blobs (id, hash, size, path) VALUES (1, 'abc', 3, 'a/b/abc.flac')`,
+		`INSERT INTO albums (id, user_id, metadata_album, metadata_format) VALUES (1, 1, 'Tago Mago', 'LP')`,
+		`INSERT INTO tracks (album_id, track_number, title, blob_id) VALUES (1, 4, 'Halleluhwah', 1)`,
+	} {
+		if err = db.Exec(statement).Error; err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	if _, err = migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	var medium struct {
+		Number int
+		Format string
+		Speed  int
+	}
+	if err = db.Raw(`SELECT number, format, speed FROM media WHERE album_id = 1`).Scan(&medium).Error; err != nil {
+		t.Fatal(err)
+	}
+	if medium.Number != 1 || medium.Format != `12"` || medium.Speed != 33 {
+		t.Errorf("migrated LP medium = %+v, want disc 1, 12\" at 33 RPM", medium)
+	}
+	var track struct {
+		DiscNumber  int
+		Side        string
+		TrackNumber int
+	}
+	if err = db.Raw(`SELECT disc_number, side, track_number FROM tracks`).Scan(&track).Error; err != nil {
+		t.Fatal(err)
+	}
+	if track.DiscNumber != 1 || track.Side != "" || track.TrackNumber != 4 {
+		t.Errorf("migrated track = %+v, want number 4 on disc 1", track)
+	}
+}
+
+// The models as they were before versioned migrations, for AutoMigrate to create an
+// instance of that time
+type baselineUser struct {
+	ID           uint64 `gorm:"primaryKey;autoIncrement"`
+	Username     string `gorm:"uniqueIndex;not null"`
+	Email        string `gorm:"uniqueIndex;not null"`
+	IsAdmin      bool   `gorm:"default:false"`
+	PasswordHash string `gorm:"not null"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineRegistrationKey struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement"`
+	Key       string    `gorm:"uniqueIndex;not null"`
+	CreatedBy uint64    `gorm:"not null"`
+	UsedBy    *uint64   `gorm:"index"`
+	IsUsed    bool      `gorm:"default:false;index"`
+	ExpiresAt time.Time `gorm:"index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (baselineRegistrationKey) TableName() string { return "registration_keys" }
+
+type baselineAlbum struct {
+	ID       uint64 `gorm:"primaryKey;autoIncrement"`
+	UserID   uint64 `gorm:"not null;index"`
+	Metadata struct {
+		Artist       string
+		Album        string
+		Format       string
+		ReleaseDate  string
+		Label        *string
+		Country      *string
+		Length       uint
+		CoverArtPath string
+	} `gorm:"embedded;embeddedPrefix:metadata_"`
+	Tracks    []baselineTrack `gorm:"foreignKey:AlbumID;constraint:OnDelete:CASCADE"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (baselineAlbum) TableName() string { return "albums" }
+
+type baselineTrack struct {
+	ID           uint64 `gorm:"primaryKey;autoIncrement"`
+	AlbumID      uint64 `gorm:"not null"`
+	TrackNumber  int    `gorm:"not null"`
+	Title        string `gorm:"not null"`
+	Duration     uint
+	FilePath     string `gorm:"not null"`
+	AudioQuality struct {
+		Format     string
+		Bitrate    int
+		SampleRate int
+		BitDepth   int
+		Channels   int
+	} `gorm:"embedded;embeddedPrefix:audio_"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (baselineTrack) TableName() string { return "tracks" }
+
+func openBaseline(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "vault.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err = db.AutoMigrate(&baselineUser{}, &baselineRegistrationKey{}, &baselineAlbum{}, &baselineTrack{}); err != nil {
+		t.Fatalf("AutoMigrate() error = %v", err)
+	}
+	return db
+}
+
+func TestUpgradeBaseline(t *testing.T) {
+	db := openBaseline(t)
+	for _, statement := range []string{
+		`INSERT INTO users (id, username, email, password_hash) VALUES (1, 'holger', 'holger@example.com', 'x')`,
+		`INSERT INTO albums (id, user_id, metadata_album, metadata_format) VALUES (1, 1, 'Tago Mago', 'LP')`,
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	ctx := context.Background()
+	if _, err = migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	// the upgraded schema is the one a new instance gets
+	fresh, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "fresh.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	freshMigrator, err := NewMigrator(fresh)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	if _, err = freshMigrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+	for _, table := range []string{"users", "registration_keys", "albums", "media", "tracks", "blobs", "scrub_reports", "scrub_issues"} {
+		if got, want := columnNames(t, db, table), columnNames(t, fresh, table); !slices.Equal(got, want) {
+			t.Errorf("upgraded %s has columns %v, want %v", table, got, want)
+		}
+		if got, want := indexNames(t, db, table), indexNames(t, fresh, table); !slices.Equal(got, want) {
+			t.Errorf("upgraded %s has indexes %v, want %v", table, got, want)
+		}
+	}
+
+	var album struct {
+		Album     string `gorm:"column:metadata_album"`
+		DeletedAt *time.Time
+	}
+	if err = db.Raw(`SELECT metadata_album, deleted_at FROM albums WHERE id = 1`).Scan(&album).Error; err != nil {
+		t.Fatal(err)
+	}
+	if album.Album != "Tago Mago" || album.DeletedAt != nil {
+		t.Errorf("upgraded album = %+v, want Tago Mago out of the trash", album)
+	}
+
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if _, err = migrator.Down(ctx, len(statuses)); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+	if db.Migrator().HasTable("albums") {
+		t.Error("albums table still exists after reverting every migration")
+	}
+}
+
+func TestUpgradeBaselineWithoutImporter(t *testing.T) {
+	db := openBaseline(t)
+	for _, statement := range []string{
+		`INSERT INTO albums (id, user_id, metadata_album) VALUES (1, 1, 'Tago Mago')`,
+		`INSERT INTO tracks (album_id, track_number, title, file_path) VALUES (1, 4, 'Halleluhwah', 'audio/halleluhwah.flac')`,
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	ctx := context.Background()
+	applied, err := migrator.Up(ctx)
+	if err == nil {
+		t.Fatal("Up() without an importer left a track with no blob")
+	}
+	if len(applied) != 1 {
+		t.Errorf("Up() applied %d migrations, want only the initial one", len(applied))
+	}
+	if !db.Migrator().HasColumn("tracks", "file_path") || db.Migrator().HasTable("blobs") {
+		t.Error("blob store migration was not rolled back")
+	}
+}
+
+// dirImporter imports files under dir into dir/blobs
+type dirImporter struct {
+	dir string
+}
+
+func (i dirImporter) Import(path string) (ImportedBlob, error) {
+	data, err := os.ReadFile(filepath.Join(i.dir, path))
+	if err != nil {
+		return ImportedBlob{}, err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	blobPath := filepath.Join("blobs", hash+filepath.Ext(path))
+	if err = os.MkdirAll(filepath.Join(i.dir, "blobs"), 0o755); err != nil {
+		return ImportedBlob{}, err
+	}
+	if err = os.WriteFile(filepath.Join(i.dir, blobPath), data, 0o644); err != nil {
+		return ImportedBlob{}, err
+	}
+	return ImportedBlob{Hash: hash, Size: int64(len(data)), Path: blobPath}, nil
+}
+
+func (i dirImporter) Remove(path string) error {
+	return os.Remove(filepath.Join(i.dir, path))
+}
+
+func TestUpgradeBaselineImportsFiles(t *testing.T) {
+	db := openBaseline(t)
+	dir := t.TempDir()
+	for path, content := range map[string]string{
+		"audio/halleluhwah.flac":  "flac",
+		"audio/halleluhwah2.flac": "flac",
+		"audio/halleluhwah.wav":   "flac", // the same content under another extension
+		"covers/tago-mago.jpg":    "jpeg",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, statement := range []string{
+		`INSERT INTO users (id, username, email, password_hash) VALUES (1, 'holger', 'holger@example.com', 'x')`,
+		`INSERT INTO albums (id, user_id, metadata_album, metadata_cover_art_path) VALUES (1, 1, 'Tago Mago', 'covers/tago-mago.jpg')`,
+		`INSERT INTO tracks (id, album_id, track_number, title, file_path) VALUES
+			(1, 1, 1, 'Halleluhwah', 'audio/halleluhwah.flac'),
+			(2, 1, 2, 'Halleluhwah (again)', 'audio/halleluhwah.flac'),
+			(3, 1, 3, 'Halleluhwah (copy)', 'audio/halleluhwah2.flac'),
+			(4, 1, 4, 'Halleluhwah (wav)', 'audio/halleluhwah.wav'),
+			(5, 1, 5, 'Aumgn', 'audio/aumgn.flac')`,
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	migrator.SetBlobImporter(dirImporter{dir: dir})
+	// the file of track 5 is missing, which stops the import until it is dealt with
+	applied, err := migrator.Up(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "tracks [5]") {
+		t.Fatalf("Up() error = %v, want track 5 reported missing", err)
+	}
+	if len(applied) != 1 || db.Migrator().HasTable("blobs") {
+		t.Fatalf("Up() applied %d migrations, want the blob store migration rolled back", len(applied))
+	}
+	if err = db.Exec(`UPDATE tracks SET file_path = '' WHERE id = 5`).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(context.Background()); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	type blob struct {
+		ID       uint64
+		Hash     string
+		Path     string
+		RefCount int
+	}
+	var blobs []blob
+	if err = db.Raw(`SELECT id, hash, path, ref_count FROM blobs ORDER BY id`).Scan(&blobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 2 || blobs[0].RefCount != 4 || blobs[1].RefCount != 1 {
+		t.Fatalf("imported blobs = %+v, want the audio with 4 references and the cover with 1", blobs)
+	}
+	audio, cover := blobs[0], blobs[1]
+
+	var tracks []struct {
+		ID     uint64
+		BlobID *uint64
+	}
+	if err = db.Raw(`SELECT id, blob_id FROM tracks ORDER BY id`).Scan(&tracks).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, track := range tracks {
+		// track 5 was kept without audio
+		if missing := track.ID == 5; missing != (track.BlobID == nil) || !missing && *track.BlobID != audio.ID {
+			t.Errorf("track %d has blob %v, want %d unless its file is missing", track.ID, track.BlobID, audio.ID)
+		}
+	}
+
+	var album struct {
+		CoverBlobID  *uint64
+		CoverArtPath string `gorm:"column:metadata_cover_art_path"`
+	}
+	if err = db.Raw(`SELECT cover_blob_id, metadata_cover_art_path FROM albums WHERE id = 1`).Scan(&album).Error; err != nil {
+		t.Fatal(err)
+	}
+	if album.CoverBlobID == nil || *album.CoverBlobID != cover.ID || album.CoverArtPath != cover.Path {
+		t.Errorf("album cover = %+v, want blob %d at %s", album, cover.ID, cover.Path)
+	}
+
+	var used int64
+	if err = db.Raw(`SELECT storage_used FROM users WHERE id = 1`).Scan(&used).Error; err != nil {
+		t.Fatal(err)
+	}
+	if used != 4*4+4 {
+		t.Errorf("storage_used = %d, want every reference counted", used)
+	}
+
+	// the originals and the duplicate copy are gone, leaving one file per blob
+	var files []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			relativePath, _ := filepath.Rel(dir, path)
+			files = append(files, relativePath)
+		}
+		return err
+	})
+	want := []string{audio.Path, cover.Path}
+	slices.Sort(want)
+	if !slices.Equal(files, want) {
+		t.Errorf("files after import = %v, want %v", files, want)
+	}
+}
+
+func columnNames(t *testing.T, db *gorm.DB, table string) []string {
+	t.Helper()
+	columns, err := db.Migrator().ColumnTypes(table)
+	if err != nil {
+		t.Fatalf("ColumnTypes(%s) error = %v", table, err)
+	}
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name()
+	}
+	slices.Sort(names)
+	return names
+}
+
+func indexNames(t *testing.T, db *gorm.DB, table string) []string {
+	t.Helper()
+	indexes, err := db.Migrator().GetIndexes(table)
+	if err != nil {
+		t.Fatalf("GetIndexes(%s) error = %v", table, err)
+	}
+	names := make([]string, len(indexes))
+	for i, index := range indexes {
+		names[i] = index.Name()
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestRebind(t *testing.T) {
+	query := `UPDATE blobs SET ref_count = ? WHERE id = ?`
+	if got := dialects["postgres"].rebind(query); got != `UPDATE blobs SET ref_count = $1 WHERE id = $2` {
+		t.Errorf("postgres rebind() = %s", got)
+	}
+	if got := dialects["sqlite"].rebind(query); got != query {
+		t.Errorf("sqlite rebind() = %s, want the query as it is", got)
+	}
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS tracks;
+DROP TABLE IF EXISTS albums;
+DROP TABLE IF EXISTS registration_keys;
+DROP TABLE IF EXISTS users;
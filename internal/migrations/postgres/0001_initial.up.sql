@@ -0,0 +1,65 @@
+-- Initial schema, matching what AutoMigrate produced for the models in internal/services
+-- before versioned migrations. IF NOT EXISTS lets instances created by AutoMigrate adopt
+-- them; every later change is a migration of its own.
+
+CREATE TABLE IF NOT EXISTS users (
+    id            BIGSERIAL PRIMARY KEY,
+    username      TEXT NOT NULL,
+    email         TEXT NOT NULL,
+    is_admin      BOOLEAN DEFAULT false,
+    password_hash TEXT NOT NULL,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS registration_keys (
+    id         BIGSERIAL PRIMARY KEY,
+    key        TEXT NOT NULL,
+    created_by BIGINT NOT NULL,
+    used_by    BIGINT,
+    is_used    BOOLEAN DEFAULT false,
+    expires_at TIMESTAMPTZ,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_registration_keys_key ON registration_keys (key);
+CREATE INDEX IF NOT EXISTS idx_registration_keys_used_by ON registration_keys (used_by);
+CREATE INDEX IF NOT EXISTS idx_registration_keys_is_used ON registration_keys (is_used);
+CREATE INDEX IF NOT EXISTS idx_registration_keys_expires_at ON registration_keys (expires_at);
+
+CREATE TABLE IF NOT EXISTS albums (
+    id                      BIGSERIAL PRIMARY KEY,
+    user_id                 BIGINT NOT NULL,
+    metadata_artist         TEXT,
+    metadata_album          TEXT,
+    metadata_format         TEXT,
+    metadata_release_date   TEXT,
+    metadata_label          TEXT,
+    metadata_country        TEXT,
+    metadata_length         BIGINT,
+    metadata_cover_art_path TEXT,
+    created_at              TIMESTAMPTZ,
+    updated_at              TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_albums_user_id ON albums (user_id);
+
+-- file_path is relative to the upload dir
+CREATE TABLE IF NOT EXISTS tracks (
+    id                BIGSERIAL PRIMARY KEY,
+    album_id          BIGINT NOT NULL,
+    track_number      BIGINT NOT NULL,
+    title             TEXT NOT NULL,
+    duration          BIGINT,
+    file_path         TEXT NOT NULL,
+    audio_format      TEXT,
+    audio_bitrate     BIGINT,
+    audio_sample_rate BIGINT,
+    audio_bit_depth   BIGINT,
+    audio_channels    BIGINT,
+    created_at        TIMESTAMPTZ,
+    updated_at        TIMESTAMPTZ,
+    CONSTRAINT fk_albums_tracks FOREIGN KEY (album_id) REFERENCES albums (id) ON DELETE CASCADE
+);
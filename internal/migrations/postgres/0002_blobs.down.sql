@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_albums_cover_blob_id;
+ALTER TABLE albums DROP COLUMN cover_blob_id;
+
+DROP INDEX IF EXISTS idx_tracks_blob_id;
+DROP INDEX IF EXISTS idx_tracks_album_id;
+ALTER TABLE tracks DROP COLUMN blob_id;
+ALTER TABLE tracks ALTER COLUMN file_path SET NOT NULL;
+
+DROP TABLE IF EXISTS blobs;
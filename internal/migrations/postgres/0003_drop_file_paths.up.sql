@@ -0,0 +1,3 @@
+-- Tracks find their audio through blob_id.
+
+ALTER TABLE tracks DROP COLUMN file_path;
@@ -0,0 +1,7 @@
+-- Whatever is in the trash is restored.
+
+DROP INDEX IF EXISTS idx_tracks_deleted_at;
+ALTER TABLE tracks DROP COLUMN deleted_at;
+
+DROP INDEX IF EXISTS idx_albums_deleted_at;
+ALTER TABLE albums DROP COLUMN deleted_at;
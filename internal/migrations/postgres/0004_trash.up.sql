@@ -0,0 +1,8 @@
+-- Deleted albums and tracks go to the trash, with the time they were deleted, until they
+-- are restored or purged.
+
+ALTER TABLE albums ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_albums_deleted_at ON albums (deleted_at);
+
+ALTER TABLE tracks ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_tracks_deleted_at ON tracks (deleted_at);
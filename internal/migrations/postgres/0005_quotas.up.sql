@@ -0,0 +1,15 @@
+-- Per-user storage quotas, in bytes. A NULL storage_quota uses the instance default.
+-- storage_used counts every blob reference the user owns, trashed ones included, starting
+-- with the tracks and covers they already have.
+
+ALTER TABLE users ADD COLUMN storage_quota BIGINT;
+ALTER TABLE users ADD COLUMN storage_used  BIGINT NOT NULL DEFAULT 0;
+
+UPDATE users SET storage_used =
+    COALESCE((SELECT SUM(blobs.size) FROM tracks
+              JOIN albums ON albums.id = tracks.album_id
+              JOIN blobs ON blobs.id = tracks.blob_id
+              WHERE albums.user_id = users.id), 0) +
+    COALESCE((SELECT SUM(blobs.size) FROM albums
+              JOIN blobs ON blobs.id = albums.cover_blob_id
+              WHERE albums.user_id = users.id), 0);
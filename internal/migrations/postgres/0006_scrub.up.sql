@@ -0,0 +1,34 @@
+-- Scrub runs check every blob against its hash. A report is resumed from last_blob_id
+-- after a restart, and lists what it found as issues.
+
+CREATE TABLE IF NOT EXISTS scrub_reports (
+    id            BIGSERIAL PRIMARY KEY,
+    status        TEXT NOT NULL,
+    started_at    TIMESTAMPTZ,
+    finished_at   TIMESTAMPTZ,
+    last_blob_id  BIGINT,
+    files_checked BIGINT,
+    bytes_checked BIGINT,
+    missing       BIGINT,
+    mismatched    BIGINT,
+    orphaned      BIGINT,
+    error         TEXT,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_scrub_reports_status ON scrub_reports (status);
+
+CREATE TABLE IF NOT EXISTS scrub_issues (
+    id            BIGSERIAL PRIMARY KEY,
+    report_id     BIGINT NOT NULL,
+    kind          TEXT NOT NULL,
+    blob_id       BIGINT,
+    path          TEXT,
+    expected_hash TEXT,
+    actual_hash   TEXT,
+    created_at    TIMESTAMPTZ,
+    CONSTRAINT fk_scrub_reports_issues FOREIGN KEY (report_id) REFERENCES scrub_reports (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_scrub_issues_report_id ON scrub_issues (report_id);
+-- a resumed scrub may find the issue of the blob it was interrupted on again
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scrub_issues_report_path ON scrub_issues (report_id, path, kind);
@@ -0,0 +1,3 @@
+ALTER TABLE tracks DROP COLUMN IF EXISTS blob_share;
+ALTER TABLE tracks DROP COLUMN IF EXISTS end_sample;
+ALTER TABLE tracks DROP COLUMN IF EXISTS start_sample;
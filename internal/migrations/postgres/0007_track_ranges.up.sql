@@ -0,0 +1,7 @@
+-- Tracks cut from a side-long recording reference the samples [start_sample, end_sample)
+-- of a shared blob, and are charged blob_share bytes of it against the owner's quota.
+-- end_sample 0 means the track is the whole file.
+
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS start_sample BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS end_sample   BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS blob_share   BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE tracks DROP COLUMN IF EXISTS side;
+ALTER TABLE tracks DROP COLUMN IF EXISTS disc_number;
+
+DROP TABLE IF EXISTS media;
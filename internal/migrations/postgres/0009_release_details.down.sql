@@ -0,0 +1,9 @@
+ALTER TABLE tracks DROP COLUMN IF EXISTS credits;
+
+ALTER TABLE albums DROP COLUMN IF EXISTS metadata_styles;
+ALTER TABLE albums DROP COLUMN IF EXISTS metadata_genres;
+ALTER TABLE albums DROP COLUMN IF EXISTS metadata_edition_notes;
+ALTER TABLE albums DROP COLUMN IF EXISTS metadata_matrix;
+ALTER TABLE albums DROP COLUMN IF EXISTS metadata_pressing_plant;
+ALTER TABLE albums DROP COLUMN IF EXISTS metadata_barcode;
+ALTER TABLE albums DROP COLUMN IF EXISTS metadata_catalog_number;
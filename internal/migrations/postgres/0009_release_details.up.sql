@@ -0,0 +1,12 @@
+-- Collector's details of a release. Matrix etchings, genres and styles are JSON arrays,
+-- as are the credits of each track.
+
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS metadata_catalog_number TEXT NOT NULL DEFAULT '';
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS metadata_barcode        TEXT NOT NULL DEFAULT '';
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS metadata_pressing_plant TEXT NOT NULL DEFAULT '';
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS metadata_matrix         TEXT;
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS metadata_edition_notes  TEXT NOT NULL DEFAULT '';
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS metadata_genres         TEXT;
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS metadata_styles         TEXT;
+
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS credits TEXT;
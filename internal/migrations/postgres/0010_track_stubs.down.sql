@@ -0,0 +1,3 @@
+DELETE FROM tracks WHERE blob_id IS NULL;
+
+ALTER TABLE tracks ALTER COLUMN blob_id SET NOT NULL;
@@ -0,0 +1,3 @@
+-- Stub tracks come from a release's tracklist before their audio is uploaded, and have no blob.
+
+ALTER TABLE tracks ALTER COLUMN blob_id DROP NOT NULL;
@@ -0,0 +1,10 @@
+ALTER TABLE albums DROP COLUMN IF EXISTS loudness_analyzed_at;
+ALTER TABLE albums DROP COLUMN IF EXISTS loudness_range;
+ALTER TABLE albums DROP COLUMN IF EXISTS loudness_true_peak;
+ALTER TABLE albums DROP COLUMN IF EXISTS loudness_integrated;
+
+ALTER TABLE tracks DROP COLUMN IF EXISTS loudness_blocks;
+ALTER TABLE tracks DROP COLUMN IF EXISTS loudness_analyzed_at;
+ALTER TABLE tracks DROP COLUMN IF EXISTS loudness_range;
+ALTER TABLE tracks DROP COLUMN IF EXISTS loudness_true_peak;
+ALTER TABLE tracks DROP COLUMN IF EXISTS loudness_integrated;
@@ -0,0 +1,14 @@
+-- EBU R128 loudness of tracks and albums, measured after ingest. loudness_analyzed_at is
+-- NULL until then. loudness_blocks holds a track's gating blocks as JSON, for its album's
+-- measurement.
+
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS loudness_integrated  DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS loudness_true_peak   DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS loudness_range       DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS loudness_analyzed_at TIMESTAMPTZ;
+ALTER TABLE tracks ADD COLUMN IF NOT EXISTS loudness_blocks      TEXT;
+
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS loudness_integrated  DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS loudness_true_peak   DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS loudness_range       DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE albums ADD COLUMN IF NOT EXISTS loudness_analyzed_at TIMESTAMPTZ;
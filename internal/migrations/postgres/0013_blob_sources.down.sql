@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_blobs_source_hash;
+ALTER TABLE blobs DROP COLUMN IF EXISTS source;
+ALTER TABLE blobs DROP COLUMN IF EXISTS source_hash;
@@ -0,0 +1,6 @@
+-- Uploads stored as FLAC keep the hash of the file as uploaded, so it still
+-- deduplicates, and what it takes to rebuild it, as JSON.
+
+ALTER TABLE blobs ADD COLUMN IF NOT EXISTS source_hash VARCHAR(64);
+ALTER TABLE blobs ADD COLUMN IF NOT EXISTS source TEXT;
+CREATE INDEX IF NOT EXISTS idx_blobs_source_hash ON blobs (source_hash);
@@ -0,0 +1,65 @@
+-- Initial schema, matching what AutoMigrate produced for the models in internal/services
+-- before versioned migrations. IF NOT EXISTS lets instances created by AutoMigrate adopt
+-- them; every later change is a migration of its own.
+
+CREATE TABLE IF NOT EXISTS users (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    username      TEXT NOT NULL,
+    email         TEXT NOT NULL,
+    is_admin      NUMERIC DEFAULT false,
+    password_hash TEXT NOT NULL,
+    created_at    DATETIME,
+    updated_at    DATETIME
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username ON users (username);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+
+CREATE TABLE IF NOT EXISTS registration_keys (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    key        TEXT NOT NULL,
+    created_by INTEGER NOT NULL,
+    used_by    INTEGER,
+    is_used    NUMERIC DEFAULT false,
+    expires_at DATETIME,
+    used_at    DATETIME,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_registration_keys_key ON registration_keys (key);
+CREATE INDEX IF NOT EXISTS idx_registration_keys_used_by ON registration_keys (used_by);
+CREATE INDEX IF NOT EXISTS idx_registration_keys_is_used ON registration_keys (is_used);
+CREATE INDEX IF NOT EXISTS idx_registration_keys_expires_at ON registration_keys (expires_at);
+
+CREATE TABLE IF NOT EXISTS albums (
+    id                      INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id                 INTEGER NOT NULL,
+    metadata_artist         TEXT,
+    metadata_album          TEXT,
+    metadata_format         TEXT,
+    metadata_release_date   TEXT,
+    metadata_label          TEXT,
+    metadata_country        TEXT,
+    metadata_length         INTEGER,
+    metadata_cover_art_path TEXT,
+    created_at              DATETIME,
+    updated_at              DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_albums_user_id ON albums (user_id);
+
+-- file_path is relative to the upload dir
+CREATE TABLE IF NOT EXISTS tracks (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    album_id          INTEGER NOT NULL,
+    track_number      INTEGER NOT NULL,
+    title             TEXT NOT NULL,
+    duration          INTEGER,
+    file_path         TEXT NOT NULL,
+    audio_format      TEXT,
+    audio_bitrate     INTEGER,
+    audio_sample_rate INTEGER,
+    audio_bit_depth   INTEGER,
+    audio_channels    INTEGER,
+    created_at        DATETIME,
+    updated_at        DATETIME,
+    CONSTRAINT fk_albums_tracks FOREIGN KEY (album_id) REFERENCES albums (id) ON DELETE CASCADE
+);
@@ -0,0 +1,32 @@
+-- SQLite cannot drop a column with a foreign key, so tracks are rebuilt as they were.
+
+DROP INDEX IF EXISTS idx_albums_cover_blob_id;
+ALTER TABLE albums DROP COLUMN cover_blob_id;
+
+CREATE TABLE tracks_rebuilt (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    album_id          INTEGER NOT NULL,
+    track_number      INTEGER NOT NULL,
+    title             TEXT NOT NULL,
+    duration          INTEGER,
+    file_path         TEXT NOT NULL,
+    audio_format      TEXT,
+    audio_bitrate     INTEGER,
+    audio_sample_rate INTEGER,
+    audio_bit_depth   INTEGER,
+    audio_channels    INTEGER,
+    created_at        DATETIME,
+    updated_at        DATETIME,
+    CONSTRAINT fk_albums_tracks FOREIGN KEY (album_id) REFERENCES albums (id) ON DELETE CASCADE
+);
+INSERT INTO tracks_rebuilt (
+    id, album_id, track_number, title, duration, file_path, audio_format, audio_bitrate,
+    audio_sample_rate, audio_bit_depth, audio_channels, created_at, updated_at
+)
+SELECT id, album_id, track_number, title, duration, COALESCE(file_path, ''), audio_format, audio_bitrate,
+    audio_sample_rate, audio_bit_depth, audio_channels, created_at, updated_at
+FROM tracks;
+DROP TABLE tracks;
+ALTER TABLE tracks_rebuilt RENAME TO tracks;
+
+DROP TABLE IF EXISTS blobs;
@@ -0,0 +1,22 @@
+-- Media files move into a content-addressed blob store, where identical files are kept
+-- once. Tracks and album covers reference blobs, each reference counted in ref_count.
+-- The migrator imports the files of existing tracks and covers after this script, in the
+-- same transaction (see blobs.go); a track whose file is missing is left without a blob.
+
+CREATE TABLE IF NOT EXISTS blobs (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    hash       TEXT NOT NULL,
+    size       INTEGER NOT NULL,
+    path       TEXT NOT NULL,
+    ref_count  INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_blobs_hash ON blobs (hash);
+
+ALTER TABLE tracks ADD COLUMN blob_id INTEGER CONSTRAINT fk_tracks_blob REFERENCES blobs (id) ON DELETE RESTRICT;
+CREATE INDEX IF NOT EXISTS idx_tracks_album_id ON tracks (album_id);
+CREATE INDEX IF NOT EXISTS idx_tracks_blob_id ON tracks (blob_id);
+
+ALTER TABLE albums ADD COLUMN cover_blob_id INTEGER;
+CREATE INDEX IF NOT EXISTS idx_albums_cover_blob_id ON albums (cover_blob_id);
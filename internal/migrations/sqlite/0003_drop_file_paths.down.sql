@@ -0,0 +1,4 @@
+-- Tracks point at their blob's file, or at none when they have no blob.
+
+ALTER TABLE tracks ADD COLUMN file_path TEXT;
+UPDATE tracks SET file_path = COALESCE((SELECT path FROM blobs WHERE blobs.id = tracks.blob_id), '');
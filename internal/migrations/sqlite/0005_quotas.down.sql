@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN storage_used;
+ALTER TABLE users DROP COLUMN storage_quota;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS scrub_issues;
+DROP TABLE IF EXISTS scrub_reports;
@@ -0,0 +1,34 @@
+-- Scrub runs check every blob against its hash. A report is resumed from last_blob_id
+-- after a restart, and lists what it found as issues.
+
+CREATE TABLE IF NOT EXISTS scrub_reports (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    status        TEXT NOT NULL,
+    started_at    DATETIME,
+    finished_at   DATETIME,
+    last_blob_id  INTEGER,
+    files_checked INTEGER,
+    bytes_checked INTEGER,
+    missing       INTEGER,
+    mismatched    INTEGER,
+    orphaned      INTEGER,
+    error         TEXT,
+    created_at    DATETIME,
+    updated_at    DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_scrub_reports_status ON scrub_reports (status);
+
+CREATE TABLE IF NOT EXISTS scrub_issues (
+    id            INTEGER PRIMARY KEY AUTOINCREMENT,
+    report_id     INTEGER NOT NULL,
+    kind          TEXT NOT NULL,
+    blob_id       INTEGER,
+    path          TEXT,
+    expected_hash TEXT,
+    actual_hash   TEXT,
+    created_at    DATETIME,
+    CONSTRAINT fk_scrub_reports_issues FOREIGN KEY (report_id) REFERENCES scrub_reports (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_scrub_issues_report_id ON scrub_issues (report_id);
+-- a resumed scrub may find the issue of the blob it was interrupted on again
+CREATE UNIQUE INDEX IF NOT EXISTS idx_scrub_issues_report_path ON scrub_issues (report_id, path, kind);
@@ -0,0 +1,3 @@
+ALTER TABLE tracks DROP COLUMN blob_share;
+ALTER TABLE tracks DROP COLUMN end_sample;
+ALTER TABLE tracks DROP COLUMN start_sample;
@@ -0,0 +1,7 @@
+-- Tracks cut from a side-long recording reference the samples [start_sample, end_sample)
+-- of a shared blob, and are charged blob_share bytes of it against the owner's quota.
+-- end_sample 0 means the track is the whole file.
+
+ALTER TABLE tracks ADD COLUMN start_sample INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tracks ADD COLUMN end_sample   INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tracks ADD COLUMN blob_share   INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE tracks DROP COLUMN side;
+ALTER TABLE tracks DROP COLUMN disc_number;
+
+DROP TABLE IF EXISTS media;
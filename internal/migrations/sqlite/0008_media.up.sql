@@ -0,0 +1,27 @@
+-- Releases are made of media (the discs of a double LP, say), each with a format and
+-- speed. Tracks sit on a disc, on a side of it (A, B, AA...), at track_number on that side.
+
+CREATE TABLE IF NOT EXISTS media (
+    album_id INTEGER NOT NULL,
+    number   INTEGER NOT NULL,
+    format   TEXT NOT NULL DEFAULT '',
+    speed    INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (album_id, number),
+    CONSTRAINT fk_albums_media FOREIGN KEY (album_id) REFERENCES albums (id) ON DELETE CASCADE
+);
+
+ALTER TABLE tracks ADD COLUMN disc_number INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE tracks ADD COLUMN side        TEXT NOT NULL DEFAULT '';
+
+-- Existing albums become a single disc, keeping their track numbers as positions on it.
+-- Where the album format names a size, the disc gets it and the usual speed.
+INSERT OR IGNORE INTO media (album_id, number, format, speed)
+SELECT id, 1,
+       CASE WHEN UPPER(metadata_format) IN ('LP', '12"') THEN '12"'
+            WHEN metadata_format = '10"' THEN '10"'
+            WHEN UPPER(metadata_format) IN ('7"', 'SINGLE') THEN '7"'
+            ELSE '' END,
+       CASE WHEN UPPER(metadata_format) IN ('LP', '12"') THEN 33
+            WHEN UPPER(metadata_format) IN ('7"', 'SINGLE') THEN 45
+            ELSE 0 END
+FROM albums;
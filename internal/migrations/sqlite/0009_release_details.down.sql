@@ -0,0 +1,9 @@
+ALTER TABLE tracks DROP COLUMN credits;
+
+ALTER TABLE albums DROP COLUMN metadata_styles;
+ALTER TABLE albums DROP COLUMN metadata_genres;
+ALTER TABLE albums DROP COLUMN metadata_edition_notes;
+ALTER TABLE albums DROP COLUMN metadata_matrix;
+ALTER TABLE albums DROP COLUMN metadata_pressing_plant;
+ALTER TABLE albums DROP COLUMN metadata_barcode;
+ALTER TABLE albums DROP COLUMN metadata_catalog_number;
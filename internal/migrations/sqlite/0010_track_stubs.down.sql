@@ -0,0 +1,41 @@
+-- Stub tracks are dropped, having no blob to point at.
+
+CREATE TABLE tracks_rebuilt (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    album_id          INTEGER NOT NULL,
+    track_number      INTEGER NOT NULL,
+    title             TEXT NOT NULL,
+    duration          INTEGER,
+    blob_id           INTEGER NOT NULL,
+    audio_format      TEXT,
+    audio_bitrate     INTEGER,
+    audio_sample_rate INTEGER,
+    audio_bit_depth   INTEGER,
+    audio_channels    INTEGER,
+    created_at        DATETIME,
+    updated_at        DATETIME,
+    deleted_at        DATETIME,
+    start_sample      INTEGER NOT NULL DEFAULT 0,
+    end_sample        INTEGER NOT NULL DEFAULT 0,
+    blob_share        INTEGER NOT NULL DEFAULT 0,
+    disc_number       INTEGER NOT NULL DEFAULT 1,
+    side              TEXT NOT NULL DEFAULT '',
+    credits           TEXT,
+    CONSTRAINT fk_albums_tracks FOREIGN KEY (album_id) REFERENCES albums (id) ON DELETE CASCADE,
+    CONSTRAINT fk_tracks_blob FOREIGN KEY (blob_id) REFERENCES blobs (id) ON DELETE RESTRICT
+);
+INSERT INTO tracks_rebuilt (
+    id, album_id, track_number, title, duration, blob_id, audio_format, audio_bitrate, audio_sample_rate,
+    audio_bit_depth, audio_channels, created_at, updated_at, deleted_at, start_sample, end_sample,
+    blob_share, disc_number, side, credits
+)
+SELECT id, album_id, track_number, title, duration, blob_id, audio_format, audio_bitrate, audio_sample_rate,
+    audio_bit_depth, audio_channels, created_at, updated_at, deleted_at, start_sample, end_sample,
+    blob_share, disc_number, side, credits
+FROM tracks WHERE blob_id IS NOT NULL;
+DROP TABLE tracks;
+ALTER TABLE tracks_rebuilt RENAME TO tracks;
+
+CREATE INDEX IF NOT EXISTS idx_tracks_album_id ON tracks (album_id);
+CREATE INDEX IF NOT EXISTS idx_tracks_blob_id ON tracks (blob_id);
+CREATE INDEX IF NOT EXISTS idx_tracks_deleted_at ON tracks (deleted_at);
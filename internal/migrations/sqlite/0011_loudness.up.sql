@@ -0,0 +1,14 @@
+-- EBU R128 loudness of tracks and albums, measured after ingest. loudness_analyzed_at is
+-- NULL until then. loudness_blocks holds a track's gating blocks as JSON, for its album's
+-- measurement.
+
+ALTER TABLE tracks ADD COLUMN loudness_integrated  REAL NOT NULL DEFAULT 0;
+ALTER TABLE tracks ADD COLUMN loudness_true_peak   REAL NOT NULL DEFAULT 0;
+ALTER TABLE tracks ADD COLUMN loudness_range       REAL NOT NULL DEFAULT 0;
+ALTER TABLE tracks ADD COLUMN loudness_analyzed_at DATETIME;
+ALTER TABLE tracks ADD COLUMN loudness_blocks      TEXT;
+
+ALTER TABLE albums ADD COLUMN loudness_integrated  REAL NOT NULL DEFAULT 0;
+ALTER TABLE albums ADD COLUMN loudness_true_peak   REAL NOT NULL DEFAULT 0;
+ALTER TABLE albums ADD COLUMN loudness_range       REAL NOT NULL DEFAULT 0;
+ALTER TABLE albums ADD COLUMN loudness_analyzed_at DATETIME;
@@ -0,0 +1 @@
+ALTER TABLE tracks DROP COLUMN rip_quality;
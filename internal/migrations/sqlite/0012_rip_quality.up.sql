@@ -0,0 +1,4 @@
+-- What analyzing a track's audio found wrong with the rip, as JSON. NULL until the
+-- track is analyzed.
+
+ALTER TABLE tracks ADD COLUMN rip_quality TEXT;
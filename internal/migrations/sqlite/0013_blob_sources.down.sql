@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_blobs_source_hash;
+ALTER TABLE blobs DROP COLUMN source;
+ALTER TABLE blobs DROP COLUMN source_hash;
@@ -0,0 +1,6 @@
+-- Uploads stored as FLAC keep the hash of the file as uploaded, so it still
+-- deduplicates, and what it takes to rebuild it, as JSON.
+
+ALTER TABLE blobs ADD COLUMN source_hash TEXT;
+ALTER TABLE blobs ADD COLUMN source TEXT;
+CREATE INDEX IF NOT EXISTS idx_blobs_source_hash ON blobs (source_hash);
@@ -0,0 +1,4 @@
+-- The conversion preset a user's downloads default to, by name. Empty downloads
+-- tracks as they are stored.
+
+ALTER TABLE users ADD COLUMN conversion_preset TEXT NOT NULL DEFAULT '';
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 	"vinyl-vault/internal/services"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type GormAlbumRepository struct {
@@ -19,11 +21,22 @@ func NewGormAlbumRepository(db *gorm.DB) services.AlbumRepository {
 	}
 }
 
+// withMedia preloads an album's media, and its tracks in play order
+func withMedia(db *gorm.DB) *gorm.DB {
+	return db.Preload("Media", func(db *gorm.DB) *gorm.DB { return db.Order("number") })
+}
+
+func orderTracks(db *gorm.DB) *gorm.DB {
+	return db.Order(trackOrder)
+}
+
 func (r *GormAlbumRepository) FindByUserID(ctx context.Context, userID uint64) ([]*services.Album, error) {
 
 	var albums []*services.Album
 
-	if result := r.db.WithContext(ctx).Preload("Tracks").Where("user_id = ?", userID).Find(&albums); result.Error != nil {
+	if result := r.db.WithContext(ctx).Scopes(withMedia).
+		Preload("Tracks", orderTracks).Preload("Tracks.Blob").
+		Where("user_id = ?", userID).Find(&albums); result.Error != nil {
 		return nil, fmt.Errorf("failed to find albums: %w", result.Error)
 	}
 	return albums, nil
@@ -32,10 +45,12 @@ func (r *GormAlbumRepository) FindByUserID(ctx context.Context, userID uint64) (
 func (r *GormAlbumRepository) FindByID(ctx context.Context, id uint64) (*services.Album, error) {
 	var album services.Album
 
-	result := r.db.WithContext(ctx).Preload("Tracks").First(&album, id)
+	result := r.db.WithContext(ctx).Scopes(withMedia).
+		Preload("Tracks", orderTracks).Preload("Tracks.Blob").
+		First(&album, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("album with id %d not found", id)
+			return nil, fmt.Errorf("album with id %d: %w", id, services.ErrAlbumNotFound)
 		}
 		return nil, fmt.Errorf("failed to find album: %w", result.Error)
 	}
@@ -46,7 +61,7 @@ func (r *GormAlbumRepository) FindByArtist(ctx context.Context, artist string) (
 
 	var albums []*services.Album
 
-	result := r.db.WithContext(ctx).Where("metadata_artist = ?", artist).Find(&albums)
+	result := r.db.WithContext(ctx).Scopes(withMedia).Where("metadata_artist = ?", artist).Find(&albums)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to find albums: %w", result.Error)
 	}
@@ -54,10 +69,30 @@ func (r *GormAlbumRepository) FindByArtist(ctx context.Context, artist string) (
 }
 
 func (r *GormAlbumRepository) Save(ctx context.Context, album *services.Album) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Media").Save(album).Error; err != nil {
+			return err
+		}
 
-	result := r.db.WithContext(ctx).Save(album)
-	if result.Error != nil {
-		return fmt.Errorf("failed to save album: %w", result.Error)
+		numbers := make([]int, len(album.Media))
+		for i := range album.Media {
+			album.Media[i].AlbumID = album.ID
+			numbers[i] = album.Media[i].Number
+		}
+		stale := tx.Where("album_id = ?", album.ID)
+		if len(numbers) > 0 {
+			stale = stale.Where("number NOT IN ?", numbers)
+		}
+		if err := stale.Delete(&services.Medium{}).Error; err != nil {
+			return err
+		}
+		if len(album.Media) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&album.Media).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save album: %w", err)
 	}
 	return nil
 }
@@ -70,7 +105,82 @@ func (r *GormAlbumRepository) Delete(ctx context.Context, id uint64) error {
 	}
 
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("album with id %d not found", id)
+		return fmt.Errorf("album with id %d: %w", id, services.ErrAlbumNotFound)
 	}
 	return nil
 }
+
+func (r *GormAlbumRepository) FindByIDWithDeleted(ctx context.Context, id uint64) (*services.Album, error) {
+	var album services.Album
+
+	result := r.db.WithContext(ctx).Unscoped().Scopes(withMedia).
+		Preload("Tracks", func(db *gorm.DB) *gorm.DB { return orderTracks(db.Unscoped()) }).
+		Preload("Tracks.Blob").
+		First(&album, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("album with id %d: %w", id, services.ErrAlbumNotFound)
+		}
+		return nil, fmt.Errorf("failed to find album: %w", result.Error)
+	}
+	return &album, nil
+}
+
+func (r *GormAlbumRepository) FindDeletedByUserID(ctx context.Context, userID uint64) ([]*services.Album, error) {
+	var albums []*services.Album
+
+	result := r.db.WithContext(ctx).Unscoped().Scopes(withMedia).
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Order("deleted_at DESC").
+		Find(&albums)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find deleted albums: %w", result.Error)
+	}
+	return albums, nil
+}
+
+func (r *GormAlbumRepository) FindDeletedBefore(ctx context.Context, cutoff time.Time) ([]*services.Album, error) {
+	var albums []*services.Album
+
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Find(&albums)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find deleted albums: %w", result.Error)
+	}
+	return albums, nil
+}
+
+func (r *GormAlbumRepository) Restore(ctx context.Context, id uint64) error {
+	result := r.db.WithContext(ctx).Unscoped().Model(&services.Album{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to restore album: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("album with id %d in trash: %w", id, services.ErrAlbumNotFound)
+	}
+	return nil
+}
+
+func (r *GormAlbumRepository) Purge(ctx context.Context, id uint64) error {
+	result := r.db.WithContext(ctx).Unscoped().Delete(&services.Album{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to purge album: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("album with id %d: %w", id, services.ErrAlbumNotFound)
+	}
+	return nil
+}
+
+func (r *GormAlbumRepository) Count(ctx context.Context) (int64, error) {
+	var count int64
+	if result := r.db.WithContext(ctx).Model(&services.Album{}).Count(&count); result.Error != nil {
+		return 0, fmt.Errorf("failed to count albums: %w", result.Error)
+	}
+	return count, nil
+}
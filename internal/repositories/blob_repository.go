@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"vinyl-vault/internal/services"
+
+	"gorm.io/gorm"
+)
+
+type GormBlobRepository struct {
+	db *gorm.DB
+}
+
+func NewGormBlobRepository(db *gorm.DB) services.BlobRepository {
+	return &GormBlobRepository{
+		db: db,
+	}
+}
+
+func (r *GormBlobRepository) FindByID(ctx context.Context, id uint64) (*services.Blob, error) {
+	var blob services.Blob
+
+	result := r.db.WithContext(ctx).First(&blob, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("blob with id %d: %w", id, services.ErrBlobNotFound)
+		}
+		return nil, fmt.Errorf("failed to find blob: %w", result.Error)
+	}
+	return &blob, nil
+}
+
+func (r *GormBlobRepository) FindByHash(ctx context.Context, hash string) (*services.Blob, error) {
+	// blobs that weren't converted have an empty source hash
+	if hash == "" {
+		return nil, services.ErrBlobNotFound
+	}
+	var blob services.Blob
+
+	result := r.db.WithContext(ctx).Where("hash = ? OR source_hash = ?", hash, hash).First(&blob)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, services.ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("failed to find blob: %w", result.Error)
+	}
+	return &blob, nil
+}
+
+func (r *GormBlobRepository) Save(ctx context.Context, blob *services.Blob) error {
+	result := r.db.WithContext(ctx).Save(blob)
+	if result.Error != nil {
+		return fmt.Errorf("failed to save blob: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *GormBlobRepository) AdjustRefCount(ctx context.Context, id uint64, delta int) (*services.Blob, error) {
+	var blob services.Blob
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&services.Blob{}).Where("id = ?", id).
+			UpdateColumn("ref_count", gorm.Expr("ref_count + ?", delta))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return services.ErrBlobNotFound
+		}
+		return tx.First(&blob, id).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update blob refcount: %w", err)
+	}
+	return &blob, nil
+}
+
+func (r *GormBlobRepository) UpdatePath(ctx context.Context, id uint64, path string) error {
+	result := r.db.WithContext(ctx).Model(&services.Blob{}).Where("id = ?", id).Update("path", path)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update blob path: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("failed to update blob path: %w", services.ErrBlobNotFound)
+	}
+	return nil
+}
+
+func (r *GormBlobRepository) DeleteIfUnreferenced(ctx context.Context, id uint64) (bool, error) {
+	result := r.db.WithContext(ctx).Where("ref_count <= 0").Delete(&services.Blob{}, id)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to delete blob: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (r *GormBlobRepository) FindAfterID(ctx context.Context, afterID uint64, limit int) ([]*services.Blob, error) {
+	var blobs []*services.Blob
+
+	result := r.db.WithContext(ctx).Where("id > ?", afterID).Order("id ASC").Limit(limit).Find(&blobs)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find blobs: %w", result.Error)
+	}
+	return blobs, nil
+}
+
+func (r *GormBlobRepository) FindOrphaned(ctx context.Context) ([]*services.Blob, error) {
+	var blobs []*services.Blob
+
+	result := r.db.WithContext(ctx).
+		Where("NOT EXISTS (SELECT 1 FROM tracks WHERE tracks.blob_id = blobs.id)").
+		Where("NOT EXISTS (SELECT 1 FROM albums WHERE albums.cover_blob_id = blobs.id)").
+		Order("id ASC").
+		Find(&blobs)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find orphaned blobs: %w", result.Error)
+	}
+	return blobs, nil
+}
+
+func (r *GormBlobRepository) IsReferencedBy(ctx context.Context, id, userID uint64) (bool, error) {
+	var referenced bool
+
+	result := r.db.WithContext(ctx).Raw(`SELECT
+		EXISTS (SELECT 1 FROM tracks JOIN albums ON albums.id = tracks.album_id
+			WHERE tracks.blob_id = ? AND albums.user_id = ?) OR
+		EXISTS (SELECT 1 FROM albums WHERE albums.cover_blob_id = ? AND albums.user_id = ?)`,
+		id, userID, id, userID).Scan(&referenced)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to check blob references: %w", result.Error)
+	}
+	return referenced, nil
+}
+
+func (r *GormBlobRepository) Stats(ctx context.Context) (int64, int64, error) {
+	var stats struct {
+		Count int64
+		Bytes int64
+	}
+	result := r.db.WithContext(ctx).Model(&services.Blob{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(size), 0) AS bytes").
+		Scan(&stats)
+	if result.Error != nil {
+		return 0, 0, fmt.Errorf("failed to get blob stats: %w", result.Error)
+	}
+	return stats.Count, stats.Bytes, nil
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"vinyl-vault/internal/database"
+	"vinyl-vault/internal/migrations"
+	"vinyl-vault/internal/repositories/repositorytest"
+
+	"gorm.io/gorm"
+)
+
+func TestGormRepositoryContractSQLite(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		return gormRepositories(t, "sqlite://"+filepath.Join(t.TempDir(), "vault.db"))
+	})
+}
+
+// Postgres runs only when VINYL_VAULT_TEST_POSTGRES_URL points at a disposable database
+func TestGormRepositoryContractPostgres(t *testing.T) {
+	databaseURL := os.Getenv("VINYL_VAULT_TEST_POSTGRES_URL")
+	if databaseURL == "" {
+		t.Skip("VINYL_VAULT_TEST_POSTGRES_URL not set")
+	}
+
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		return gormRepositories(t, databaseURL)
+	})
+}
+
+func gormRepositories(t *testing.T, databaseURL string) repositorytest.Repositories {
+	t.Helper()
+
+	db, err := database.Open(databaseURL)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil {
+		t.Fatalf("NewMigrator() error = %v", err)
+	}
+	if _, err = migrator.Up(context.Background()); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	if db.Dialector.Name() == "postgres" {
+		truncate(t, db)
+	}
+
+	return repositorytest.Repositories{
+		Users:  NewGormUserRepository(db),
+		Keys:   NewGormRegistrationKeyRepository(db),
+		Blobs:  NewGormBlobRepository(db),
+		Albums: NewGormAlbumRepository(db),
+		Tracks: NewGormTrackRepository(db),
+		Scrubs: NewGormScrubRepository(db),
+	}
+}
+
+func truncate(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	err := db.Exec("TRUNCATE users, registration_keys, blobs, albums, tracks, scrub_reports, scrub_issues RESTART IDENTITY CASCADE").Error
+	if err != nil {
+		t.Fatalf("truncating tables: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+	"vinyl-vault/internal/services"
+
+	"gorm.io/gorm"
+)
+
+type AlbumRepository struct {
+	store *Store
+}
+
+func NewAlbumRepository(store *Store) services.AlbumRepository {
+	return &AlbumRepository{
+		store: store,
+	}
+}
+
+func (r *AlbumRepository) FindByID(ctx context.Context, id uint64) (*services.Album, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	album, ok := r.store.albums[id]
+	if !ok || album.DeletedAt.Valid {
+		return nil, fmt.Errorf("album with id %d: %w", id, services.ErrAlbumNotFound)
+	}
+	return r.withTracks(album, false), nil
+}
+
+func (r *AlbumRepository) FindByUserID(ctx context.Context, userID uint64) ([]*services.Album, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var albums []*services.Album
+	for _, album := range r.store.albums {
+		if album.UserID == userID && !album.DeletedAt.Valid {
+			albums = append(albums, r.withTracks(album, false))
+		}
+	}
+	sortAlbums(albums)
+	return albums, nil
+}
+
+func (r *AlbumRepository) FindByArtist(ctx context.Context, artist string) ([]*services.Album, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var albums []*services.Album
+	for _, album := range r.store.albums {
+		if album.Metadata.Artist == artist && !album.DeletedAt.Valid {
+			albums = append(albums, r.store.albumWithMedia(album))
+		}
+	}
+	sortAlbums(albums)
+	return albums, nil
+}
+
+func (r *AlbumRepository) Save(ctx context.Context, album *services.Album) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var createdAt *time.Time
+	if existing, ok := r.store.albums[album.ID]; ok {
+		createdAt = &existing.CreatedAt
+	}
+	if album.ID == 0 {
+		album.ID = r.store.nextID("albums")
+	} else {
+		r.store.useID("albums", album.ID)
+	}
+	stamp(&album.CreatedAt, &album.UpdatedAt, createdAt)
+
+	r.store.albums[album.ID] = copyAlbum(album)
+
+	media := make([]services.Medium, len(album.Media))
+	for i := range album.Media {
+		album.Media[i].AlbumID = album.ID
+		media[i] = album.Media[i]
+	}
+	slices.SortFunc(media, func(a, b services.Medium) int { return a.Number - b.Number })
+	media = slices.CompactFunc(media, func(a, b services.Medium) bool { return a.Number == b.Number })
+	r.store.media[album.ID] = media
+	return nil
+}
+
+func (r *AlbumRepository) Delete(ctx context.Context, id uint64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	album, ok := r.store.albums[id]
+	if !ok || album.DeletedAt.Valid {
+		return fmt.Errorf("album with id %d: %w", id, services.ErrAlbumNotFound)
+	}
+	album.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (r *AlbumRepository) FindByIDWithDeleted(ctx context.Context, id uint64) (*services.Album, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	album, ok := r.store.albums[id]
+	if !ok {
+		return nil, fmt.Errorf("album with id %d: %w", id, services.ErrAlbumNotFound)
+	}
+	return r.withTracks(album, true), nil
+}
+
+func (r *AlbumRepository) FindDeletedByUserID(ctx context.Context, userID uint64) ([]*services.Album, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var albums []*services.Album
+	for _, album := range r.store.albums {
+		if album.UserID == userID && album.DeletedAt.Valid {
+			albums = append(albums, r.store.albumWithMedia(album))
+		}
+	}
+
+	// most recently trashed first
+	sort.Slice(albums, func(i, j int) bool { return albums[i].DeletedAt.Time.After(albums[j].DeletedAt.Time) })
+	return albums, nil
+}
+
+func (r *AlbumRepository) FindDeletedBefore(ctx context.Context, cutoff time.Time) ([]*services.Album, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var albums []*services.Album
+	for _, album := range r.store.albums {
+		if album.DeletedAt.Valid && album.DeletedAt.Time.Before(cutoff) {
+			albums = append(albums, copyAlbum(album))
+		}
+	}
+	sortAlbums(albums)
+	return albums, nil
+}
+
+func (r *AlbumRepository) Restore(ctx context.Context, id uint64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	album, ok := r.store.albums[id]
+	if !ok || !album.DeletedAt.Valid {
+		return fmt.Errorf("album with id %d in trash: %w", id, services.ErrAlbumNotFound)
+	}
+	album.DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+func (r *AlbumRepository) Purge(ctx context.Context, id uint64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.albums[id]; !ok {
+		return fmt.Errorf("album with id %d: %w", id, services.ErrAlbumNotFound)
+	}
+	delete(r.store.albums, id)
+	delete(r.store.media, id)
+
+	// tracks cascade, as with the foreign key in the schema
+	for trackID, track := range r.store.tracks {
+		if track.AlbumID == id {
+			delete(r.store.tracks, trackID)
+		}
+	}
+	return nil
+}
+
+func (r *AlbumRepository) Count(ctx context.Context) (int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var count int64
+	for _, album := range r.store.albums {
+		if !album.DeletedAt.Valid {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// withTracks copies an album with its media and tracks attached; callers must hold the lock
+func (r *AlbumRepository) withTracks(album *services.Album, includeDeleted bool) *services.Album {
+	c := r.store.albumWithMedia(album)
+	for _, track := range r.store.tracks {
+		if track.AlbumID == album.ID && (includeDeleted || !track.DeletedAt.Valid) {
+			c.Tracks = append(c.Tracks, *r.store.trackWithBlob(track))
+		}
+	}
+	slices.SortFunc(c.Tracks, func(a, b services.Track) int { return services.CompareTracks(&a, &b) })
+	return c
+}
+
+func sortAlbums(albums []*services.Album) {
+	sort.Slice(albums, func(i, j int) bool { return albums[i].ID < albums[j].ID })
+}
@@ -0,0 +1,184 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"vinyl-vault/internal/services"
+)
+
+type BlobRepository struct {
+	store *Store
+}
+
+func NewBlobRepository(store *Store) services.BlobRepository {
+	return &BlobRepository{
+		store: store,
+	}
+}
+
+func (r *BlobRepository) FindByID(ctx context.Context, id uint64) (*services.Blob, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	blob, ok := r.store.blobs[id]
+	if !ok {
+		return nil, fmt.Errorf("blob with id %d: %w", id, services.ErrBlobNotFound)
+	}
+	return copyBlob(blob), nil
+}
+
+func (r *BlobRepository) FindByHash(ctx context.Context, hash string) (*services.Blob, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, blob := range r.store.blobs {
+		if hash != "" && (blob.Hash == hash || blob.SourceHash == hash) {
+			return copyBlob(blob), nil
+		}
+	}
+	return nil, services.ErrBlobNotFound
+}
+
+func (r *BlobRepository) Save(ctx context.Context, blob *services.Blob) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, other := range r.store.blobs {
+		if other.ID != blob.ID && other.Hash == blob.Hash {
+			return fmt.Errorf("failed to save blob: hash already exists")
+		}
+	}
+
+	var createdAt *time.Time
+	if existing, ok := r.store.blobs[blob.ID]; ok {
+		createdAt = &existing.CreatedAt
+	}
+	if blob.ID == 0 {
+		blob.ID = r.store.nextID("blobs")
+	} else {
+		r.store.useID("blobs", blob.ID)
+	}
+	stamp(&blob.CreatedAt, &blob.UpdatedAt, createdAt)
+
+	r.store.blobs[blob.ID] = copyBlob(blob)
+	return nil
+}
+
+func (r *BlobRepository) AdjustRefCount(ctx context.Context, id uint64, delta int) (*services.Blob, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	blob, ok := r.store.blobs[id]
+	if !ok {
+		return nil, fmt.Errorf("failed to update blob refcount: %w", services.ErrBlobNotFound)
+	}
+	blob.RefCount += delta
+	return copyBlob(blob), nil
+}
+
+func (r *BlobRepository) UpdatePath(ctx context.Context, id uint64, path string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	blob, ok := r.store.blobs[id]
+	if !ok {
+		return fmt.Errorf("failed to update blob path: %w", services.ErrBlobNotFound)
+	}
+	blob.Path = path
+	blob.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *BlobRepository) DeleteIfUnreferenced(ctx context.Context, id uint64) (bool, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	blob, ok := r.store.blobs[id]
+	if !ok || blob.RefCount > 0 {
+		return false, nil
+	}
+	delete(r.store.blobs, id)
+	return true, nil
+}
+
+func (r *BlobRepository) FindAfterID(ctx context.Context, afterID uint64, limit int) ([]*services.Blob, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var blobs []*services.Blob
+	for _, blob := range r.store.blobs {
+		if blob.ID > afterID {
+			blobs = append(blobs, copyBlob(blob))
+		}
+	}
+	sortBlobs(blobs)
+
+	if limit >= 0 && len(blobs) > limit {
+		blobs = blobs[:limit]
+	}
+	return blobs, nil
+}
+
+func (r *BlobRepository) FindOrphaned(ctx context.Context) ([]*services.Blob, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	// trashed tracks and albums still hold their blobs
+	referenced := make(map[uint64]bool)
+	for _, track := range r.store.tracks {
+		if track.BlobID != nil {
+			referenced[*track.BlobID] = true
+		}
+	}
+	for _, album := range r.store.albums {
+		if album.CoverBlobID != nil {
+			referenced[*album.CoverBlobID] = true
+		}
+	}
+
+	var blobs []*services.Blob
+	for _, blob := range r.store.blobs {
+		if !referenced[blob.ID] {
+			blobs = append(blobs, copyBlob(blob))
+		}
+	}
+	sortBlobs(blobs)
+	return blobs, nil
+}
+
+func (r *BlobRepository) IsReferencedBy(ctx context.Context, id, userID uint64) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, album := range r.store.albums {
+		if album.UserID != userID {
+			continue
+		}
+		if album.CoverBlobID != nil && *album.CoverBlobID == id {
+			return true, nil
+		}
+		for _, track := range r.store.tracks {
+			if track.AlbumID == album.ID && track.BlobID != nil && *track.BlobID == id {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (r *BlobRepository) Stats(ctx context.Context) (int64, int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var bytes int64
+	for _, blob := range r.store.blobs {
+		bytes += blob.Size
+	}
+	return int64(len(r.store.blobs)), bytes, nil
+}
+
+func sortBlobs(blobs []*services.Blob) {
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].ID < blobs[j].ID })
+}
@@ -0,0 +1,20 @@
+package memory
+
+import (
+	"testing"
+	"vinyl-vault/internal/repositories/repositorytest"
+)
+
+func TestRepositoryContract(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		store := NewStore()
+		return repositorytest.Repositories{
+			Users:  NewUserRepository(store),
+			Keys:   NewRegistrationKeyRepository(store),
+			Blobs:  NewBlobRepository(store),
+			Albums: NewAlbumRepository(store),
+			Tracks: NewTrackRepository(store),
+			Scrubs: NewScrubRepository(store),
+		}
+	})
+}
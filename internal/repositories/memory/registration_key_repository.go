@@ -0,0 +1,88 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"vinyl-vault/internal/services"
+)
+
+type RegistrationKeyRepository struct {
+	store *Store
+}
+
+func NewRegistrationKeyRepository(store *Store) services.RegistrationKeyRepository {
+	return &RegistrationKeyRepository{
+		store: store,
+	}
+}
+
+func (r *RegistrationKeyRepository) FindByKey(ctx context.Context, key string) (*services.RegistrationKey, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, regKey := range r.store.keys {
+		if regKey.Key == key {
+			return copyKey(regKey), nil
+		}
+	}
+	return nil, services.ErrKeyNotFound
+}
+
+func (r *RegistrationKeyRepository) FindByCreator(ctx context.Context, creatorID uint64) ([]*services.RegistrationKey, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var keys []*services.RegistrationKey
+	for _, regKey := range r.store.keys {
+		if regKey.CreatedBy == creatorID {
+			keys = append(keys, copyKey(regKey))
+		}
+	}
+
+	// newest first
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.After(keys[j].CreatedAt)
+		}
+		return keys[i].ID > keys[j].ID
+	})
+	return keys, nil
+}
+
+func (r *RegistrationKeyRepository) Save(ctx context.Context, key *services.RegistrationKey) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, other := range r.store.keys {
+		if other.ID != key.ID && other.Key == key.Key {
+			return fmt.Errorf("failed to save registration key: key already exists")
+		}
+	}
+
+	var createdAt *time.Time
+	if existing, ok := r.store.keys[key.ID]; ok {
+		createdAt = &existing.CreatedAt
+	}
+	if key.ID == 0 {
+		key.ID = r.store.nextID("registration_keys")
+	} else {
+		r.store.useID("registration_keys", key.ID)
+	}
+	stamp(&key.CreatedAt, &key.UpdatedAt, createdAt)
+
+	r.store.keys[key.ID] = copyKey(key)
+	return nil
+}
+
+func (r *RegistrationKeyRepository) Delete(ctx context.Context, id uint64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.keys[id]; !ok {
+		return fmt.Errorf("registration key with id %d: %w", id, services.ErrKeyNotFound)
+	}
+	delete(r.store.keys, id)
+	return nil
+}
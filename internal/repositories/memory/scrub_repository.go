@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+	"vinyl-vault/internal/services"
+)
+
+type ScrubRepository struct {
+	store *Store
+}
+
+func NewScrubRepository(store *Store) services.ScrubRepository {
+	return &ScrubRepository{
+		store: store,
+	}
+}
+
+func (r *ScrubRepository) FindLatest(ctx context.Context) (*services.ScrubReport, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	report := r.latest(func(*services.ScrubReport) bool { return true })
+	if report == nil {
+		return nil, services.ErrScrubNotFound
+	}
+
+	c := copyScrubReport(report)
+	for _, issue := range r.store.scrubIssues {
+		if issue.ReportID == report.ID {
+			c.Issues = append(c.Issues, *copyScrubIssue(issue))
+		}
+	}
+	sort.Slice(c.Issues, func(i, j int) bool { return c.Issues[i].ID < c.Issues[j].ID })
+	return c, nil
+}
+
+func (r *ScrubRepository) FindUnfinished(ctx context.Context) (*services.ScrubReport, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	report := r.latest(func(report *services.ScrubReport) bool { return report.Status == services.ScrubRunning })
+	if report == nil {
+		return nil, services.ErrScrubNotFound
+	}
+	return copyScrubReport(report), nil
+}
+
+// latest returns the most recently started report that matches; callers must hold the lock
+func (r *ScrubRepository) latest(match func(*services.ScrubReport) bool) *services.ScrubReport {
+	var latest *services.ScrubReport
+	for _, report := range r.store.scrubReports {
+		if !match(report) {
+			continue
+		}
+		if latest == nil || report.StartedAt.After(latest.StartedAt) ||
+			(report.StartedAt.Equal(latest.StartedAt) && report.ID > latest.ID) {
+			latest = report
+		}
+	}
+	return latest
+}
+
+func (r *ScrubRepository) Save(ctx context.Context, report *services.ScrubReport) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	var createdAt *time.Time
+	if existing, ok := r.store.scrubReports[report.ID]; ok {
+		createdAt = &existing.CreatedAt
+	}
+	if report.ID == 0 {
+		report.ID = r.store.nextID("scrub_reports")
+	} else {
+		r.store.useID("scrub_reports", report.ID)
+	}
+	stamp(&report.CreatedAt, &report.UpdatedAt, createdAt)
+
+	// issues are appended through AddIssue as they are found
+	r.store.scrubReports[report.ID] = copyScrubReport(report)
+	return nil
+}
+
+func (r *ScrubRepository) AddIssue(ctx context.Context, issue *services.ScrubIssue) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.scrubReports[issue.ReportID]; !ok {
+		return fmt.Errorf("failed to save scrub issue: report %d does not exist", issue.ReportID)
+	}
+	for _, other := range r.store.scrubIssues {
+		if other.ReportID == issue.ReportID && other.Path == issue.Path && other.Kind == issue.Kind {
+			return nil
+		}
+	}
+
+	issue.ID = r.store.nextID("scrub_issues")
+	if issue.CreatedAt.IsZero() {
+		issue.CreatedAt = time.Now()
+	}
+	r.store.scrubIssues[issue.ID] = copyScrubIssue(issue)
+	return nil
+}
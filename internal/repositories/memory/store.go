@@ -0,0 +1,198 @@
+// Package memory implements the service repositories on top of in-process maps.
+// It mirrors the behavior of the Gorm repositories (soft deletes, cascades, unique
+// columns, ordering) so services can be tested without a database.
+package memory
+
+import (
+	"bytes"
+	"slices"
+	"sync"
+	"time"
+	"vinyl-vault/internal/services"
+)
+
+// Store holds the rows shared by the repositories, the way a database would:
+// albums see their tracks, tracks see their blobs. It is safe for concurrent use.
+type Store struct {
+	mu sync.RWMutex
+
+	users  map[uint64]*services.User
+	keys   map[uint64]*services.RegistrationKey
+	blobs  map[uint64]*services.Blob
+	albums map[uint64]*services.Album
+	media  map[uint64][]services.Medium // by album ID
+	tracks map[uint64]*services.Track
+
+	scrubReports map[uint64]*services.ScrubReport
+	scrubIssues  map[uint64]*services.ScrubIssue
+
+	// one sequence per table, like Postgres serials
+	sequences map[string]uint64
+}
+
+func NewStore() *Store {
+	return &Store{
+		users:  make(map[uint64]*services.User),
+		keys:   make(map[uint64]*services.RegistrationKey),
+		blobs:  make(map[uint64]*services.Blob),
+		albums: make(map[uint64]*services.Album),
+		media:  make(map[uint64][]services.Medium),
+		tracks: make(map[uint64]*services.Track),
+
+		scrubReports: make(map[uint64]*services.ScrubReport),
+		scrubIssues:  make(map[uint64]*services.ScrubIssue),
+
+		sequences: make(map[string]uint64),
+	}
+}
+
+// nextID returns the next ID of a table; callers must hold the write lock
+func (s *Store) nextID(table string) uint64 {
+	s.sequences[table]++
+	return s.sequences[table]
+}
+
+// useID keeps a table's sequence ahead of explicitly assigned IDs; callers must hold the write lock
+func (s *Store) useID(table string, id uint64) {
+	if id > s.sequences[table] {
+		s.sequences[table] = id
+	}
+}
+
+// stamp sets timestamps the way Gorm does on Save: CreatedAt once, UpdatedAt every time
+func stamp(createdAt, updatedAt *time.Time, existing *time.Time) {
+	now := time.Now()
+	if createdAt.IsZero() {
+		if existing != nil {
+			*createdAt = *existing
+		} else {
+			*createdAt = now
+		}
+	}
+	*updatedAt = now
+}
+
+func copyUser(user *services.User) *services.User {
+	c := *user
+	if user.StorageQuota != nil {
+		quota := *user.StorageQuota
+		c.StorageQuota = &quota
+	}
+	return &c
+}
+
+func copyKey(key *services.RegistrationKey) *services.RegistrationKey {
+	c := *key
+	if key.UsedBy != nil {
+		usedBy := *key.UsedBy
+		c.UsedBy = &usedBy
+	}
+	if key.UsedAt != nil {
+		usedAt := *key.UsedAt
+		c.UsedAt = &usedAt
+	}
+	return &c
+}
+
+func copyBlob(blob *services.Blob) *services.Blob {
+	c := *blob
+	if blob.Source != nil {
+		source := *blob.Source
+		source.Header = bytes.Clone(blob.Source.Header)
+		source.Trailer = bytes.Clone(blob.Source.Trailer)
+		c.Source = &source
+	}
+	return &c
+}
+
+// copyScrubReport copies the row only, issues are attached by the caller
+func copyScrubReport(report *services.ScrubReport) *services.ScrubReport {
+	c := *report
+	c.Issues = nil
+	if report.FinishedAt != nil {
+		finishedAt := *report.FinishedAt
+		c.FinishedAt = &finishedAt
+	}
+	return &c
+}
+
+func copyScrubIssue(issue *services.ScrubIssue) *services.ScrubIssue {
+	c := *issue
+	if issue.BlobID != nil {
+		blobID := *issue.BlobID
+		c.BlobID = &blobID
+	}
+	return &c
+}
+
+// copyAlbum copies the row only, associations are attached by the caller
+func copyAlbum(album *services.Album) *services.Album {
+	c := *album
+	c.Media = nil
+	c.Tracks = nil
+	if album.CoverBlobID != nil {
+		cover := *album.CoverBlobID
+		c.CoverBlobID = &cover
+	}
+	if album.Metadata.Label != nil {
+		label := *album.Metadata.Label
+		c.Metadata.Label = &label
+	}
+	if album.Metadata.Country != nil {
+		country := *album.Metadata.Country
+		c.Metadata.Country = &country
+	}
+	c.Metadata.Matrix = slices.Clone(album.Metadata.Matrix)
+	c.Metadata.Genres = slices.Clone(album.Metadata.Genres)
+	c.Metadata.Styles = slices.Clone(album.Metadata.Styles)
+	c.Loudness = copyLoudness(album.Loudness)
+	return &c
+}
+
+// albumWithMedia returns a copy of the album with its media attached; callers must hold the lock
+func (s *Store) albumWithMedia(album *services.Album) *services.Album {
+	c := copyAlbum(album)
+	c.Media = slices.Clone(s.media[album.ID])
+	return c
+}
+
+func copyTrack(track *services.Track) *services.Track {
+	c := *track
+	c.Blob = nil
+	c.Credits = slices.Clone(track.Credits)
+	if track.BlobID != nil {
+		blobID := *track.BlobID
+		c.BlobID = &blobID
+	}
+	if track.RipQuality != nil {
+		ripQuality := *track.RipQuality
+		ripQuality.Flags = slices.Clone(track.RipQuality.Flags)
+		c.RipQuality = &ripQuality
+	}
+	c.Loudness = copyLoudness(track.Loudness)
+	if track.LoudnessBlocks != nil {
+		c.LoudnessBlocks = &services.LoudnessBlocks{}
+		c.LoudnessBlocks.Merge(track.LoudnessBlocks)
+	}
+	return &c
+}
+
+func copyLoudness(loudness services.Loudness) services.Loudness {
+	if loudness.AnalyzedAt != nil {
+		at := *loudness.AnalyzedAt
+		loudness.AnalyzedAt = &at
+	}
+	return loudness
+}
+
+// trackWithBlob returns a copy of the track with its blob attached; callers must hold the lock
+func (s *Store) trackWithBlob(track *services.Track) *services.Track {
+	c := copyTrack(track)
+	if track.BlobID == nil {
+		return c
+	}
+	if blob, ok := s.blobs[*track.BlobID]; ok {
+		c.Blob = copyBlob(blob)
+	}
+	return c
+}
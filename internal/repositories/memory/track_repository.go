@@ -0,0 +1,168 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+	"vinyl-vault/internal/services"
+
+	"gorm.io/gorm"
+)
+
+type TrackRepository struct {
+	store *Store
+}
+
+func NewTrackRepository(store *Store) services.TrackRepository {
+	return &TrackRepository{
+		store: store,
+	}
+}
+
+func (r *TrackRepository) FindByID(ctx context.Context, id uint64) (*services.Track, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	track, ok := r.store.tracks[id]
+	if !ok || track.DeletedAt.Valid {
+		return nil, fmt.Errorf("track with id %d: %w", id, services.ErrTrackNotFound)
+	}
+	return r.store.trackWithBlob(track), nil
+}
+
+func (r *TrackRepository) FindByAlbumID(ctx context.Context, albumID uint64) ([]*services.Track, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var tracks []*services.Track
+	for _, track := range r.store.tracks {
+		if track.AlbumID == albumID && !track.DeletedAt.Valid {
+			tracks = append(tracks, r.store.trackWithBlob(track))
+		}
+	}
+
+	slices.SortFunc(tracks, services.CompareTracks)
+	return tracks, nil
+}
+
+func (r *TrackRepository) Save(ctx context.Context, track *services.Track) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	// the foreign keys the schema enforces
+	if _, ok := r.store.albums[track.AlbumID]; !ok {
+		return fmt.Errorf("failed to save track: album %d does not exist", track.AlbumID)
+	}
+	if track.BlobID != nil {
+		if _, ok := r.store.blobs[*track.BlobID]; !ok {
+			return fmt.Errorf("failed to save track: blob %d does not exist", *track.BlobID)
+		}
+	}
+
+	var createdAt *time.Time
+	if existing, ok := r.store.tracks[track.ID]; ok {
+		createdAt = &existing.CreatedAt
+	}
+	if track.ID == 0 {
+		track.ID = r.store.nextID("tracks")
+	} else {
+		r.store.useID("tracks", track.ID)
+	}
+	stamp(&track.CreatedAt, &track.UpdatedAt, createdAt)
+
+	r.store.tracks[track.ID] = copyTrack(track)
+	return nil
+}
+
+func (r *TrackRepository) Delete(ctx context.Context, id uint64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	track, ok := r.store.tracks[id]
+	if !ok || track.DeletedAt.Valid {
+		return fmt.Errorf("track with id %d: %w", id, services.ErrTrackNotFound)
+	}
+	track.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	return nil
+}
+
+func (r *TrackRepository) FindByIDWithDeleted(ctx context.Context, id uint64) (*services.Track, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	track, ok := r.store.tracks[id]
+	if !ok {
+		return nil, fmt.Errorf("track with id %d: %w", id, services.ErrTrackNotFound)
+	}
+	return r.store.trackWithBlob(track), nil
+}
+
+func (r *TrackRepository) FindDeletedByUserID(ctx context.Context, userID uint64) ([]*services.Track, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var tracks []*services.Track
+	for _, track := range r.store.tracks {
+		album, ok := r.store.albums[track.AlbumID]
+		if !ok || album.UserID != userID || album.DeletedAt.Valid || !track.DeletedAt.Valid {
+			continue
+		}
+		tracks = append(tracks, copyTrack(track))
+	}
+
+	// most recently trashed first
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i].DeletedAt.Time.After(tracks[j].DeletedAt.Time) })
+	return tracks, nil
+}
+
+func (r *TrackRepository) FindDeletedBefore(ctx context.Context, cutoff time.Time) ([]*services.Track, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var tracks []*services.Track
+	for _, track := range r.store.tracks {
+		if track.DeletedAt.Valid && track.DeletedAt.Time.Before(cutoff) {
+			tracks = append(tracks, copyTrack(track))
+		}
+	}
+	sort.Slice(tracks, func(i, j int) bool { return tracks[i].ID < tracks[j].ID })
+	return tracks, nil
+}
+
+func (r *TrackRepository) Restore(ctx context.Context, id uint64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	track, ok := r.store.tracks[id]
+	if !ok || !track.DeletedAt.Valid {
+		return fmt.Errorf("track with id %d in trash: %w", id, services.ErrTrackNotFound)
+	}
+	track.DeletedAt = gorm.DeletedAt{}
+	return nil
+}
+
+func (r *TrackRepository) Purge(ctx context.Context, id uint64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.tracks[id]; !ok {
+		return fmt.Errorf("track with id %d: %w", id, services.ErrTrackNotFound)
+	}
+	delete(r.store.tracks, id)
+	return nil
+}
+
+func (r *TrackRepository) Count(ctx context.Context) (int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	var count int64
+	for _, track := range r.store.tracks {
+		if !track.DeletedAt.Valid {
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,118 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"vinyl-vault/internal/services"
+)
+
+type UserRepository struct {
+	store *Store
+}
+
+func NewUserRepository(store *Store) services.UserRepository {
+	return &UserRepository{
+		store: store,
+	}
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, id uint64) (*services.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return nil, fmt.Errorf("user with id %d: %w", id, services.ErrUserNotFound)
+	}
+	return copyUser(user), nil
+}
+
+func (r *UserRepository) FindByUsername(ctx context.Context, username string) (*services.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, user := range r.store.users {
+		if user.Username == username {
+			return copyUser(user), nil
+		}
+	}
+	return nil, fmt.Errorf("user %q: %w", username, services.ErrUserNotFound)
+}
+
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*services.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, user := range r.store.users {
+		if user.Email == email {
+			return copyUser(user), nil
+		}
+	}
+	return nil, fmt.Errorf("user with email %q: %w", email, services.ErrUserNotFound)
+}
+
+func (r *UserRepository) Save(ctx context.Context, user *services.User) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for _, other := range r.store.users {
+		if other.ID == user.ID {
+			continue
+		}
+		if other.Username == user.Username || other.Email == user.Email {
+			return fmt.Errorf("failed to save user: %w", services.ErrUserExists)
+		}
+	}
+
+	existing, ok := r.store.users[user.ID]
+	if user.ID == 0 {
+		user.ID = r.store.nextID("users")
+	} else {
+		r.store.useID("users", user.ID)
+	}
+
+	// like the Gorm repository, storage usage only changes through AdjustStorageUsed
+	var used int64
+	var createdAt *time.Time
+	if ok {
+		used = existing.StorageUsed
+		createdAt = &existing.CreatedAt
+	}
+	stamp(&user.CreatedAt, &user.UpdatedAt, createdAt)
+
+	stored := copyUser(user)
+	stored.StorageUsed = used
+	r.store.users[user.ID] = stored
+	return nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id uint64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.users[id]; !ok {
+		return fmt.Errorf("user with id %d: %w", id, services.ErrUserNotFound)
+	}
+	delete(r.store.users, id)
+	return nil
+}
+
+func (r *UserRepository) AdjustStorageUsed(ctx context.Context, id uint64, delta int64) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return fmt.Errorf("user with id %d: %w", id, services.ErrUserNotFound)
+	}
+	user.StorageUsed = max(user.StorageUsed+delta, 0)
+	return nil
+}
+
+func (r *UserRepository) Count(ctx context.Context) (int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	return int64(len(r.store.users)), nil
+}
@@ -25,7 +25,7 @@ func (r *GormRegistrationKeyRepository) FindByKey(ctx context.Context, key strin
 	result := r.db.WithContext(ctx).Where("key = ?", key).First(&regKey)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("registration key not found")
+			return nil, services.ErrKeyNotFound
 		}
 		return nil, fmt.Errorf("failed to find registration key: %w", result.Error)
 	}
@@ -58,7 +58,7 @@ func (r *GormRegistrationKeyRepository) Delete(ctx context.Context, id uint64) e
 	}
 
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("registration key with id %d not found", id)
+		return fmt.Errorf("registration key with id %d: %w", id, services.ErrKeyNotFound)
 	}
 
 	return nil
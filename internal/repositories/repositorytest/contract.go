@@ -0,0 +1,757 @@
+// Package repositorytest is the behavior every repository backend must share.
+// Backends run it from their own tests with a factory returning empty repositories.
+package repositorytest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+	"vinyl-vault/internal/services"
+	"vinyl-vault/pkg"
+)
+
+// Repositories is one backend's set of repositories, all sharing the same storage
+type Repositories struct {
+	Users  services.UserRepository
+	Keys   services.RegistrationKeyRepository
+	Blobs  services.BlobRepository
+	Albums services.AlbumRepository
+	Tracks services.TrackRepository
+	Scrubs services.ScrubRepository
+}
+
+// Factory returns repositories over fresh, empty storage
+type Factory func(t *testing.T) Repositories
+
+func Run(t *testing.T, newRepositories Factory) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, newRepositories(t)) })
+	t.Run("RegistrationKeys", func(t *testing.T) { testRegistrationKeys(t, newRepositories(t)) })
+	t.Run("Albums", func(t *testing.T) { testAlbums(t, newRepositories(t)) })
+	t.Run("Tracks", func(t *testing.T) { testTracks(t, newRepositories(t)) })
+	t.Run("Blobs", func(t *testing.T) { testBlobs(t, newRepositories(t)) })
+	t.Run("Scrubs", func(t *testing.T) { testScrubs(t, newRepositories(t)) })
+}
+
+func testUsers(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := repos.Users.FindByID(ctx, 999)
+		expectError(t, "FindByID", err, services.ErrUserNotFound)
+		_, err = repos.Users.FindByUsername(ctx, "nobody")
+		expectError(t, "FindByUsername", err, services.ErrUserNotFound)
+		_, err = repos.Users.FindByEmail(ctx, "nobody@example.com")
+		expectError(t, "FindByEmail", err, services.ErrUserNotFound)
+		expectError(t, "Delete", repos.Users.Delete(ctx, 999), services.ErrUserNotFound)
+		expectError(t, "AdjustStorageUsed", repos.Users.AdjustStorageUsed(ctx, 999, 1), services.ErrUserNotFound)
+	})
+
+	user := mustSaveUser(t, repos, "alice")
+
+	t.Run("find", func(t *testing.T) {
+		if user.ID == 0 {
+			t.Fatal("Save() did not assign an ID")
+		}
+		for name, find := range map[string]func() (*services.User, error){
+			"FindByID":       func() (*services.User, error) { return repos.Users.FindByID(ctx, user.ID) },
+			"FindByUsername": func() (*services.User, error) { return repos.Users.FindByUsername(ctx, "alice") },
+			"FindByEmail":    func() (*services.User, error) { return repos.Users.FindByEmail(ctx, "alice@example.com") },
+		} {
+			found, err := find()
+			if err != nil {
+				t.Fatalf("%s() error = %v", name, err)
+			}
+			if found.ID != user.ID || found.Username != "alice" || found.PasswordHash != "hash" {
+				t.Errorf("%s() = %+v, want the saved user", name, found)
+			}
+		}
+		expectCount(t, "Count", repos.Users.Count, 1)
+	})
+
+	t.Run("unique username", func(t *testing.T) {
+		duplicate := &services.User{Username: "alice", Email: "other@example.com", PasswordHash: "hash"}
+		if err := repos.Users.Save(ctx, duplicate); !errors.Is(err, services.ErrUserExists) {
+			t.Errorf("Save() with a taken username error = %v, want ErrUserExists", err)
+		}
+	})
+
+	t.Run("conversion preset", func(t *testing.T) {
+		for _, preset := range []string{"cd", ""} {
+			user.ConversionPreset = preset
+			if err := repos.Users.Save(ctx, user); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			if found, err := repos.Users.FindByID(ctx, user.ID); err != nil || found.ConversionPreset != preset {
+				t.Errorf("FindByID() = %+v, %v; want conversion preset %q", found, err, preset)
+			}
+		}
+	})
+
+	t.Run("storage used", func(t *testing.T) {
+		if err := repos.Users.AdjustStorageUsed(ctx, user.ID, 100); err != nil {
+			t.Fatalf("AdjustStorageUsed() error = %v", err)
+		}
+
+		// a stale copy must not overwrite the usage
+		stale := *user
+		stale.StorageUsed = 0
+		stale.IsAdmin = true
+		if err := repos.Users.Save(ctx, &stale); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		expectStorageUsed(t, repos, user.ID, 100)
+
+		if err := repos.Users.AdjustStorageUsed(ctx, user.ID, -500); err != nil {
+			t.Fatalf("AdjustStorageUsed() error = %v", err)
+		}
+		expectStorageUsed(t, repos, user.ID, 0)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := repos.Users.Delete(ctx, user.ID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		_, err := repos.Users.FindByID(ctx, user.ID)
+		expectError(t, "FindByID after Delete", err, services.ErrUserNotFound)
+		expectError(t, "second Delete", repos.Users.Delete(ctx, user.ID), services.ErrUserNotFound)
+	})
+}
+
+func testRegistrationKeys(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := repos.Keys.FindByKey(ctx, "missing")
+		expectError(t, "FindByKey", err, services.ErrKeyNotFound)
+		expectError(t, "Delete", repos.Keys.Delete(ctx, 999), services.ErrKeyNotFound)
+	})
+
+	// saved out of order so insertion order can't pass for created_at order
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, k := range []struct {
+		key       string
+		createdBy uint64
+		age       time.Duration
+	}{
+		{"middle", 1, 2 * time.Minute},
+		{"newest", 1, time.Minute},
+		{"other-creator", 2, 0},
+		{"oldest", 1, 3 * time.Minute},
+	} {
+		key := &services.RegistrationKey{
+			Key:       k.key,
+			CreatedBy: k.createdBy,
+			ExpiresAt: base.Add(24 * time.Hour),
+			CreatedAt: base.Add(-k.age),
+		}
+		if err := repos.Keys.Save(ctx, key); err != nil {
+			t.Fatalf("Save(%s) error = %v", k.key, err)
+		}
+	}
+
+	t.Run("find by creator newest first", func(t *testing.T) {
+		keys, err := repos.Keys.FindByCreator(ctx, 1)
+		if err != nil {
+			t.Fatalf("FindByCreator() error = %v", err)
+		}
+		var got []string
+		for _, key := range keys {
+			got = append(got, key.Key)
+		}
+		expectOrder(t, "FindByCreator", got, []string{"newest", "middle", "oldest"})
+
+		if keys, _ = repos.Keys.FindByCreator(ctx, 3); len(keys) != 0 {
+			t.Errorf("FindByCreator() for a creator without keys returned %d keys", len(keys))
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		key, err := repos.Keys.FindByKey(ctx, "newest")
+		if err != nil {
+			t.Fatalf("FindByKey() error = %v", err)
+		}
+		if err = repos.Keys.Delete(ctx, key.ID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		_, err = repos.Keys.FindByKey(ctx, "newest")
+		expectError(t, "FindByKey after Delete", err, services.ErrKeyNotFound)
+		expectError(t, "second Delete", repos.Keys.Delete(ctx, key.ID), services.ErrKeyNotFound)
+	})
+}
+
+func testAlbums(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := repos.Albums.FindByID(ctx, 999)
+		expectError(t, "FindByID", err, services.ErrAlbumNotFound)
+		_, err = repos.Albums.FindByIDWithDeleted(ctx, 999)
+		expectError(t, "FindByIDWithDeleted", err, services.ErrAlbumNotFound)
+		expectError(t, "Delete", repos.Albums.Delete(ctx, 999), services.ErrAlbumNotFound)
+		expectError(t, "Restore", repos.Albums.Restore(ctx, 999), services.ErrAlbumNotFound)
+		expectError(t, "Purge", repos.Albums.Purge(ctx, 999), services.ErrAlbumNotFound)
+	})
+
+	album := mustSaveAlbum(t, repos, 1, "Blue Train")
+	blob := mustSaveBlob(t, repos, "a")
+	track := mustSaveTrack(t, repos, album.ID, 1, blob.ID)
+
+	t.Run("find", func(t *testing.T) {
+		found, err := repos.Albums.FindByID(ctx, album.ID)
+		if err != nil {
+			t.Fatalf("FindByID() error = %v", err)
+		}
+		if found.Metadata.Album != "Blue Train" || len(found.Tracks) != 1 {
+			t.Errorf("FindByID() = %+v, want the album with its track", found)
+		}
+
+		albums, err := repos.Albums.FindByUserID(ctx, 1)
+		if err != nil || len(albums) != 1 {
+			t.Errorf("FindByUserID() = %d albums, %v; want 1", len(albums), err)
+		}
+		albums, err = repos.Albums.FindByArtist(ctx, "Artist")
+		if err != nil || len(albums) != 1 {
+			t.Errorf("FindByArtist() = %d albums, %v; want 1", len(albums), err)
+		}
+	})
+
+	t.Run("media", func(t *testing.T) {
+		album.Media = []services.Medium{{Number: 1, Format: `12"`, Speed: 33}, {Number: 2, Format: `12"`, Speed: 45}}
+		if err := repos.Albums.Save(ctx, album); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		found, err := repos.Albums.FindByID(ctx, album.ID)
+		if err != nil || len(found.Media) != 2 || found.Media[1].Number != 2 || found.Media[1].Speed != 45 {
+			t.Fatalf("FindByID() media = %+v, %v; want two discs", found.Media, err)
+		}
+
+		// saving replaces the media, and keeps the tracks
+		found.Media = found.Media[:1]
+		found.Media[0].Format = `10"`
+		if err = repos.Albums.Save(ctx, found); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		albums, err := repos.Albums.FindByUserID(ctx, 1)
+		if err != nil || len(albums) != 1 || len(albums[0].Media) != 1 || albums[0].Media[0].Format != `10"` {
+			t.Errorf("FindByUserID() after replacing media = %+v, %v; want one 10\" disc", albums, err)
+		}
+		if len(albums) == 1 && len(albums[0].Tracks) != 1 {
+			t.Errorf("FindByUserID() = %d tracks after replacing media, want 1", len(albums[0].Tracks))
+		}
+	})
+
+	t.Run("release details", func(t *testing.T) {
+		found, err := repos.Albums.FindByID(ctx, album.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found.Metadata.CatalogNumber = "SHVL 798"
+		found.Metadata.Matrix = []pkg.Matrix{{Side: "A", Etching: "A-1U"}, {Side: "B", Etching: "B-1U"}}
+		found.Metadata.Genres = []string{"Rock"}
+		found.Metadata.Styles = []string{"Krautrock", "Experimental"}
+		if err = repos.Albums.Save(ctx, found); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		found.Metadata.Matrix[0].Etching = "changed after saving"
+
+		found, err = repos.Albums.FindByID(ctx, album.ID)
+		if err != nil || found.Metadata.CatalogNumber != "SHVL 798" || len(found.Metadata.Matrix) != 2 ||
+			found.Metadata.Matrix[0].Etching != "A-1U" || !slices.Equal(found.Metadata.Styles, []string{"Krautrock", "Experimental"}) {
+			t.Errorf("FindByID() metadata = %+v, %v; want the release details saved", found.Metadata, err)
+		}
+
+		track := &found.Tracks[0]
+		track.Credits = []pkg.Credit{{Role: "performer", Name: "Holger Czukay", Detail: "bass"}}
+		if err = repos.Tracks.Save(ctx, track); err != nil {
+			t.Fatalf("Save() track error = %v", err)
+		}
+		saved, err := repos.Tracks.FindByID(ctx, track.ID)
+		if err != nil || len(saved.Credits) != 1 || saved.Credits[0] != track.Credits[0] {
+			t.Errorf("FindByID() credits = %+v, %v; want %+v", saved, err, track.Credits)
+		}
+	})
+
+	t.Run("trash", func(t *testing.T) {
+		expectError(t, "Restore of a live album", repos.Albums.Restore(ctx, album.ID), services.ErrAlbumNotFound)
+
+		if err := repos.Albums.Delete(ctx, album.ID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		_, err := repos.Albums.FindByID(ctx, album.ID)
+		expectError(t, "FindByID after Delete", err, services.ErrAlbumNotFound)
+		expectError(t, "second Delete", repos.Albums.Delete(ctx, album.ID), services.ErrAlbumNotFound)
+		expectCount(t, "Count after Delete", repos.Albums.Count, 0)
+
+		if albums, _ := repos.Albums.FindByUserID(ctx, 1); len(albums) != 0 {
+			t.Errorf("FindByUserID() returned %d trashed albums", len(albums))
+		}
+		if albums, _ := repos.Albums.FindDeletedByUserID(ctx, 1); len(albums) != 1 {
+			t.Errorf("FindDeletedByUserID() = %d albums, want 1", len(albums))
+		}
+		if albums, _ := repos.Albums.FindDeletedBefore(ctx, time.Now().Add(time.Minute)); len(albums) != 1 {
+			t.Errorf("FindDeletedBefore() = %d albums, want 1", len(albums))
+		}
+		if albums, _ := repos.Albums.FindDeletedBefore(ctx, time.Now().Add(-time.Hour)); len(albums) != 0 {
+			t.Errorf("FindDeletedBefore() an hour ago = %d albums, want 0", len(albums))
+		}
+
+		found, err := repos.Albums.FindByIDWithDeleted(ctx, album.ID)
+		if err != nil || !found.DeletedAt.Valid {
+			t.Fatalf("FindByIDWithDeleted() = %+v, %v; want the trashed album", found, err)
+		}
+
+		if err = repos.Albums.Restore(ctx, album.ID); err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		if _, err = repos.Albums.FindByID(ctx, album.ID); err != nil {
+			t.Errorf("FindByID() after Restore error = %v", err)
+		}
+	})
+
+	t.Run("purge cascades to tracks", func(t *testing.T) {
+		if err := repos.Albums.Purge(ctx, album.ID); err != nil {
+			t.Fatalf("Purge() error = %v", err)
+		}
+		_, err := repos.Albums.FindByIDWithDeleted(ctx, album.ID)
+		expectError(t, "FindByIDWithDeleted after Purge", err, services.ErrAlbumNotFound)
+		_, err = repos.Tracks.FindByIDWithDeleted(ctx, track.ID)
+		expectError(t, "track FindByIDWithDeleted after Purge", err, services.ErrTrackNotFound)
+		expectError(t, "second Purge", repos.Albums.Purge(ctx, album.ID), services.ErrAlbumNotFound)
+	})
+}
+
+func testTracks(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := repos.Tracks.FindByID(ctx, 999)
+		expectError(t, "FindByID", err, services.ErrTrackNotFound)
+		_, err = repos.Tracks.FindByIDWithDeleted(ctx, 999)
+		expectError(t, "FindByIDWithDeleted", err, services.ErrTrackNotFound)
+		expectError(t, "Delete", repos.Tracks.Delete(ctx, 999), services.ErrTrackNotFound)
+		expectError(t, "Restore", repos.Tracks.Restore(ctx, 999), services.ErrTrackNotFound)
+		expectError(t, "Purge", repos.Tracks.Purge(ctx, 999), services.ErrTrackNotFound)
+	})
+
+	album := mustSaveAlbum(t, repos, 1, "Kind of Blue")
+	blob := mustSaveBlob(t, repos, "b")
+
+	// saved out of order so insertion order can't pass for track order
+	tracks := make(map[int]*services.Track)
+	for _, number := range []int{3, 1, 4, 2} {
+		tracks[number] = mustSaveTrack(t, repos, album.ID, number, blob.ID)
+	}
+
+	t.Run("find", func(t *testing.T) {
+		found, err := repos.Tracks.FindByID(ctx, tracks[1].ID)
+		if err != nil {
+			t.Fatalf("FindByID() error = %v", err)
+		}
+		if found.TrackNumber != 1 || found.Blob == nil || found.Blob.ID != blob.ID {
+			t.Errorf("FindByID() = %+v, want track 1 with its blob", found)
+		}
+	})
+
+	t.Run("find by album in track order", func(t *testing.T) {
+		found, err := repos.Tracks.FindByAlbumID(ctx, album.ID)
+		if err != nil {
+			t.Fatalf("FindByAlbumID() error = %v", err)
+		}
+		expectOrder(t, "FindByAlbumID", trackNumbers(found), []int{1, 2, 3, 4})
+
+		if found, _ = repos.Tracks.FindByAlbumID(ctx, 999); len(found) != 0 {
+			t.Errorf("FindByAlbumID() for a missing album returned %d tracks", len(found))
+		}
+	})
+
+	t.Run("trash", func(t *testing.T) {
+		if err := repos.Tracks.Delete(ctx, tracks[2].ID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		_, err := repos.Tracks.FindByID(ctx, tracks[2].ID)
+		expectError(t, "FindByID after Delete", err, services.ErrTrackNotFound)
+		expectError(t, "second Delete", repos.Tracks.Delete(ctx, tracks[2].ID), services.ErrTrackNotFound)
+
+		found, err := repos.Tracks.FindByAlbumID(ctx, album.ID)
+		if err != nil {
+			t.Fatalf("FindByAlbumID() error = %v", err)
+		}
+		expectOrder(t, "FindByAlbumID without trashed", trackNumbers(found), []int{1, 3, 4})
+		expectCount(t, "Count after Delete", repos.Tracks.Count, 3)
+
+		deleted, err := repos.Tracks.FindDeletedByUserID(ctx, 1)
+		if err != nil || len(deleted) != 1 || deleted[0].ID != tracks[2].ID {
+			t.Errorf("FindDeletedByUserID() = %d tracks, %v; want track 2", len(deleted), err)
+		}
+
+		// tracks of a trashed album are listed with the album, not on their own
+		if err = repos.Albums.Delete(ctx, album.ID); err != nil {
+			t.Fatalf("album Delete() error = %v", err)
+		}
+		if deleted, _ = repos.Tracks.FindDeletedByUserID(ctx, 1); len(deleted) != 0 {
+			t.Errorf("FindDeletedByUserID() with the album trashed = %d tracks, want 0", len(deleted))
+		}
+		if err = repos.Albums.Restore(ctx, album.ID); err != nil {
+			t.Fatalf("album Restore() error = %v", err)
+		}
+
+		if err = repos.Tracks.Restore(ctx, tracks[2].ID); err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		if found, _ = repos.Tracks.FindByAlbumID(ctx, album.ID); len(found) != 4 {
+			t.Errorf("FindByAlbumID() after Restore = %d tracks, want 4", len(found))
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		if err := repos.Tracks.Purge(ctx, tracks[4].ID); err != nil {
+			t.Fatalf("Purge() error = %v", err)
+		}
+		_, err := repos.Tracks.FindByIDWithDeleted(ctx, tracks[4].ID)
+		expectError(t, "FindByIDWithDeleted after Purge", err, services.ErrTrackNotFound)
+	})
+
+	t.Run("play order", func(t *testing.T) {
+		double := mustSaveAlbum(t, repos, 1, "Tago Mago")
+		// disc, side and number, saved out of order
+		for _, position := range []struct {
+			disc   int
+			side   string
+			number int
+		}{{2, "C", 1}, {1, "B", 2}, {1, "A", 10}, {1, "B", 1}, {1, "A", 2}} {
+			track := &services.Track{AlbumID: double.ID, DiscNumber: position.disc, Side: position.side,
+				TrackNumber: position.number, Title: "Track", BlobID: &blob.ID}
+			if err := repos.Tracks.Save(ctx, track); err != nil {
+				t.Fatalf("saving track: %v", err)
+			}
+		}
+		want := []string{"A2", "A10", "B1", "B2", "C1"}
+
+		found, err := repos.Tracks.FindByAlbumID(ctx, double.ID)
+		if err != nil {
+			t.Fatalf("FindByAlbumID() error = %v", err)
+		}
+		expectOrder(t, "FindByAlbumID", trackPositions(found), want)
+
+		withTracks, err := repos.Albums.FindByID(ctx, double.ID)
+		if err != nil {
+			t.Fatalf("FindByID() error = %v", err)
+		}
+		albumTracks := make([]*services.Track, len(withTracks.Tracks))
+		for i := range withTracks.Tracks {
+			albumTracks[i] = &withTracks.Tracks[i]
+		}
+		expectOrder(t, "album FindByID tracks", trackPositions(albumTracks), want)
+	})
+
+	t.Run("stub", func(t *testing.T) {
+		other := mustSaveAlbum(t, repos, 1, "Sketches of Spain")
+		stub := &services.Track{AlbumID: other.ID, DiscNumber: 1, TrackNumber: 1, Title: "Concierto de Aranjuez"}
+		if err := repos.Tracks.Save(ctx, stub); err != nil {
+			t.Fatalf("Save() stub error = %v", err)
+		}
+		found, err := repos.Tracks.FindByID(ctx, stub.ID)
+		if err != nil || !found.IsStub() || found.Blob != nil {
+			t.Fatalf("FindByID() = %+v, %v; want a stub without a blob", found, err)
+		}
+
+		found.BlobID = &blob.ID
+		if err = repos.Tracks.Save(ctx, found); err != nil {
+			t.Fatalf("Save() filled stub error = %v", err)
+		}
+		if found, err = repos.Tracks.FindByID(ctx, stub.ID); err != nil || found.Blob == nil || found.Blob.ID != blob.ID {
+			t.Errorf("FindByID() = %+v, %v; want the stub filled with blob %d", found, err, blob.ID)
+		}
+	})
+
+	t.Run("loudness", func(t *testing.T) {
+		analyzed := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+		track := tracks[2]
+		track.Loudness = services.Loudness{Integrated: -14.2, TruePeak: -0.8, Range: 6.5, AnalyzedAt: &analyzed}
+		track.LoudnessBlocks = &services.LoudnessBlocks{
+			Momentary: services.LoudnessHistogram{-142: {Blocks: 3, Energy: 0.12}},
+			ShortTerm: services.LoudnessHistogram{-140: {Blocks: 1, Energy: 0.04}},
+		}
+		if err := repos.Tracks.Save(ctx, track); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		found, err := repos.Tracks.FindByID(ctx, track.ID)
+		if err != nil {
+			t.Fatalf("FindByID() error = %v", err)
+		}
+		if found.Loudness.Integrated != -14.2 || found.Loudness.TruePeak != -0.8 || found.Loudness.Range != 6.5 ||
+			found.Loudness.AnalyzedAt == nil || !found.Loudness.AnalyzedAt.Equal(analyzed) {
+			t.Errorf("FindByID() Loudness = %+v, want %+v", found.Loudness, track.Loudness)
+		}
+		if found.LoudnessBlocks == nil || found.LoudnessBlocks.Momentary[-142] != (services.LoudnessBin{Blocks: 3, Energy: 0.12}) ||
+			found.LoudnessBlocks.ShortTerm[-140].Blocks != 1 {
+			t.Errorf("FindByID() LoudnessBlocks = %+v, want %+v", found.LoudnessBlocks, track.LoudnessBlocks)
+		}
+
+		album.Loudness = services.Loudness{Integrated: -15, TruePeak: -0.5, Range: 8, AnalyzedAt: &analyzed}
+		if err = repos.Albums.Save(ctx, album); err != nil {
+			t.Fatalf("Save() album error = %v", err)
+		}
+		foundAlbum, err := repos.Albums.FindByID(ctx, album.ID)
+		if err != nil || foundAlbum.Loudness.Integrated != -15 || foundAlbum.Loudness.Range != 8 {
+			t.Errorf("FindByID() album = %+v, %v; want its loudness", foundAlbum, err)
+		}
+	})
+
+	t.Run("rip quality", func(t *testing.T) {
+		analyzed := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+		track := tracks[2]
+		track.RipQuality = &pkg.RipQuality{
+			ClippedSamples: 12, ClicksPerMinute: 14.5, Bandwidth: 16000, EffectiveBitDepth: 16,
+			Flags: []string{pkg.RipClipping, pkg.RipClicks, pkg.RipLossySource}, AnalyzedAt: analyzed,
+		}
+		if err := repos.Tracks.Save(ctx, track); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		found, err := repos.Tracks.FindByID(ctx, track.ID)
+		if err != nil {
+			t.Fatalf("FindByID() error = %v", err)
+		}
+		if found.RipQuality == nil || found.RipQuality.ClippedSamples != 12 || found.RipQuality.Bandwidth != 16000 ||
+			!slices.Equal(found.RipQuality.Flags, track.RipQuality.Flags) || !found.RipQuality.AnalyzedAt.Equal(analyzed) {
+			t.Errorf("FindByID() RipQuality = %+v, want %+v", found.RipQuality, track.RipQuality)
+		}
+	})
+}
+
+func testBlobs(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+
+	t.Run("stats", func(t *testing.T) {
+		if count, bytes, err := repos.Blobs.Stats(ctx); err != nil || count != 0 || bytes != 0 {
+			t.Errorf("Stats() on an empty store = %d, %d, %v; want 0, 0", count, bytes, err)
+		}
+
+		mustSaveBlob(t, repos, "a")
+		mustSaveBlob(t, repos, "b")
+		count, bytes, err := repos.Blobs.Stats(ctx)
+		if err != nil {
+			t.Fatalf("Stats() error = %v", err)
+		}
+		if count != 2 || bytes != 2 {
+			t.Errorf("Stats() = %d blobs, %d bytes; want 2, 2", count, bytes)
+		}
+	})
+
+	t.Run("find by source hash", func(t *testing.T) {
+		blob := &services.Blob{
+			Hash: "flac", Size: 1, Path: "blobs/flac.flac", SourceHash: "aiff",
+			Source: &services.BlobSource{Ext: ".aiff", Size: 3, Encoder: "pcm_s24be", PCMMD5: "md5", Header: []byte("FORM")},
+		}
+		if err := repos.Blobs.Save(ctx, blob); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		for _, hash := range []string{"flac", "aiff"} {
+			found, err := repos.Blobs.FindByHash(ctx, hash)
+			if err != nil || found.ID != blob.ID {
+				t.Errorf("FindByHash(%q) = %+v, %v; want blob %d", hash, found, err, blob.ID)
+				continue
+			}
+			if found.Source == nil || found.Source.Encoder != "pcm_s24be" || string(found.Source.Header) != "FORM" {
+				t.Errorf("FindByHash(%q).Source = %+v, want it saved", hash, found.Source)
+			}
+		}
+		_, err := repos.Blobs.FindByHash(ctx, "")
+		expectError(t, "FindByHash", err, services.ErrBlobNotFound)
+	})
+
+	t.Run("update path", func(t *testing.T) {
+		blob := mustSaveBlob(t, repos, "moved")
+		if _, err := repos.Blobs.AdjustRefCount(ctx, blob.ID, 2); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Blobs.UpdatePath(ctx, blob.ID, "blobs/moved.flac"); err != nil {
+			t.Fatalf("UpdatePath() error = %v", err)
+		}
+		found, err := repos.Blobs.FindByID(ctx, blob.ID)
+		if err != nil || found.Path != "blobs/moved.flac" || found.RefCount != 2 {
+			t.Errorf("FindByID() after UpdatePath() = %+v, %v; want the new path and 2 references", found, err)
+		}
+		err = repos.Blobs.UpdatePath(ctx, blob.ID+1000, "blobs/none")
+		expectError(t, "UpdatePath", err, services.ErrBlobNotFound)
+	})
+
+	t.Run("referenced by", func(t *testing.T) {
+		owner, other := mustSaveUser(t, repos, "holger"), mustSaveUser(t, repos, "irmin")
+		album := mustSaveAlbum(t, repos, owner.ID, "Tago Mago")
+		audio, trashed, cover := mustSaveBlob(t, repos, "audio"), mustSaveBlob(t, repos, "trashed"), mustSaveBlob(t, repos, "cover")
+		mustSaveTrack(t, repos, album.ID, 1, audio.ID)
+		if err := repos.Tracks.Delete(ctx, mustSaveTrack(t, repos, album.ID, 2, trashed.ID).ID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		album.CoverBlobID = &cover.ID
+		if err := repos.Albums.Save(ctx, album); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+
+		for _, blob := range []*services.Blob{audio, trashed, cover} {
+			if referenced, err := repos.Blobs.IsReferencedBy(ctx, blob.ID, owner.ID); err != nil || !referenced {
+				t.Errorf("IsReferencedBy(%s, owner) = %v, %v; want true", blob.Hash, referenced, err)
+			}
+			if referenced, err := repos.Blobs.IsReferencedBy(ctx, blob.ID, other.ID); err != nil || referenced {
+				t.Errorf("IsReferencedBy(%s, other) = %v, %v; want false", blob.Hash, referenced, err)
+			}
+		}
+	})
+}
+
+func testScrubs(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := repos.Scrubs.FindLatest(ctx)
+		expectError(t, "FindLatest", err, services.ErrScrubNotFound)
+		_, err = repos.Scrubs.FindUnfinished(ctx)
+		expectError(t, "FindUnfinished", err, services.ErrScrubNotFound)
+	})
+
+	started := time.Now().Add(-time.Hour)
+	running := &services.ScrubReport{Status: services.ScrubRunning, StartedAt: started}
+	completed := &services.ScrubReport{Status: services.ScrubCompleted, StartedAt: started.Add(time.Minute)}
+	for _, report := range []*services.ScrubReport{running, completed} {
+		if err := repos.Scrubs.Save(ctx, report); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	t.Run("find", func(t *testing.T) {
+		if latest, err := repos.Scrubs.FindLatest(ctx); err != nil || latest.ID != completed.ID {
+			t.Errorf("FindLatest() = %+v, %v; want report %d", latest, err, completed.ID)
+		}
+		if unfinished, err := repos.Scrubs.FindUnfinished(ctx); err != nil || unfinished.ID != running.ID {
+			t.Errorf("FindUnfinished() = %+v, %v; want report %d", unfinished, err, running.ID)
+		}
+	})
+
+	t.Run("issues are unique per path and kind", func(t *testing.T) {
+		blobID := uint64(1)
+		for _, issue := range []services.ScrubIssue{
+			{ReportID: completed.ID, Kind: services.ScrubIssueMissing, BlobID: &blobID, Path: "blobs/a"},
+			{ReportID: completed.ID, Kind: services.ScrubIssueMissing, BlobID: &blobID, Path: "blobs/a"},
+			{ReportID: completed.ID, Kind: services.ScrubIssueOrphaned, BlobID: &blobID, Path: "blobs/a"},
+			{ReportID: completed.ID, Kind: services.ScrubIssueOrphaned, Path: "blobs/b"},
+			{ReportID: running.ID, Kind: services.ScrubIssueMissing, BlobID: &blobID, Path: "blobs/a"},
+		} {
+			if err := repos.Scrubs.AddIssue(ctx, &issue); err != nil {
+				t.Fatalf("AddIssue() error = %v", err)
+			}
+		}
+
+		// saving the report keeps the issues it doesn't carry
+		completed.FilesChecked = 2
+		if err := repos.Scrubs.Save(ctx, completed); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+
+		latest, err := repos.Scrubs.FindLatest(ctx)
+		if err != nil {
+			t.Fatalf("FindLatest() error = %v", err)
+		}
+		var issues []string
+		for _, issue := range latest.Issues {
+			issues = append(issues, string(issue.Kind)+" "+issue.Path)
+		}
+		expectOrder(t, "FindLatest", issues, []string{"missing blobs/a", "orphaned blobs/a", "orphaned blobs/b"})
+		if latest.FilesChecked != 2 {
+			t.Errorf("FindLatest().FilesChecked = %d, want 2", latest.FilesChecked)
+		}
+	})
+}
+
+func mustSaveUser(t *testing.T, repos Repositories, username string) *services.User {
+	t.Helper()
+	user := &services.User{Username: username, Email: username + "@example.com", PasswordHash: "hash"}
+	if err := repos.Users.Save(context.Background(), user); err != nil {
+		t.Fatalf("saving user: %v", err)
+	}
+	return user
+}
+
+func mustSaveBlob(t *testing.T, repos Repositories, hash string) *services.Blob {
+	t.Helper()
+	blob := &services.Blob{Hash: hash, Size: 1, Path: "blobs/" + hash}
+	if err := repos.Blobs.Save(context.Background(), blob); err != nil {
+		t.Fatalf("saving blob: %v", err)
+	}
+	return blob
+}
+
+func mustSaveAlbum(t *testing.T, repos Repositories, userID uint64, title string) *services.Album {
+	t.Helper()
+	album := &services.Album{UserID: userID, Metadata: pkg.Metadata{Artist: "Artist", Album: title}}
+	if err := repos.Albums.Save(context.Background(), album); err != nil {
+		t.Fatalf("saving album: %v", err)
+	}
+	return album
+}
+
+func mustSaveTrack(t *testing.T, repos Repositories, albumID uint64, number int, blobID uint64) *services.Track {
+	t.Helper()
+	track := &services.Track{AlbumID: albumID, TrackNumber: number, Title: "Track", BlobID: &blobID}
+	if err := repos.Tracks.Save(context.Background(), track); err != nil {
+		t.Fatalf("saving track: %v", err)
+	}
+	return track
+}
+
+func expectError(t *testing.T, op string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s() error = %v, want %v", op, err, want)
+	}
+}
+
+func expectCount(t *testing.T, op string, count func(context.Context) (int64, error), want int64) {
+	t.Helper()
+	if got, err := count(context.Background()); err != nil || got != want {
+		t.Errorf("%s() = %d, %v; want %d", op, got, err, want)
+	}
+}
+
+func expectStorageUsed(t *testing.T, repos Repositories, id uint64, want int64) {
+	t.Helper()
+	user, err := repos.Users.FindByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if user.StorageUsed != want {
+		t.Errorf("StorageUsed = %d, want %d", user.StorageUsed, want)
+	}
+}
+
+func expectOrder[T comparable](t *testing.T, op string, got, want []T) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s() = %v, want %v", op, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s() = %v, want %v", op, got, want)
+			return
+		}
+	}
+}
+
+func trackNumbers(tracks []*services.Track) []int {
+	numbers := make([]int, len(tracks))
+	for i, track := range tracks {
+		numbers[i] = track.TrackNumber
+	}
+	return numbers
+}
+
+func trackPositions(tracks []*services.Track) []string {
+	positions := make([]string, len(tracks))
+	for i, track := range tracks {
+		positions[i] = track.Position()
+	}
+	return positions
+}
@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"vinyl-vault/internal/services"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GormScrubRepository struct {
+	db *gorm.DB
+}
+
+func NewGormScrubRepository(db *gorm.DB) services.ScrubRepository {
+	return &GormScrubRepository{
+		db: db,
+	}
+}
+
+func (r *GormScrubRepository) FindLatest(ctx context.Context) (*services.ScrubReport, error) {
+	var report services.ScrubReport
+
+	result := r.db.WithContext(ctx).
+		Preload("Issues", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Order("started_at DESC").First(&report)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, services.ErrScrubNotFound
+		}
+		return nil, fmt.Errorf("failed to find scrub report: %w", result.Error)
+	}
+	return &report, nil
+}
+
+func (r *GormScrubRepository) FindUnfinished(ctx context.Context) (*services.ScrubReport, error) {
+	var report services.ScrubReport
+
+	result := r.db.WithContext(ctx).Where("status = ?", services.ScrubRunning).Order("started_at DESC").First(&report)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, services.ErrScrubNotFound
+		}
+		return nil, fmt.Errorf("failed to find scrub report: %w", result.Error)
+	}
+	return &report, nil
+}
+
+func (r *GormScrubRepository) Save(ctx context.Context, report *services.ScrubReport) error {
+	// issues are appended through AddIssue as they are found
+	result := r.db.WithContext(ctx).Omit("Issues").Save(report)
+	if result.Error != nil {
+		return fmt.Errorf("failed to save scrub report: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *GormScrubRepository) AddIssue(ctx context.Context, issue *services.ScrubIssue) error {
+	result := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(issue)
+	if result.Error != nil {
+		return fmt.Errorf("failed to save scrub issue: %w", result.Error)
+	}
+	return nil
+}
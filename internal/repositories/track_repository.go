@@ -4,12 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"vinyl-vault/internal/services"
 
 	"gorm.io/gorm"
 )
 
+// trackOrder is the order tracks play in, as services.CompareTracks sorts them
+const trackOrder = "disc_number, LENGTH(side), side, track_number, id"
+
 type GormTrackRepository struct {
 	db *gorm.DB
 }
@@ -23,10 +27,10 @@ func NewGormTrackRepository(db *gorm.DB) services.TrackRepository {
 func (r *GormTrackRepository) FindByID(ctx context.Context, id uint64) (*services.Track, error) {
 	var track services.Track
 
-	result := r.db.WithContext(ctx).First(&track, id)
+	result := r.db.WithContext(ctx).Preload("Blob").First(&track, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("track with id %d not found", id)
+			return nil, fmt.Errorf("track with id %d: %w", id, services.ErrTrackNotFound)
 		}
 		return nil, fmt.Errorf("failed to find track: %w", result.Error)
 	}
@@ -36,7 +40,7 @@ func (r *GormTrackRepository) FindByID(ctx context.Context, id uint64) (*service
 func (r *GormTrackRepository) FindByAlbumID(ctx context.Context, albumID uint64) ([]*services.Track, error) {
 	var tracks []*services.Track
 
-	result := r.db.WithContext(ctx).Where("album_id = ?", albumID).Order("track_number ASC").Find(&tracks)
+	result := r.db.WithContext(ctx).Preload("Blob").Where("album_id = ?", albumID).Order(trackOrder).Find(&tracks)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to find tracks: %w", result.Error)
 	}
@@ -60,7 +64,80 @@ func (r *GormTrackRepository) Delete(ctx context.Context, id uint64) error {
 	}
 
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("track with id %d not found", id)
+		return fmt.Errorf("track with id %d: %w", id, services.ErrTrackNotFound)
+	}
+	return nil
+}
+
+func (r *GormTrackRepository) FindByIDWithDeleted(ctx context.Context, id uint64) (*services.Track, error) {
+	var track services.Track
+
+	result := r.db.WithContext(ctx).Unscoped().Preload("Blob").First(&track, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("track with id %d: %w", id, services.ErrTrackNotFound)
+		}
+		return nil, fmt.Errorf("failed to find track: %w", result.Error)
+	}
+	return &track, nil
+}
+
+func (r *GormTrackRepository) FindDeletedByUserID(ctx context.Context, userID uint64) ([]*services.Track, error) {
+	var tracks []*services.Track
+
+	result := r.db.WithContext(ctx).Unscoped().
+		Joins("JOIN albums ON albums.id = tracks.album_id").
+		Where("albums.user_id = ? AND albums.deleted_at IS NULL AND tracks.deleted_at IS NOT NULL", userID).
+		Order("tracks.deleted_at DESC").
+		Find(&tracks)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find deleted tracks: %w", result.Error)
+	}
+	return tracks, nil
+}
+
+func (r *GormTrackRepository) FindDeletedBefore(ctx context.Context, cutoff time.Time) ([]*services.Track, error) {
+	var tracks []*services.Track
+
+	result := r.db.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Find(&tracks)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to find deleted tracks: %w", result.Error)
+	}
+	return tracks, nil
+}
+
+func (r *GormTrackRepository) Restore(ctx context.Context, id uint64) error {
+	result := r.db.WithContext(ctx).Unscoped().Model(&services.Track{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to restore track: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("track with id %d in trash: %w", id, services.ErrTrackNotFound)
 	}
 	return nil
 }
+
+func (r *GormTrackRepository) Purge(ctx context.Context, id uint64) error {
+	result := r.db.WithContext(ctx).Unscoped().Delete(&services.Track{}, id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to purge track: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("track with id %d: %w", id, services.ErrTrackNotFound)
+	}
+	return nil
+}
+
+func (r *GormTrackRepository) Count(ctx context.Context) (int64, error) {
+	var count int64
+	if result := r.db.WithContext(ctx).Model(&services.Track{}).Count(&count); result.Error != nil {
+		return 0, fmt.Errorf("failed to count tracks: %w", result.Error)
+	}
+	return count, nil
+}
@@ -26,7 +26,7 @@ func (r *GormUserRepository) FindByID(ctx context.Context, id uint64) (*services
 	result := r.db.WithContext(ctx).First(&user, id)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("user with id %d not found", id)
+			return nil, fmt.Errorf("user with id %d: %w", id, services.ErrUserNotFound)
 		}
 		return nil, fmt.Errorf("failed to find user: %w", result.Error)
 	}
@@ -37,6 +37,9 @@ func (r *GormUserRepository) FindByUsername(ctx context.Context, username string
 
 	var user services.User
 	if result := r.db.WithContext(ctx).Where("username = ?", username).First(&user); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("user %q: %w", username, services.ErrUserNotFound)
+		}
 		return nil, fmt.Errorf("failed to find user: %w", result.Error)
 	}
 	return &user, nil
@@ -46,14 +49,21 @@ func (r *GormUserRepository) FindByEmail(ctx context.Context, email string) (*se
 
 	var user services.User
 	if result := r.db.WithContext(ctx).Where("email = ?", email).First(&user); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("user with email %q: %w", email, services.ErrUserNotFound)
+		}
 		return nil, fmt.Errorf("failed to find user: %w", result.Error)
 	}
 	return &user, nil
 }
 
 func (r *GormUserRepository) Save(ctx context.Context, user *services.User) error {
-	result := r.db.WithContext(ctx).Save(user)
+	// storage usage is only ever changed through AdjustStorageUsed, a stale copy must not overwrite it
+	result := r.db.WithContext(ctx).Omit("StorageUsed").Save(user)
 	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrDuplicatedKey) {
+			return fmt.Errorf("failed to save user: %w", services.ErrUserExists)
+		}
 		return fmt.Errorf("failed to save user: %w", result.Error)
 	}
 	return nil
@@ -65,7 +75,28 @@ func (r *GormUserRepository) Delete(ctx context.Context, id uint64) error {
 		return fmt.Errorf("failed to delete user: %w", result.Error)
 	}
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("user with id %d not found", id)
+		return fmt.Errorf("user with id %d: %w", id, services.ErrUserNotFound)
 	}
 	return nil
 }
+
+func (r *GormUserRepository) AdjustStorageUsed(ctx context.Context, id uint64, delta int64) error {
+	// clamped at zero; CASE rather than GREATEST so it runs on SQLite too
+	result := r.db.WithContext(ctx).Model(&services.User{}).Where("id = ?", id).
+		UpdateColumn("storage_used", gorm.Expr("CASE WHEN storage_used + ? < 0 THEN 0 ELSE storage_used + ? END", delta, delta))
+	if result.Error != nil {
+		return fmt.Errorf("failed to update storage usage: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user with id %d: %w", id, services.ErrUserNotFound)
+	}
+	return nil
+}
+
+func (r *GormUserRepository) Count(ctx context.Context) (int64, error) {
+	var count int64
+	if result := r.db.WithContext(ctx).Model(&services.User{}).Count(&count); result.Error != nil {
+		return 0, fmt.Errorf("failed to count users: %w", result.Error)
+	}
+	return count, nil
+}
@@ -3,50 +3,104 @@ package services
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
+	"vinyl-vault/internal/logging"
 	"vinyl-vault/pkg"
+
+	"gorm.io/gorm"
 )
 
 type Album struct {
-	ID        uint64       `json:"id" gorm:"primaryKey;autoIncrement"`
-	UserID    uint64       `json:"user_id" gorm:"not null;index"`
-	Metadata  pkg.Metadata `json:"metadata" gorm:"embedded;embeddedPrefix:metadata_"`
-	Tracks    []Track      `json:"tracks" gorm:"foreignKey:AlbumID;constraint:OnDelete:CASCADE"`
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"updated_at"`
+	ID          uint64         `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID      uint64         `json:"user_id" gorm:"not null;index"`
+	Metadata    pkg.Metadata   `json:"metadata" gorm:"embedded;embeddedPrefix:metadata_"`
+	CoverBlobID *uint64        `json:"cover_blob_id,omitempty" gorm:"index"`
+	Media       []Medium       `json:"media" gorm:"foreignKey:AlbumID;constraint:OnDelete:CASCADE"`
+	Tracks      []Track        `json:"tracks" gorm:"foreignKey:AlbumID;constraint:OnDelete:CASCADE"`
+	Loudness    Loudness       `json:"loudness,omitzero" gorm:"embedded;embeddedPrefix:loudness_"` // of its analyzed tracks together
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// Medium is one disc of a release. Tracks refer to it by its number.
+type Medium struct {
+	AlbumID uint64 `json:"-" gorm:"primaryKey;autoIncrement:false"`
+	Number  int    `json:"number" gorm:"primaryKey;autoIncrement:false"` // 1 for the first disc
+	Format  string `json:"format,omitempty" gorm:"not null;default:''"`  // 12", 10", 7"...
+	Speed   int    `json:"speed,omitempty" gorm:"not null;default:0"`    // RPM, 33 standing for 33⅓
+}
+
+func (Medium) TableName() string {
+	return "media"
+}
+
+// mediumSpeeds are the speeds records are cut at
+var mediumSpeeds = map[int]bool{33: true, 45: true, 78: true}
+
+// Medium returns the album's disc with the given number, or nil
+func (a *Album) Medium(number int) *Medium {
+	for i := range a.Media {
+		if a.Media[i].Number == number {
+			return &a.Media[i]
+		}
+	}
+	return nil
 }
 
 type AlbumRepository interface {
 	FindByID(ctx context.Context, id uint64) (*Album, error)
 	FindByUserID(ctx context.Context, userID uint64) ([]*Album, error)
 	FindByArtist(ctx context.Context, artist string) ([]*Album, error)
-	Save(ctx context.Context, track *Album) error
+	// Save also replaces the album's media with album.Media
+	Save(ctx context.Context, album *Album) error
+	// Delete moves the album to the trash, Purge removes it for good
 	Delete(ctx context.Context, id uint64) error
+
+	// FindByIDWithDeleted also returns trashed albums, with all their tracks
+	FindByIDWithDeleted(ctx context.Context, id uint64) (*Album, error)
+	FindDeletedByUserID(ctx context.Context, userID uint64) ([]*Album, error)
+	FindDeletedBefore(ctx context.Context, cutoff time.Time) ([]*Album, error)
+	Restore(ctx context.Context, id uint64) error
+	Purge(ctx context.Context, id uint64) error
+
+	// Count returns the number of albums outside the trash
+	Count(ctx context.Context) (int64, error)
 }
 
 type AlbumService struct {
 	albumRepository AlbumRepository
-	fileService     *FileService
+	trackRepository TrackRepository
+	blobService     BlobReleaser
 }
 
-func NewAlbumService(albumRepository AlbumRepository, fileService *FileService) *AlbumService {
+func NewAlbumService(albumRepository AlbumRepository, trackRepository TrackRepository, blobService BlobReleaser) *AlbumService {
 	return &AlbumService{
 		albumRepository: albumRepository,
-		fileService:     fileService,
+		trackRepository: trackRepository,
+		blobService:     blobService,
 	}
 }
 
-func (a *AlbumService) CreateAlbum(ctx context.Context, userID uint64, metadata pkg.Metadata) (*Album, error) {
-	if metadata.Artist == "" || metadata.Album == "" {
-		return nil, fmt.Errorf("artist and album are required")
+// CreateAlbum creates an album. Without media it is a single disc of the album's format.
+func (a *AlbumService) CreateAlbum(ctx context.Context, userID uint64, metadata pkg.Metadata, media []Medium) (*Album, error) {
+	if err := validateMetadata(&metadata); err != nil {
+		return nil, err
 	}
-	if metadata.Format == "" {
-		return nil, fmt.Errorf("format is required")
+	if len(media) == 0 {
+		media = []Medium{defaultMedium(metadata.Format)}
+	}
+	if err := validateMedia(media); err != nil {
+		return nil, err
 	}
 
 	album := &Album{
 		UserID:   userID,
 		Metadata: metadata,
+		Media:    media,
 	}
 	if err := a.albumRepository.Save(ctx, album); err != nil {
 		return nil, fmt.Errorf("failed to create album: %w", err)
@@ -88,8 +142,24 @@ func (a *AlbumService) IsOwner(ctx context.Context, albumID, userID uint64) (boo
 	return album.UserID == userID, nil
 }
 
-// UpdateAlbumInfo updates album's metadata and coverart if present
-func (a *AlbumService) UpdateAlbumInfo(ctx context.Context, userID, albumID uint64, metadata pkg.Metadata) (*Album, error) {
+// UpdateAlbumInfo updates album's metadata, its media unless media is nil, and the
+// credits of the tracks listed in credits, by track ID. Cover art is managed by SetCoverArt.
+func (a *AlbumService) UpdateAlbumInfo(
+	ctx context.Context, userID, albumID uint64, metadata pkg.Metadata, media []Medium, credits map[uint64][]pkg.Credit,
+) (*Album, error) {
+	if err := validateMetadata(&metadata); err != nil {
+		return nil, err
+	}
+	if media != nil {
+		if err := validateMedia(media); err != nil {
+			return nil, err
+		}
+	}
+	for _, trackCredits := range credits {
+		if err := validateCredits(trackCredits); err != nil {
+			return nil, err
+		}
+	}
 
 	album, err := a.albumRepository.FindByID(ctx, albumID)
 	if err != nil {
@@ -97,40 +167,187 @@ func (a *AlbumService) UpdateAlbumInfo(ctx context.Context, userID, albumID uint
 	}
 
 	if album.UserID != userID {
-		return nil, fmt.Errorf("unauthorized: you don't own this album")
+		return nil, fmt.Errorf("album %d: %w", albumID, ErrNotOwner)
 	}
 
-	// If updating cover art, delete old one
-	if metadata.CoverArtPath != "" && metadata.CoverArtPath != album.Metadata.CoverArtPath {
-		if album.Metadata.CoverArtPath != "" {
-			a.fileService.DeleteCoverArt(album.Metadata.CoverArtPath)
+	if media != nil {
+		if err = checkMediaInUse(album, media); err != nil {
+			return nil, err
+		}
+		album.Media = media
+	}
+	credited := make([]*Track, 0, len(credits))
+	for trackID, trackCredits := range credits {
+		i := slices.IndexFunc(album.Tracks, func(track Track) bool { return track.ID == trackID })
+		if i < 0 {
+			return nil, NewValidationError("credits", fmt.Sprintf("track %d is not on this album", trackID))
 		}
+		album.Tracks[i].Credits = trackCredits
+		credited = append(credited, &album.Tracks[i])
 	}
+	metadata.CoverArtPath = album.Metadata.CoverArtPath
 	album.Metadata = metadata
 
 	if err = a.albumRepository.Save(ctx, album); err != nil {
 		return nil, fmt.Errorf("failed to update album's metadata: %w", err)
 	}
+	for _, track := range credited {
+		if err = a.trackRepository.Save(ctx, track); err != nil {
+			return nil, fmt.Errorf("failed to update credits of track %d: %w", track.ID, err)
+		}
+	}
 	return album, nil
 }
 
-func (a *AlbumService) DeleteAlbum(ctx context.Context, userID, albumID uint64) error {
+// SetCoverArt points the album at a stored cover blob and releases the previous one.
+// The caller hands over its reference to blob; it is released if the update fails.
+func (a *AlbumService) SetCoverArt(ctx context.Context, userID, albumID uint64, blob *Blob) (*Album, error) {
 
 	album, err := a.albumRepository.FindByID(ctx, albumID)
 	if err != nil {
-		return fmt.Errorf("album not found: %w", err)
+		a.blobService.ReleaseBlob(ctx, userID, blob.ID)
+		return nil, fmt.Errorf("album not found: %w", err)
 	}
 
 	if album.UserID != userID {
-		return fmt.Errorf("unauthorized: you don't own this album")
+		a.blobService.ReleaseBlob(ctx, userID, blob.ID)
+		return nil, fmt.Errorf("album %d: %w", albumID, ErrNotOwner)
+	}
+
+	previous := album.CoverBlobID
+	album.CoverBlobID = &blob.ID
+	album.Metadata.CoverArtPath = blob.Path
+
+	if err = a.albumRepository.Save(ctx, album); err != nil {
+		a.blobService.ReleaseBlob(ctx, userID, blob.ID)
+		return nil, fmt.Errorf("failed to update album's cover art: %w", err)
 	}
 
-	if album.Metadata.CoverArtPath != "" {
-		a.fileService.DeleteCoverArt(album.Metadata.CoverArtPath)
+	if previous != nil {
+		a.blobService.ReleaseBlob(ctx, album.UserID, *previous)
 	}
+	return album, nil
+}
 
+func (a *AlbumService) DeleteAlbum(ctx context.Context, userID, albumID uint64) error {
+
+	album, err := a.albumRepository.FindByID(ctx, albumID)
+	if err != nil {
+		return fmt.Errorf("album not found: %w", err)
+	}
+
+	if album.UserID != userID {
+		return fmt.Errorf("album %d: %w", albumID, ErrNotOwner)
+	}
+
+	// soft delete: media stays on disk until the album is purged from the trash
 	if err = a.albumRepository.Delete(ctx, albumID); err != nil {
 		return fmt.Errorf("failed to delete album: %w", err)
 	}
+	logging.FromContext(ctx).Info("album moved to trash", "album_id", albumID, "user_id", userID)
+	return nil
+}
+
+// barcodePattern matches UPC and EAN codes, which are printed with spaces between groups
+var barcodePattern = regexp.MustCompile(`^[0-9 ]{8,17}$`)
+
+// validateMetadata checks the fields every album needs and the release details, trimming
+// the details and dropping empty or repeated genres and styles
+func validateMetadata(metadata *pkg.Metadata) error {
+	var errs ValidationErrors
+	if metadata.Artist == "" {
+		errs = append(errs, NewValidationError("artist", "is required"))
+	}
+	if metadata.Album == "" {
+		errs = append(errs, NewValidationError("album", "is required"))
+	}
+	if metadata.Format == "" {
+		errs = append(errs, NewValidationError("format", "is required"))
+	}
+
+	metadata.CatalogNumber = strings.TrimSpace(metadata.CatalogNumber)
+	metadata.Barcode = strings.TrimSpace(metadata.Barcode)
+	metadata.PressingPlant = strings.TrimSpace(metadata.PressingPlant)
+	metadata.EditionNotes = strings.TrimSpace(metadata.EditionNotes)
+	if metadata.Barcode != "" && !barcodePattern.MatchString(metadata.Barcode) {
+		errs = append(errs, NewValidationError("barcode", "must be the digits of a UPC or EAN code"))
+	}
+	sides := make(map[string]bool)
+	for i := range metadata.Matrix {
+		matrix := &metadata.Matrix[i]
+		matrix.Side = strings.ToUpper(strings.TrimSpace(matrix.Side))
+		matrix.Etching = strings.TrimSpace(matrix.Etching)
+		switch {
+		case !sidePattern.MatchString(matrix.Side):
+			errs = append(errs, NewValidationError("matrix", "every etching needs a side, such as A or AA"))
+		case sides[matrix.Side]:
+			errs = append(errs, NewValidationError("matrix", fmt.Sprintf("side %s is listed twice", matrix.Side)))
+		case matrix.Etching == "":
+			errs = append(errs, NewValidationError("matrix", fmt.Sprintf("side %s has no etching", matrix.Side)))
+		}
+		sides[matrix.Side] = true
+	}
+	metadata.Genres = tidyTags(metadata.Genres)
+	metadata.Styles = tidyTags(metadata.Styles)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// tidyTags trims genres or styles and drops empty and repeated ones, ignoring case
+func tidyTags(tags []string) []string {
+	var tidy []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.ContainsFunc(tidy, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			tidy = append(tidy, tag)
+		}
+	}
+	return tidy
+}
+
+// defaultMedium is the single disc of an album created without media, sized after
+// its format where that names one (as migration 0008 does for existing albums)
+func defaultMedium(format string) Medium {
+	switch strings.ToUpper(strings.TrimSpace(format)) {
+	case "LP", `12"`:
+		return Medium{Number: 1, Format: `12"`, Speed: 33}
+	case `10"`:
+		return Medium{Number: 1, Format: `10"`}
+	case `7"`, "SINGLE":
+		return Medium{Number: 1, Format: `7"`, Speed: 45}
+	}
+	return Medium{Number: 1}
+}
+
+// validateMedia checks disc numbers and speeds, and sorts the media by number
+func validateMedia(media []Medium) error {
+	seen := make(map[int]bool)
+	for i := range media {
+		medium := &media[i]
+		medium.Format = strings.TrimSpace(medium.Format)
+		switch {
+		case medium.Number < 1:
+			return NewValidationError("media", "disc numbers start at 1")
+		case seen[medium.Number]:
+			return NewValidationError("media", fmt.Sprintf("disc %d is listed twice", medium.Number))
+		case medium.Speed != 0 && !mediumSpeeds[medium.Speed]:
+			return NewValidationError("media", fmt.Sprintf("disc %d: speed must be 33, 45 or 78 RPM", medium.Number))
+		}
+		seen[medium.Number] = true
+	}
+	slices.SortFunc(media, func(a, b Medium) int { return a.Number - b.Number })
+	return nil
+}
+
+// checkMediaInUse refuses to drop a disc that still has tracks on it
+func checkMediaInUse(album *Album, media []Medium) error {
+	kept := &Album{Media: media}
+	for _, track := range album.Tracks {
+		if kept.Medium(track.DiscNumber) == nil {
+			return NewValidationError("media", fmt.Sprintf("disc %d still has tracks", track.DiscNumber))
+		}
+	}
 	return nil
 }
@@ -0,0 +1,238 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+	"vinyl-vault/internal/services"
+	"vinyl-vault/pkg"
+)
+
+// release creates an album of the user through the service, so its details are validated
+func (f *fixture) release(t *testing.T, albumService *services.AlbumService, userID uint64, metadata pkg.Metadata, media []services.Medium) *services.Album {
+	t.Helper()
+	if metadata.Format == "" {
+		metadata.Format = "LP"
+	}
+	album, err := albumService.CreateAlbum(context.Background(), userID, metadata, media)
+	if err != nil {
+		t.Fatalf("CreateAlbum(%s) error = %v", metadata.Album, err)
+	}
+	return album
+}
+
+// credited saves a track of the album at position, credited to credits
+func (f *fixture) credited(t *testing.T, albumID uint64, disc int, side string, number int, title string, credits ...pkg.Credit) *services.Track {
+	t.Helper()
+	track := &services.Track{AlbumID: albumID, DiscNumber: disc, Side: side, TrackNumber: number, Title: title, Credits: credits}
+	if err := f.tracks.Save(context.Background(), track); err != nil {
+		t.Fatalf("saving track: %v", err)
+	}
+	return track
+}
+
+func TestAlbumService_SearchAlbums(t *testing.T) {
+	f := newFixture(t)
+	albumService := services.NewAlbumService(f.albums, f.tracks, f.blobService)
+	user := f.user(t, "alice")
+	other := f.user(t, "bob")
+	label := "United Artists"
+
+	tagoMago := f.release(t, albumService, user.ID, pkg.Metadata{
+		Artist: "Can", Album: "Tago Mago", Label: &label, CatalogNumber: "UAS 29211",
+		Matrix: []pkg.Matrix{{Side: "A", Etching: "ST-UA-29211-A1"}},
+		Genres: []string{"Rock"}, Styles: []string{"Krautrock"},
+	}, nil)
+	f.credited(t, tagoMago.ID, 1, "A", 1, "Paperhouse", pkg.Credit{Role: "producer", Name: "Holger Czukay"})
+	neu := f.release(t, albumService, user.ID, pkg.Metadata{
+		Artist: "Neu!", Album: "Neu! 75", Barcode: "4 015698 008716",
+		Genres: []string{"Rock", "Electronic"}, Styles: []string{"Krautrock", "Ambient"},
+	}, nil)
+	f.credited(t, neu.ID, 1, "A", 1, "Isi", pkg.Credit{Role: "engineer", Name: "Conny Plank"})
+	zuckerzeit := f.release(t, albumService, user.ID, pkg.Metadata{
+		Artist: "Cluster", Album: "Zuckerzeit", Genres: []string{"Electronic"}, Styles: []string{"Ambient"},
+	}, nil)
+	f.credited(t, zuckerzeit.ID, 1, "A", 1, "Hollywood", pkg.Credit{Role: "producer", Name: "Conny Plank"})
+	// found by every query below but for the owner
+	f.release(t, albumService, other.ID, pkg.Metadata{
+		Artist: "Cluster", Album: "Zuckerzeit Tago Mago Neu! 75", CatalogNumber: "UAS 29211",
+		Genres: []string{"Rock", "Electronic"}, Styles: []string{"Krautrock", "Ambient"},
+	}, nil)
+
+	tests := []struct {
+		name    string
+		query   services.AlbumQuery
+		want    []string
+		wantErr bool
+	}{
+		{name: "title", query: services.AlbumQuery{Text: "mago"}, want: []string{"Tago Mago"}},
+		{name: "words across fields in album order", query: services.AlbumQuery{Text: "ROCK krautrock"}, want: []string{"Tago Mago", "Neu! 75"}},
+		{name: "label and track title", query: services.AlbumQuery{Text: "united paperhouse"}, want: []string{"Tago Mago"}},
+		{name: "catalog number without spaces", query: services.AlbumQuery{Text: "uas29211"}, want: []string{"Tago Mago"}},
+		{name: "matrix etching with dashes", query: services.AlbumQuery{Text: "29211-a1"}, want: []string{"Tago Mago"}},
+		{name: "barcode without spaces", query: services.AlbumQuery{Text: "4015698008716"}, want: []string{"Neu! 75"}},
+		{name: "genre", query: services.AlbumQuery{Genre: "electronic"}, want: []string{"Neu! 75", "Zuckerzeit"}},
+		{name: "genre and style", query: services.AlbumQuery{Genre: "Rock", Style: "Ambient"}, want: []string{"Neu! 75"}},
+		{name: "credit", query: services.AlbumQuery{Credit: "plank"}, want: []string{"Neu! 75", "Zuckerzeit"}},
+		{name: "credit and text", query: services.AlbumQuery{Credit: "Plank", Text: "cluster"}, want: []string{"Zuckerzeit"}},
+		{name: "style and credit", query: services.AlbumQuery{Style: "Krautrock", Credit: "czukay"}, want: []string{"Tago Mago"}},
+		{name: "a genre no album has", query: services.AlbumQuery{Genre: "Jazz"}, want: []string{}},
+		{name: "a word no album has", query: services.AlbumQuery{Text: "mago jazz"}, want: []string{}},
+		{name: "nothing to search for", query: services.AlbumQuery{Text: "  "}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			albums, err := albumService.SearchAlbums(context.Background(), user.ID, tt.query)
+			if tt.wantErr {
+				if !services.IsValidation(err) {
+					t.Fatalf("SearchAlbums() error = %v, want a validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SearchAlbums() error = %v", err)
+			}
+			titles := make([]string, 0, len(albums))
+			for _, album := range albums {
+				titles = append(titles, album.Metadata.Album)
+			}
+			if !slices.Equal(titles, tt.want) {
+				t.Errorf("SearchAlbums(%+v) = %q, want %q", tt.query, titles, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlbumService_CreateAlbumValidatesRelease(t *testing.T) {
+	f := newFixture(t)
+	albumService := services.NewAlbumService(f.albums, f.tracks, f.blobService)
+	user := f.user(t, "alice")
+
+	tests := []struct {
+		name       string
+		metadata   pkg.Metadata
+		wantFields []string
+	}{
+		{name: "barcode with letters", metadata: pkg.Metadata{Barcode: "UAS 29211"}, wantFields: []string{"barcode"}},
+		{name: "barcode too short", metadata: pkg.Metadata{Barcode: "4015"}, wantFields: []string{"barcode"}},
+		{name: "etching without a side", metadata: pkg.Metadata{Matrix: []pkg.Matrix{{Etching: "A-1"}}}, wantFields: []string{"matrix"}},
+		{name: "side that is no side", metadata: pkg.Metadata{Matrix: []pkg.Matrix{{Side: "1", Etching: "A-1"}}}, wantFields: []string{"matrix"}},
+		{
+			name:       "side listed twice",
+			metadata:   pkg.Metadata{Matrix: []pkg.Matrix{{Side: "a", Etching: "A-1"}, {Side: " A ", Etching: "A-2"}}},
+			wantFields: []string{"matrix"},
+		},
+		{name: "side without an etching", metadata: pkg.Metadata{Matrix: []pkg.Matrix{{Side: "B", Etching: "  "}}}, wantFields: []string{"matrix"}},
+		{
+			name:       "every invalid field at once",
+			metadata:   pkg.Metadata{Artist: "-", Barcode: "n/a", Matrix: []pkg.Matrix{{Side: "A"}}},
+			wantFields: []string{"album", "format", "barcode", "matrix"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata := tt.metadata
+			if metadata.Artist == "" {
+				metadata.Artist, metadata.Album, metadata.Format = "Can", "Tago Mago", "LP"
+			}
+			_, err := albumService.CreateAlbum(context.Background(), user.ID, metadata, nil)
+			var errs services.ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("CreateAlbum() error = %v, want validation errors", err)
+			}
+			var fields []string
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("CreateAlbum() invalid fields = %q, want %q", fields, tt.wantFields)
+			}
+		})
+	}
+
+	t.Run("details are tidied", func(t *testing.T) {
+		album := f.release(t, albumService, user.ID, pkg.Metadata{
+			Artist: "Can", Album: "Tago Mago", CatalogNumber: "  UAS 29211 ", Barcode: " 4015698008716 ",
+			Matrix: []pkg.Matrix{{Side: " b ", Etching: " UAS 29211 B-1 "}},
+			Genres: []string{"Rock", " rock ", ""}, Styles: []string{" Krautrock"},
+		}, nil)
+		metadata := album.Metadata
+		if metadata.CatalogNumber != "UAS 29211" || metadata.Barcode != "4015698008716" {
+			t.Errorf("CreateAlbum() catalog number %q, barcode %q; want them trimmed", metadata.CatalogNumber, metadata.Barcode)
+		}
+		if want := []pkg.Matrix{{Side: "B", Etching: "UAS 29211 B-1"}}; !slices.Equal(metadata.Matrix, want) {
+			t.Errorf("CreateAlbum() matrix = %+v, want %+v", metadata.Matrix, want)
+		}
+		if !slices.Equal(metadata.Genres, []string{"Rock"}) || !slices.Equal(metadata.Styles, []string{"Krautrock"}) {
+			t.Errorf("CreateAlbum() genres %q, styles %q; want [Rock] and [Krautrock]", metadata.Genres, metadata.Styles)
+		}
+	})
+}
+
+func TestAlbumService_ExportAlbums(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	albumService := services.NewAlbumService(f.albums, f.tracks, f.blobService)
+	user := f.user(t, "alice")
+	label, country := "United Artists", "DE"
+
+	tagoMago := f.release(t, albumService, user.ID, pkg.Metadata{
+		Artist: "Can", Album: "Tago Mago", Format: "2xLP", Label: &label, Country: &country,
+		CatalogNumber: "UAS 29211", Matrix: []pkg.Matrix{{Side: "A", Etching: "UAS 29211 A-1"}, {Side: "C", Etching: "UAS 29212 C-1"}},
+		Genres: []string{"Rock"},
+	}, []services.Medium{{Number: 2, Format: `12"`, Speed: 33}, {Number: 1, Format: `12"`, Speed: 33}})
+	producer := pkg.Credit{Role: "producer", Name: "Holger Czukay"}
+	f.credited(t, tagoMago.ID, 2, "C", 1, "Aumgn")
+	f.credited(t, tagoMago.ID, 1, "B", 1, "Halleluhwah")
+	f.credited(t, tagoMago.ID, 1, "A", 1, "Paperhouse", producer)
+	f.credited(t, tagoMago.ID, 1, "A", 2, "Mushroom")
+	// a CD has no sides, and its positions are the track numbers
+	cd := f.release(t, albumService, user.ID, pkg.Metadata{Artist: "Cluster", Album: "Zuckerzeit", Format: "CD"}, nil)
+	f.credited(t, cd.ID, 1, "", 1, "Hollywood")
+	trashed := f.release(t, albumService, user.ID, pkg.Metadata{Artist: "Neu!", Album: "Neu! 75"}, nil)
+	f.trashAlbum(t, trashed, time.Now())
+
+	export, err := albumService.ExportAlbums(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("ExportAlbums() error = %v", err)
+	}
+	if export.Version != services.ExportVersion || len(export.Releases) != 2 {
+		t.Fatalf("ExportAlbums() = version %d with %d releases, want version %d with 2", export.Version, len(export.Releases), services.ExportVersion)
+	}
+
+	release := export.Releases[0]
+	if release.Title != "Tago Mago" || release.Format != "2xLP" || release.Label != label || release.Country != country ||
+		release.CatalogNumber != "UAS 29211" || !slices.Equal(release.Matrix, tagoMago.Metadata.Matrix) {
+		t.Errorf("ExportAlbums() release = %+v, want the details of Tago Mago", release)
+	}
+	// sorted by number, without the album they belong to
+	want := []services.Medium{{Number: 1, Format: `12"`, Speed: 33}, {Number: 2, Format: `12"`, Speed: 33}}
+	for i := range release.Media {
+		release.Media[i].AlbumID = 0
+	}
+	if !slices.Equal(release.Media, want) {
+		t.Errorf("ExportAlbums() media = %+v, want %+v", release.Media, want)
+	}
+	var positions []string
+	for _, track := range release.Tracks {
+		positions = append(positions, track.Position+" "+track.Title)
+	}
+	if want := []string{"A1 Paperhouse", "A2 Mushroom", "B1 Halleluhwah", "C1 Aumgn"}; !slices.Equal(positions, want) {
+		t.Errorf("ExportAlbums() tracks = %q, want %q", positions, want)
+	}
+	if track := release.Tracks[3]; track.DiscNumber != 2 || track.Side != "C" {
+		t.Errorf("ExportAlbums() Aumgn on disc %d side %q, want disc 2 side C", track.DiscNumber, track.Side)
+	}
+	if credits := release.Tracks[0].Credits; !slices.Equal(credits, []pkg.Credit{producer}) {
+		t.Errorf("ExportAlbums() Paperhouse credits = %+v, want %+v", credits, producer)
+	}
+
+	cdRelease := export.Releases[1]
+	if len(cdRelease.Media) != 1 || len(cdRelease.Tracks) != 1 || cdRelease.Tracks[0].Position != "1" || cdRelease.Tracks[0].Side != "" {
+		t.Errorf("ExportAlbums() CD = %+v, want one disc with track 1", cdRelease)
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+	"vinyl-vault/internal/logging"
+	"vinyl-vault/internal/metrics"
+)
+
+// analysisQueueSize bounds the tracks waiting for analysis; a bulk upload beyond it
+// is caught up with AnalyzeAlbum
+const analysisQueueSize = 1024
+
+// AnalysisQueue takes tracks whose audio was just stored, to analyze in the background
+type AnalysisQueue interface {
+	Enqueue(trackIDs ...uint64)
+}
+
+// enqueueAnalysis hands tracks to queue, if the service has been given one
+func enqueueAnalysis(queue AnalysisQueue, trackIDs ...uint64) {
+	if queue != nil {
+		queue.Enqueue(trackIDs...)
+	}
+}
+
+// AnalysisService measures the loudness of tracks as they are ingested, and that of
+// their albums from the tracks, and checks the tracks' rips for faults on the same pass
+type AnalysisService struct {
+	trackRepository   TrackRepository
+	albumRepository   AlbumRepository
+	fileService       *FileService
+	conversionService *ConversionService
+	queue             chan uint64
+}
+
+func NewAnalysisService(
+	trackRepository TrackRepository, albumRepository AlbumRepository,
+	fileService *FileService, conversionService *ConversionService,
+) *AnalysisService {
+	return &AnalysisService{
+		trackRepository:   trackRepository,
+		albumRepository:   albumRepository,
+		fileService:       fileService,
+		conversionService: conversionService,
+		queue:             make(chan uint64, analysisQueueSize),
+	}
+}
+
+// Start analyzes queued tracks, one at a time, until ctx is cancelled
+func (a *AnalysisService) Start(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case trackID := <-a.queue:
+				a.logAnalysis(ctx, trackID)
+			}
+		}
+	}()
+}
+
+// Enqueue queues tracks for analysis without waiting. Tracks that don't fit in the
+// queue are dropped and logged.
+func (a *AnalysisService) Enqueue(trackIDs ...uint64) {
+	for _, trackID := range trackIDs {
+		select {
+		case a.queue <- trackID:
+		default:
+			metrics.AnalysisFailures.Inc()
+			logging.FromContext(context.Background()).Warn("analysis queue is full, track skipped", "track_id", trackID)
+		}
+	}
+}
+
+// logAnalysis runs a queued analysis, which has no caller to hand its result to
+func (a *AnalysisService) logAnalysis(ctx context.Context, trackID uint64) {
+	track, err := a.trackRepository.FindByID(ctx, trackID)
+	if err == nil {
+		err = a.analyze(ctx, track)
+	}
+	if err != nil {
+		metrics.AnalysisFailures.Inc()
+		logging.FromContext(ctx).Error("track analysis failed", "track_id", trackID, "error", err)
+	}
+}
+
+// AnalyzeTrack measures a track now, as for one stored before analysis existed (owner only)
+func (a *AnalysisService) AnalyzeTrack(ctx context.Context, userID, trackID uint64) (*Track, error) {
+	track, err := a.trackRepository.FindByID(ctx, trackID)
+	if err != nil {
+		return nil, fmt.Errorf("track not found: %w", err)
+	}
+	album, err := a.albumRepository.FindByID(ctx, track.AlbumID)
+	if err != nil {
+		return nil, fmt.Errorf("album not found: %w", err)
+	}
+	if album.UserID != userID {
+		return nil, fmt.Errorf("track %d: %w", trackID, ErrNotOwner)
+	}
+	if track.IsStub() {
+		return nil, fmt.Errorf("track %d has no audio: %w", trackID, ErrFileNotFound)
+	}
+
+	if err = a.analyze(ctx, track); err != nil {
+		return nil, err
+	}
+	return track, nil
+}
+
+// AnalyzeAlbum queues every track of the album with audio, and returns how many (owner only)
+func (a *AnalysisService) AnalyzeAlbum(ctx context.Context, userID, albumID uint64) (int, error) {
+	album, err := a.albumRepository.FindByID(ctx, albumID)
+	if err != nil {
+		return 0, fmt.Errorf("album not found: %w", err)
+	}
+	if album.UserID != userID {
+		return 0, fmt.Errorf("album %d: %w", albumID, ErrNotOwner)
+	}
+
+	var queued int
+	for _, track := range album.Tracks {
+		if !track.IsStub() {
+			a.Enqueue(track.ID)
+			queued++
+		}
+	}
+	logging.FromContext(ctx).Info("album queued for analysis", "album_id", albumID, "tracks", queued)
+	return queued, nil
+}
+
+// analyze measures the track's loudness and rip quality, then its album's loudness
+func (a *AnalysisService) analyze(ctx context.Context, track *Track) error {
+	if track.IsStub() || track.Blob == nil {
+		return nil
+	}
+	start := time.Now()
+	pcm, err := a.conversionService.OpenPCM(ctx, a.fileService.GetFullPath(track.Blob.Path), track.StartSample, track.EndSample)
+	if err != nil {
+		return fmt.Errorf("failed to decode track %d: %w", track.ID, err)
+	}
+	defer pcm.Close()
+	if pcm.Channels <= 0 || pcm.SampleRate <= 0 {
+		return fmt.Errorf("track %d has %d channels at %d Hz", track.ID, pcm.Channels, pcm.SampleRate)
+	}
+	bitDepth := pcm.BitDepth
+	if bitDepth == 0 {
+		bitDepth = track.AudioQuality.BitDepth
+	}
+	loudnessMeter := newLoudnessMeter(pcm.SampleRate, pcm.Channels)
+	ripMeter := newRipMeter(pcm.SampleRate, pcm.Channels, bitDepth)
+	if err = pcm.feed(loudnessMeter.Add, ripMeter.Add); err != nil {
+		return fmt.Errorf("failed to measure track %d: %w", track.ID, err)
+	}
+
+	now := time.Now()
+	track.Loudness, track.LoudnessBlocks = loudnessMeter.Loudness(now)
+	track.RipQuality = ripMeter.Quality(now)
+	if err = a.trackRepository.Save(ctx, track); err != nil {
+		return fmt.Errorf("failed to save track analysis: %w", err)
+	}
+	metrics.AnalysisDuration.Observe(time.Since(start).Seconds())
+	logging.FromContext(ctx).Info("track analyzed", "track_id", track.ID, "loudness", track.Loudness.Integrated,
+		"true_peak", track.Loudness.TruePeak, "range", track.Loudness.Range, "rip_flags", track.RipQuality.Flags,
+		"duration", time.Since(start))
+
+	return a.updateAlbumLoudness(ctx, track.AlbumID)
+}
+
+// updateAlbumLoudness gates the blocks of all the album's measured tracks together
+func (a *AnalysisService) updateAlbumLoudness(ctx context.Context, albumID uint64) error {
+	album, err := a.albumRepository.FindByID(ctx, albumID)
+	if err != nil {
+		return fmt.Errorf("album not found: %w", err)
+	}
+
+	var blocks LoudnessBlocks
+	var peak float64
+	for _, track := range album.Tracks {
+		if !track.Loudness.Analyzed() || track.LoudnessBlocks == nil {
+			continue
+		}
+		blocks.Merge(track.LoudnessBlocks)
+		peak = max(peak, math.Pow(10, track.Loudness.TruePeak/20))
+	}
+	if blocks.Momentary == nil {
+		return nil
+	}
+
+	album.Loudness = blocks.Loudness(peak, time.Now())
+	if err = a.albumRepository.Save(ctx, album); err != nil {
+		return fmt.Errorf("failed to save album loudness: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"vinyl-vault/internal/services"
+	"vinyl-vault/internal/services/audiotest"
+)
+
+func TestAnalysisService_AnalyzeTrack(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	owner, other := f.user(t, "alice"), f.user(t, "bob")
+	album := f.album(t, owner.ID, "Tago Mago")
+
+	wav := filepath.Join(t.TempDir(), "track.wav")
+	format := audiotest.Stereo16(48000)
+	audiotest.WriteFile(t, wav, audiotest.WAV(format, 5*48000, audiotest.Sine(format, 1000, -20)))
+	data, err := os.ReadFile(wav)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loud := f.track(t, album.ID, 1, f.blob(t, owner.ID, string(data), ".wav"))
+	stub := f.track(t, album.ID, 2, nil)
+
+	service := services.NewAnalysisService(f.tracks, f.albums, f.files, services.NewConversionService(t.TempDir()))
+
+	if _, err := service.AnalyzeTrack(ctx, other.ID, loud.ID); !errors.Is(err, services.ErrNotOwner) {
+		t.Errorf("AnalyzeTrack() by another user error = %v, want ErrNotOwner", err)
+	}
+	if _, err := service.AnalyzeTrack(ctx, owner.ID, stub.ID); !errors.Is(err, services.ErrFileNotFound) {
+		t.Errorf("AnalyzeTrack() of a stub error = %v, want ErrFileNotFound", err)
+	}
+
+	track, err := service.AnalyzeTrack(ctx, owner.ID, loud.ID)
+	if err != nil {
+		t.Fatalf("AnalyzeTrack() error = %v", err)
+	}
+	if math.Abs(track.Loudness.Integrated+20) > 0.1 || !track.Loudness.Analyzed() || track.LoudnessBlocks == nil {
+		t.Errorf("track Loudness = %+v, want about -20 LUFS", track.Loudness)
+	}
+	if track.RipQuality == nil || track.RipQuality.EffectiveBitDepth != 16 || len(track.RipQuality.Flags) != 0 {
+		t.Errorf("track RipQuality = %+v, want a clean 16-bit rip", track.RipQuality)
+	}
+
+	saved, err := f.albums.FindByID(ctx, album.ID)
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if saved.Loudness.Integrated != track.Loudness.Integrated || saved.Loudness.TruePeak != track.Loudness.TruePeak {
+		t.Errorf("album Loudness = %+v, want that of its only analyzed track %+v", saved.Loudness, track.Loudness)
+	}
+}
+
+func TestAnalysisService_AnalyzeAlbum(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	owner, other := f.user(t, "alice"), f.user(t, "bob")
+	album := f.album(t, owner.ID, "Tago Mago")
+	first := f.track(t, album.ID, 1, f.blob(t, owner.ID, "one", ".flac"))
+	f.track(t, album.ID, 2, nil)
+	third := f.track(t, album.ID, 3, f.blob(t, owner.ID, "three", ".flac"))
+
+	service := services.NewAnalysisService(f.tracks, f.albums, nil, nil)
+
+	if _, err := service.AnalyzeAlbum(ctx, other.ID, album.ID); !errors.Is(err, services.ErrNotOwner) {
+		t.Errorf("AnalyzeAlbum() by another user error = %v, want ErrNotOwner", err)
+	}
+	queued, err := service.AnalyzeAlbum(ctx, owner.ID, album.ID)
+	if err != nil || queued != 2 {
+		t.Fatalf("AnalyzeAlbum() = %d, %v; want 2 tracks queued", queued, err)
+	}
+	if got := []uint64{<-service.Queued(), <-service.Queued()}; got[0] != first.ID || got[1] != third.ID {
+		t.Errorf("queued tracks %v, want [%d %d]", got, first.ID, third.ID)
+	}
+}
@@ -7,16 +7,26 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+	"vinyl-vault/internal/metrics"
 )
 
 const maxArchiveFiles = 100
 
-func (f *FileService) ArchiveAudioFilesToZip(filePaths []string, zipName string) (string, error) {
-	if len(filePaths) == 0 {
+// ArchiveEntry is a file to add to an archive under a display name,
+// since blob store filenames are content hashes.
+type ArchiveEntry struct {
+	Path, Name string
+	// Open, when set, supplies the content instead of Path, e.g. a track cut from a longer recording
+	Open func() (io.ReadCloser, error)
+}
+
+func (f *FileService) ArchiveAudioFilesToZip(entries []ArchiveEntry, zipName string) (string, error) {
+	if len(entries) == 0 {
 		return "", fmt.Errorf("no files to archive")
 	}
 
-	if len(filePaths) > maxArchiveFiles {
+	if len(entries) > maxArchiveFiles {
 		return "", fmt.Errorf("too many files to archive (max %d)", maxArchiveFiles)
 	}
 
@@ -24,6 +34,10 @@ func (f *FileService) ArchiveAudioFilesToZip(filePaths []string, zipName string)
 		zipName += ".zip"
 	}
 
+	defer func(start time.Time) {
+		metrics.ArchiveBuildDuration.Observe(time.Since(start).Seconds())
+	}(time.Now())
+
 	zipPath := filepath.Join(f.uploadDir, zipName)
 	zipFile, err := os.Create(zipPath)
 	if err != nil {
@@ -34,15 +48,21 @@ func (f *FileService) ArchiveAudioFilesToZip(filePaths []string, zipName string)
 	zipWriter := zip.NewWriter(zipFile)
 	defer zipWriter.Close()
 
-	for _, filePath := range filePaths {
-		if !f.FileExists(filePath) {
+	for _, entry := range entries {
+		filePath := entry.Path
+		if entry.Open == nil && !f.FileExists(filePath) {
 			err = os.Remove(zipPath)
 			if err != nil {
 				return "", err
 			}
-			return "", fmt.Errorf("file not found: %s", filePath)
+			return "", fmt.Errorf("%s: %w", filePath, ErrFileNotFound)
+		}
+		if entry.Open != nil {
+			err = f.addReaderToZip(zipWriter, entry)
+		} else {
+			err = f.addFileToZip(zipWriter, filePath, entry.Name)
 		}
-		if err = f.addFileToZip(zipWriter, filePath); err != nil {
+		if err != nil {
 			err = os.Remove(zipPath)
 			if err != nil {
 				return "", err
@@ -54,7 +74,7 @@ func (f *FileService) ArchiveAudioFilesToZip(filePaths []string, zipName string)
 	return zipPath, nil
 }
 
-func (f *FileService) addFileToZip(zipWriter *zip.Writer, filePath string) error {
+func (f *FileService) addFileToZip(zipWriter *zip.Writer, filePath, name string) error {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return err
@@ -71,7 +91,10 @@ func (f *FileService) addFileToZip(zipWriter *zip.Writer, filePath string) error
 		return err
 	}
 
-	header.Name = filepath.Base(filePath)
+	header.Name = name
+	if header.Name == "" {
+		header.Name = filepath.Base(filePath)
+	}
 	header.Method = zip.Deflate
 
 	writer, err := zipWriter.CreateHeader(header)
@@ -83,6 +106,21 @@ func (f *FileService) addFileToZip(zipWriter *zip.Writer, filePath string) error
 	return err
 }
 
+func (f *FileService) addReaderToZip(zipWriter *zip.Writer, entry ArchiveEntry) error {
+	src, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: entry.Name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, src)
+	return err
+}
+
 func (f *FileService) DeleteZipFile(zipPath string) error {
 	if !strings.HasSuffix(strings.ToLower(zipPath), ".zip") {
 		return fmt.Errorf("file is not a zip file")
@@ -1,8 +1,8 @@
 package services
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
@@ -18,24 +18,14 @@ var audioFileValidExtensions = map[string]bool{
 	".opus": true,
 }
 
-func (f *FileService) SaveTrackAudioFile(
-	file *multipart.FileHeader, albumID uint64, trackNumber int, trackTitle string,
-) (*FileUploadResult, error) {
-	if trackTitle == "" {
-		return nil, fmt.Errorf("track title cannot be empty")
-	}
-
+// SaveTrackAudioFile stores the upload in the content-addressed blob store.
+// Uploading the same file twice returns the path of the existing copy.
+func (f *FileService) SaveTrackAudioFile(ctx context.Context, userID uint64, file *multipart.FileHeader) (*FileUploadResult, error) {
 	if err := f.ValidateAudioFile(file); err != nil {
 		return nil, err
 	}
-
-	ext := f.GetAudioFileExtension(file.Filename)
-	safeTitle := SanitizeFilename(trackTitle)
-	filename := fmt.Sprintf("%d_%02d_%s%s", albumID, trackNumber, safeTitle, ext)
-	destPath := filepath.Join(f.audioDir, filename)
-
-	if err := os.MkdirAll(f.audioDir, dirPermissions); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
+	if err := f.checkQuota(ctx, userID, file.Size); err != nil {
+		return nil, err
 	}
 
 	src, err := file.Open()
@@ -44,27 +34,7 @@ func (f *FileService) SaveTrackAudioFile(
 	}
 	defer src.Close()
 
-	dst, err := os.Create(destPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create destination file: %w", err)
-	}
-	defer dst.Close()
-
-	if err = dst.Chmod(filePermissions); err != nil {
-		os.Remove(destPath)
-		return nil, fmt.Errorf("failed to set file permissions: %w", err)
-	}
-
-	if _, err = io.Copy(dst, src); err != nil {
-		os.Remove(destPath)
-		return nil, fmt.Errorf("failed to save file: %w", err)
-	}
-
-	return &FileUploadResult{
-		Path:     destPath,
-		Filename: filename,
-		Size:     uint64(file.Size),
-	}, nil
+	return f.WriteBlob(src, f.GetAudioFileExtension(file.Filename))
 }
 
 func (f *FileService) DeleteAudioFile(filePath string) error {
@@ -85,11 +55,11 @@ func (f *FileService) DeleteAudioFile(filePath string) error {
 func (f *FileService) ValidateAudioFile(file *multipart.FileHeader) error {
 	ext := f.GetAudioFileExtension(file.Filename)
 	if !f.IsValidAudioExtension(ext) {
-		return fmt.Errorf("unsupported audio format: %s", ext)
+		return NewServiceError("FileService.ValidateAudioFile", ErrUnsupportedFormat, fmt.Sprintf("unsupported audio format: %s", ext))
 	}
 	if file.Size > f.maxAudioFileSize {
 		maxMB := f.maxAudioFileSize / (1 << 20)
-		return fmt.Errorf("file too large: maximum size is %dMB", maxMB)
+		return NewServiceError("FileService.ValidateAudioFile", ErrFileTooLarge, fmt.Sprintf("file too large: maximum size is %dMB", maxMB))
 	}
 	return nil
 }
@@ -101,3 +71,23 @@ func (f *FileService) GetAudioFileExtension(filename string) string {
 func (f *FileService) IsValidAudioExtension(ext string) bool {
 	return audioFileValidExtensions[ext]
 }
+
+// OpenTrackFile opens the whole stored file of a track that is not split
+func (f *FileService) OpenTrackFile(track *Track) (*TrackAudio, error) {
+	if track.Blob == nil {
+		return nil, ErrFileNotFound
+	}
+	path := f.GetFullPath(track.Blob.Path)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrFileNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open track audio: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open track audio: %w", err)
+	}
+	return newTrackAudio(file, info.Size(), filepath.Ext(path), file.Close), nil
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"vinyl-vault/pkg"
+)
+
+// maxAudioHeader bounds how much leading metadata (ID3, LIST and the like) is read
+// and copied into cut files
+const maxAudioHeader = 16 << 20
+
+var errNotLossless = fmt.Errorf("%w: only WAV, AIFF and FLAC recordings can be split", ErrUnsupportedFormat)
+
+// AudioInfo describes an uncompressed or FLAC recording, read from its header
+type AudioInfo struct {
+	Format     string // wav, aiff or flac
+	SampleRate int
+	Channels   int
+	BitDepth   int
+	Samples    int64 // sample frames, i.e. per channel
+
+	pcm *pcmLayout // nil unless the samples can be cut straight out of the file
+}
+
+// Quality is the info in the form stored on tracks
+func (i *AudioInfo) Quality() pkg.AudioQuality {
+	return pkg.AudioQuality{
+		Format:     i.Format,
+		Bitrate:    i.SampleRate * i.Channels * i.BitDepth / 1000,
+		SampleRate: i.SampleRate,
+		BitDepth:   i.BitDepth,
+		Channels:   i.Channels,
+	}
+}
+
+// Duration of the samples [start, end), rounded to the nearest second
+func (i *AudioInfo) Duration(start, end int64) pkg.Duration {
+	if i.SampleRate <= 0 || end <= start {
+		return 0
+	}
+	return pkg.Duration((end - start + int64(i.SampleRate)/2) / int64(i.SampleRate))
+}
+
+// pcmLayout is where the sample frames of a WAV or AIFF file sit, and how to rewrite
+// its header for a file holding only some of them
+type pcmLayout struct {
+	header     []byte // everything before the first frame
+	dataOffset int64
+	frameSize  int64
+	encoding   *pcmEncoding // nil when the samples are in an encoding we can't decode
+	// resize patches a copy of header for a file of frames sample frames
+	resize func(header []byte, frames int64)
+}
+
+// ReadAudioInfo reads the format of a WAV, AIFF or FLAC file
+func ReadAudioInfo(path string) (*AudioInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		return readWAVInfo(file)
+	case ".aiff", ".aif":
+		return readAIFFInfo(file)
+	case ".flac":
+		return readFLACInfo(file)
+	}
+	return nil, errNotLossless
+}
+
+func readWAVInfo(r io.ReadSeeker) (*AudioInfo, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil || string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("not a WAV file")
+	}
+
+	info := &AudioInfo{Format: "wav"}
+	var blockAlign int64
+	var encoding *pcmEncoding
+	var factAt int64 = -1
+	offset := int64(12)
+	for {
+		id, size, err := readChunkHeader(r, binary.LittleEndian)
+		if err != nil {
+			return nil, fmt.Errorf("WAV file has no data chunk")
+		}
+		payload := offset + 8
+
+		switch id {
+		case "fmt ":
+			// WAVE_FORMAT_EXTENSIBLE keeps the format tag in the first 2 bytes of a
+			// subformat GUID at 24
+			var fmtChunk [26]byte
+			if size < 16 {
+				return nil, fmt.Errorf("malformed WAV fmt chunk")
+			}
+			if _, err = io.ReadFull(r, fmtChunk[:min(size, 26)]); err != nil {
+				return nil, fmt.Errorf("malformed WAV fmt chunk: %w", err)
+			}
+			info.Channels = int(binary.LittleEndian.Uint16(fmtChunk[2:]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:]))
+			blockAlign = int64(binary.LittleEndian.Uint16(fmtChunk[12:]))
+			info.BitDepth = int(binary.LittleEndian.Uint16(fmtChunk[14:]))
+			formatTag := binary.LittleEndian.Uint16(fmtChunk[0:])
+			if formatTag == 0xfffe && size >= 26 {
+				formatTag = binary.LittleEndian.Uint16(fmtChunk[24:])
+			}
+			encoding = wavEncoding(formatTag, info.BitDepth, int(blockAlign), info.Channels)
+		case "fact":
+			factAt = payload
+		case "data":
+			if blockAlign == 0 || info.SampleRate == 0 {
+				return nil, fmt.Errorf("WAV data chunk comes before its format")
+			}
+			if payload > maxAudioHeader {
+				return nil, fmt.Errorf("WAV header is too large")
+			}
+			info.Samples = int64(size) / blockAlign
+
+			layout := &pcmLayout{dataOffset: payload, frameSize: blockAlign, encoding: encoding}
+			layout.resize = func(header []byte, frames int64) {
+				data := frames * blockAlign
+				binary.LittleEndian.PutUint32(header[4:], uint32(int64(len(header))-8+data+data%2))
+				binary.LittleEndian.PutUint32(header[payload-4:], uint32(data))
+				if factAt >= 0 {
+					binary.LittleEndian.PutUint32(header[factAt:], uint32(frames))
+				}
+			}
+			if layout.header, err = readHeader(r, payload); err != nil {
+				return nil, err
+			}
+			info.pcm = layout
+			return info, nil
+		}
+
+		offset = payload + int64(size) + int64(size%2)
+		if _, err = r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// aiffCompressions are the AIFF-C compression types that still store plain frames
+var aiffCompressions = map[string]bool{"NONE": true, "sowt": true, "fl32": true, "FL32": true, "fl64": true, "FL64": true}
+
+func readAIFFInfo(r io.ReadSeeker) (*AudioInfo, error) {
+	var form [12]byte
+	if _, err := io.ReadFull(r, form[:]); err != nil || string(form[0:4]) != "FORM" ||
+		(string(form[8:12]) != "AIFF" && string(form[8:12]) != "AIFC") {
+		return nil, fmt.Errorf("not an AIFF file")
+	}
+	aifc := string(form[8:12]) == "AIFC"
+
+	info := &AudioInfo{Format: "aiff"}
+	commAt := int64(-1)
+	plain := true
+	compression := "NONE"
+	offset := int64(12)
+	for {
+		id, size, err := readChunkHeader(r, binary.BigEndian)
+		if err != nil {
+			return nil, fmt.Errorf("AIFF file has no sound data chunk")
+		}
+		payload := offset + 8
+
+		switch id {
+		case "COMM":
+			var comm [22]byte
+			n := 18
+			if aifc {
+				n = 22
+			}
+			if int(size) < n {
+				return nil, fmt.Errorf("malformed AIFF COMM chunk")
+			}
+			if _, err = io.ReadFull(r, comm[:n]); err != nil {
+				return nil, fmt.Errorf("malformed AIFF COMM chunk: %w", err)
+			}
+			commAt = payload
+			info.Channels = int(binary.BigEndian.Uint16(comm[0:]))
+			info.Samples = int64(binary.BigEndian.Uint32(comm[2:]))
+			info.BitDepth = int(binary.BigEndian.Uint16(comm[6:]))
+			info.SampleRate = int(extendedToFloat(comm[8:18]))
+			if aifc {
+				compression = string(comm[18:22])
+				plain = aiffCompressions[compression]
+			}
+		case "SSND":
+			if commAt < 0 {
+				return nil, fmt.Errorf("AIFF sound data comes before its format")
+			}
+			var ssnd [8]byte
+			if _, err = io.ReadFull(r, ssnd[:]); err != nil {
+				return nil, fmt.Errorf("malformed AIFF SSND chunk: %w", err)
+			}
+			if !plain {
+				return info, nil
+			}
+			dataOffset := payload + 8 + int64(binary.BigEndian.Uint32(ssnd[0:]))
+			if dataOffset > maxAudioHeader {
+				return nil, fmt.Errorf("AIFF header is too large")
+			}
+			frameSize := int64(info.Channels * ((info.BitDepth + 7) / 8))
+
+			layout := &pcmLayout{dataOffset: dataOffset, frameSize: frameSize, encoding: aiffEncoding(compression, info.BitDepth)}
+			layout.resize = func(header []byte, frames int64) {
+				data := frames * frameSize
+				binary.BigEndian.PutUint32(header[4:], uint32(int64(len(header))-8+data+data%2))
+				binary.BigEndian.PutUint32(header[commAt+2:], uint32(frames))
+				binary.BigEndian.PutUint32(header[payload-4:], uint32(dataOffset-payload+data))
+			}
+			if layout.header, err = readHeader(r, dataOffset); err != nil {
+				return nil, err
+			}
+			info.pcm = layout
+			return info, nil
+		}
+
+		offset = payload + int64(size) + int64(size%2)
+		if _, err = r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func readFLACInfo(r io.Reader) (*AudioInfo, error) {
+	// "fLaC", then STREAMINFO is always the first metadata block
+	var head [8 + 34]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil || string(head[0:4]) != "fLaC" || head[4]&0x7f != 0 {
+		return nil, fmt.Errorf("not a FLAC file")
+	}
+	streamInfo := head[8:]
+
+	// 20 bits sample rate, 3 bits channels-1, 5 bits bits-per-sample-1, 36 bits total samples
+	packed := binary.BigEndian.Uint64(streamInfo[10:18])
+	return &AudioInfo{
+		Format:     "flac",
+		SampleRate: int(packed >> 44),
+		Channels:   int(packed>>41&0x7) + 1,
+		BitDepth:   int(packed>>36&0x1f) + 1,
+		Samples:    int64(packed & 0xfffffffff),
+	}, nil
+}
+
+func readChunkHeader(r io.Reader, order binary.ByteOrder) (string, uint32, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", 0, err
+	}
+	return string(header[0:4]), order.Uint32(header[4:]), nil
+}
+
+func readHeader(r io.ReadSeeker, size int64) ([]byte, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	header := make([]byte, size)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read audio header: %w", err)
+	}
+	return header, nil
+}
+
+// extendedToFloat decodes the 80-bit IEEE 754 extended float AIFF stores its sample rate in
+func extendedToFloat(b []byte) float64 {
+	exponent := int(binary.BigEndian.Uint16(b[0:]) & 0x7fff)
+	mantissa := binary.BigEndian.Uint64(b[2:])
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+	value := math.Ldexp(float64(mantissa), exponent-16383-63)
+	if b[0]&0x80 != 0 {
+		value = -value
+	}
+	return math.Round(value)
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// TrackAudio is a track's audio as it is served: a stored file, a cut out of a longer
+// recording, or either with tags written in. It is seekable so that it can be served
+// with Range support, and must be closed.
+type TrackAudio struct {
+	io.ReadSeeker
+	Size  int64
+	Ext   string // of the recording, e.g. ".aiff"
+	src   io.ReaderAt
+	close func() error
+}
+
+func newTrackAudio(src io.ReaderAt, size int64, ext string, close func() error) *TrackAudio {
+	return &TrackAudio{
+		ReadSeeker: io.NewSectionReader(src, 0, size),
+		Size:       size,
+		Ext:        ext,
+		src:        src,
+		close:      close,
+	}
+}
+
+func (a *TrackAudio) Close() error {
+	return a.close()
+}
+
+// ReadAt reads the audio without moving the offset Read and Seek use
+func (a *TrackAudio) ReadAt(p []byte, off int64) (int, error) {
+	if off >= a.Size {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > a.Size-off {
+		n, err := a.src.ReadAt(p[:a.Size-off], off)
+		if err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+	return a.src.ReadAt(p, off)
+}
+
+// openPCMRange presents the frames [start, end) of a WAV or AIFF file as a file of its
+// own: the original header with its sizes rewritten, followed by the frames read in place
+func openPCMRange(path string, layout *pcmLayout, start, end int64, ext string) (*TrackAudio, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := bytes.Clone(layout.header)
+	layout.resize(header, end-start)
+	data := (end - start) * layout.frameSize
+	parts := concatReaderAt{
+		{r: bytes.NewReader(header), n: int64(len(header))},
+		{r: file, n: data, offset: layout.dataOffset + start*layout.frameSize},
+	}
+	// chunks are padded to an even length
+	if data%2 == 1 {
+		parts = append(parts, sizedReaderAt{r: bytes.NewReader([]byte{0}), n: 1})
+	}
+
+	return newTrackAudio(parts, parts.size(), ext, file.Close), nil
+}
+
+type sizedReaderAt struct {
+	r      io.ReaderAt
+	n      int64
+	offset int64 // where the part starts within r
+}
+
+// concatReaderAt reads several ReaderAt sections as one
+type concatReaderAt []sizedReaderAt
+
+func (c concatReaderAt) size() int64 {
+	var total int64
+	for _, part := range c {
+		total += part.n
+	}
+	return total
+}
+
+func (c concatReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for _, part := range c {
+		if len(p) == 0 {
+			break
+		}
+		if off >= part.n {
+			off -= part.n
+			continue
+		}
+		want := min(int64(len(p)), part.n-off)
+		n, err := part.r.ReadAt(p[:want], part.offset+off)
+		read += n
+		if int64(n) < want {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return read, err
+		}
+		p = p[n:]
+		off = 0
+	}
+	if len(p) > 0 {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+// errNotPCM marks audio whose samples can't be scaled in place
+var errNotPCM = errors.New("audio is not in a PCM encoding we can scale")
+
+// applyGain scales the samples of WAV or AIFF audio by gain dB as they are read. The
+// header and size stay as they are, so Range requests work on the result too.
+func applyGain(audio *TrackAudio, gain float64) (*TrackAudio, error) {
+	var info *AudioInfo
+	var err error
+	section := io.NewSectionReader(audio, 0, audio.Size)
+	switch strings.ToLower(audio.Ext) {
+	case ".wav":
+		info, err = readWAVInfo(section)
+	case ".aiff", ".aif":
+		info, err = readAIFFInfo(section)
+	default:
+		return nil, errNotPCM
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.pcm == nil || info.pcm.encoding == nil {
+		return nil, errNotPCM
+	}
+
+	layout := info.pcm
+	scaled := &gainReaderAt{
+		src:      audio,
+		start:    layout.dataOffset,
+		end:      min(layout.dataOffset+info.Samples*layout.frameSize, audio.Size),
+		encoding: layout.encoding,
+		factor:   math.Pow(10, gain/20),
+	}
+	return newTrackAudio(scaled, audio.Size, audio.Ext, audio.Close), nil
+}
+
+// gainReaderAt multiplies the samples stored in [start, end) of src by factor
+type gainReaderAt struct {
+	src        io.ReaderAt
+	start, end int64
+	encoding   *pcmEncoding
+	factor     float64
+}
+
+func (g *gainReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	// widen the read to whole samples where it cuts through one
+	size := int64(g.encoding.bytes)
+	lo, hi := off, off+int64(len(p))
+	if lo > g.start && lo < g.end {
+		lo = g.start + (lo-g.start)/size*size
+	}
+	if hi > g.start && hi < g.end {
+		hi = min(g.start+(hi-g.start+size-1)/size*size, g.end)
+	}
+	widened := lo != off || hi != off+int64(len(p))
+	buf := p
+	if widened {
+		buf = make([]byte, hi-lo)
+	}
+	n, err := g.src.ReadAt(buf, lo)
+
+	from, to := max(lo, g.start), min(lo+int64(n), g.end)
+	to = from + max(to-from, 0)/size*size
+	for at := from; at < to; at += size {
+		sample := buf[at-lo:]
+		g.encoding.encode(sample, g.encoding.decode(sample)*g.factor)
+	}
+
+	if !widened {
+		return n, err
+	}
+	copied := 0
+	if skip := int(off - lo); n > skip {
+		copied = copy(p, buf[skip:n])
+	}
+	if copied == len(p) {
+		err = nil
+	}
+	return copied, err
+}
@@ -0,0 +1,131 @@
+// Package audiotest builds the WAV and AIFF files that audio tests read, with samples
+// chosen by the test so that what comes back can be checked.
+package audiotest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/bits"
+	"os"
+	"testing"
+)
+
+// Format is how a file's samples are stored
+type Format struct {
+	SampleRate int
+	Channels   int
+	BitDepth   int // 16 or 24
+}
+
+// Stereo16 is 16-bit stereo at sampleRate
+func Stereo16(sampleRate int) Format {
+	return Format{SampleRate: sampleRate, Channels: 2, BitDepth: 16}
+}
+
+// Samples gives the sample of a channel in a frame, a signed integer of the format's bit
+// depth. Only the bits of that depth are stored.
+type Samples func(frame, channel int) int32
+
+// Ramp holds the index of its frame in every channel, so that a cut can be checked by
+// reading the frames back
+func Ramp(frame, channel int) int32 {
+	return int32(frame)
+}
+
+// Sine is a sine wave of freq Hz at amplitude dBFS on every channel
+func Sine(format Format, freq, amplitude float64) Samples {
+	gain := math.Pow(10, amplitude/20) * float64(int32(1)<<(format.BitDepth-1)-1)
+	return func(frame, channel int) int32 {
+		return int32(math.Round(gain * math.Sin(2*math.Pi*freq*float64(frame)/float64(format.SampleRate))))
+	}
+}
+
+// WAV returns a WAV file of frames frames
+func WAV(format Format, frames int, samples Samples) []byte {
+	data := pcm(format, frames, samples, binary.LittleEndian)
+	pad := len(data) % 2
+	blockAlign := format.Channels * format.BitDepth / 8
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+24+8+len(data)+pad))
+	buf.WriteString("WAVEfmt ")
+	for _, field := range []any{
+		uint32(16), uint16(1), uint16(format.Channels), uint32(format.SampleRate),
+		uint32(format.SampleRate * blockAlign), uint16(blockAlign), uint16(format.BitDepth),
+	} {
+		binary.Write(&buf, binary.LittleEndian, field)
+	}
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if pad == 1 {
+		buf.WriteByte(0)
+	}
+	return buf.Bytes()
+}
+
+// AIFF returns an AIFF file of frames frames followed by trailer, which is where tag
+// chunks usually go
+func AIFF(format Format, frames int, samples Samples, trailer []byte) []byte {
+	data := pcm(format, frames, samples, binary.BigEndian)
+	pad := len(data) % 2
+
+	var buf bytes.Buffer
+	buf.WriteString("FORM")
+	binary.Write(&buf, binary.BigEndian, uint32(4+26+16+len(data)+pad+len(trailer)))
+	buf.WriteString("AIFFCOMM")
+	for _, field := range []any{uint32(18), uint16(format.Channels), uint32(frames), uint16(format.BitDepth)} {
+		binary.Write(&buf, binary.BigEndian, field)
+	}
+	buf.Write(extended(format.SampleRate))
+	buf.WriteString("SSND")
+	binary.Write(&buf, binary.BigEndian, []uint32{uint32(8 + len(data)), 0, 0})
+	buf.Write(data)
+	if pad == 1 {
+		buf.WriteByte(0)
+	}
+	buf.Write(trailer)
+	return buf.Bytes()
+}
+
+// WriteFile writes a file built by WAV or AIFF to path
+func WriteFile(t testing.TB, path string, content []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// pcm interleaves the samples of every frame, each in the bytes of the format's bit depth
+func pcm(format Format, frames int, samples Samples, order binary.ByteOrder) []byte {
+	width := format.BitDepth / 8
+	data := make([]byte, 0, frames*format.Channels*width)
+	sample := make([]byte, 4)
+	for frame := range frames {
+		for channel := range format.Channels {
+			v := uint32(samples(frame, channel))
+			if order == binary.BigEndian {
+				binary.BigEndian.PutUint32(sample, v<<(32-format.BitDepth))
+				data = append(data, sample[:width]...)
+			} else {
+				binary.LittleEndian.PutUint32(sample, v)
+				data = append(data, sample[:width]...)
+			}
+		}
+	}
+	return data
+}
+
+// extended encodes a sample rate as the 80-bit float AIFF stores it in
+func extended(sampleRate int) []byte {
+	b := make([]byte, 10)
+	if sampleRate <= 0 {
+		return b
+	}
+	exponent := bits.Len64(uint64(sampleRate)) - 1
+	binary.BigEndian.PutUint16(b, uint16(16383+exponent))
+	binary.BigEndian.PutUint64(b[2:], uint64(sampleRate)<<(63-exponent))
+	return b
+}
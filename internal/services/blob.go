@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"vinyl-vault/internal/logging"
+)
+
+// Blob is a content-addressed file in the blob store. Tracks and covers
+// reference blobs by ID, so identical uploads share a single file on disk.
+type Blob struct {
+	ID        uint64    `json:"id" gorm:"primaryKey;autoIncrement"`
+	Hash      string    `json:"hash" gorm:"uniqueIndex;size:64;not null"` // hex SHA-256 of the content
+	Size      int64     `json:"size" gorm:"not null"`
+	Path      string    `json:"-" gorm:"not null"` // relative to the upload dir
+	RefCount  int       `json:"ref_count" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// An AIFF or WAV upload stored as FLAC keeps the hash of the file as it was
+	// uploaded, which finds it too, and what it takes to rebuild that file
+	SourceHash string      `json:"source_hash,omitempty" gorm:"index;size:64"`
+	Source     *BlobSource `json:"-" gorm:"serializer:json"`
+}
+
+type BlobRepository interface {
+	FindByID(ctx context.Context, id uint64) (*Blob, error)
+	// FindByHash finds a blob by the hash of its content or, for one stored as FLAC,
+	// of the upload it was made from.
+	FindByHash(ctx context.Context, hash string) (*Blob, error)
+	Save(ctx context.Context, blob *Blob) error
+	// AdjustRefCount atomically adds delta to the blob's refcount and returns the updated blob.
+	AdjustRefCount(ctx context.Context, id uint64, delta int) (*Blob, error)
+	// UpdatePath points the blob at another file of the same content.
+	UpdatePath(ctx context.Context, id uint64, path string) error
+	// DeleteIfUnreferenced removes the row only if its refcount is still <= 0.
+	DeleteIfUnreferenced(ctx context.Context, id uint64) (bool, error)
+	// FindAfterID pages through blobs in ID order.
+	FindAfterID(ctx context.Context, afterID uint64, limit int) ([]*Blob, error)
+	// FindOrphaned returns blobs that no track or album cover points at.
+	FindOrphaned(ctx context.Context) ([]*Blob, error)
+	// IsReferencedBy reports whether any of the user's tracks or album covers, trashed
+	// ones included, point at the blob.
+	IsReferencedBy(ctx context.Context, id, userID uint64) (bool, error)
+	// Stats counts the stored blobs and sums their sizes.
+	Stats(ctx context.Context) (count int64, bytes int64, err error)
+}
+
+type BlobService struct {
+	blobRepository    BlobRepository
+	fileService       *FileService
+	usage             UsageTracker       // optional, charges each reference to its owner's quota
+	conversionService *ConversionService // optional, stores AIFF and WAV uploads as FLAC
+}
+
+func NewBlobService(blobRepository BlobRepository, fileService *FileService, usage UsageTracker) *BlobService {
+	return &BlobService{
+		blobRepository: blobRepository,
+		fileService:    fileService,
+		usage:          usage,
+	}
+}
+
+// SetFLACIngest has AIFF and WAV uploads of 16 or 24-bit samples stored as FLAC, which
+// takes about 40% less space. Each upload is only replaced once its FLAC is checked to
+// rebuild it byte for byte; those that fail the check are kept as they are.
+func (b *BlobService) SetFLACIngest(conversionService *ConversionService) {
+	b.conversionService = conversionService
+}
+
+// Acquire records a reference owned by ownerID to a file already written to the blob store.
+// If a blob with the same hash exists its refcount is bumped instead.
+func (b *BlobService) Acquire(ctx context.Context, ownerID uint64, upload *FileUploadResult) (*Blob, error) {
+	if upload == nil || upload.Hash == "" {
+		return nil, fmt.Errorf("upload has no content hash")
+	}
+
+	if blob, err := b.AcquireByHash(ctx, ownerID, upload.Hash); err == nil {
+		b.discardUpload(ctx, blob, upload)
+		return blob, nil
+	} else if !errors.Is(err, ErrBlobNotFound) {
+		return nil, err
+	}
+	// the content may be stored already, with its file gone missing
+	if lost, err := b.blobRepository.FindByHash(ctx, upload.Hash); err == nil {
+		return b.restoreFile(ctx, ownerID, lost, upload)
+	} else if !errors.Is(err, ErrBlobNotFound) {
+		return nil, err
+	}
+
+	stored, source := upload, (*BlobSource)(nil)
+	if b.conversionService != nil {
+		flac, flacSource, err := b.storeAsFLAC(ctx, upload, nil)
+		switch {
+		case err == nil:
+			stored, source = flac, flacSource
+		case !errors.Is(err, errNotIngestable) && !errors.Is(err, errFLACStored):
+			logging.FromContext(ctx).Warn("keeping upload as it is", "hash", upload.Hash, "error", err)
+		}
+	}
+
+	relativePath, err := b.fileService.GetRelativePath(stored.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process blob path: %w", err)
+	}
+
+	blob := &Blob{
+		Hash:     stored.Hash,
+		Size:     int64(stored.Size),
+		Path:     relativePath,
+		RefCount: 1,
+	}
+	if source != nil {
+		blob.SourceHash, blob.Source = upload.Hash, source
+	}
+	if err = b.blobRepository.Save(ctx, blob); err != nil {
+		// a concurrent upload of the same content may have won the insert
+		if existing, findErr := b.AcquireByHash(ctx, ownerID, upload.Hash); findErr == nil {
+			b.discardUpload(ctx, existing, stored)
+			b.discardUpload(ctx, existing, upload)
+			return existing, nil
+		}
+		return nil, fmt.Errorf("failed to save blob: %w", err)
+	}
+	b.discardUpload(ctx, blob, upload)
+	if err = b.addUsage(ctx, ownerID, blob.Size); err != nil {
+		b.dropUncharged(ctx, ownerID, blob.ID)
+		return nil, err
+	}
+	return blob, nil
+}
+
+// restoreFile points a blob whose file is missing at an upload of its content, then
+// acquires it. A blob stored as FLAC is restored once the upload encodes to the same FLAC.
+func (b *BlobService) restoreFile(ctx context.Context, ownerID uint64, blob *Blob, upload *FileUploadResult) (*Blob, error) {
+	stored := upload
+	if blob.Hash != upload.Hash {
+		var err error
+		if b.conversionService == nil {
+			err = fmt.Errorf("it is stored as FLAC, which is turned off")
+		} else {
+			stored, _, err = b.storeAsFLAC(ctx, upload, blob)
+		}
+		if err != nil {
+			b.discardUpload(ctx, blob, upload)
+			return nil, fmt.Errorf("failed to restore the missing file of blob %d: %w", blob.ID, err)
+		}
+	}
+
+	relativePath, err := b.fileService.GetRelativePath(stored.Path)
+	if err == nil {
+		err = b.blobRepository.UpdatePath(ctx, blob.ID, relativePath)
+	}
+	if err != nil {
+		b.discardUpload(ctx, blob, stored)
+		b.discardUpload(ctx, blob, upload)
+		return nil, fmt.Errorf("failed to restore the missing file of blob %d: %w", blob.ID, err)
+	}
+	logging.FromContext(ctx).Warn("restored missing blob file from upload", "blob_id", blob.ID, "path", relativePath)
+	blob.Path = relativePath
+	b.discardUpload(ctx, blob, upload)
+	return b.AcquireByHash(ctx, ownerID, upload.Hash)
+}
+
+// discardUpload removes an upload written to the blob store that blob holds under another
+// path: one it was made from as FLAC, or the same content with another extension
+func (b *BlobService) discardUpload(ctx context.Context, blob *Blob, upload *FileUploadResult) {
+	if b.fileService.GetFullPath(blob.Path) == upload.Path {
+		return
+	}
+	if err := b.fileService.DeleteBlobFile(upload.Path); err != nil {
+		logging.FromContext(ctx).Warn("failed to remove duplicate upload", "path", upload.Path, "error", err)
+	}
+}
+
+// AcquireByHash adds a reference to an existing blob without any upload.
+// Returns ErrBlobNotFound if the content is not stored yet.
+func (b *BlobService) AcquireByHash(ctx context.Context, ownerID uint64, hash string) (*Blob, error) {
+	blob, err := b.blobRepository.FindByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if !b.fileService.FileExists(b.fileService.GetFullPath(blob.Path)) {
+		return nil, ErrBlobNotFound
+	}
+
+	// deduplicated content still counts against the owner's quota
+	if b.usage != nil {
+		if err = b.usage.CheckQuota(ctx, ownerID, blob.Size); err != nil {
+			return nil, err
+		}
+	}
+
+	blob, err = b.blobRepository.AdjustRefCount(ctx, blob.ID, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err = b.addUsage(ctx, ownerID, blob.Size); err != nil {
+		b.dropUncharged(ctx, ownerID, blob.ID)
+		return nil, err
+	}
+	return blob, nil
+}
+
+// AcquireOwnedByHash is AcquireByHash for content the owner already references, which is
+// all a client may reuse without uploading it: another user's hash must not get their file.
+// Returns ErrBlobNotFound for content the owner doesn't have.
+func (b *BlobService) AcquireOwnedByHash(ctx context.Context, ownerID uint64, hash string) (*Blob, error) {
+	blob, err := b.blobRepository.FindByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	owned, err := b.blobRepository.IsReferencedBy(ctx, blob.ID, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check blob owner: %w", err)
+	}
+	if !owned {
+		return nil, ErrBlobNotFound
+	}
+	return b.AcquireByHash(ctx, ownerID, hash)
+}
+
+func (b *BlobService) GetBlob(ctx context.Context, id uint64) (*Blob, error) {
+	blob, err := b.blobRepository.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob: %w", err)
+	}
+	return blob, nil
+}
+
+// Stats reports the size of the whole blob store, across every owner
+func (b *BlobService) Stats(ctx context.Context) (count int64, bytes int64, err error) {
+	return b.blobRepository.Stats(ctx)
+}
+
+// Retain adds n references to a blob whose size is already charged to its owner,
+// e.g. for the other tracks cut from one uploaded side
+func (b *BlobService) Retain(ctx context.Context, id uint64, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	if _, err := b.blobRepository.AdjustRefCount(ctx, id, n); err != nil {
+		return fmt.Errorf("failed to retain blob: %w", err)
+	}
+	return nil
+}
+
+// ReleaseBlob drops one of ownerID's references and removes the file once nothing points at it.
+func (b *BlobService) ReleaseBlob(ctx context.Context, ownerID, id uint64) error {
+	return b.release(ctx, ownerID, id, nil)
+}
+
+// ReleaseBlobShare is ReleaseBlob for a reference that was charged share bytes
+// rather than the whole blob, such as one track of a split recording.
+func (b *BlobService) ReleaseBlobShare(ctx context.Context, ownerID, id uint64, share int64) error {
+	return b.release(ctx, ownerID, id, &share)
+}
+
+func (b *BlobService) release(ctx context.Context, ownerID, id uint64, share *int64) error {
+	if id == 0 {
+		return nil
+	}
+
+	blob, err := b.blobRepository.AdjustRefCount(ctx, id, -1)
+	if err != nil {
+		return fmt.Errorf("failed to release blob: %w", err)
+	}
+	charged := blob.Size
+	if share != nil {
+		charged = *share
+	}
+	if err = b.addUsage(ctx, ownerID, -charged); err != nil {
+		return err
+	}
+	if blob.RefCount > 0 {
+		return nil
+	}
+
+	deleted, err := b.blobRepository.DeleteIfUnreferenced(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	if !deleted {
+		return nil
+	}
+	logging.FromContext(ctx).Debug("deleting unreferenced blob", "blob_id", id, "path", blob.Path)
+	return b.fileService.DeleteBlobFile(b.fileService.GetFullPath(blob.Path))
+}
+
+// dropUncharged undoes a reference whose usage could not be charged, deleting the blob
+// and its file unless someone else holds it by now
+func (b *BlobService) dropUncharged(ctx context.Context, ownerID, id uint64) {
+	var uncharged int64
+	if err := b.release(ctx, ownerID, id, &uncharged); err != nil {
+		logging.FromContext(ctx).Warn("failed to drop uncharged blob reference", "blob_id", id, "error", err)
+	}
+}
+
+func (b *BlobService) addUsage(ctx context.Context, ownerID uint64, delta int64) error {
+	if b.usage == nil || delta == 0 {
+		return nil
+	}
+	return b.usage.AddUsage(ctx, ownerID, delta)
+}
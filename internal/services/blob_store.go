@@ -0,0 +1,119 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const blobDirName = "blobs"
+
+// BlobPath returns where content with the given hash lives, sharded by the
+// first two byte pairs of the hash: blobs/ab/cd/abcd....ext
+func (f *FileService) BlobPath(hash, ext string) string {
+	return filepath.Join(f.blobDir, hash[0:2], hash[2:4], hash+strings.ToLower(ext))
+}
+
+// WriteBlob streams src into the blob store while hashing it. When the same
+// content is already on disk the temp copy is discarded and the existing file reused.
+func (f *FileService) WriteBlob(src io.Reader, ext string) (*FileUploadResult, error) {
+	tmpDir := filepath.Join(f.blobDir, "tmp")
+	if err := os.MkdirAll(tmpDir, dirPermissions); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(tmpDir, "upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create destination file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once renamed
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), src)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to save file: %w", err)
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	destPath := f.BlobPath(hash, ext)
+
+	if !f.FileExists(destPath) {
+		if err = os.MkdirAll(filepath.Dir(destPath), dirPermissions); err != nil {
+			return nil, fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err = os.Chmod(tmpPath, filePermissions); err != nil {
+			return nil, fmt.Errorf("failed to set file permissions: %w", err)
+		}
+		if err = os.Rename(tmpPath, destPath); err != nil {
+			return nil, fmt.Errorf("failed to move file into blob store: %w", err)
+		}
+	}
+
+	return &FileUploadResult{
+		Path:     destPath,
+		Filename: filepath.Base(destPath),
+		Size:     uint64(size),
+		Hash:     hash,
+	}, nil
+}
+
+// DeleteBlobFile removes a blob file and prunes its now-empty shard directories.
+func (f *FileService) DeleteBlobFile(filePath string) error {
+	if filePath == "" {
+		return nil
+	}
+
+	if err := f.ValidateFilePath(filePath); err != nil {
+		return err
+	}
+
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+
+	// os.Remove refuses non-empty dirs, so this only cleans up empty shards
+	shard := filepath.Dir(filePath)
+	for i := 0; i < 2; i++ {
+		if os.Remove(shard) != nil {
+			break
+		}
+		shard = filepath.Dir(shard)
+	}
+	return nil
+}
+
+// ListBlobFiles returns the full path of every file in the blob store, skipping in-progress uploads
+func (f *FileService) ListBlobFiles() ([]string, error) {
+	tmpDir := filepath.Join(f.blobDir, "tmp")
+
+	var files []string
+	err := filepath.WalkDir(f.blobDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == f.blobDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if path == tmpDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blob files: %w", err)
+	}
+	return files, nil
+}
@@ -0,0 +1,197 @@
+package services_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"vinyl-vault/internal/services"
+	"vinyl-vault/internal/services/audiotest"
+)
+
+func TestBlobService_AcquireSameContentOtherExtension(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.user(t, "alice")
+
+	var blobs []*services.Blob
+	for _, ext := range []string{".aif", ".aiff"} {
+		upload, err := f.files.WriteBlob(strings.NewReader("FORM...AIFF"), ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		blob, err := f.blobService.Acquire(ctx, user.ID, upload)
+		if err != nil {
+			t.Fatalf("Acquire(%s) error = %v", ext, err)
+		}
+		blobs = append(blobs, blob)
+	}
+
+	if blobs[0].ID != blobs[1].ID || blobs[1].RefCount != 2 {
+		t.Errorf("Acquire() = blobs %d and %d with %d references, want one with 2", blobs[0].ID, blobs[1].ID, blobs[1].RefCount)
+	}
+	files, err := f.files.ListBlobFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != f.files.GetFullPath(blobs[0].Path) {
+		t.Errorf("blob store holds %v, want only %s", files, blobs[0].Path)
+	}
+}
+
+func TestBlobService_AcquireRestoresMissingFile(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.user(t, "alice")
+
+	t.Run("from the same content", func(t *testing.T) {
+		lost := f.blob(t, user.ID, "FORM...AIFF", ".aif")
+		if err := os.Remove(f.files.GetFullPath(lost.Path)); err != nil {
+			t.Fatal(err)
+		}
+		upload, err := f.files.WriteBlob(strings.NewReader("FORM...AIFF"), ".aiff")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blob, err := f.blobService.Acquire(ctx, user.ID, upload)
+		if err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+		if blob.ID != lost.ID || blob.RefCount != 2 || f.files.GetFullPath(blob.Path) != upload.Path {
+			t.Errorf("Acquire() = blob %d at %s with %d references, want blob %d at the upload with 2",
+				blob.ID, blob.Path, blob.RefCount, lost.ID)
+		}
+		if stored, err := f.blobs.FindByID(ctx, lost.ID); err != nil || stored.Path != blob.Path {
+			t.Errorf("FindByID() = %+v, %v; want the upload's path saved", stored, err)
+		}
+	})
+
+	t.Run("of a FLAC, with FLAC ingest off", func(t *testing.T) {
+		upload, err := f.files.WriteBlob(strings.NewReader("FORM...24-bit AIFF"), ".aiff")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lost := &services.Blob{Hash: "flac", Size: 10, Path: "blobs/lost.flac", RefCount: 1, SourceHash: upload.Hash, Source: &services.BlobSource{Ext: ".aiff"}}
+		if err = f.blobs.Save(ctx, lost); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = f.blobService.Acquire(ctx, user.ID, upload); err == nil {
+			t.Fatal("Acquire() restored a FLAC without encoding it")
+		}
+		if f.files.FileExists(upload.Path) {
+			t.Errorf("upload %s was left behind", upload.Path)
+		}
+		if stored, err := f.blobs.FindByID(ctx, lost.ID); err != nil || stored.Path != lost.Path || stored.RefCount != 1 {
+			t.Errorf("FindByID() = %+v, %v; want blob %d as it was", stored, err, lost.ID)
+		}
+	})
+}
+
+// failingUsage checks quotas but can't record any usage
+type failingUsage struct {
+	services.UsageTracker
+}
+
+func (failingUsage) AddUsage(ctx context.Context, userID uint64, delta int64) error {
+	return errors.New("database error")
+}
+
+func TestBlobService_AcquireUncharged(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.user(t, "alice")
+	failing := services.NewBlobService(f.blobs, f.files, failingUsage{f.quota})
+
+	t.Run("new content is removed", func(t *testing.T) {
+		upload, err := f.files.WriteBlob(strings.NewReader("new"), ".flac")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = failing.Acquire(ctx, user.ID, upload); err == nil {
+			t.Fatal("Acquire() succeeded without charging its usage")
+		}
+		if _, err = f.blobs.FindByHash(ctx, upload.Hash); !errors.Is(err, services.ErrBlobNotFound) {
+			t.Errorf("FindByHash() error = %v, want ErrBlobNotFound", err)
+		}
+		if f.files.FileExists(upload.Path) {
+			t.Errorf("blob file %s was left behind", upload.Path)
+		}
+	})
+
+	t.Run("stored content keeps its references", func(t *testing.T) {
+		stored := f.blob(t, user.ID, "stored", ".flac")
+		upload, err := f.files.WriteBlob(strings.NewReader("stored"), ".flac")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = failing.Acquire(ctx, user.ID, upload); err == nil {
+			t.Fatal("Acquire() succeeded without charging its usage")
+		}
+		blob, err := f.blobs.FindByID(ctx, stored.ID)
+		if err != nil || blob.RefCount != 1 {
+			t.Errorf("blob after a failed Acquire() = %+v, %v; want 1 reference", blob, err)
+		}
+		if !f.files.FileExists(f.files.GetFullPath(stored.Path)) {
+			t.Errorf("blob file %s was removed", stored.Path)
+		}
+	})
+}
+
+func TestBlobService_AcquireStoresAIFFAsFLAC(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+	ctx := context.Background()
+	f := newFixture(t)
+	conversionService := services.NewConversionService(t.TempDir())
+	f.blobService.SetFLACIngest(conversionService)
+	user := f.user(t, "alice")
+	album := f.album(t, user.ID, "Monster Movie")
+
+	path := filepath.Join(t.TempDir(), "side.aiff")
+	mono24 := audiotest.Format{SampleRate: 48000, Channels: 1, BitDepth: 24}
+	audiotest.WriteFile(t, path, audiotest.AIFF(mono24, 48000, audiotest.Ramp, append([]byte("ID3 \x00\x00\x00\x04"), "TIT2"...)))
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	upload, err := f.files.WriteBlob(file, ".aiff")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := f.blobService.Acquire(ctx, user.ID, upload)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if filepath.Ext(blob.Path) != ".flac" || blob.SourceHash != upload.Hash || blob.Source == nil {
+		t.Fatalf("Acquire() = %s with source hash %s, want a FLAC made from %s", blob.Path, blob.SourceHash, upload.Hash)
+	}
+	if f.files.FileExists(upload.Path) {
+		t.Errorf("upload %s was kept next to its FLAC", upload.Path)
+	}
+
+	track := f.track(t, album.ID, 1, blob)
+	track.Blob = blob
+	audio, err := services.NewSplitService(nil, nil, nil, f.files, conversionService).OpenOriginal(ctx, track)
+	if err != nil {
+		t.Fatalf("OpenOriginal() error = %v", err)
+	}
+	defer audio.Close()
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, audio); err != nil {
+		t.Fatal(err)
+	}
+	if hash := hex.EncodeToString(hasher.Sum(nil)); hash != upload.Hash || audio.Ext != ".aiff" {
+		t.Errorf("OpenOriginal() = %s with hash %s, want the upload's %s", audio.Ext, hash, upload.Hash)
+	}
+}
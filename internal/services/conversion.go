@@ -1,13 +1,23 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
+	"vinyl-vault/internal/config"
+	"vinyl-vault/internal/logging"
+	"vinyl-vault/internal/metrics"
 )
 
+// maxLoggedOutput keeps the tail of ffmpeg's output, where the actual error is printed
+const maxLoggedOutput = 4096
+
 type AudioFormat string
 
 const (
@@ -19,25 +29,55 @@ const (
 	FormatOpus AudioFormat = "opus"
 )
 
+// formatEncoders names the ffmpeg encoder each target format is produced with. AIFF
+// and WAV are written as wide as the preset's samples; these are their 16-bit encoders.
+var formatEncoders = map[AudioFormat]string{
+	FormatAIFF: "pcm_s16be",
+	FormatWAV:  "pcm_s16le",
+	FormatFLAC: "flac",
+	FormatALAC: "alac",
+	FormatMP3:  "libmp3lame",
+	FormatOpus: "libopus",
+}
+
 type ConversionService struct {
-	tempDir string
+	tempDir     string
+	ffmpegPath  string
+	resampler   string
+	presets     map[string]ConversionPreset
+	ffmpegFound atomic.Bool // once checkFFmpeg succeeded
 }
 
 func NewConversionService(tempDir string) *ConversionService {
 	return &ConversionService{
-		tempDir: tempDir,
+		tempDir:    tempDir,
+		ffmpegPath: "ffmpeg",
+		resampler:  "soxr",
+		presets:    newPresets(nil),
+	}
+}
+
+func NewConversionServiceWithConfig(cfg *config.Config) *ConversionService {
+	return &ConversionService{
+		tempDir:    cfg.Storage.TempDir,
+		ffmpegPath: cfg.Conversion.FFmpegPath,
+		resampler:  cfg.Conversion.Resampler,
+		presets:    newPresets(cfg.Conversion.Presets),
 	}
 }
 
-func (c *ConversionService) ConvertAudio(inputPath string, targetFormat AudioFormat) (string, error) {
+// ConvertAudio transcodes the samples [start, end) of a file, end 0 standing for its
+// end, into a temp file as preset says, with the ReplayGain tags of replayGain when it
+// is not nil. The caller removes the file with CleanupTempFile.
+func (c *ConversionService) ConvertAudio(ctx context.Context, inputPath string, start, end int64, preset ConversionPreset, replayGain *ReplayGain) (string, error) {
 	// Validate ffmpeg is available
-	if err := c.validateFFmpeg(); err != nil {
+	if err := c.validateFFmpeg(ctx); err != nil {
 		return "", err
 	}
 
 	// Validate target format
-	if !c.isValidFormat(targetFormat) {
-		return "", fmt.Errorf("unsupported format: %s", targetFormat)
+	if !c.isValidFormat(preset.Format) {
+		return "", fmt.Errorf("unsupported format: %s", preset.Format)
 	}
 
 	// Check if input file exists
@@ -49,33 +89,191 @@ func (c *ConversionService) ConvertAudio(inputPath string, targetFormat AudioFor
 	if err := os.MkdirAll(c.tempDir, 0755); err != nil {
 		return "", fmt.Errorf("failed to create temp directory: %w", err)
 	}
+	output, err := os.CreateTemp(c.tempDir, "converted-*."+c.getFileExtension(preset.Format))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	output.Close()
+	outputPath := output.Name()
 
-	// Generate output filename
-	baseFilename := filepath.Base(inputPath)
-	nameWithoutExt := strings.TrimSuffix(baseFilename, filepath.Ext(baseFilename))
-	outputPath := filepath.Join(c.tempDir, fmt.Sprintf("%s_converted.%s", nameWithoutExt, c.getFileExtension(targetFormat)))
-
-	// Build ffmpeg command based on target format
-	args, err := c.buildFFmpegArgs(inputPath, outputPath, targetFormat)
+	// What the preset leaves to the source is read from it; a lossy one can't be read,
+	// and ffmpeg keeps what it decodes to
+	info, err := ReadAudioInfo(inputPath)
 	if err != nil {
+		info = nil
+	}
+	args, err := c.buildFFmpegArgs(inputPath, outputPath, preset, info, start, end, replayGain)
+	if err != nil {
+		os.Remove(outputPath)
 		return "", err
 	}
 
+	targetFormat := preset.Format
+	logger := logging.FromContext(ctx).With("input", filepath.Base(inputPath), "format", targetFormat, "preset", preset.Name)
+	logger.Info("converting audio")
+	begin := time.Now()
+
 	// Execute conversion
-	cmd := exec.Command("ffmpeg", args...)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("ffmpeg conversion failed: %w\nOutput: %s", err, string(output))
+	if err = c.runFFmpeg(logging.WithLogger(ctx, logger), args...); err != nil {
+		os.Remove(outputPath)
+		metrics.ConversionFailures.WithLabelValues(string(targetFormat)).Inc()
+		return "", err
 	}
 
-	// Verify output file was created
-	if _, err = os.Stat(outputPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("conversion failed: output file not created")
+	// Verify output file was written
+	if stat, err := os.Stat(outputPath); err != nil || stat.Size() == 0 {
+		os.Remove(outputPath)
+		metrics.ConversionFailures.WithLabelValues(string(targetFormat)).Inc()
+		logger.Error("ffmpeg produced no output file", "output_path", outputPath)
+		return "", fmt.Errorf("output file not created: %w", ErrConversionFailed)
 	}
 
+	elapsed := time.Since(begin)
+	metrics.ConversionDuration.WithLabelValues(string(targetFormat)).Observe(elapsed.Seconds())
+	logger.Info("converted audio", "duration", elapsed)
 	return outputPath, nil
 }
 
+// ExtractRange decodes the samples [start, end) of a lossless recording into a temp file
+// of the same format. atrim counts decoded samples, so the cut is exact whatever
+// the source's frame boundaries; the caller removes the file with CleanupTempFile.
+func (c *ConversionService) ExtractRange(ctx context.Context, inputPath string, start, end int64, bitDepth int) (string, error) {
+	if err := c.validateFFmpeg(ctx); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(c.tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	ext := strings.ToLower(filepath.Ext(inputPath))
+	output, err := os.CreateTemp(c.tempDir, "range-*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	output.Close()
+
+	args := []string{
+		"-v", "error", "-i", inputPath, "-y",
+		"-map", "0:a:0", "-map_metadata", "0",
+		"-af", fmt.Sprintf("atrim=start_sample=%d:end_sample=%d,asetpts=PTS-STARTPTS", start, end),
+		"-acodec", rangeEncoder(ext, bitDepth),
+	}
+	if ext == ".flac" {
+		args = append(args, "-compression_level", "5")
+	}
+	args = append(args, output.Name())
+
+	logger := logging.FromContext(ctx).With("input", filepath.Base(inputPath), "start_sample", start, "end_sample", end)
+	if err = c.runFFmpeg(logging.WithLogger(ctx, logger), args...); err != nil {
+		os.Remove(output.Name())
+		return "", err
+	}
+	return output.Name(), nil
+}
+
+// Normalize decodes the samples [start, end) of a recording, end 0 standing for its end,
+// and writes them scaled by gain dB to a temp FLAC file at the recording's bit depth. The
+// caller removes the file with CleanupTempFile.
+func (c *ConversionService) Normalize(ctx context.Context, inputPath string, start, end int64, gain float64) (string, error) {
+	if err := c.validateFFmpeg(ctx); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(c.tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	output, err := os.CreateTemp(c.tempDir, "normalized-*.flac")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	output.Close()
+
+	filter := fmt.Sprintf("volume=%.2fdB", gain)
+	if start > 0 || end > 0 {
+		trim := fmt.Sprintf("atrim=start_sample=%d", start)
+		if end > 0 {
+			trim += fmt.Sprintf(":end_sample=%d", end)
+		}
+		filter = trim + ",asetpts=PTS-STARTPTS," + filter
+	}
+	args := []string{
+		"-v", "error", "-i", inputPath, "-y",
+		"-map", "0:a:0", "-map_metadata", "0",
+		"-af", filter, "-acodec", "flac", "-compression_level", "5",
+		output.Name(),
+	}
+
+	logger := logging.FromContext(ctx).With("input", filepath.Base(inputPath), "gain", gain)
+	if err = c.runFFmpeg(logging.WithLogger(ctx, logger), args...); err != nil {
+		os.Remove(output.Name())
+		return "", err
+	}
+	return output.Name(), nil
+}
+
+// EncodeFLAC writes a lossless recording to a temp FLAC file at the same bit depth and
+// sample rate. The caller removes the file with CleanupTempFile.
+func (c *ConversionService) EncodeFLAC(ctx context.Context, inputPath string, bitDepth int) (string, error) {
+	if err := c.validateFFmpeg(ctx); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(c.tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	output, err := os.CreateTemp(c.tempDir, "ingest-*.flac")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	output.Close()
+
+	// ffmpeg decodes 24-bit samples into 32-bit ones; bits_per_raw_sample keeps the
+	// FLAC at 24
+	sampleFormat := "s16"
+	if bitDepth > 16 {
+		sampleFormat = "s32"
+	}
+	args := []string{
+		"-v", "error", "-i", inputPath, "-y",
+		"-map", "0:a:0", "-map_metadata", "0",
+		"-acodec", "flac", "-compression_level", "5",
+		"-sample_fmt", sampleFormat, "-bits_per_raw_sample", strconv.Itoa(bitDepth),
+		output.Name(),
+	}
+
+	logger := logging.FromContext(ctx).With("input", filepath.Base(inputPath), "bit_depth", bitDepth)
+	start := time.Now()
+	if err = c.runFFmpeg(logging.WithLogger(ctx, logger), args...); err != nil {
+		os.Remove(output.Name())
+		metrics.ConversionFailures.WithLabelValues(string(FormatFLAC)).Inc()
+		return "", err
+	}
+	metrics.ConversionDuration.WithLabelValues(string(FormatFLAC)).Observe(time.Since(start).Seconds())
+	return output.Name(), nil
+}
+
+// rangeEncoder picks an encoder that keeps the recording's format and bit depth
+func rangeEncoder(ext string, bitDepth int) string {
+	if ext == ".flac" {
+		return "flac"
+	}
+	return pcmEncoder(bitDepth, ext != ".wav")
+}
+
+// pcmEncoder names the encoder of signed samples wide enough for bitDepth, 16 bits
+// when it is unknown
+func pcmEncoder(bitDepth int, bigEndian bool) string {
+	bits := 16
+	switch {
+	case bitDepth > 24:
+		bits = 32
+	case bitDepth > 16:
+		bits = 24
+	}
+	if bigEndian {
+		return fmt.Sprintf("pcm_s%dbe", bits)
+	}
+	return fmt.Sprintf("pcm_s%dle", bits)
+}
+
 func (c *ConversionService) isValidFormat(format AudioFormat) bool {
 	switch format {
 	case FormatAIFF, FormatFLAC, FormatALAC, FormatMP3, FormatWAV, FormatOpus:
@@ -134,36 +332,122 @@ func (c *ConversionService) CleanupTempFile(filePath string) error {
 	return nil
 }
 
-func (c *ConversionService) buildFFmpegArgs(inputPath, outputPath string, format AudioFormat) ([]string, error) {
-	args := []string{"-i", inputPath, "-y"}
-
-	switch format {
-	case FormatAIFF:
-		args = append(args, "-acodec", "pcm_s16be", "-f", "aiff")
-	case FormatWAV:
-		args = append(args, "-acodec", "pcm_s16le", "-f", "wav")
-	case FormatFLAC:
-		args = append(args, "-acodec", "flac", "-compression_level", "5") // sweet spot for both speed and compression
-
-	case FormatALAC:
-		args = append(args, "-acodec", "alac", "-f", "mp4") // ALAC is typically in MP4 container
-	case FormatMP3:
-		args = append(args, "-acodec", "libmp3lame", "-b:a", "320k", "-ar", "44100") // 320k, 44.1kHz sample rate
+// buildFFmpegArgs converts the samples [start, end) of a file, end 0 standing for its
+// end, as preset says. info describes the source, nil when it is unknown; what the
+// preset leaves unset is kept from it.
+func (c *ConversionService) buildFFmpegArgs(inputPath, outputPath string, preset ConversionPreset, info *AudioInfo, start, end int64, replayGain *ReplayGain) ([]string, error) {
+	if _, ok := formatEncoders[preset.Format]; !ok {
+		return nil, fmt.Errorf("unsupported format: %s", preset.Format)
+	}
+	var sourceRate int
+	if info != nil {
+		sourceRate = info.SampleRate
+	}
+	preset = preset.forSource(info)
 
-	case FormatOpus:
-		args = append(args, "-acodec", "libopus", "-b:a", "192k", "-vbr", "on") // High quality Opus (transparent quality) + Variable bitrate
+	args := []string{"-v", "error", "-i", inputPath, "-y", "-map", "0:a:0", "-map_metadata", "0"}
+	var filters []string
+	if start > 0 || end > 0 {
+		trim := fmt.Sprintf("atrim=start_sample=%d", start)
+		if end > 0 {
+			trim += fmt.Sprintf(":end_sample=%d", end)
+		}
+		filters = append(filters, trim, "asetpts=PTS-STARTPTS")
+	}
+	if filter := preset.resampleFilter(sourceRate, c.resampler); filter != "" {
+		filters = append(filters, filter)
+	}
+	if len(filters) > 0 {
+		args = append(args, "-af", strings.Join(filters, ","))
+	}
+	args = append(args, preset.encoderArgs()...)
 
-	default:
-		return nil, fmt.Errorf("unsupported format: %s", format)
+	if replayGain != nil {
+		// ffmpeg writes these as Vorbis comments, or as TXXX frames in MP3
+		for _, field := range replayGain.Fields() {
+			args = append(args, "-metadata", field[0]+"="+field[1])
+		}
 	}
 	args = append(args, outputPath)
 	return args, nil
 }
 
-func (c *ConversionService) validateFFmpeg() error {
-	cmd := exec.Command("ffmpeg", "-version")
+// runFFmpeg runs ffmpeg to the end, logging the tail of its output when it fails
+func (c *ConversionService) runFFmpeg(ctx context.Context, args ...string) error {
+	out, err := exec.CommandContext(ctx, c.ffmpegPath, args...).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if len(out) > maxLoggedOutput {
+		out = out[len(out)-maxLoggedOutput:]
+	}
+	logging.FromContext(ctx).Error("ffmpeg failed", "error", err, "args", args, "output", string(out))
+	return fmt.Errorf("ffmpeg exited with %v: %w", err, ErrConversionFailed)
+}
+
+// validateFFmpeg checks for ffmpeg until it is first found. A missing ffmpeg is looked
+// for again on the next call, so installing it needs no restart.
+func (c *ConversionService) validateFFmpeg(ctx context.Context) error {
+	if c.ffmpegFound.Load() {
+		return nil
+	}
+	return c.checkFFmpeg(ctx)
+}
+
+// checkFFmpeg runs `ffmpeg -version` every time, for readiness checks
+func (c *ConversionService) checkFFmpeg(ctx context.Context) error {
+	cmd := exec.CommandContext(ctx, c.ffmpegPath, "-version")
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("ffmpeg not found in system PATH. Please install ffmpeg to enable audio conversion")
+		logging.FromContext(ctx).Error("ffmpeg is not available", "ffmpeg_path", c.ffmpegPath, "error", err)
+		return fmt.Errorf("ffmpeg not found at %q, install it or set conversion.ffmpeg_path: %w", c.ffmpegPath, ErrFFmpegUnavailable)
 	}
+	c.ffmpegFound.Store(true)
 	return nil
 }
+
+// FFmpegVersion returns the first line of `ffmpeg -version`, e.g. "ffmpeg version 7.1 ..."
+func (c *ConversionService) FFmpegVersion(ctx context.Context) (string, error) {
+	output, err := exec.CommandContext(ctx, c.ffmpegPath, "-version").Output()
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg not found at %q: %w", c.ffmpegPath, ErrFFmpegUnavailable)
+	}
+	firstLine, _, _ := strings.Cut(string(output), "\n")
+	return strings.TrimSpace(firstLine), nil
+}
+
+// EncoderSupport says whether the local ffmpeg build can produce a format
+type EncoderSupport struct {
+	Encoder   string `json:"encoder"`
+	Available bool   `json:"available"`
+}
+
+// Encoders reports, for every supported format, whether ffmpeg was built with its encoder
+func (c *ConversionService) Encoders(ctx context.Context) (map[AudioFormat]EncoderSupport, error) {
+	output, err := exec.CommandContext(ctx, c.ffmpegPath, "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg not found at %q: %w", c.ffmpegPath, ErrFFmpegUnavailable)
+	}
+	available := parseEncoders(string(output))
+
+	support := make(map[AudioFormat]EncoderSupport, len(formatEncoders))
+	for format, encoder := range formatEncoders {
+		support[format] = EncoderSupport{Encoder: encoder, Available: available[encoder]}
+	}
+	return support, nil
+}
+
+// parseEncoders reads the encoder names from `ffmpeg -encoders`, whose listing
+// follows a "------" separator as lines of capability flags, name and description
+func parseEncoders(output string) map[string]bool {
+	encoders := make(map[string]bool)
+	_, listing, found := strings.Cut(output, "------")
+	if !found {
+		return encoders
+	}
+	for _, line := range strings.Split(listing, "\n") {
+		if fields := strings.Fields(line); len(fields) >= 2 {
+			encoders[fields[1]] = true
+		}
+	}
+	return encoders
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestConversionService_ValidateFFmpeg(t *testing.T) {
+	ctx := context.Background()
+	c := NewConversionService(t.TempDir())
+	c.ffmpegPath = filepath.Join(t.TempDir(), "ffmpeg")
+	if err := c.validateFFmpeg(ctx); !errors.Is(err, ErrFFmpegUnavailable) {
+		t.Fatalf("validateFFmpeg() without ffmpeg error = %v, want ErrFFmpegUnavailable", err)
+	}
+
+	// `true -version` succeeds like ffmpeg's
+	c.ffmpegPath = "true"
+	if err := c.validateFFmpeg(ctx); err != nil {
+		t.Fatalf("validateFFmpeg() error = %v", err)
+	}
+	// which is remembered, while readiness checks look again
+	c.ffmpegPath = "false"
+	if err := c.validateFFmpeg(ctx); err != nil {
+		t.Errorf("validateFFmpeg() once found error = %v", err)
+	}
+	if err := c.checkFFmpeg(ctx); !errors.Is(err, ErrFFmpegUnavailable) {
+		t.Errorf("checkFFmpeg() error = %v, want ErrFFmpegUnavailable", err)
+	}
+	if err := c.runFFmpeg(ctx, "-version"); !errors.Is(err, ErrConversionFailed) {
+		t.Errorf("runFFmpeg() error = %v, want ErrConversionFailed", err)
+	}
+}
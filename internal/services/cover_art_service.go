@@ -1,8 +1,8 @@
 package services
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
@@ -16,34 +16,33 @@ var coverArtValidExtensions = map[string]bool{
 	".webp": true,
 }
 
+var coverArtMIMETypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".webp": "image/webp",
+}
+
 func (f *FileService) ValidateCoverArt(file *multipart.FileHeader) error {
 	ext := strings.ToLower(filepath.Ext(file.Filename))
 	if !coverArtValidExtensions[ext] {
-		return fmt.Errorf("unsupported image format: %s (allowed: jpg, png, webp)", ext)
+		return NewServiceError("FileService.ValidateCoverArt", ErrUnsupportedFormat, fmt.Sprintf("unsupported image format: %s (allowed: jpg, png, webp)", ext))
 	}
 
 	if file.Size > f.maxCoverArtSize {
 		maxMB := f.maxCoverArtSize / (1 << 20)
-		return fmt.Errorf("image too large: maximum size is %dMB", maxMB)
+		return NewServiceError("FileService.ValidateCoverArt", ErrFileTooLarge, fmt.Sprintf("image too large: maximum size is %dMB", maxMB))
 	}
 	return nil
 }
 
-func (f *FileService) SaveCoverArt(file *multipart.FileHeader, albumID uint64) (*FileUploadResult, error) {
-	if albumID == 0 {
-		return nil, fmt.Errorf("invalid album ID")
-	}
-
+// SaveCoverArt stores the image in the content-addressed blob store.
+func (f *FileService) SaveCoverArt(ctx context.Context, userID uint64, file *multipart.FileHeader) (*FileUploadResult, error) {
 	if err := f.ValidateCoverArt(file); err != nil {
 		return nil, err
 	}
-
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	filename := fmt.Sprintf("%d_%s%s", albumID, generateRandomString(8), ext)
-	destPath := filepath.Join(f.coverArtDir, filename)
-
-	if err := os.MkdirAll(f.coverArtDir, dirPermissions); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
+	if err := f.checkQuota(ctx, userID, file.Size); err != nil {
+		return nil, err
 	}
 
 	src, err := file.Open()
@@ -52,27 +51,7 @@ func (f *FileService) SaveCoverArt(file *multipart.FileHeader, albumID uint64) (
 	}
 	defer src.Close()
 
-	dst, err := os.Create(destPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create destination file: %w", err)
-	}
-	defer dst.Close()
-
-	if err = dst.Chmod(filePermissions); err != nil {
-		os.Remove(destPath)
-		return nil, fmt.Errorf("failed to set file permissions: %w", err)
-	}
-
-	if _, err = io.Copy(dst, src); err != nil {
-		os.Remove(destPath)
-		return nil, fmt.Errorf("failed to save file: %w", err)
-	}
-
-	return &FileUploadResult{
-		Path:     destPath,
-		Filename: filename,
-		Size:     uint64(file.Size),
-	}, nil
+	return f.WriteBlob(src, filepath.Ext(file.Filename))
 }
 
 func (f *FileService) DeleteCoverArt(filePath string) error {
@@ -89,3 +68,19 @@ func (f *FileService) DeleteCoverArt(filePath string) error {
 	}
 	return nil
 }
+
+// ReadCoverArt reads the album's cover to embed in downloads, or returns nil when it has none
+func (f *FileService) ReadCoverArt(album *Album) (*Picture, error) {
+	if album.Metadata.CoverArtPath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(f.GetFullPath(album.Metadata.CoverArtPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cover art: %w", err)
+	}
+	mimeType := coverArtMIMETypes[strings.ToLower(filepath.Ext(album.Metadata.CoverArtPath))]
+	if mimeType == "" {
+		mimeType = "image/jpeg"
+	}
+	return &Picture{MIME: mimeType, Data: data}, nil
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cueFramesPerSecond is the resolution of CUE sheet times, which count CD frames
+const cueFramesPerSecond = 75
+
+// CueSheet is the part of a CUE sheet needed to split the recording it describes
+type CueSheet struct {
+	Performer string
+	Title     string
+	File      string
+	Tracks    []CueTrack
+}
+
+type CueTrack struct {
+	Number    int
+	Title     string
+	Performer string
+	Start     time.Duration // INDEX 01, where the track proper begins after any pregap
+}
+
+// ParseCueSheet reads a CUE sheet describing a single file. Commands that don't
+// affect where tracks start (REM, FLAGS, ISRC, PREGAP...) are ignored.
+func ParseCueSheet(r io.Reader) (*CueSheet, error) {
+	sheet := &CueSheet{}
+	var track *CueTrack
+	hasStart := false
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff") // byte order mark
+		}
+		command, rest, _ := strings.Cut(text, " ")
+		rest = strings.TrimSpace(rest)
+
+		fail := func(format string, args ...any) error {
+			return NewValidationError("cue_sheet", fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+		}
+
+		switch strings.ToUpper(command) {
+		case "FILE":
+			if sheet.File != "" {
+				return nil, fail("sheets spanning several files are not supported, upload each file with its own")
+			}
+			// FILE "name" TYPE
+			name := rest
+			if i := strings.LastIndex(rest, " "); i > 0 {
+				name = rest[:i]
+			}
+			sheet.File = cueString(name)
+		case "TRACK":
+			if track != nil && !hasStart {
+				return nil, fail("track %d has no INDEX 01", track.Number)
+			}
+			numberField, _, _ := strings.Cut(rest, " ")
+			number, err := strconv.Atoi(numberField)
+			if err != nil || number <= 0 {
+				return nil, fail("invalid track number %q", numberField)
+			}
+			sheet.Tracks = append(sheet.Tracks, CueTrack{Number: number})
+			track = &sheet.Tracks[len(sheet.Tracks)-1]
+			hasStart = false
+		case "TITLE":
+			if track != nil {
+				track.Title = cueString(rest)
+			} else {
+				sheet.Title = cueString(rest)
+			}
+		case "PERFORMER":
+			if track != nil {
+				track.Performer = cueString(rest)
+			} else {
+				sheet.Performer = cueString(rest)
+			}
+		case "INDEX":
+			if track == nil {
+				return nil, fail("INDEX outside a TRACK")
+			}
+			index, timestamp, _ := strings.Cut(rest, " ")
+			if index != "01" && index != "1" {
+				continue
+			}
+			start, err := parseCueTime(strings.TrimSpace(timestamp))
+			if err != nil {
+				return nil, fail("%v", err)
+			}
+			track.Start = start
+			hasStart = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read CUE sheet: %w", err)
+	}
+
+	if len(sheet.Tracks) == 0 {
+		return nil, NewValidationError("cue_sheet", "has no tracks")
+	}
+	if !hasStart {
+		return nil, NewValidationError("cue_sheet", fmt.Sprintf("track %d has no INDEX 01", track.Number))
+	}
+	return sheet, nil
+}
+
+// SplitPoints turns the sheet's tracks into the points a recording is cut at
+func (s *CueSheet) SplitPoints() []SplitPoint {
+	points := make([]SplitPoint, len(s.Tracks))
+	for i, track := range s.Tracks {
+		points[i] = SplitPoint{Title: track.Title, Start: track.Start}
+	}
+	return points
+}
+
+// cueString unquotes a value that may or may not be in double quotes
+func cueString(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// parseCueTime reads mm:ss:ff, where ff counts 1/75ths of a second
+func parseCueTime(s string) (time.Duration, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 3 {
+		return 0, fmt.Errorf("invalid time %q, want mm:ss:ff", s)
+	}
+	var values [3]int
+	for i, field := range fields {
+		value, err := strconv.Atoi(field)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid time %q, want mm:ss:ff", s)
+		}
+		values[i] = value
+	}
+	if values[1] >= 60 || values[2] >= cueFramesPerSecond {
+		return 0, fmt.Errorf("invalid time %q, want mm:ss:ff", s)
+	}
+	frames := int64((values[0]*60+values[1])*cueFramesPerSecond + values[2])
+	return time.Duration(frames * int64(time.Second) / cueFramesPerSecond), nil
+}
+
+// ParseTimestamp reads a split point given by hand: m:ss, m:ss.fff, or CUE-style
+// mm:ss:ff. A plain number is seconds.
+func ParseTimestamp(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.Count(s, ":") == 2 {
+		return parseCueTime(s)
+	}
+
+	minutes, seconds := "0", s
+	if m, sec, found := strings.Cut(s, ":"); found {
+		minutes, seconds = m, sec
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 {
+		return 0, fmt.Errorf("invalid time %q, want m:ss or m:ss.fff", s)
+	}
+	sec, err := strconv.ParseFloat(seconds, 64)
+	if err != nil || sec < 0 || (m > 0 && sec >= 60) {
+		return 0, fmt.Errorf("invalid time %q, want m:ss or m:ss.fff", s)
+	}
+	return time.Duration(m)*time.Minute + time.Duration(sec*float64(time.Second)+0.5), nil
+}
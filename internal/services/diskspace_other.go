@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package services
+
+func freeDiskSpace(path string) (uint64, error) {
+	return 0, errDiskSpaceUnsupported
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"errors"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -17,20 +18,32 @@ var (
 
 	ErrNotFound      = errors.New("resource not found")
 	ErrUserNotFound  = errors.New("user not found")
+	ErrUserExists    = errors.New("username or email already taken")
 	ErrAlbumNotFound = errors.New("album not found")
 	ErrTrackNotFound = errors.New("track not found")
 	ErrKeyNotFound   = errors.New("registration key not found")
+	ErrBlobNotFound  = errors.New("blob not found")
+	ErrScrubNotFound = errors.New("no scrub report found")
+
+	ErrReleaseNotFound   = errors.New("release not found")
+	ErrLookupUnavailable = errors.New("release lookup is unavailable")
 
 	ErrFileNotFound      = errors.New("file not found")
 	ErrFileTooLarge      = errors.New("file too large")
 	ErrUnsupportedFormat = errors.New("unsupported file format")
 	ErrFileOutsideDir    = errors.New("file path is outside allowed directories")
+	ErrQuotaExceeded     = errors.New("storage quota exceeded")
 
 	ErrKeyAlreadyUsed = errors.New("registration key has already been used")
 	ErrKeyExpired     = errors.New("registration key has expired")
 	ErrInvalidKey     = errors.New("invalid registration key")
 
 	ErrAdminOnly = errors.New("only admins can perform this action")
+
+	ErrScrubRunning = errors.New("a scrub is already running")
+
+	ErrFFmpegUnavailable = errors.New("ffmpeg is not available")
+	ErrConversionFailed  = errors.New("audio conversion failed")
 )
 
 type ServiceError struct {
@@ -74,12 +87,25 @@ func NewValidationError(field, message string) *ValidationError {
 	}
 }
 
+// ValidationErrors collects every invalid field of a request
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
 func IsNotFound(err error) bool {
 	return errors.Is(err, ErrNotFound) ||
 		errors.Is(err, ErrUserNotFound) ||
 		errors.Is(err, ErrAlbumNotFound) ||
 		errors.Is(err, ErrTrackNotFound) ||
 		errors.Is(err, ErrKeyNotFound) ||
+		errors.Is(err, ErrBlobNotFound) ||
+		errors.Is(err, ErrScrubNotFound) ||
 		errors.Is(err, ErrFileNotFound)
 }
 
@@ -92,7 +118,9 @@ func IsUnauthorized(err error) bool {
 
 func IsValidation(err error) bool {
 	var valErr *ValidationError
+	var valErrs ValidationErrors
 	return errors.As(err, &valErr) ||
+		errors.As(err, &valErrs) ||
 		errors.Is(err, ErrInvalidInput) ||
 		errors.Is(err, ErrInvalidEmail) ||
 		errors.Is(err, ErrPasswordTooShort) ||
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"vinyl-vault/pkg"
+)
+
+// ExportVersion is the version of the export format, which api/export.schema.json
+// describes. It goes up when a field changes meaning or goes away, not when one is added.
+const ExportVersion = 1
+
+// Export is a set of releases in the export format: the metadata of the albums,
+// without anything that refers to files on the server
+type Export struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Releases   []ExportRelease `json:"releases"`
+}
+
+type ExportRelease struct {
+	Artist        string        `json:"artist"`
+	Title         string        `json:"title"`
+	Format        string        `json:"format"`
+	ReleaseDate   string        `json:"release_date,omitempty"`
+	Label         string        `json:"label,omitempty"`
+	Country       string        `json:"country,omitempty"`
+	CatalogNumber string        `json:"catalog_number,omitempty"`
+	Barcode       string        `json:"barcode,omitempty"`
+	PressingPlant string        `json:"pressing_plant,omitempty"`
+	Matrix        []pkg.Matrix  `json:"matrix,omitempty"`
+	EditionNotes  string        `json:"edition_notes,omitempty"`
+	Genres        []string      `json:"genres,omitempty"`
+	Styles        []string      `json:"styles,omitempty"`
+	Media         []Medium      `json:"media"`
+	Tracks        []ExportTrack `json:"tracks"`
+}
+
+type ExportTrack struct {
+	Position    string       `json:"position"` // A1, or the track number on releases without sides
+	DiscNumber  int          `json:"disc_number"`
+	Side        string       `json:"side,omitempty"`
+	TrackNumber int          `json:"track_number"`
+	Title       string       `json:"title"`
+	Duration    pkg.Duration `json:"duration,omitempty"` // seconds
+	Credits     []pkg.Credit `json:"credits,omitempty"`
+}
+
+// ExportAlbum exports a single album
+func (a *AlbumService) ExportAlbum(ctx context.Context, albumID uint64) (*Export, error) {
+	album, err := a.albumRepository.FindByID(ctx, albumID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export album: %w", err)
+	}
+	return newExport([]*Album{album}), nil
+}
+
+// ExportAlbums exports every album of the user outside the trash
+func (a *AlbumService) ExportAlbums(ctx context.Context, userID uint64) (*Export, error) {
+	albums, err := a.albumRepository.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export albums: %w", err)
+	}
+	return newExport(albums), nil
+}
+
+func newExport(albums []*Album) *Export {
+	export := &Export{
+		Version:    ExportVersion,
+		ExportedAt: time.Now().UTC().Truncate(time.Second),
+		Releases:   make([]ExportRelease, 0, len(albums)),
+	}
+	for _, album := range albums {
+		metadata := album.Metadata
+		release := ExportRelease{
+			Artist:        metadata.Artist,
+			Title:         metadata.Album,
+			Format:        metadata.Format,
+			ReleaseDate:   metadata.ReleaseDate,
+			CatalogNumber: metadata.CatalogNumber,
+			Barcode:       metadata.Barcode,
+			PressingPlant: metadata.PressingPlant,
+			Matrix:        metadata.Matrix,
+			EditionNotes:  metadata.EditionNotes,
+			Genres:        metadata.Genres,
+			Styles:        metadata.Styles,
+			Media:         album.Media,
+			Tracks:        make([]ExportTrack, 0, len(album.Tracks)),
+		}
+		if release.Media == nil {
+			release.Media = []Medium{}
+		}
+		if metadata.Label != nil {
+			release.Label = *metadata.Label
+		}
+		if metadata.Country != nil {
+			release.Country = *metadata.Country
+		}
+		for _, track := range album.Tracks {
+			release.Tracks = append(release.Tracks, ExportTrack{
+				Position:    track.Position(),
+				DiscNumber:  track.DiscNumber,
+				Side:        track.Side,
+				TrackNumber: track.TrackNumber,
+				Title:       track.Title,
+				Duration:    track.Duration,
+				Credits:     track.Credits,
+			})
+		}
+		export.Releases = append(export.Releases, release)
+	}
+	return export
+}
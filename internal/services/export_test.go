@@ -0,0 +1,8 @@
+package services
+
+// What the services_test tests need from inside the package
+
+// Queued returns the tracks waiting for analysis
+func (a *AnalysisService) Queued() <-chan uint64 {
+	return a.queue
+}
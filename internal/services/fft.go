@@ -0,0 +1,69 @@
+package services
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// spectrumAnalyzer takes the power spectrum of frames of a fixed size, a power of two,
+// through a Hann window
+type spectrumAnalyzer struct {
+	size     int
+	window   []float64
+	twiddles []complex128 // e^(-2πik/size) for k < size/2
+	buf      []complex128
+}
+
+func newSpectrumAnalyzer(size int) *spectrumAnalyzer {
+	s := &spectrumAnalyzer{
+		size:     size,
+		window:   make([]float64, size),
+		twiddles: make([]complex128, size/2),
+		buf:      make([]complex128, size),
+	}
+	for i := range size {
+		s.window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+	}
+	for k := range size / 2 {
+		s.twiddles[k] = cmplx.Rect(1, -2*math.Pi*float64(k)/float64(size))
+	}
+	return s
+}
+
+// power writes the power of bins 0 to size/2 of frame, which holds size samples, to out
+func (s *spectrumAnalyzer) power(frame, out []float64) {
+	for i, v := range frame[:s.size] {
+		s.buf[i] = complex(v*s.window[i], 0)
+	}
+	s.transform()
+	// scaled so that a full-scale sine peaks near 1 whatever the size
+	scale := 16 / float64(s.size*s.size)
+	for k := range s.size/2 + 1 {
+		re, im := real(s.buf[k]), imag(s.buf[k])
+		out[k] = (re*re + im*im) * scale
+	}
+}
+
+// transform is an in-place radix-2 FFT of buf
+func (s *spectrumAnalyzer) transform() {
+	n, x := s.size, s.buf
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		half, stride := size/2, n/size
+		for start := 0; start < n; start += size {
+			for k := range half {
+				a, b := x[start+k], x[start+k+half]*s.twiddles[k*stride]
+				x[start+k], x[start+k+half] = a+b, a-b
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"vinyl-vault/pkg"
+)
+
+// FileProvider looks releases up in a directory of JSON files in the export format,
+// for use offline and in tests. A release's ID is its file name and its index in the
+// file, as in "pink-floyd.json#0". Files are read on every lookup, so releases can be
+// added without a restart.
+type FileProvider struct {
+	dir string
+}
+
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{dir: dir}
+}
+
+func (f *FileProvider) Name() string {
+	return "file"
+}
+
+// Search matches barcodes and catalog numbers whole, ignoring spaces and dashes, and
+// artists and titles on part of the name, ignoring case
+func (f *FileProvider) Search(ctx context.Context, query ReleaseQuery) ([]ReleaseCandidate, error) {
+	names, err := filepath.Glob(filepath.Join(f.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var candidates []ReleaseCandidate
+	for _, path := range names {
+		export, err := readExport(path)
+		if err != nil {
+			return nil, err
+		}
+		for i, release := range export.Releases {
+			if query.matchesRelease(&release) {
+				candidates = append(candidates, f.candidate(filepath.Base(path), i, &release))
+			}
+		}
+	}
+	return candidates, nil
+}
+
+func (f *FileProvider) Release(ctx context.Context, id string) (*ReleaseCandidate, error) {
+	name, index, found := strings.Cut(id, "#")
+	i, err := strconv.Atoi(index)
+	// IDs name a file in the directory, never a path
+	if !found || err != nil || name != filepath.Base(name) || filepath.Ext(name) != ".json" {
+		return nil, fmt.Errorf("release %q: %w", id, ErrReleaseNotFound)
+	}
+	export, err := readExport(filepath.Join(f.dir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("release %q: %w", id, ErrReleaseNotFound)
+	} else if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(export.Releases) {
+		return nil, fmt.Errorf("release %q: %w", id, ErrReleaseNotFound)
+	}
+	candidate := f.candidate(name, i, &export.Releases[i])
+	return &candidate, nil
+}
+
+func readExport(path string) (*Export, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var export Export
+	if err = json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("failed to read releases from %s: %w", filepath.Base(path), err)
+	}
+	if export.Version > ExportVersion {
+		return nil, fmt.Errorf("%s is export version %d, newer than this server's %d", filepath.Base(path), export.Version, ExportVersion)
+	}
+	return &export, nil
+}
+
+func (q ReleaseQuery) matchesRelease(release *ExportRelease) bool {
+	contains := func(value, part string) bool {
+		return strings.Contains(strings.ToLower(value), strings.ToLower(strings.TrimSpace(part)))
+	}
+	return (q.Barcode == "" || compactCode(q.Barcode) == compactCode(release.Barcode)) &&
+		(q.CatalogNumber == "" || compactCode(q.CatalogNumber) == compactCode(release.CatalogNumber)) &&
+		(q.Artist == "" || contains(release.Artist, q.Artist)) &&
+		(q.Title == "" || contains(release.Title, q.Title))
+}
+
+func (f *FileProvider) candidate(name string, index int, release *ExportRelease) ReleaseCandidate {
+	candidate := ReleaseCandidate{
+		Provider: f.Name(),
+		ID:       fmt.Sprintf("%s#%d", name, index),
+		Metadata: pkg.Metadata{
+			Artist:        release.Artist,
+			Album:         release.Title,
+			Format:        release.Format,
+			ReleaseDate:   release.ReleaseDate,
+			CatalogNumber: release.CatalogNumber,
+			Barcode:       release.Barcode,
+			PressingPlant: release.PressingPlant,
+			Matrix:        release.Matrix,
+			EditionNotes:  release.EditionNotes,
+			Genres:        release.Genres,
+			Styles:        release.Styles,
+		},
+		Media:  release.Media,
+		Tracks: make([]CandidateTrack, len(release.Tracks)),
+	}
+	if release.Label != "" {
+		candidate.Metadata.Label = &release.Label
+	}
+	if release.Country != "" {
+		candidate.Metadata.Country = &release.Country
+	}
+	for i, track := range release.Tracks {
+		candidate.Tracks[i] = CandidateTrack{
+			DiscNumber:  track.DiscNumber,
+			Side:        track.Side,
+			TrackNumber: track.TrackNumber,
+			Title:       track.Title,
+			Duration:    track.Duration,
+			Credits:     track.Credits,
+		}
+	}
+	return candidate
+}
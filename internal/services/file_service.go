@@ -1,8 +1,7 @@
 package services
 
 import (
-	"crypto/rand"
-	"encoding/hex"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -18,11 +17,14 @@ const (
 type FileUploadResult struct {
 	Path, Filename string
 	Size           uint64
+	Hash           string // hex SHA-256 of the content
 }
 
 type FileService struct {
 	uploadDir, coverArtDir, audioDir  string
+	blobDir                           string
 	maxAudioFileSize, maxCoverArtSize int64
+	quota                             QuotaChecker
 }
 
 func NewFileService(uploadDir, coverArtDir, audioDir string) *FileService {
@@ -30,21 +32,35 @@ func NewFileService(uploadDir, coverArtDir, audioDir string) *FileService {
 		uploadDir:        uploadDir,
 		coverArtDir:      coverArtDir,
 		audioDir:         audioDir,
+		blobDir:          filepath.Join(uploadDir, blobDirName),
 		maxAudioFileSize: 500 << 20, // 500mb
 		maxCoverArtSize:  10 << 20,  // 10mb
 	}
 }
 
-func NewFileServiceWithConfig(uploadDir, coverArtDir, audioDir string, cfg *config.Config) *FileService {
+func NewFileServiceWithConfig(cfg *config.Config) *FileService {
 	return &FileService{
-		uploadDir:        uploadDir,
-		coverArtDir:      coverArtDir,
-		audioDir:         audioDir,
-		maxAudioFileSize: cfg.MaxAudioFileSize,
-		maxCoverArtSize:  cfg.MaxCoverArtSize,
+		uploadDir:        cfg.Storage.UploadDir,
+		coverArtDir:      cfg.Storage.CoverArtPath(),
+		audioDir:         cfg.Storage.AudioPath(),
+		blobDir:          filepath.Join(cfg.Storage.UploadDir, blobDirName),
+		maxAudioFileSize: int64(cfg.Limits.MaxAudioFileSize),
+		maxCoverArtSize:  int64(cfg.Limits.MaxCoverArtSize),
 	}
 }
 
+// SetQuotaChecker enables per-user storage quotas on uploads
+func (f *FileService) SetQuotaChecker(quota QuotaChecker) {
+	f.quota = quota
+}
+
+func (f *FileService) checkQuota(ctx context.Context, userID uint64, size int64) error {
+	if f.quota == nil {
+		return nil
+	}
+	return f.quota.CheckQuota(ctx, userID, size)
+}
+
 func (f *FileService) GetRelativePath(fullPath string) (string, error) {
 	if fullPath == "" {
 		return "", fmt.Errorf("path cannot be empty")
@@ -70,7 +86,7 @@ func (f *FileService) GetRelativePath(fullPath string) (string, error) {
 		return "", fmt.Errorf("failed to get relative path: %w", err)
 	}
 	if rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
-		return "", fmt.Errorf("path is outside upload dir")
+		return "", fmt.Errorf("%s: %w", fullPath, ErrFileOutsideDir)
 	}
 	return rel, nil
 }
@@ -96,7 +112,7 @@ func (f *FileService) FileExists(filePath string) bool {
 }
 
 func (f *FileService) EnsureDirectoriesExist() error {
-	dirs := []string{f.uploadDir, f.coverArtDir, f.audioDir}
+	dirs := []string{f.uploadDir, f.coverArtDir, f.audioDir, f.blobDir}
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, dirPermissions); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", dir, err)
@@ -105,6 +121,22 @@ func (f *FileService) EnsureDirectoriesExist() error {
 	return nil
 }
 
+// CheckWritable creates the media directories if needed and proves each accepts new files
+func (f *FileService) CheckWritable() error {
+	if err := f.EnsureDirectoriesExist(); err != nil {
+		return err
+	}
+	for _, dir := range []string{f.uploadDir, f.audioDir, f.coverArtDir} {
+		probe, err := os.CreateTemp(dir, ".write-check-*")
+		if err != nil {
+			return fmt.Errorf("directory %s is not writable: %w", dir, err)
+		}
+		probe.Close()
+		os.Remove(probe.Name())
+	}
+	return nil
+}
+
 func (f *FileService) ValidateFilePath(filePath string) error {
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
@@ -117,7 +149,7 @@ func (f *FileService) ValidateFilePath(filePath string) error {
 		return fmt.Errorf("invalid file path: %w", err)
 	}
 
-	allowedDirs := []string{f.uploadDir, f.audioDir, f.coverArtDir}
+	allowedDirs := []string{f.uploadDir, f.audioDir, f.coverArtDir, f.blobDir}
 	for _, dir := range allowedDirs {
 		absDir, err := filepath.Abs(dir)
 		if err != nil {
@@ -132,15 +164,7 @@ func (f *FileService) ValidateFilePath(filePath string) error {
 		}
 	}
 
-	return fmt.Errorf("file path is outside allowed directories")
-}
-
-func generateRandomString(length int) string {
-	bytes := make([]byte, length/2)
-	if _, err := rand.Read(bytes); err != nil {
-		return ""
-	}
-	return hex.EncodeToString(bytes)
+	return fmt.Errorf("%s: %w", filePath, ErrFileOutsideDir)
 }
 
 func SanitizeFilename(name string) string {
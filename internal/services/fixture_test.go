@@ -0,0 +1,90 @@
+package services_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"vinyl-vault/internal/repositories/memory"
+	"vinyl-vault/internal/services"
+	"vinyl-vault/pkg"
+)
+
+// fixture is a vault over the in-memory repositories and a temporary blob store
+type fixture struct {
+	users  services.UserRepository
+	albums services.AlbumRepository
+	tracks services.TrackRepository
+	blobs  services.BlobRepository
+	scrubs services.ScrubRepository
+
+	files       *services.FileService
+	quota       *services.QuotaService
+	blobService *services.BlobService
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	store := memory.NewStore()
+	dir := t.TempDir()
+
+	f := &fixture{
+		users:  memory.NewUserRepository(store),
+		albums: memory.NewAlbumRepository(store),
+		tracks: memory.NewTrackRepository(store),
+		blobs:  memory.NewBlobRepository(store),
+		scrubs: memory.NewScrubRepository(store),
+		files:  services.NewFileService(dir, filepath.Join(dir, "covers"), filepath.Join(dir, "audio")),
+	}
+	if err := f.files.EnsureDirectoriesExist(); err != nil {
+		t.Fatal(err)
+	}
+	f.quota = services.NewQuotaService(f.users, f.albums, f.blobs, 0)
+	f.blobService = services.NewBlobService(f.blobs, f.files, f.quota)
+	return f
+}
+
+func (f *fixture) user(t *testing.T, username string) *services.User {
+	t.Helper()
+	user := &services.User{Username: username, Email: username + "@example.com", PasswordHash: "hash"}
+	if err := f.users.Save(context.Background(), user); err != nil {
+		t.Fatalf("saving user: %v", err)
+	}
+	return user
+}
+
+func (f *fixture) album(t *testing.T, userID uint64, title string) *services.Album {
+	t.Helper()
+	album := &services.Album{UserID: userID, Metadata: pkg.Metadata{Artist: "Artist", Album: title}}
+	if err := f.albums.Save(context.Background(), album); err != nil {
+		t.Fatalf("saving album: %v", err)
+	}
+	return album
+}
+
+// track saves a track of the album holding blob, or a stub when blob is nil
+func (f *fixture) track(t *testing.T, albumID uint64, number int, blob *services.Blob) *services.Track {
+	t.Helper()
+	track := &services.Track{AlbumID: albumID, TrackNumber: number, Title: "Track"}
+	if blob != nil {
+		track.BlobID = &blob.ID
+	}
+	if err := f.tracks.Save(context.Background(), track); err != nil {
+		t.Fatalf("saving track: %v", err)
+	}
+	return track
+}
+
+// blob stores content as a blob referenced by the user
+func (f *fixture) blob(t *testing.T, userID uint64, content, ext string) *services.Blob {
+	t.Helper()
+	upload, err := f.files.WriteBlob(strings.NewReader(content), ext)
+	if err != nil {
+		t.Fatalf("writing blob: %v", err)
+	}
+	blob, err := f.blobService.Acquire(context.Background(), userID, upload)
+	if err != nil {
+		t.Fatalf("acquiring blob: %v", err)
+	}
+	return blob
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+	"vinyl-vault/internal/config"
+	"vinyl-vault/internal/database"
+	"vinyl-vault/internal/logging"
+)
+
+// checkTimeout bounds each readiness check, so one hung dependency can't stall the probe
+const checkTimeout = 5 * time.Second
+
+var errDiskSpaceUnsupported = errors.New("free disk space is not reported on this platform")
+
+type CheckStatus string
+
+const (
+	CheckOK      CheckStatus = "ok"
+	CheckFailed  CheckStatus = "failed"
+	CheckSkipped CheckStatus = "skipped"
+)
+
+type CheckResult struct {
+	Name     string        `json:"name"`
+	Status   CheckStatus   `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+type ReadinessReport struct {
+	Ready  bool          `json:"ready"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Diagnostics is the admin overview of the instance. Config only holds settings safe to show.
+type Diagnostics struct {
+	Versions DiagnosticsVersions            `json:"versions"`
+	Config   ConfigSummary                  `json:"config"`
+	Encoders map[AudioFormat]EncoderSupport `json:"encoders,omitempty"`
+	Counts   DiagnosticsCounts              `json:"counts"`
+	Checks   []CheckResult                  `json:"checks"`
+}
+
+type DiagnosticsVersions struct {
+	App    string `json:"app"`
+	Go     string `json:"go"`
+	FFmpeg string `json:"ffmpeg,omitempty"`
+}
+
+type ConfigSummary struct {
+	Environment         string          `json:"environment"`
+	Database            string          `json:"database"`
+	UploadDir           string          `json:"upload_dir"`
+	AudioDir            string          `json:"audio_dir"`
+	CoverArtDir         string          `json:"cover_art_dir"`
+	TempDir             string          `json:"temp_dir"`
+	MaxAudioFileSize    config.ByteSize `json:"max_audio_file_size"`
+	MaxCoverArtSize     config.ByteSize `json:"max_cover_art_size"`
+	DefaultStorageQuota config.ByteSize `json:"default_storage_quota"`
+	MinFreeDiskSpace    config.ByteSize `json:"min_free_disk_space"`
+	TrashRetention      config.Duration `json:"trash_retention"`
+	ScrubInterval       config.Duration `json:"scrub_interval"`
+	MetricsEnabled      bool            `json:"metrics_enabled"`
+	IngestFLAC          bool            `json:"ingest_flac"`
+}
+
+type DiagnosticsCounts struct {
+	Users  int64 `json:"users"`
+	Albums int64 `json:"albums"`
+	Tracks int64 `json:"tracks"`
+}
+
+// DatabasePinger is satisfied by *sql.DB
+type DatabasePinger interface {
+	PingContext(ctx context.Context) error
+}
+
+type HealthService struct {
+	cfg               *config.Config
+	db                DatabasePinger
+	userRepository    UserRepository
+	albumRepository   AlbumRepository
+	trackRepository   TrackRepository
+	fileService       *FileService
+	conversionService *ConversionService
+}
+
+func NewHealthService(
+	cfg *config.Config,
+	db DatabasePinger,
+	userRepository UserRepository,
+	albumRepository AlbumRepository,
+	trackRepository TrackRepository,
+	fileService *FileService,
+	conversionService *ConversionService,
+) *HealthService {
+	return &HealthService{
+		cfg:               cfg,
+		db:                db,
+		userRepository:    userRepository,
+		albumRepository:   albumRepository,
+		trackRepository:   trackRepository,
+		fileService:       fileService,
+		conversionService: conversionService,
+	}
+}
+
+// Readiness runs every dependency check concurrently; the instance is ready when none failed
+func (h *HealthService) Readiness(ctx context.Context) *ReadinessReport {
+	checks := []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{"database", h.db.PingContext},
+		{"storage", func(ctx context.Context) error { return h.fileService.CheckWritable() }},
+		{"ffmpeg", h.conversionService.checkFFmpeg},
+		{"disk_space", h.checkDiskSpace},
+	}
+
+	report := &ReadinessReport{Ready: true, Checks: make([]CheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = runCheck(ctx, check.name, check.run)
+		}()
+	}
+	wg.Wait()
+
+	logger := logging.FromContext(ctx)
+	for _, result := range report.Checks {
+		if result.Status == CheckFailed {
+			report.Ready = false
+			logger.Warn("readiness check failed", "check", result.Name, "error", result.Error)
+		}
+	}
+	return report
+}
+
+func runCheck(ctx context.Context, name string, run func(ctx context.Context) error) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := run(ctx)
+	result := CheckResult{Name: name, Status: CheckOK, Duration: time.Since(start)}
+	switch {
+	case errors.Is(err, errDiskSpaceUnsupported):
+		result.Status = CheckSkipped
+		result.Error = err.Error()
+	case err != nil:
+		result.Status = CheckFailed
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// checkDiskSpace fails when the filesystem holding uploads or scratch space runs low
+func (h *HealthService) checkDiskSpace(ctx context.Context) error {
+	minFree := uint64(h.cfg.Limits.MinFreeDiskSpace)
+	for _, dir := range []string{h.cfg.Storage.UploadDir, h.cfg.Storage.TempDir} {
+		// the temp dir is only created by the first conversion
+		if err := os.MkdirAll(dir, dirPermissions); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+		free, err := freeDiskSpace(dir)
+		if err != nil {
+			if errors.Is(err, errDiskSpaceUnsupported) {
+				return err
+			}
+			return fmt.Errorf("failed to read free space of %s: %w", dir, err)
+		}
+		if free < minFree {
+			return fmt.Errorf("%s has %s free, below limits.min_free_disk_space (%s)",
+				dir, config.ByteSize(free), h.cfg.Limits.MinFreeDiskSpace)
+		}
+	}
+	return nil
+}
+
+// Diagnostics reports versions, settings, encoder support, library size and check results (admin only)
+func (h *HealthService) Diagnostics(ctx context.Context, adminID uint64) (*Diagnostics, error) {
+	admin, err := h.userRepository.FindByID(ctx, adminID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+	if !admin.IsAdmin {
+		return nil, fmt.Errorf("view diagnostics: %w", ErrAdminOnly)
+	}
+
+	diagnostics := &Diagnostics{
+		Versions: DiagnosticsVersions{App: appVersion(), Go: runtime.Version()},
+		Config:   h.configSummary(),
+		Checks:   h.Readiness(ctx).Checks,
+	}
+
+	// a missing ffmpeg already shows up as a failed check
+	if version, err := h.conversionService.FFmpegVersion(ctx); err == nil {
+		diagnostics.Versions.FFmpeg = version
+	}
+	if encoders, err := h.conversionService.Encoders(ctx); err == nil {
+		diagnostics.Encoders = encoders
+	}
+
+	if diagnostics.Counts.Users, err = h.userRepository.Count(ctx); err != nil {
+		return nil, err
+	}
+	if diagnostics.Counts.Albums, err = h.albumRepository.Count(ctx); err != nil {
+		return nil, err
+	}
+	if diagnostics.Counts.Tracks, err = h.trackRepository.Count(ctx); err != nil {
+		return nil, err
+	}
+	return diagnostics, nil
+}
+
+func (h *HealthService) configSummary() ConfigSummary {
+	cfg := h.cfg
+	return ConfigSummary{
+		Environment:         cfg.Environment,
+		Database:            database.Driver(cfg.DatabaseURL),
+		UploadDir:           cfg.Storage.UploadDir,
+		AudioDir:            cfg.Storage.AudioPath(),
+		CoverArtDir:         cfg.Storage.CoverArtPath(),
+		TempDir:             cfg.Storage.TempDir,
+		MaxAudioFileSize:    cfg.Limits.MaxAudioFileSize,
+		MaxCoverArtSize:     cfg.Limits.MaxCoverArtSize,
+		DefaultStorageQuota: cfg.Limits.DefaultStorageQuota,
+		MinFreeDiskSpace:    cfg.Limits.MinFreeDiskSpace,
+		TrashRetention:      cfg.Maintenance.TrashRetention,
+		ScrubInterval:       cfg.Maintenance.ScrubInterval,
+		MetricsEnabled:      cfg.Metrics.Enabled,
+		IngestFLAC:          cfg.Conversion.IngestFLAC,
+	}
+}
+
+// appVersion is the module version stamped by the Go toolchain, with the VCS revision when built from a checkout
+func appVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := info.Main.Version
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			version += " (" + setting.Value + ")"
+		}
+	}
+	return version
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"vinyl-vault/internal/config"
+)
+
+type pingerFunc func(ctx context.Context) error
+
+func (f pingerFunc) PingContext(ctx context.Context) error {
+	return f(ctx)
+}
+
+func TestParseEncoders(t *testing.T) {
+	output := `Encoders:
+ V..... = Video
+ A..... = Audio
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (codec h264)
+ A....D flac                 FLAC (Free Lossless Audio Codec)
+ A....D pcm_s16le            PCM signed 16-bit little-endian
+`
+	encoders := parseEncoders(output)
+	for _, name := range []string{"libx264", "flac", "pcm_s16le"} {
+		if !encoders[name] {
+			t.Errorf("parseEncoders() is missing %q", name)
+		}
+	}
+	if encoders["="] || encoders["libmp3lame"] {
+		t.Errorf("parseEncoders() = %v, picked up names outside the listing", encoders)
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	newHealthService := func(t *testing.T, ping pingerFunc, minFree config.ByteSize) *HealthService {
+		dir := t.TempDir()
+		cfg := config.Default()
+		cfg.Storage.UploadDir = filepath.Join(dir, "uploads")
+		cfg.Storage.TempDir = filepath.Join(dir, "tmp")
+		cfg.Limits.MinFreeDiskSpace = minFree
+		cfg.Conversion.FFmpegPath = filepath.Join(dir, "no-ffmpeg")
+
+		return NewHealthService(cfg, ping, nil, nil, nil,
+			NewFileServiceWithConfig(cfg), NewConversionServiceWithConfig(cfg))
+	}
+	healthy := pingerFunc(func(ctx context.Context) error { return nil })
+
+	tests := []struct {
+		name       string
+		ping       pingerFunc
+		minFree    config.ByteSize
+		wantFailed []string
+	}{
+		{name: "missing ffmpeg", ping: healthy, wantFailed: []string{"ffmpeg"}},
+		{
+			name:       "database down",
+			ping:       func(ctx context.Context) error { return errors.New("connection refused") },
+			wantFailed: []string{"database", "ffmpeg"},
+		},
+		{name: "disk full", ping: healthy, minFree: 1 << 62, wantFailed: []string{"ffmpeg", "disk_space"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := newHealthService(t, tt.ping, tt.minFree).Readiness(context.Background())
+			if report.Ready {
+				t.Error("Readiness() reported ready with failing checks")
+			}
+
+			var failed []string
+			for _, check := range report.Checks {
+				if check.Status == CheckFailed {
+					failed = append(failed, check.Name)
+				}
+			}
+			if len(failed) != len(tt.wantFailed) {
+				t.Fatalf("failed checks = %v, want %v", failed, tt.wantFailed)
+			}
+			for i := range failed {
+				if failed[i] != tt.wantFailed[i] {
+					t.Errorf("failed checks = %v, want %v", failed, tt.wantFailed)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errNotIngestable marks uploads that are kept as they are rather than stored as FLAC
+var errNotIngestable = errors.New("not 16 or 24-bit integer WAV or AIFF")
+
+// errFLACStored marks uploads whose FLAC is a blob of its own already, uploaded as it is
+var errFLACStored = errors.New("FLAC is stored already")
+
+// BlobSource is what it takes to rebuild an upload that was stored as FLAC byte for
+// byte: everything in the file around its samples, and how those were encoded.
+type BlobSource struct {
+	Ext     string `json:"ext"` // of the upload, e.g. ".aiff"
+	Size    int64  `json:"size"`
+	Encoder string `json:"encoder"` // the ffmpeg encoder that writes the samples as they were, e.g. pcm_s24be
+	PCMMD5  string `json:"pcm_md5"` // hex MD5 of the samples
+	Header  []byte `json:"header"`  // everything before the first sample
+	Trailer []byte `json:"trailer,omitempty"`
+}
+
+// readBlobSource reads what a WAV or AIFF file is besides its samples, and the bit
+// depth they are stored at. Only 16 and 24-bit integer samples are taken, which FLAC
+// holds exactly; anything else is errNotIngestable.
+func readBlobSource(path string) (*BlobSource, int, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".wav" && ext != ".aiff" {
+		return nil, 0, errNotIngestable
+	}
+	info, err := ReadAudioInfo(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	layout := info.pcm
+	if layout == nil || layout.encoding == nil {
+		return nil, 0, errNotIngestable
+	}
+	encoding := layout.encoding
+	if encoding.float || encoding.unsigned || (encoding.bytes != 2 && encoding.bytes != 3) ||
+		info.BitDepth != encoding.bytes*8 || layout.frameSize != int64(encoding.bytes*info.Channels) {
+		return nil, 0, errNotIngestable
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	dataEnd := layout.dataOffset + info.Samples*layout.frameSize
+	if dataEnd > stat.Size() {
+		return nil, 0, fmt.Errorf("%s is cut short", filepath.Base(path))
+	}
+	if stat.Size()-dataEnd > maxAudioHeader {
+		return nil, 0, fmt.Errorf("%s has too much after its samples", filepath.Base(path))
+	}
+
+	sum := md5.New()
+	if _, err = io.Copy(sum, io.NewSectionReader(file, layout.dataOffset, dataEnd-layout.dataOffset)); err != nil {
+		return nil, 0, fmt.Errorf("failed to read samples: %w", err)
+	}
+	trailer := make([]byte, stat.Size()-dataEnd)
+	if _, err = file.ReadAt(trailer, dataEnd); err != nil {
+		return nil, 0, fmt.Errorf("failed to read audio trailer: %w", err)
+	}
+
+	return &BlobSource{
+		Ext:     ext,
+		Size:    stat.Size(),
+		Encoder: pcmEncoder(info.BitDepth, encoding.order == binary.BigEndian),
+		PCMMD5:  hex.EncodeToString(sum.Sum(nil)),
+		Header:  bytes.Clone(layout.header),
+		Trailer: trailer,
+	}, info.BitDepth, nil
+}
+
+// rebuildSource writes the file source describes to w, its samples decoded from the
+// FLAC at flacPath, and returns the MD5 of those samples
+func (c *ConversionService) rebuildSource(ctx context.Context, flacPath string, source *BlobSource, w io.Writer) (string, error) {
+	raw, err := c.DecodeRaw(ctx, flacPath, source.Encoder)
+	if err != nil {
+		return "", err
+	}
+	defer raw.Close()
+
+	sum := md5.New()
+	if _, err = w.Write(source.Header); err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(io.MultiWriter(w, sum), raw); err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", filepath.Base(flacPath), err)
+	}
+	if _, err = w.Write(source.Trailer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// RebuildSource writes the upload a blob stored as FLAC was made from to a temp file,
+// checking it against the hash of the upload. The caller removes the file with
+// CleanupTempFile.
+func (c *ConversionService) RebuildSource(ctx context.Context, flacPath string, source *BlobSource, sourceHash string) (string, error) {
+	if err := os.MkdirAll(c.tempDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	output, err := os.CreateTemp(c.tempDir, "source-*"+source.Ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	hasher := sha256.New()
+	_, err = c.rebuildSource(ctx, flacPath, source, io.MultiWriter(output, hasher))
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && hex.EncodeToString(hasher.Sum(nil)) != sourceHash {
+		err = fmt.Errorf("%s does not rebuild the file it was made from: %w", filepath.Base(flacPath), ErrConversionFailed)
+	}
+	if err != nil {
+		os.Remove(output.Name())
+		return "", err
+	}
+	return output.Name(), nil
+}
+
+// storeAsFLAC writes a FLAC copy of an AIFF or WAV upload to the blob store, once it
+// is checked to decode to the same samples and to rebuild the very same file. It
+// leaves the upload where it is. lost is the blob whose missing FLAC the copy restores,
+// which it has to match; nil when the upload is new.
+func (b *BlobService) storeAsFLAC(ctx context.Context, upload *FileUploadResult, lost *Blob) (*FileUploadResult, *BlobSource, error) {
+	source, bitDepth, err := readBlobSource(upload.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	flacPath, err := b.conversionService.EncodeFLAC(ctx, upload.Path, bitDepth)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer b.conversionService.CleanupTempFile(flacPath)
+
+	hasher := sha256.New()
+	pcmMD5, err := b.conversionService.rebuildSource(ctx, flacPath, source, hasher)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pcmMD5 != source.PCMMD5 {
+		return nil, nil, fmt.Errorf("FLAC samples have MD5 %s, the upload's %s: %w", pcmMD5, source.PCMMD5, ErrConversionFailed)
+	}
+	if hash := hex.EncodeToString(hasher.Sum(nil)); hash != upload.Hash {
+		return nil, nil, fmt.Errorf("FLAC rebuilds a file with hash %s, not the upload: %w", hash, ErrConversionFailed)
+	}
+
+	file, err := os.Open(flacPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	// the very same FLAC may have been uploaded as it is, and its blob can't take another source
+	flacHash := sha256.New()
+	if _, err = io.Copy(flacHash, file); err != nil {
+		return nil, nil, fmt.Errorf("failed to hash FLAC: %w", err)
+	}
+	hash := hex.EncodeToString(flacHash.Sum(nil))
+	if lost != nil && hash != lost.Hash {
+		return nil, nil, fmt.Errorf("upload encodes to FLAC %s, not the stored %s: %w", hash, lost.Hash, ErrConversionFailed)
+	}
+	if found, err := b.blobRepository.FindByHash(ctx, hash); err == nil && (lost == nil || found.ID != lost.ID) {
+		return nil, nil, errFLACStored
+	} else if err != nil && !errors.Is(err, ErrBlobNotFound) {
+		return nil, nil, err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	result, err := b.fileService.WriteBlob(file, ".flac")
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, source, nil
+}
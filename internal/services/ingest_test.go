@@ -0,0 +1,144 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"vinyl-vault/internal/services/audiotest"
+)
+
+func TestReadBlobSource(t *testing.T) {
+	dir := t.TempDir()
+	id3 := append([]byte("ID3 \x00\x00\x00\x04"), "TIT2"...)
+	cd := audiotest.Stereo16(44100)
+	mono24 := audiotest.Format{SampleRate: 48000, Channels: 1, BitDepth: 24}
+	tests := []struct {
+		name         string
+		content      []byte
+		ext          string
+		encoder      string
+		bitDepth     int
+		header, data int // bytes before and of the samples
+		trailer      []byte
+	}{
+		{
+			name: "wav", ext: ".wav", encoder: "pcm_s16le", bitDepth: 16, header: 44, data: 1000 * 4,
+			content: audiotest.WAV(cd, 1000, audiotest.Ramp),
+		},
+		{
+			name: "aiff", ext: ".aiff", encoder: "pcm_s16be", bitDepth: 16, header: 54, data: 1000 * 4,
+			content: audiotest.AIFF(cd, 1000, audiotest.Ramp, nil),
+		},
+		{
+			// the pad byte of the odd-sized SSND chunk is kept with the tags after it
+			name: "24-bit aiff with tags", ext: ".aiff", encoder: "pcm_s24be", bitDepth: 24, header: 54, data: 999 * 3,
+			content: audiotest.AIFF(mono24, 999, audiotest.Ramp, id3),
+			trailer: append([]byte{0}, id3...),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+tt.ext)
+			audiotest.WriteFile(t, path, tt.content)
+
+			source, bitDepth, err := readBlobSource(path)
+			if err != nil {
+				t.Fatalf("readBlobSource() error = %v", err)
+			}
+			if bitDepth != tt.bitDepth || source.Ext != tt.ext || source.Encoder != tt.encoder || source.Size != int64(len(tt.content)) {
+				t.Errorf("readBlobSource() = %d bits, %+v; want %d bits of %s in %s", bitDepth, source, tt.bitDepth, tt.encoder, tt.ext)
+			}
+			samples := tt.content[tt.header : tt.header+tt.data]
+			if sum := md5.Sum(samples); source.PCMMD5 != hex.EncodeToString(sum[:]) {
+				t.Errorf("readBlobSource() PCMMD5 = %s, want that of the samples", source.PCMMD5)
+			}
+			// which put back between the header and trailer are the file again
+			rebuilt := slices.Concat(source.Header, samples, source.Trailer)
+			if !bytes.Equal(rebuilt, tt.content) || !bytes.Equal(source.Trailer, tt.trailer) {
+				t.Errorf("readBlobSource() header %d and trailer %q bytes don't rebuild the file", len(source.Header), source.Trailer)
+			}
+		})
+	}
+
+	t.Run("not ingestable", func(t *testing.T) {
+		flac := filepath.Join(dir, "track.flac")
+		if err := os.WriteFile(flac, []byte("fLaC"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// 8-bit WAV samples are unsigned, which FLAC doesn't store as they are
+		eightBit := filepath.Join(dir, "8-bit.wav")
+		content := audiotest.WAV(cd, 10, audiotest.Ramp)
+		binary.LittleEndian.PutUint16(content[32:], 2) // block align
+		binary.LittleEndian.PutUint16(content[34:], 8) // bits per sample
+		if err := os.WriteFile(eightBit, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{flac, eightBit} {
+			if _, _, err := readBlobSource(path); !errors.Is(err, errNotIngestable) {
+				t.Errorf("readBlobSource(%s) error = %v, want errNotIngestable", filepath.Base(path), err)
+			}
+		}
+	})
+}
+
+func TestBuildFFmpegArgsBitDepth(t *testing.T) {
+	c := NewConversionService(t.TempDir())
+	tests := []struct {
+		format   AudioFormat
+		bitDepth int
+		want     string
+	}{
+		{FormatAIFF, 24, "pcm_s24be"},
+		{FormatAIFF, 0, "pcm_s16be"},
+		{FormatWAV, 24, "pcm_s24le"},
+		{FormatWAV, 32, "pcm_s32le"},
+		{FormatWAV, 16, "pcm_s16le"},
+		{FormatFLAC, 24, "flac"},
+	}
+	for _, tt := range tests {
+		preset, err := c.Preset(string(tt.format))
+		if err != nil {
+			t.Fatal(err)
+		}
+		args, err := c.buildFFmpegArgs("in.aiff", "out", preset, &AudioInfo{BitDepth: tt.bitDepth}, 0, 0, nil)
+		if err != nil {
+			t.Fatalf("buildFFmpegArgs(%s, %d) error = %v", tt.format, tt.bitDepth, err)
+		}
+		if i := slices.Index(args, "-acodec"); i < 0 || args[i+1] != tt.want {
+			t.Errorf("buildFFmpegArgs(%s, %d) = %v, want encoder %s", tt.format, tt.bitDepth, args, tt.want)
+		}
+	}
+}
+
+func TestSplitService_OpenOriginal(t *testing.T) {
+	dir := t.TempDir()
+	fileService := NewFileService(dir, filepath.Join(dir, "covers"), filepath.Join(dir, "audio"))
+	content := audiotest.WAV(audiotest.Stereo16(44100), 1000, audiotest.Ramp)
+	audiotest.WriteFile(t, filepath.Join(dir, "side.wav"), content)
+	service := NewSplitService(nil, nil, nil, fileService, NewConversionService(dir))
+
+	// audio kept as it was uploaded is served as it is stored
+	track := &Track{ID: 1, BlobID: new(uint64), Blob: &Blob{Path: "side.wav"}}
+	audio, err := service.OpenOriginal(context.Background(), track)
+	if err != nil {
+		t.Fatalf("OpenOriginal() error = %v", err)
+	}
+	if audio.Size != int64(len(content)) || audio.Ext != ".wav" {
+		t.Errorf("OpenOriginal() = %d bytes of %s, want the stored WAV", audio.Size, audio.Ext)
+	}
+	audio.Close()
+
+	// while one stored as FLAC needs ffmpeg to be rebuilt
+	track.Blob = &Blob{Path: "side.wav", SourceHash: "aiff", Source: &BlobSource{Ext: ".aiff", Encoder: "pcm_s16be"}}
+	if _, err = service.OpenOriginal(context.Background(), track); !errors.Is(err, ErrFFmpegUnavailable) {
+		t.Errorf("OpenOriginal() without ffmpeg error = %v, want ErrFFmpegUnavailable", err)
+	}
+}
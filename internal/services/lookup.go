@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"vinyl-vault/internal/config"
+	"vinyl-vault/internal/logging"
+	"vinyl-vault/pkg"
+)
+
+// ReleaseQuery looks releases up by barcode, catalog number, artist or title. Every
+// field given has to match.
+type ReleaseQuery struct {
+	Barcode       string
+	CatalogNumber string
+	Artist        string
+	Title         string
+}
+
+func (q ReleaseQuery) isEmpty() bool {
+	return strings.TrimSpace(q.Barcode+q.CatalogNumber+q.Artist+q.Title) == ""
+}
+
+// ReleaseCandidate is a release found by a provider: its details and tracklist, ready
+// to be applied to an album, and where its cover art can be fetched from
+type ReleaseCandidate struct {
+	Provider  string           `json:"provider"`
+	ID        string           `json:"id"` // the provider's, to pass back to ApplyRelease
+	Metadata  pkg.Metadata     `json:"metadata"`
+	Media     []Medium         `json:"media,omitempty"`
+	Tracks    []CandidateTrack `json:"tracks"`
+	CoverURLs []string         `json:"cover_urls,omitempty"` // front first
+}
+
+type CandidateTrack struct {
+	DiscNumber  int          `json:"disc_number"`
+	Side        string       `json:"side,omitempty"`
+	TrackNumber int          `json:"track_number"`
+	Title       string       `json:"title"`
+	Duration    pkg.Duration `json:"duration,omitempty"`
+	Credits     []pkg.Credit `json:"credits,omitempty"`
+}
+
+// MetadataProvider is a source of release details, such as a web service or a
+// directory of files
+type MetadataProvider interface {
+	// Name identifies the provider in candidates and requests
+	Name() string
+	// Search returns the releases matching query, best match first
+	Search(ctx context.Context, query ReleaseQuery) ([]ReleaseCandidate, error)
+	// Release returns the release with an ID from Search, or ErrReleaseNotFound
+	Release(ctx context.Context, id string) (*ReleaseCandidate, error)
+}
+
+type LookupService struct {
+	albumRepository AlbumRepository
+	trackRepository TrackRepository
+	providers       []MetadataProvider
+}
+
+func NewLookupService(albumRepository AlbumRepository, trackRepository TrackRepository, providers ...MetadataProvider) *LookupService {
+	return &LookupService{
+		albumRepository: albumRepository,
+		trackRepository: trackRepository,
+		providers:       providers,
+	}
+}
+
+// NewLookupServiceWithConfig sets up the file provider when a release directory is
+// configured, then MusicBrainz unless its URL is empty
+func NewLookupServiceWithConfig(cfg *config.Config, albumRepository AlbumRepository, trackRepository TrackRepository) *LookupService {
+	var providers []MetadataProvider
+	if cfg.Lookup.ReleaseDir != "" {
+		providers = append(providers, NewFileProvider(cfg.Lookup.ReleaseDir))
+	}
+	if cfg.Lookup.MusicBrainzURL != "" {
+		providers = append(providers, NewMusicBrainzProvider(cfg.Lookup.MusicBrainzURL, cfg.Lookup.UserAgent))
+	}
+	return NewLookupService(albumRepository, trackRepository, providers...)
+}
+
+// Providers returns the names of the configured providers, in the order they are searched
+func (l *LookupService) Providers() []string {
+	names := make([]string, len(l.providers))
+	for i, provider := range l.providers {
+		names[i] = provider.Name()
+	}
+	return names
+}
+
+func (l *LookupService) provider(name string) (MetadataProvider, error) {
+	for _, provider := range l.providers {
+		if provider.Name() == name {
+			return provider, nil
+		}
+	}
+	return nil, NewValidationError("provider", fmt.Sprintf("unknown provider %q", name))
+}
+
+// SearchReleases asks the named provider, or every provider when name is empty, for
+// releases matching query. A provider that fails is left out, unless they all do.
+func (l *LookupService) SearchReleases(ctx context.Context, query ReleaseQuery, name string) ([]ReleaseCandidate, error) {
+	if query.isEmpty() {
+		return nil, NewValidationError("barcode", "give a barcode, a catalog number, an artist or a title to look up")
+	}
+	providers := l.providers
+	if name != "" {
+		provider, err := l.provider(name)
+		if err != nil {
+			return nil, err
+		}
+		providers = []MetadataProvider{provider}
+	}
+	if len(providers) == 0 {
+		return nil, NewServiceError("LookupService.SearchReleases", ErrLookupUnavailable, "no metadata provider is configured")
+	}
+
+	candidates := make([]ReleaseCandidate, 0)
+	var errs []error
+	for _, provider := range providers {
+		found, err := provider.Search(ctx, query)
+		if err != nil {
+			logging.FromContext(ctx).Warn("release lookup failed", "provider", provider.Name(), "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			continue
+		}
+		candidates = append(candidates, found...)
+	}
+	if len(errs) == len(providers) {
+		return nil, fmt.Errorf("%w: %w", ErrLookupUnavailable, errors.Join(errs...))
+	}
+	return candidates, nil
+}
+
+// ApplyRelease fills an album in from a release found by SearchReleases, creating the
+// album when albumID is 0. The release's details replace the album's where it has them,
+// its discs are added to or replace the album's by number, and every position of its
+// tracklist the album has no track at gets a stub, which uploading audio fills. Tracks
+// already on the album keep their audio and title, and take the release's credits if
+// they have none.
+func (l *LookupService) ApplyRelease(ctx context.Context, userID, albumID uint64, name, id string) (*Album, error) {
+	provider, err := l.provider(name)
+	if err != nil {
+		return nil, err
+	}
+	candidate, err := provider.Release(ctx, id)
+	if err != nil {
+		if !errors.Is(err, ErrReleaseNotFound) {
+			err = fmt.Errorf("%w: %w", ErrLookupUnavailable, err)
+		}
+		return nil, fmt.Errorf("failed to look up release %s: %w", id, err)
+	}
+
+	album := &Album{UserID: userID}
+	if albumID != 0 {
+		if album, err = l.albumRepository.FindByID(ctx, albumID); err != nil {
+			return nil, fmt.Errorf("album not found: %w", err)
+		}
+		if album.UserID != userID {
+			return nil, fmt.Errorf("album %d: %w", albumID, ErrNotOwner)
+		}
+	}
+
+	metadata := album.Metadata
+	mergeMetadata(&metadata, candidate.Metadata)
+	if err = validateMetadata(&metadata); err != nil {
+		return nil, err
+	}
+	album.Metadata = metadata
+	media := mergeMedia(album.Media, candidate.Media)
+	if len(media) == 0 {
+		media = []Medium{defaultMedium(metadata.Format)}
+	}
+	if err = validateMedia(media); err != nil {
+		return nil, err
+	}
+	album.Media = media
+
+	stubs, updated, err := applyTracklist(album, candidate.Tracks)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = l.albumRepository.Save(ctx, album); err != nil {
+		return nil, fmt.Errorf("failed to apply release to album: %w", err)
+	}
+	for _, track := range updated {
+		if err = l.trackRepository.Save(ctx, track); err != nil {
+			return nil, fmt.Errorf("failed to update track %d: %w", track.ID, err)
+		}
+	}
+	for _, stub := range stubs {
+		stub.AlbumID = album.ID
+		if err = l.trackRepository.Save(ctx, stub); err != nil {
+			return nil, fmt.Errorf("failed to create track stub: %w", err)
+		}
+		album.Tracks = append(album.Tracks, *stub)
+	}
+	slices.SortFunc(album.Tracks, func(a, b Track) int { return CompareTracks(&a, &b) })
+
+	logging.FromContext(ctx).Info("release applied", "album_id", album.ID, "user_id", userID,
+		"provider", provider.Name(), "release", id, "stubs", len(stubs))
+	return album, nil
+}
+
+// mergeMetadata copies the fields release has into metadata
+func mergeMetadata(metadata *pkg.Metadata, release pkg.Metadata) {
+	for _, field := range []struct{ to, from *string }{
+		{&metadata.Artist, &release.Artist},
+		{&metadata.Album, &release.Album},
+		{&metadata.Format, &release.Format},
+		{&metadata.ReleaseDate, &release.ReleaseDate},
+		{&metadata.CatalogNumber, &release.CatalogNumber},
+		{&metadata.Barcode, &release.Barcode},
+		{&metadata.PressingPlant, &release.PressingPlant},
+		{&metadata.EditionNotes, &release.EditionNotes},
+	} {
+		if strings.TrimSpace(*field.from) != "" {
+			*field.to = *field.from
+		}
+	}
+	if release.Label != nil && *release.Label != "" {
+		metadata.Label = release.Label
+	}
+	if release.Country != nil && *release.Country != "" {
+		metadata.Country = release.Country
+	}
+	if len(release.Matrix) > 0 {
+		metadata.Matrix = release.Matrix
+	}
+	if len(release.Genres) > 0 {
+		metadata.Genres = release.Genres
+	}
+	if len(release.Styles) > 0 {
+		metadata.Styles = release.Styles
+	}
+	if release.Length != 0 {
+		metadata.Length = release.Length
+	}
+}
+
+// mergeMedia returns media with release's discs added, or replacing those of the same number
+func mergeMedia(media, release []Medium) []Medium {
+	merged := slices.Clone(media)
+	for _, medium := range release {
+		i := slices.IndexFunc(merged, func(m Medium) bool { return m.Number == medium.Number })
+		if i < 0 {
+			merged = append(merged, medium)
+		} else {
+			merged[i] = medium
+		}
+	}
+	return merged
+}
+
+// applyTracklist checks the release's tracklist against the album, and returns the
+// stubs to create and the album's tracks it updated
+func applyTracklist(album *Album, tracklist []CandidateTrack) (stubs, updated []*Track, err error) {
+	for _, entry := range tracklist {
+		position := TrackPosition{DiscNumber: entry.DiscNumber, Side: entry.Side, TrackNumber: entry.TrackNumber}
+		if err = checkPosition(album, &position.DiscNumber, &position.Side); err != nil {
+			return nil, nil, fmt.Errorf("release track %q: %w", entry.Title, err)
+		}
+		credits := slices.Clone(entry.Credits)
+		if err = validateCredits(credits); err != nil {
+			return nil, nil, fmt.Errorf("release track %q: %w", entry.Title, err)
+		}
+
+		i := slices.IndexFunc(album.Tracks, func(track Track) bool {
+			return track.DiscNumber == position.DiscNumber && track.Side == position.Side &&
+				track.TrackNumber == position.TrackNumber
+		})
+		switch {
+		case i < 0:
+			stubs = append(stubs, &Track{
+				DiscNumber:  position.DiscNumber,
+				Side:        position.Side,
+				TrackNumber: position.TrackNumber,
+				Title:       entry.Title,
+				Duration:    entry.Duration,
+				Credits:     credits,
+			})
+		case album.Tracks[i].IsStub():
+			// a stub from an earlier lookup takes the new release's entry
+			track := &album.Tracks[i]
+			track.Title, track.Duration, track.Credits = entry.Title, entry.Duration, credits
+			updated = append(updated, track)
+		case len(album.Tracks[i].Credits) == 0 && len(credits) > 0:
+			album.Tracks[i].Credits = credits
+			updated = append(updated, &album.Tracks[i])
+		}
+	}
+	return stubs, updated, nil
+}
@@ -0,0 +1,142 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"vinyl-vault/internal/services"
+	"vinyl-vault/pkg"
+)
+
+func writeReleases(t *testing.T, dir, name string, releases ...services.ExportRelease) {
+	t.Helper()
+	data, err := json.Marshal(services.Export{Version: services.ExportVersion, Releases: releases})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var darkSide = services.ExportRelease{
+	Artist: "Pink Floyd", Title: "The Dark Side of the Moon", Format: "LP",
+	Label: "Harvest", CatalogNumber: "SHVL 804", Barcode: "5099902894218",
+	Media: []services.Medium{{Number: 1, Format: `12"`, Speed: 33}},
+	Tracks: []services.ExportTrack{
+		{DiscNumber: 1, Side: "A", TrackNumber: 1, Title: "Speak to Me", Duration: 68},
+		{DiscNumber: 1, Side: "A", TrackNumber: 2, Title: "Breathe", Duration: 169,
+			Credits: []pkg.Credit{{Role: "performer", Name: "David Gilmour", Detail: "vocals"}}},
+		{DiscNumber: 1, Side: "B", TrackNumber: 1, Title: "Money", Duration: 382},
+	},
+}
+
+func TestFileProvider(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeReleases(t, dir, "floyd.json", services.ExportRelease{Artist: "Pink Floyd", Title: "Animals", Format: "LP"}, darkSide)
+	writeReleases(t, dir, "can.json", services.ExportRelease{Artist: "Can", Title: "Tago Mago", Format: "2xLP"})
+	provider := services.NewFileProvider(dir)
+
+	tests := []struct {
+		name    string
+		query   services.ReleaseQuery
+		wantIDs []string
+	}{
+		{"barcode with spaces", services.ReleaseQuery{Barcode: "5 099902 894218"}, []string{"floyd.json#1"}},
+		{"catalog number without space", services.ReleaseQuery{CatalogNumber: "shvl804"}, []string{"floyd.json#1"}},
+		{"artist", services.ReleaseQuery{Artist: "floyd"}, []string{"floyd.json#0", "floyd.json#1"}},
+		{"artist and title", services.ReleaseQuery{Artist: "floyd", Title: "animals"}, []string{"floyd.json#0"}},
+		{"no match", services.ReleaseQuery{Artist: "Can", Title: "Animals"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates, err := provider.Search(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			var ids []string
+			for _, candidate := range candidates {
+				ids = append(ids, candidate.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("Search() = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+
+	candidate, err := provider.Release(ctx, "floyd.json#1")
+	if err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if candidate.Metadata.Album != darkSide.Title || *candidate.Metadata.Label != "Harvest" ||
+		len(candidate.Tracks) != 3 || candidate.Tracks[1].Credits[0].Name != "David Gilmour" {
+		t.Errorf("Release() = %+v", candidate)
+	}
+	for _, id := range []string{"floyd.json#2", "floyd.json", "../floyd.json#0", "missing.json#0"} {
+		if _, err = provider.Release(ctx, id); !errors.Is(err, services.ErrReleaseNotFound) {
+			t.Errorf("Release(%q) error = %v, want ErrReleaseNotFound", id, err)
+		}
+	}
+}
+
+func TestLookupService_ApplyRelease(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeReleases(t, dir, "floyd.json", darkSide)
+
+	f := newFixture(t)
+	owner, other := f.user(t, "alice"), f.user(t, "bob")
+	album := &services.Album{
+		UserID:   owner.ID,
+		Metadata: pkg.Metadata{Artist: "Floyd", Album: "DSOTM", Format: "LP", CoverArtPath: "covers/dsotm.jpg"},
+		Media:    []services.Medium{{Number: 1}},
+	}
+	if err := f.albums.Save(ctx, album); err != nil {
+		t.Fatal(err)
+	}
+	blob := f.blob(t, owner.ID, "breathe", ".flac")
+	track := &services.Track{AlbumID: album.ID, DiscNumber: 1, Side: "A", TrackNumber: 2, Title: "Breathe (In the Air)", BlobID: &blob.ID}
+	if err := f.tracks.Save(ctx, track); err != nil {
+		t.Fatal(err)
+	}
+	lookup := services.NewLookupService(f.albums, f.tracks, services.NewFileProvider(dir))
+
+	if _, err := lookup.ApplyRelease(ctx, other.ID, album.ID, "file", "floyd.json#0"); !errors.Is(err, services.ErrNotOwner) {
+		t.Errorf("ApplyRelease() by another user error = %v, want ErrNotOwner", err)
+	}
+	if _, err := lookup.ApplyRelease(ctx, owner.ID, album.ID, "discogs", "floyd.json#0"); err == nil {
+		t.Error("ApplyRelease() with an unknown provider succeeded")
+	}
+
+	applied, err := lookup.ApplyRelease(ctx, owner.ID, album.ID, "file", "floyd.json#0")
+	if err != nil {
+		t.Fatalf("ApplyRelease() error = %v", err)
+	}
+	if applied.Metadata.Artist != "Pink Floyd" || applied.Metadata.CatalogNumber != "SHVL 804" ||
+		applied.Metadata.CoverArtPath != "covers/dsotm.jpg" || applied.Media[0].Speed != 33 {
+		t.Errorf("ApplyRelease() metadata = %+v, media = %+v", applied.Metadata, applied.Media)
+	}
+
+	var positions []string
+	for _, track := range applied.Tracks {
+		positions = append(positions, track.Position())
+	}
+	if strings.Join(positions, ",") != "A1,A2,B1" {
+		t.Fatalf("ApplyRelease() tracks at %v, want A1,A2,B1", positions)
+	}
+	kept := applied.Tracks[1]
+	if kept.IsStub() || kept.Title != "Breathe (In the Air)" || len(kept.Credits) != 1 {
+		t.Errorf("existing track = %+v, want its audio and title kept and the release's credits", kept)
+	}
+	if !applied.Tracks[0].IsStub() || applied.Tracks[0].Title != "Speak to Me" || applied.Tracks[2].Duration != 382 {
+		t.Errorf("stubs = %+v, %+v", applied.Tracks[0], applied.Tracks[2])
+	}
+	if tracks, err := f.tracks.FindByAlbumID(ctx, album.ID); err != nil || len(tracks) != 3 {
+		t.Errorf("repository has %d tracks, %v; want the 2 stubs saved", len(tracks), err)
+	}
+}
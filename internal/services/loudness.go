@@ -0,0 +1,447 @@
+package services
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// ReplayGainReference is the loudness ReplayGain 2.0 brings tracks to, in LUFS
+	ReplayGainReference = -18.0
+
+	// absoluteGate leaves silence out of a measurement, in LUFS (EBU R128)
+	absoluteGate = -70.0
+	// silenceFloor stands in for the -∞ of digital silence, which JSON can't carry
+	silenceFloor = -120.0
+	// histogramBins is how many bins a loudness unit is split into
+	histogramBins = 10
+)
+
+// Loudness is an EBU R128 measurement of a track, or of an album's tracks together
+type Loudness struct {
+	Integrated float64    `json:"integrated"` // LUFS
+	TruePeak   float64    `json:"true_peak"`  // dBTP
+	Range      float64    `json:"range"`      // LU
+	AnalyzedAt *time.Time `json:"analyzed_at,omitempty"`
+}
+
+// Analyzed reports whether the loudness has been measured
+func (l *Loudness) Analyzed() bool {
+	return l.AnalyzedAt != nil
+}
+
+// LoudnessHistogram sorts gating blocks by loudness into bins of 1/histogramBins LU,
+// keyed by the bin's lower edge times histogramBins
+type LoudnessHistogram map[int]LoudnessBin
+
+// LoudnessBin keeps the exact energy of its blocks, so that only gating is approximate
+type LoudnessBin struct {
+	Blocks int     `json:"blocks"`
+	Energy float64 `json:"energy"` // the sum of the blocks' mean squares
+}
+
+// LoudnessBlocks are what a track's loudness was measured from. An album's loudness
+// gates the blocks of all its tracks together, as if they were one recording.
+type LoudnessBlocks struct {
+	Momentary LoudnessHistogram `json:"momentary"`  // 400 ms blocks, for the integrated loudness
+	ShortTerm LoudnessHistogram `json:"short_term"` // 3 s blocks, for the loudness range
+}
+
+// Merge adds the blocks of another measurement
+func (b *LoudnessBlocks) Merge(other *LoudnessBlocks) {
+	if b.Momentary == nil {
+		b.Momentary, b.ShortTerm = LoudnessHistogram{}, LoudnessHistogram{}
+	}
+	b.Momentary.merge(other.Momentary)
+	b.ShortTerm.merge(other.ShortTerm)
+}
+
+func (h LoudnessHistogram) merge(other LoudnessHistogram) {
+	for key, bin := range other {
+		merged := h[key]
+		merged.Blocks += bin.Blocks
+		merged.Energy += bin.Energy
+		h[key] = merged
+	}
+}
+
+// add counts a block of the given mean square
+func (h LoudnessHistogram) add(energy float64) {
+	if energy <= 0 {
+		return
+	}
+	if loudness := energyLoudness(energy); loudness >= absoluteGate {
+		key := int(math.Floor(loudness * histogramBins))
+		bin := h[key]
+		bin.Blocks++
+		bin.Energy += energy
+		h[key] = bin
+	}
+}
+
+func energyLoudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+// binLoudness is the middle of a bin
+func binLoudness(key int) float64 {
+	return (float64(key) + 0.5) / histogramBins
+}
+
+// gatedMean is the loudness of the mean energy of the blocks at or above gate
+func (h LoudnessHistogram) gatedMean(gate float64) (float64, bool) {
+	var energy float64
+	var blocks int
+	for key, bin := range h {
+		if binLoudness(key) >= gate {
+			energy += bin.Energy
+			blocks += bin.Blocks
+		}
+	}
+	if blocks == 0 {
+		return 0, false
+	}
+	return energyLoudness(energy / float64(blocks)), true
+}
+
+// Integrated is the loudness of the blocks that pass the absolute gate and the relative
+// gate 10 LU below their mean (EBU R128, ITU-R BS.1770-4)
+func (h LoudnessHistogram) Integrated() float64 {
+	ungated, ok := h.gatedMean(absoluteGate)
+	if !ok {
+		return absoluteGate
+	}
+	integrated, _ := h.gatedMean(max(ungated-10, absoluteGate))
+	return integrated
+}
+
+// Range is the spread between the 10th and 95th percentiles of the short-term blocks
+// passing the relative gate 20 LU below their mean (EBU Tech 3342)
+func (h LoudnessHistogram) Range() float64 {
+	ungated, ok := h.gatedMean(absoluteGate)
+	if !ok {
+		return 0
+	}
+	gate := ungated - 20
+	keys := slices.Sorted(maps.Keys(h))
+	var total int
+	for _, key := range keys {
+		if binLoudness(key) >= gate {
+			total += h[key].Blocks
+		}
+	}
+	percentile := func(p float64) float64 {
+		want := int(math.Floor(p*float64(total-1))) + 1
+		seen := 0
+		for _, key := range keys {
+			if binLoudness(key) < gate {
+				continue
+			}
+			if seen += h[key].Blocks; seen >= want {
+				return binLoudness(key)
+			}
+		}
+		return binLoudness(keys[len(keys)-1])
+	}
+	return percentile(0.95) - percentile(0.10)
+}
+
+// Loudness measures the blocks, with the given true peak as linear amplitude
+func (b *LoudnessBlocks) Loudness(peak float64, at time.Time) Loudness {
+	truePeak := silenceFloor
+	if peak > 0 {
+		truePeak = max(20*math.Log10(peak), silenceFloor)
+	}
+	return Loudness{
+		Integrated: round2(b.Momentary.Integrated()),
+		TruePeak:   round2(truePeak),
+		Range:      round2(b.ShortTerm.Range()),
+		AnalyzedAt: &at,
+	}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// Normalization picks the ReplayGain a stream is adjusted by
+type Normalization string
+
+const (
+	NormalizeTrack Normalization = "track"
+	NormalizeAlbum Normalization = "album" // the track gain when the album has not been measured
+)
+
+// ParseNormalization reads the normalize parameter of a stream, empty for none
+func ParseNormalization(s string) (Normalization, error) {
+	switch mode := Normalization(strings.ToLower(s)); mode {
+	case "", NormalizeTrack, NormalizeAlbum:
+		return mode, nil
+	}
+	return "", NewValidationError("normalize", "must be track or album")
+}
+
+// ReplayGain is what ReplayGain 2.0 players adjust a track by to play it at
+// ReplayGainReference, and the peaks they keep it from clipping with
+type ReplayGain struct {
+	TrackGain float64 // dB
+	TrackPeak float64 // linear, 1 being full scale
+	AlbumGain float64
+	AlbumPeak float64
+	HasAlbum  bool
+}
+
+// NewReplayGain takes the gains from the loudness of the track and its album, and
+// returns nil when the track has not been measured
+func NewReplayGain(album *Album, track *Track) *ReplayGain {
+	if !track.Loudness.Analyzed() {
+		return nil
+	}
+	gain := &ReplayGain{
+		TrackGain: round2(ReplayGainReference - track.Loudness.Integrated),
+		TrackPeak: math.Pow(10, track.Loudness.TruePeak/20),
+	}
+	if album != nil && album.Loudness.Analyzed() {
+		gain.AlbumGain = round2(ReplayGainReference - album.Loudness.Integrated)
+		gain.AlbumPeak = math.Pow(10, album.Loudness.TruePeak/20)
+		gain.HasAlbum = true
+	}
+	return gain
+}
+
+// Gain is the adjustment for mode in dB, lowered where it would push the peak past
+// full scale
+func (r *ReplayGain) Gain(mode Normalization) float64 {
+	gain, peak := r.TrackGain, r.TrackPeak
+	if mode == NormalizeAlbum && r.HasAlbum {
+		gain, peak = r.AlbumGain, r.AlbumPeak
+	}
+	if peak > 0 {
+		gain = min(gain, -20*math.Log10(peak))
+	}
+	return gain
+}
+
+// Fields are the tags players read the gains from, named as in Vorbis comments
+func (r *ReplayGain) Fields() [][2]string {
+	fields := [][2]string{
+		{"REPLAYGAIN_TRACK_GAIN", fmt.Sprintf("%.2f dB", r.TrackGain)},
+		{"REPLAYGAIN_TRACK_PEAK", fmt.Sprintf("%.6f", r.TrackPeak)},
+	}
+	if r.HasAlbum {
+		fields = append(fields,
+			[2]string{"REPLAYGAIN_ALBUM_GAIN", fmt.Sprintf("%.2f dB", r.AlbumGain)},
+			[2]string{"REPLAYGAIN_ALBUM_PEAK", fmt.Sprintf("%.6f", r.AlbumPeak)})
+	}
+	return fields
+}
+
+// loudnessMeter measures audio fed to it by Add, following ITU-R BS.1770-4: samples
+// are K-weighted, and their energy summed over 100 ms steps that 400 ms and 3 s blocks
+// are made of
+type loudnessMeter struct {
+	channels int
+	weights  []float64 // per channel
+	filters  []kWeighting
+	peaks    []truePeakMeter
+
+	step    int       // frames in 100 ms
+	frames  int       // in the current step
+	energy  float64   // of the current step
+	steps   []float64 // energy of the last 30 steps, newest last
+	nSteps  int
+	blocks  LoudnessBlocks
+	maxPeak float64
+}
+
+func newLoudnessMeter(sampleRate, channels int) *loudnessMeter {
+	m := &loudnessMeter{
+		channels: channels,
+		weights:  make([]float64, channels),
+		filters:  make([]kWeighting, channels),
+		peaks:    make([]truePeakMeter, channels),
+		step:     max(sampleRate/10, 1),
+		blocks:   LoudnessBlocks{Momentary: LoudnessHistogram{}, ShortTerm: LoudnessHistogram{}},
+	}
+	for c := range channels {
+		m.weights[c] = 1
+		m.filters[c] = newKWeighting(float64(sampleRate))
+		m.peaks[c] = newTruePeakMeter(sampleRate)
+	}
+	// the surround channels of 5.0 and 5.1 count for more, and the LFE not at all
+	switch channels {
+	case 5:
+		m.weights[3], m.weights[4] = 1.41, 1.41
+	case 6:
+		m.weights[3], m.weights[4], m.weights[5] = 0, 1.41, 1.41
+	}
+	return m
+}
+
+// Add measures interleaved samples, which must be whole frames
+func (m *loudnessMeter) Add(samples []float64) {
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		for c := range m.channels {
+			x := samples[i+c]
+			m.maxPeak = max(m.maxPeak, m.peaks[c].add(x))
+			if m.weights[c] != 0 {
+				y := m.filters[c].filter(x)
+				m.energy += m.weights[c] * y * y
+			}
+		}
+		if m.frames++; m.frames == m.step {
+			m.endStep()
+		}
+	}
+}
+
+func (m *loudnessMeter) endStep() {
+	m.steps = append(m.steps, m.energy)
+	if len(m.steps) > 30 {
+		m.steps = m.steps[1:]
+	}
+	m.nSteps++
+	m.energy, m.frames = 0, 0
+
+	blockEnergy := func(steps []float64) float64 {
+		var sum float64
+		for _, e := range steps {
+			sum += e
+		}
+		return sum / float64(len(steps)*m.step)
+	}
+	// 400 ms blocks overlap by 75%, 3 s ones by 2/3
+	if len(m.steps) >= 4 {
+		m.blocks.Momentary.add(blockEnergy(m.steps[len(m.steps)-4:]))
+	}
+	if len(m.steps) == 30 && m.nSteps%10 == 0 {
+		m.blocks.ShortTerm.add(blockEnergy(m.steps))
+	}
+}
+
+// Loudness is the measurement of everything added so far
+func (m *loudnessMeter) Loudness(at time.Time) (Loudness, *LoudnessBlocks) {
+	blocks := &LoudnessBlocks{}
+	blocks.Merge(&m.blocks)
+	return blocks.Loudness(m.maxPeak, at), blocks
+}
+
+// MeasureLoudness reads the audio to its end and measures it
+func MeasureLoudness(r *PCMReader) (Loudness, *LoudnessBlocks, error) {
+	if r.Channels <= 0 || r.SampleRate <= 0 {
+		return Loudness{}, nil, fmt.Errorf("audio has %d channels at %d Hz", r.Channels, r.SampleRate)
+	}
+	meter := newLoudnessMeter(r.SampleRate, r.Channels)
+	if err := r.feed(meter.Add); err != nil {
+		return Loudness{}, nil, err
+	}
+	loudness, blocks := meter.Loudness(time.Now())
+	return loudness, blocks, nil
+}
+
+// kWeighting is the two-stage filter of BS.1770: a high shelf modelling the head,
+// then a high pass. The coefficients are derived for any sample rate, as libebur128 does.
+type kWeighting struct {
+	b, a [5]float64 // the two biquads combined into one 4th-order filter
+	x, y [4]float64 // the previous inputs and outputs, newest first
+}
+
+func newKWeighting(rate float64) kWeighting {
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelfB := [3]float64{(vh + vb*k/q + k*k) / a0, 2 * (k*k - vh) / a0, (vh - vb*k/q + k*k) / a0}
+	shelfA := [3]float64{1, 2 * (k*k - 1) / a0, (1 - k/q + k*k) / a0}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / rate)
+	passB := [3]float64{1, -2, 1}
+	passA := [3]float64{1, 2 * (k*k - 1) / (1 + k/q + k*k), (1 - k/q + k*k) / (1 + k/q + k*k)}
+
+	var w kWeighting
+	for i := range 3 {
+		for j := range 3 {
+			w.b[i+j] += shelfB[i] * passB[j]
+			w.a[i+j] += shelfA[i] * passA[j]
+		}
+	}
+	return w
+}
+
+func (w *kWeighting) filter(x float64) float64 {
+	y := w.b[0] * x
+	for i := range 4 {
+		y += w.b[i+1]*w.x[i] - w.a[i+1]*w.y[i]
+	}
+	copy(w.x[1:], w.x[:3])
+	copy(w.y[1:], w.y[:3])
+	w.x[0], w.y[0] = x, y
+	return y
+}
+
+// truePeakTaps is the length of each phase of the interpolation filter
+const truePeakTaps = 12
+
+// truePeakMeter finds the peaks between samples too, by oversampling to at least
+// 176.4 kHz (BS.1770-4 annex 2) with a windowed-sinc interpolator
+type truePeakMeter struct {
+	phases  [][]float64 // the filter of each oversampled position between two samples
+	history []float64   // the last samples, newest first
+}
+
+func newTruePeakMeter(sampleRate int) truePeakMeter {
+	factor := 1
+	switch {
+	case sampleRate < 96000:
+		factor = 4
+	case sampleRate < 192000:
+		factor = 2
+	}
+	m := truePeakMeter{history: make([]float64, truePeakTaps)}
+	if factor == 1 {
+		return m
+	}
+	length := truePeakTaps * factor
+	center := float64(length-1) / 2
+	for p := range factor {
+		taps := make([]float64, truePeakTaps)
+		for j := range truePeakTaps {
+			n := float64(j*factor+p) - center
+			window := 0.5 + 0.5*math.Cos(2*math.Pi*n/float64(length+1)) // Hann
+			taps[j] = sinc(n/float64(factor)) * window
+		}
+		m.phases = append(m.phases, taps)
+	}
+	return m
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// add takes the next sample and returns the highest absolute value it brings
+func (m *truePeakMeter) add(x float64) float64 {
+	peak := math.Abs(x)
+	if m.phases == nil {
+		return peak
+	}
+	copy(m.history[1:], m.history[:truePeakTaps-1])
+	m.history[0] = x
+	for _, taps := range m.phases {
+		var y float64
+		for j, tap := range taps {
+			y += tap * m.history[j]
+		}
+		peak = max(peak, math.Abs(y))
+	}
+	return peak
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"vinyl-vault/internal/services/audiotest"
+)
+
+// sine returns seconds of a stereo sine wave at amplitude dBFS, interleaved
+func sine(sampleRate int, seconds, amplitude, freq, phase float64) []float64 {
+	n := int(seconds * float64(sampleRate))
+	gain := math.Pow(10, amplitude/20)
+	samples := make([]float64, 0, 2*n)
+	for i := range n {
+		v := gain * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate)+phase)
+		samples = append(samples, v, v)
+	}
+	return samples
+}
+
+func TestLoudnessMeter(t *testing.T) {
+	tests := []struct {
+		name                           string
+		sampleRate                     int
+		samples                        func(rate int) []float64
+		integrated, truePeak, lra      float64
+		integratedTol, peakTol, lraTol float64
+	}{
+		{
+			// EBU Tech 3341 case 1: a 1 kHz sine at -20 dBFS on both channels is -20 LUFS
+			name:       "sine at 48 kHz",
+			sampleRate: 48000,
+			samples:    func(rate int) []float64 { return sine(rate, 20, -20, 1000, 0) },
+			integrated: -20, integratedTol: 0.05,
+			truePeak: -20, peakTol: 0.1,
+			lraTol: 0.1,
+		},
+		{
+			name:       "sine at 44.1 kHz",
+			sampleRate: 44100,
+			samples:    func(rate int) []float64 { return sine(rate, 20, -20, 1000, 0) },
+			integrated: -20, integratedTol: 0.05,
+			truePeak: -20, peakTol: 0.1,
+			lraTol: 0.1,
+		},
+		{
+			// EBU Tech 3341 case 15: samples of fs/4 at 45° peak 3 dB below the wave
+			name:       "inter-sample peak",
+			sampleRate: 48000,
+			samples:    func(rate int) []float64 { return sine(rate, 5, 0, float64(rate)/4, math.Pi/4) },
+			integrated: math.NaN(),
+			truePeak:   0, peakTol: 0.2,
+			lra: math.NaN(),
+		},
+		{
+			// EBU Tech 3342 case 1: alternating -20 and -30 dBFS has a range of 10 LU
+			name:       "loudness range",
+			sampleRate: 48000,
+			samples: func(rate int) []float64 {
+				var samples []float64
+				for range 3 {
+					samples = append(samples, sine(rate, 10, -20, 1000, 0)...)
+					samples = append(samples, sine(rate, 10, -30, 1000, 0)...)
+				}
+				return samples
+			},
+			integrated: math.NaN(),
+			truePeak:   -20, peakTol: 0.1,
+			lra: 10, lraTol: 0.1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meter := newLoudnessMeter(tt.sampleRate, 2)
+			meter.Add(tt.samples(tt.sampleRate))
+			loudness, blocks := meter.Loudness(time.Now())
+
+			if !math.IsNaN(tt.integrated) && math.Abs(loudness.Integrated-tt.integrated) > tt.integratedTol {
+				t.Errorf("Integrated = %.2f, want %.2f", loudness.Integrated, tt.integrated)
+			}
+			if math.Abs(loudness.TruePeak-tt.truePeak) > tt.peakTol {
+				t.Errorf("TruePeak = %.2f, want %.2f", loudness.TruePeak, tt.truePeak)
+			}
+			if !math.IsNaN(tt.lra) && math.Abs(loudness.Range-tt.lra) > tt.lraTol {
+				t.Errorf("Range = %.2f, want %.2f", loudness.Range, tt.lra)
+			}
+			if !loudness.Analyzed() || blocks == nil || len(blocks.Momentary) == 0 {
+				t.Errorf("Loudness() = %+v, %+v; want a measurement with blocks", loudness, blocks)
+			}
+		})
+	}
+}
+
+func TestLoudnessBlocks_Merge(t *testing.T) {
+	// an album of two tracks is as loud as the tracks played one after the other
+	loud, quiet := newLoudnessMeter(48000, 2), newLoudnessMeter(48000, 2)
+	loud.Add(sine(48000, 10, -20, 1000, 0))
+	quiet.Add(sine(48000, 10, -30, 1000, 0))
+	_, loudBlocks := loud.Loudness(time.Now())
+	_, quietBlocks := quiet.Loudness(time.Now())
+
+	both := newLoudnessMeter(48000, 2)
+	both.Add(sine(48000, 10, -20, 1000, 0))
+	both.Add(sine(48000, 10, -30, 1000, 0))
+	want, _ := both.Loudness(time.Now())
+
+	var album LoudnessBlocks
+	album.Merge(loudBlocks)
+	album.Merge(quietBlocks)
+	got := album.Loudness(math.Pow(10, -20.0/20), time.Now())
+	if math.Abs(got.Integrated-want.Integrated) > 0.1 {
+		t.Errorf("merged Integrated = %.2f, want %.2f", got.Integrated, want.Integrated)
+	}
+	if got.TruePeak != -20 {
+		t.Errorf("merged TruePeak = %.2f, want -20", got.TruePeak)
+	}
+}
+
+func TestReplayGain(t *testing.T) {
+	analyzed := time.Now()
+	track := &Track{Loudness: Loudness{Integrated: -12, TruePeak: -1, AnalyzedAt: &analyzed}}
+	album := &Album{Loudness: Loudness{Integrated: -10, TruePeak: -0.5, AnalyzedAt: &analyzed}}
+
+	if NewReplayGain(album, &Track{}) != nil {
+		t.Error("NewReplayGain() of a track not analyzed is not nil")
+	}
+	gain := NewReplayGain(album, track)
+	if gain.TrackGain != -6 || gain.AlbumGain != -8 || !gain.HasAlbum {
+		t.Fatalf("NewReplayGain() = %+v", gain)
+	}
+	if got := gain.Gain(NormalizeTrack); got != -6 {
+		t.Errorf("Gain(track) = %v, want -6", got)
+	}
+	if got := gain.Gain(NormalizeAlbum); got != -8 {
+		t.Errorf("Gain(album) = %v, want -8", got)
+	}
+
+	// a quiet track is only raised until its peak reaches full scale
+	quiet := &Track{Loudness: Loudness{Integrated: -30, TruePeak: -3, AnalyzedAt: &analyzed}}
+	if got := NewReplayGain(nil, quiet).Gain(NormalizeAlbum); math.Abs(got-3) > 0.001 {
+		t.Errorf("Gain() of a quiet track = %v, want 3", got)
+	}
+
+	fields := gain.Fields()
+	if len(fields) != 4 || fields[0] != [2]string{"REPLAYGAIN_TRACK_GAIN", "-6.00 dB"} ||
+		fields[3] != [2]string{"REPLAYGAIN_ALBUM_PEAK", "0.944061"} {
+		t.Errorf("Fields() = %v", fields)
+	}
+}
+
+func TestParseNormalization(t *testing.T) {
+	for value, want := range map[string]Normalization{"": "", "track": NormalizeTrack, "Album": NormalizeAlbum} {
+		if got, err := ParseNormalization(value); err != nil || got != want {
+			t.Errorf("ParseNormalization(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	var validation *ValidationError
+	if _, err := ParseNormalization("loud"); !errors.As(err, &validation) || validation.Field != "normalize" {
+		t.Errorf("ParseNormalization(loud) error = %v, want a validation error", err)
+	}
+}
+
+func TestOpenPCM(t *testing.T) {
+	dir := t.TempDir()
+	wav := filepath.Join(dir, "side.wav")
+	audiotest.WriteFile(t, wav, audiotest.WAV(audiotest.Stereo16(8000), 1000, audiotest.Ramp))
+	aiff := filepath.Join(dir, "side.aiff")
+	audiotest.WriteFile(t, aiff, audiotest.AIFF(audiotest.Stereo16(44100), 1000, audiotest.Ramp, nil))
+	conversion := NewConversionService(dir)
+
+	for _, path := range []string{wav, aiff} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			pcm, err := conversion.OpenPCM(context.Background(), path, 250, 600)
+			if err != nil {
+				t.Fatalf("OpenPCM() error = %v", err)
+			}
+			defer pcm.Close()
+			if pcm.Channels != 2 {
+				t.Fatalf("Channels = %d, want 2", pcm.Channels)
+			}
+
+			// the frames hold their index, read back in small buffers
+			var frames []float64
+			buf := make([]float64, 6)
+			for {
+				n, err := pcm.Read(buf)
+				frames = append(frames, buf[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Read() error = %v", err)
+				}
+			}
+			if len(frames) != 2*350 {
+				t.Fatalf("read %d samples, want %d", len(frames), 2*350)
+			}
+			if first, last := frames[0]*32768, frames[len(frames)-1]*32768; first != 250 || last != 599 {
+				t.Errorf("read frames %v to %v, want 250 to 599", first, last)
+			}
+		})
+	}
+}
+
+func TestPCMEncoding(t *testing.T) {
+	tests := []struct {
+		encoding pcmEncoding
+		value    float64
+		bytes    []byte
+	}{
+		{pcmEncoding{bytes: 1, unsigned: true, order: binary.LittleEndian}, -0.5, []byte{0x40}},
+		{pcmEncoding{bytes: 2, order: binary.LittleEndian}, -0.5, []byte{0x00, 0xc0}},
+		{pcmEncoding{bytes: 3, order: binary.BigEndian}, 0.5, []byte{0x40, 0x00, 0x00}},
+		{pcmEncoding{bytes: 4, float: true, order: binary.LittleEndian}, 0.25, []byte{0, 0, 0x80, 0x3e}},
+	}
+	for _, tt := range tests {
+		b := make([]byte, tt.encoding.bytes)
+		tt.encoding.encode(b, tt.value)
+		if !bytes.Equal(b, tt.bytes) {
+			t.Errorf("encode(%v) in %d bytes = %x, want %x", tt.value, tt.encoding.bytes, b, tt.bytes)
+		}
+		if got := tt.encoding.decode(tt.bytes); got != tt.value {
+			t.Errorf("decode(%x) = %v, want %v", tt.bytes, got, tt.value)
+		}
+	}
+
+	// integer samples clip instead of wrapping around
+	encoding := pcmEncoding{bytes: 2, order: binary.LittleEndian}
+	b := make([]byte, 2)
+	encoding.encode(b, 1.5)
+	if got := int16(binary.LittleEndian.Uint16(b)); got != math.MaxInt16 {
+		t.Errorf("encode(1.5) = %d, want %d", got, math.MaxInt16)
+	}
+}
+
+func TestApplyGain(t *testing.T) {
+	dir := t.TempDir()
+	wav := filepath.Join(dir, "track.wav")
+	audiotest.WriteFile(t, wav, audiotest.WAV(audiotest.Stereo16(8000), 1000, audiotest.Ramp))
+	aiff := filepath.Join(dir, "track.aiff")
+	audiotest.WriteFile(t, aiff, audiotest.AIFF(audiotest.Stereo16(44100), 1000, audiotest.Ramp, nil))
+
+	for _, tt := range []struct {
+		path  string
+		order binary.ByteOrder
+	}{
+		{wav, binary.LittleEndian},
+		{aiff, binary.BigEndian},
+	} {
+		t.Run(filepath.Ext(tt.path), func(t *testing.T) {
+			original, err := os.ReadFile(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, err := ReadAudioInfo(tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			halved, err := applyGain(bytesAudio(original, filepath.Ext(tt.path)), -20*math.Log10(2))
+			if err != nil {
+				t.Fatalf("applyGain() error = %v", err)
+			}
+			if halved.Size != int64(len(original)) {
+				t.Errorf("Size = %d, want %d", halved.Size, len(original))
+			}
+
+			// reads that start and end within a sample see the same bytes as whole ones
+			whole, err := io.ReadAll(halved)
+			if err != nil {
+				t.Fatal(err)
+			}
+			offset := info.pcm.dataOffset
+			if !bytes.Equal(whole[:offset], original[:offset]) {
+				t.Error("header was changed")
+			}
+			for _, frame := range []int64{0, 2, 500, 998} {
+				at := offset + 4*frame
+				if got := tt.order.Uint16(whole[at:]); int64(got) != frame/2 {
+					t.Errorf("frame %d = %d, want %d", frame, got, frame/2)
+				}
+			}
+			part := make([]byte, 7)
+			if _, err = halved.ReadAt(part, offset+4*500+1); err != nil {
+				t.Fatalf("ReadAt() error = %v", err)
+			}
+			if !bytes.Equal(part, whole[offset+4*500+1:][:7]) {
+				t.Errorf("ReadAt() mid-sample = %x, want %x", part, whole[offset+4*500+1:][:7])
+			}
+		})
+	}
+
+	if _, err := applyGain(bytesAudio([]byte("fLaC"), ".flac"), -6); !errors.Is(err, errNotPCM) {
+		t.Errorf("applyGain() of FLAC error = %v, want errNotPCM", err)
+	}
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"vinyl-vault/pkg"
+)
+
+const (
+	// musicBrainzInterval spaces requests out as MusicBrainz asks of clients
+	musicBrainzInterval = time.Second
+	// musicBrainzResults is how many search results get their tracklist looked up
+	musicBrainzResults = 5
+	coverArtArchiveURL = "https://coverartarchive.org/release/"
+)
+
+// musicBrainzPosition splits a vinyl track number such as "A1" or "AA2"
+var musicBrainzPosition = regexp.MustCompile(`^([A-Z]{1,2})([0-9]+)$`)
+
+// MusicBrainzProvider looks releases up with the MusicBrainz web service
+// (https://musicbrainz.org/doc/MusicBrainz_API). Cover art comes from the Cover Art
+// Archive; its URLs are handed to the client, never fetched by the server.
+type MusicBrainzProvider struct {
+	baseURL    string
+	userAgent  string
+	httpClient *http.Client
+	interval   time.Duration
+
+	mu   sync.Mutex
+	next time.Time // earliest time of the next request
+}
+
+func NewMusicBrainzProvider(baseURL, userAgent string) *MusicBrainzProvider {
+	return &MusicBrainzProvider{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		userAgent:  userAgent,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		interval:   musicBrainzInterval,
+	}
+}
+
+func (m *MusicBrainzProvider) Name() string {
+	return "musicbrainz"
+}
+
+// Search runs a release search, then looks up the tracklists of the best results, which
+// the search leaves out
+func (m *MusicBrainzProvider) Search(ctx context.Context, query ReleaseQuery) ([]ReleaseCandidate, error) {
+	var terms []string
+	for _, term := range []struct{ field, value string }{
+		{"barcode", compactCode(query.Barcode)},
+		{"catno", query.CatalogNumber},
+		{"artist", query.Artist},
+		{"release", query.Title},
+	} {
+		if value := strings.TrimSpace(term.value); value != "" {
+			terms = append(terms, term.field+":"+luceneQuote(value))
+		}
+	}
+	params := url.Values{
+		"query": {strings.Join(terms, " AND ")},
+		"limit": {strconv.Itoa(musicBrainzResults)},
+	}
+
+	var results struct {
+		Releases []struct {
+			ID string `json:"id"`
+		} `json:"releases"`
+	}
+	if err := m.get(ctx, "/release", params, &results); err != nil {
+		return nil, err
+	}
+	candidates := make([]ReleaseCandidate, 0, len(results.Releases))
+	for _, result := range results.Releases {
+		candidate, err := m.Release(ctx, result.ID)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, *candidate)
+	}
+	return candidates, nil
+}
+
+func (m *MusicBrainzProvider) Release(ctx context.Context, id string) (*ReleaseCandidate, error) {
+	params := url.Values{"inc": {"recordings labels artist-credits genres"}}
+	var release musicBrainzRelease
+	if err := m.get(ctx, "/release/"+url.PathEscape(id), params, &release); err != nil {
+		return nil, err
+	}
+	return release.candidate(m.Name()), nil
+}
+
+// luceneQuote quotes a search term, so that spaces and operators in it are taken literally
+func luceneQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func (m *MusicBrainzProvider) get(ctx context.Context, path string, params url.Values, v any) error {
+	if err := m.wait(ctx); err != nil {
+		return err
+	}
+	params.Set("fmt", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", m.userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("musicbrainz: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest:
+		// an ID that is not a MusicBrainz ID gets a 400
+		return fmt.Errorf("musicbrainz: %w", ErrReleaseNotFound)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("musicbrainz: %s", resp.Status)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("musicbrainz: invalid response: %w", err)
+	}
+	return nil
+}
+
+// wait holds the request back until the interval has passed since the previous one
+func (m *MusicBrainzProvider) wait(ctx context.Context) error {
+	m.mu.Lock()
+	now := time.Now()
+	at := m.next
+	if at.Before(now) {
+		at = now
+	}
+	m.next = at.Add(m.interval)
+	m.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// musicBrainzRelease is the part of a release lookup we use
+type musicBrainzRelease struct {
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	Date         string `json:"date"`
+	Country      string `json:"country"`
+	Barcode      string `json:"barcode"`
+	ArtistCredit []struct {
+		Name       string `json:"name"`
+		JoinPhrase string `json:"joinphrase"`
+	} `json:"artist-credit"`
+	LabelInfo []struct {
+		CatalogNumber string `json:"catalog-number"`
+		Label         *struct {
+			Name string `json:"name"`
+		} `json:"label"`
+	} `json:"label-info"`
+	Genres []struct {
+		Name string `json:"name"`
+	} `json:"genres"`
+	CoverArtArchive struct {
+		Front bool `json:"front"`
+		Back  bool `json:"back"`
+	} `json:"cover-art-archive"`
+	Media []struct {
+		Position int    `json:"position"`
+		Format   string `json:"format"`
+		Tracks   []struct {
+			Position int    `json:"position"`
+			Number   string `json:"number"`
+			Title    string `json:"title"`
+			Length   int64  `json:"length"` // milliseconds
+		} `json:"tracks"`
+	} `json:"media"`
+}
+
+func (r *musicBrainzRelease) candidate(provider string) *ReleaseCandidate {
+	var artist strings.Builder
+	for _, credit := range r.ArtistCredit {
+		artist.WriteString(credit.Name + credit.JoinPhrase)
+	}
+	candidate := &ReleaseCandidate{
+		Provider: provider,
+		ID:       r.ID,
+		Metadata: pkg.Metadata{
+			Artist:      artist.String(),
+			Album:       r.Title,
+			ReleaseDate: r.Date,
+			Barcode:     r.Barcode,
+		},
+		Tracks: make([]CandidateTrack, 0),
+	}
+	if r.Country != "" {
+		candidate.Metadata.Country = &r.Country
+	}
+	for _, info := range r.LabelInfo {
+		if info.Label != nil && candidate.Metadata.Label == nil {
+			candidate.Metadata.Label = &info.Label.Name
+		}
+		if candidate.Metadata.CatalogNumber == "" {
+			candidate.Metadata.CatalogNumber = info.CatalogNumber
+		}
+	}
+	for _, genre := range r.Genres {
+		candidate.Metadata.Genres = append(candidate.Metadata.Genres, genre.Name)
+	}
+	if r.CoverArtArchive.Front {
+		candidate.CoverURLs = append(candidate.CoverURLs, coverArtArchiveURL+r.ID+"/front")
+	}
+	if r.CoverArtArchive.Back {
+		candidate.CoverURLs = append(candidate.CoverURLs, coverArtArchiveURL+r.ID+"/back")
+	}
+
+	var length int64
+	for _, medium := range r.Media {
+		candidate.Media = append(candidate.Media, musicBrainzMedium(medium.Position, medium.Format))
+		for _, track := range medium.Tracks {
+			entry := CandidateTrack{
+				DiscNumber:  medium.Position,
+				TrackNumber: track.Position,
+				Title:       track.Title,
+				Duration:    pkg.Duration((track.Length + 500) / 1000),
+			}
+			if match := musicBrainzPosition.FindStringSubmatch(track.Number); match != nil {
+				entry.Side = match[1]
+				entry.TrackNumber, _ = strconv.Atoi(match[2])
+			}
+			candidate.Tracks = append(candidate.Tracks, entry)
+			length += track.Length
+		}
+	}
+	candidate.Metadata.Length = pkg.Duration((length + 500) / 1000)
+	candidate.Metadata.Format = musicBrainzFormat(candidate.Media)
+	return candidate
+}
+
+// musicBrainzFormat names the release's format the way albums here do: LP, 2xLP, 7"...
+func musicBrainzFormat(media []Medium) string {
+	if len(media) == 0 {
+		return ""
+	}
+	format := media[0].Format
+	for _, medium := range media {
+		if medium.Format != format {
+			return "Mixed"
+		}
+	}
+	if format == `12"` {
+		format = "LP"
+	}
+	if len(media) > 1 {
+		return fmt.Sprintf("%dx%s", len(media), format)
+	}
+	return format
+}
+
+// musicBrainzMedium turns a medium format such as `12" Vinyl` into a Medium; MusicBrainz
+// does not record speeds
+func musicBrainzMedium(position int, format string) Medium {
+	medium := Medium{Number: position}
+	for _, size := range []string{`12"`, `10"`, `7"`} {
+		if strings.HasPrefix(format, size) {
+			medium.Format = size
+		}
+	}
+	if medium.Format == "" {
+		medium.Format = format
+	}
+	return medium
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMusicBrainzProvider(t *testing.T) {
+	release := `{
+		"id": "f5093c06-23e3-404f-aeaa-40f72885ee3a", "title": "The Dark Side of the Moon",
+		"date": "1973-03-23", "country": "GB", "barcode": "",
+		"artist-credit": [{"name": "Pink Floyd", "joinphrase": ""}],
+		"label-info": [{"catalog-number": "SHVL 804", "label": {"name": "Harvest"}}],
+		"genres": [{"name": "progressive rock"}],
+		"cover-art-archive": {"front": true, "back": false},
+		"media": [{"position": 1, "format": "12\" Vinyl", "tracks": [
+			{"position": 1, "number": "A1", "title": "Speak to Me", "length": 67733},
+			{"position": 6, "number": "B1", "title": "Money", "length": 382000}
+		]}]
+	}`
+	var userAgent string
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		switch r.URL.Path {
+		case "/ws/2/release":
+			queries = append(queries, r.URL.Query().Get("query"))
+			w.Write([]byte(`{"releases": [{"id": "f5093c06-23e3-404f-aeaa-40f72885ee3a"}]}`))
+		case "/ws/2/release/f5093c06-23e3-404f-aeaa-40f72885ee3a":
+			if r.URL.Query().Get("fmt") != "json" || !strings.Contains(r.URL.Query().Get("inc"), "recordings") {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(release))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewMusicBrainzProvider(server.URL+"/ws/2/", "vinyl-vault-test/1.0 (test@example.com)")
+	provider.interval = 0
+	candidates, err := provider.Search(context.Background(), ReleaseQuery{CatalogNumber: "SHVL 804", Artist: `Pink "Floyd"`})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if want := `catno:"SHVL 804" AND artist:"Pink \"Floyd\""`; len(queries) != 1 || queries[0] != want {
+		t.Errorf("search query = %q, want %q", queries, want)
+	}
+	if userAgent != "vinyl-vault-test/1.0 (test@example.com)" {
+		t.Errorf("User-Agent = %q", userAgent)
+	}
+	if len(candidates) != 1 {
+		t.Fatalf("Search() returned %d candidates, want 1", len(candidates))
+	}
+
+	candidate := candidates[0]
+	metadata := candidate.Metadata
+	if metadata.Artist != "Pink Floyd" || metadata.Format != "LP" || *metadata.Label != "Harvest" ||
+		metadata.CatalogNumber != "SHVL 804" || *metadata.Country != "GB" || metadata.Genres[0] != "progressive rock" {
+		t.Errorf("metadata = %+v", metadata)
+	}
+	if len(candidate.Media) != 1 || candidate.Media[0].Format != `12"` {
+		t.Errorf("media = %+v", candidate.Media)
+	}
+	if len(candidate.Tracks) != 2 || candidate.Tracks[1].Side != "B" || candidate.Tracks[1].TrackNumber != 1 ||
+		candidate.Tracks[0].Duration != 68 {
+		t.Errorf("tracks = %+v", candidate.Tracks)
+	}
+	if len(candidate.CoverURLs) != 1 || !strings.HasSuffix(candidate.CoverURLs[0], "/f5093c06-23e3-404f-aeaa-40f72885ee3a/front") {
+		t.Errorf("cover URLs = %v", candidate.CoverURLs)
+	}
+
+	if _, err = provider.Release(context.Background(), "not-a-release"); !errors.Is(err, ErrReleaseNotFound) {
+		t.Errorf("Release() of an unknown ID error = %v, want ErrReleaseNotFound", err)
+	}
+}
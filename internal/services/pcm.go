@@ -0,0 +1,369 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"vinyl-vault/internal/logging"
+)
+
+// pcmEncoding is how each sample of a WAV or AIFF file is stored
+type pcmEncoding struct {
+	bytes    int // per sample
+	float    bool
+	unsigned bool // 8-bit WAV samples are offset by 128
+	order    binary.ByteOrder
+}
+
+// wavEncoding reads the encoding of a fmt chunk; formatTag is that of the subformat
+// for WAVE_FORMAT_EXTENSIBLE
+func wavEncoding(formatTag uint16, bitDepth, blockAlign, channels int) *pcmEncoding {
+	if channels <= 0 || blockAlign%channels != 0 {
+		return nil
+	}
+	size := blockAlign / channels
+	switch {
+	case formatTag == 1 && size >= 1 && size <= 4 && bitDepth <= size*8:
+		return &pcmEncoding{bytes: size, unsigned: size == 1, order: binary.LittleEndian}
+	case formatTag == 3 && (size == 4 || size == 8):
+		return &pcmEncoding{bytes: size, float: true, order: binary.LittleEndian}
+	}
+	return nil
+}
+
+// aiffEncoding reads the encoding of an AIFF-C compression type, NONE for plain AIFF
+func aiffEncoding(compression string, bitDepth int) *pcmEncoding {
+	size := (bitDepth + 7) / 8
+	switch compression {
+	case "NONE", "twos":
+		if size >= 1 && size <= 4 {
+			return &pcmEncoding{bytes: size, order: binary.BigEndian}
+		}
+	case "sowt":
+		if size >= 1 && size <= 4 {
+			return &pcmEncoding{bytes: size, order: binary.LittleEndian}
+		}
+	case "fl32", "FL32":
+		return &pcmEncoding{bytes: 4, float: true, order: binary.BigEndian}
+	case "fl64", "FL64":
+		return &pcmEncoding{bytes: 8, float: true, order: binary.BigEndian}
+	}
+	return nil
+}
+
+// decode reads the sample at the start of b as a value in [-1, 1)
+func (e *pcmEncoding) decode(b []byte) float64 {
+	if e.float {
+		if e.bytes == 8 {
+			return math.Float64frombits(e.order.Uint64(b))
+		}
+		return float64(math.Float32frombits(e.order.Uint32(b)))
+	}
+	var v uint32
+	for i := range e.bytes {
+		shift := 8 * i
+		if e.order == binary.BigEndian {
+			shift = 8 * (e.bytes - 1 - i)
+		}
+		v |= uint32(b[i]) << shift
+	}
+	bits := 8 * e.bytes
+	if e.unsigned {
+		return (float64(v) - float64(uint32(1)<<(bits-1))) / float64(uint32(1)<<(bits-1))
+	}
+	// sign-extend from the sample's width
+	return float64(int32(v<<(32-bits))>>(32-bits)) / float64(uint32(1)<<(bits-1))
+}
+
+// encode writes v, clipped to the encoding's range, at the start of b
+func (e *pcmEncoding) encode(b []byte, v float64) {
+	if e.float {
+		if e.bytes == 8 {
+			e.order.PutUint64(b, math.Float64bits(v))
+		} else {
+			e.order.PutUint32(b, math.Float32bits(float32(v)))
+		}
+		return
+	}
+	bits := 8 * e.bytes
+	scale := float64(uint32(1) << (bits - 1))
+	n := int64(math.Round(v * scale))
+	n = min(max(n, -int64(scale)), int64(scale)-1)
+	if e.unsigned {
+		n += int64(scale)
+	}
+	for i := range e.bytes {
+		shift := 8 * i
+		if e.order == binary.BigEndian {
+			shift = 8 * (e.bytes - 1 - i)
+		}
+		b[i] = byte(n >> shift)
+	}
+}
+
+// PCMReader decodes audio to samples in [-1, 1), channels interleaved
+type PCMReader struct {
+	SampleRate int
+	Channels   int
+	BitDepth   int // of the recording, 0 for lossy ones, which have none
+
+	r        io.Reader
+	encoding *pcmEncoding
+	buf      []byte
+	close    func() error
+}
+
+// Read decodes whole frames into samples, returning how many samples it filled. It
+// returns io.EOF at the end of the audio.
+func (p *PCMReader) Read(samples []float64) (int, error) {
+	frameSize := p.Channels * p.encoding.bytes
+	frames := len(samples) / p.Channels
+	if frames == 0 {
+		return 0, fmt.Errorf("buffer too small for a frame of %d channels", p.Channels)
+	}
+	if len(p.buf) < frames*frameSize {
+		p.buf = make([]byte, frames*frameSize)
+	}
+	n, err := io.ReadFull(p.r, p.buf[:frames*frameSize])
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil // a partial frame at the end is dropped
+	}
+	n -= n % frameSize
+	if n == 0 && err == nil {
+		err = io.EOF
+	}
+	for i := 0; i < n; i += p.encoding.bytes {
+		samples[i/p.encoding.bytes] = p.encoding.decode(p.buf[i:])
+	}
+	return n / p.encoding.bytes, err
+}
+
+func (p *PCMReader) Close() error {
+	return p.close()
+}
+
+// feed reads the rest of the audio, handing each buffer of frames to every one of add
+func (p *PCMReader) feed(add ...func(samples []float64)) error {
+	samples := make([]float64, 4096*p.Channels)
+	for {
+		n, err := p.Read(samples)
+		for _, f := range add {
+			f(samples[:n])
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// OpenPCM decodes the sample frames [start, end) of a recording, end 0 standing for its
+// end. WAV and AIFF files are read in place; anything else is decoded by ffmpeg.
+func (c *ConversionService) OpenPCM(ctx context.Context, path string, start, end int64) (*PCMReader, error) {
+	info, err := ReadAudioInfo(path)
+	if err == nil && info.pcm != nil && info.pcm.encoding != nil {
+		return openPCMFile(path, info, start, end)
+	}
+	pcm, err := c.decodePCM(ctx, path, start, end)
+	if err == nil && info != nil {
+		pcm.BitDepth = info.BitDepth
+	}
+	return pcm, err
+}
+
+func openPCMFile(path string, info *AudioInfo, start, end int64) (*PCMReader, error) {
+	if end <= 0 || end > info.Samples {
+		end = info.Samples
+	}
+	start = min(max(start, 0), end)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	layout := info.pcm
+	section := io.NewSectionReader(file, layout.dataOffset+start*layout.frameSize, (end-start)*layout.frameSize)
+	return &PCMReader{
+		SampleRate: info.SampleRate,
+		Channels:   info.Channels,
+		BitDepth:   info.BitDepth,
+		r:          bufio.NewReaderSize(section, 1<<16),
+		encoding:   layout.encoding,
+		close:      file.Close,
+	}, nil
+}
+
+// decodePCM has ffmpeg decode the recording into a 32-bit float WAV on its stdout,
+// which carries every decoded sample exactly, 24-bit ones included
+func (c *ConversionService) decodePCM(ctx context.Context, path string, start, end int64) (*PCMReader, error) {
+	if err := c.validateFFmpeg(ctx); err != nil {
+		return nil, err
+	}
+	args := []string{"-v", "error", "-i", path, "-map", "0:a:0", "-map_metadata", "-1"}
+	if start > 0 || end > 0 {
+		trim := fmt.Sprintf("atrim=start_sample=%d", start)
+		if end > 0 {
+			trim += fmt.Sprintf(":end_sample=%d", end)
+		}
+		args = append(args, "-af", trim)
+	}
+	args = append(args, "-acodec", "pcm_f32le", "-f", "wav", "-")
+
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, c.ffmpegPath, args...)
+	stderr := &tailBuffer{max: maxLoggedOutput}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	stop := func() error {
+		cancel()
+		return cmd.Wait()
+	}
+
+	r := bufio.NewReaderSize(stdout, 1<<16)
+	channels, sampleRate, err := readWAVStreamHeader(r)
+	if err != nil {
+		stop()
+		logging.FromContext(ctx).Error("ffmpeg failed to decode audio", "input", filepath.Base(path), "output", stderr.String())
+		return nil, fmt.Errorf("failed to decode %s: %w", filepath.Base(path), ErrConversionFailed)
+	}
+	return &PCMReader{
+		SampleRate: sampleRate,
+		Channels:   channels,
+		r:          &exitReader{r: r, wait: cmd.Wait, stderr: stderr},
+		encoding:   &pcmEncoding{bytes: 4, float: true, order: binary.LittleEndian},
+		close: func() error {
+			stop()
+			return nil
+		},
+	}, nil
+}
+
+// DecodeRaw has ffmpeg decode a file's first audio stream to bare samples of encoder,
+// such as pcm_s24be, streamed as they are decoded. Reading it to the end reports
+// whether ffmpeg succeeded.
+func (c *ConversionService) DecodeRaw(ctx context.Context, path, encoder string) (io.ReadCloser, error) {
+	if err := c.validateFFmpeg(ctx); err != nil {
+		return nil, err
+	}
+	args := []string{
+		"-v", "error", "-i", path, "-map", "0:a:0", "-map_metadata", "-1",
+		"-acodec", encoder, "-f", strings.TrimPrefix(encoder, "pcm_"), "-",
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(ctx, c.ffmpegPath, args...)
+	stderr := &tailBuffer{max: maxLoggedOutput}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	return &rawReader{exitReader: exitReader{r: stdout, wait: cmd.Wait, stderr: stderr}, cancel: cancel}, nil
+}
+
+// rawReader is the output of DecodeRaw
+type rawReader struct {
+	exitReader
+	cancel context.CancelFunc
+}
+
+// Close stops ffmpeg if it is still decoding
+func (r *rawReader) Close() error {
+	r.cancel()
+	if r.err == nil {
+		r.wait() // reaped at the end of the output otherwise
+	}
+	return nil
+}
+
+// readWAVStreamHeader reads up to the data chunk of a WAV being written to a pipe,
+// whose sizes ffmpeg can't fill in
+func readWAVStreamHeader(r io.Reader) (channels, sampleRate int, err error) {
+	var riff [12]byte
+	if _, err = io.ReadFull(r, riff[:]); err != nil || string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return 0, 0, fmt.Errorf("not a WAV stream")
+	}
+	for {
+		id, size, err := readChunkHeader(r, binary.LittleEndian)
+		if err != nil {
+			return 0, 0, fmt.Errorf("WAV stream has no data chunk")
+		}
+		if id == "data" {
+			if channels == 0 {
+				return 0, 0, fmt.Errorf("WAV data chunk comes before its format")
+			}
+			return channels, sampleRate, nil
+		}
+		chunk := make([]byte, size+size%2)
+		if _, err = io.ReadFull(r, chunk); err != nil {
+			return 0, 0, err
+		}
+		if id == "fmt " && size >= 16 {
+			channels = int(binary.LittleEndian.Uint16(chunk[2:]))
+			sampleRate = int(binary.LittleEndian.Uint32(chunk[4:]))
+		}
+	}
+}
+
+// exitReader reports ffmpeg's failure at the end of its output, which would otherwise
+// pass for the end of the audio
+type exitReader struct {
+	r      io.Reader
+	wait   func() error
+	stderr *tailBuffer
+	err    error
+}
+
+func (e *exitReader) Read(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	n, err := e.r.Read(p)
+	if err == io.EOF {
+		if waitErr := e.wait(); waitErr != nil {
+			err = fmt.Errorf("ffmpeg exited with %v: %s: %w", waitErr, strings.TrimSpace(e.stderr.String()), ErrConversionFailed)
+		}
+		e.err = err
+	}
+	return n, err
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	max int
+	buf bytes.Buffer
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	if extra := t.buf.Len() - t.max; extra > 0 {
+		t.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return t.buf.String()
+}
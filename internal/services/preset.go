@@ -0,0 +1,228 @@
+package services
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"vinyl-vault/internal/config"
+)
+
+// ConversionPreset is a named way of converting a track for download. Zero values
+// match the source, so a lossless preset that sets nothing else loses nothing.
+type ConversionPreset struct {
+	Name       string      `json:"name"`
+	Format     AudioFormat `json:"format"`
+	BitDepth   int         `json:"bit_depth,omitempty"`   // lossless formats only
+	SampleRate int         `json:"sample_rate,omitempty"` // Hz
+	Channels   int         `json:"channels,omitempty"`
+	Dither     string      `json:"dither,omitempty"`  // ffmpeg dither method used going down to 16 bits; none turns it off
+	Bitrate    int         `json:"bitrate,omitempty"` // kbps, lossy formats only
+	VBR        bool        `json:"vbr,omitempty"`
+}
+
+// defaultPresets are offered whatever the config says: each format at the source's
+// quality, or a lossy encoder's best, and CD quality
+var defaultPresets = map[string]config.PresetConfig{
+	"aiff":   {Format: "aiff"},
+	"wav":    {Format: "wav"},
+	"flac":   {Format: "flac"},
+	"alac":   {Format: "alac"},
+	"cd":     {Format: "flac", BitDepth: 16, SampleRate: 44100, Channels: 2},
+	"mp3":    {Format: "mp3", Bitrate: 320},
+	"mp3-v0": {Format: "mp3", Bitrate: 245, VBR: true},
+	"opus":   {Format: "opus", Bitrate: 192, VBR: true},
+}
+
+// defaultDither is used going down to 16 bits when a preset doesn't pick a method
+const defaultDither = "triangular_hp"
+
+// opusSampleRates are those libopus takes
+var opusSampleRates = []int{8000, 12000, 16000, 24000, 48000}
+
+// lameQualities are the average bitrates of LAME's VBR presets, V0 first
+var lameQualities = []int{245, 225, 190, 175, 165, 130, 115, 100, 85, 65}
+
+// newPresets builds the presets on offer from the defaults and those configured
+func newPresets(configured map[string]config.PresetConfig) map[string]ConversionPreset {
+	presets := make(map[string]ConversionPreset, len(defaultPresets)+len(configured))
+	for name, p := range defaultPresets {
+		presets[name] = newPreset(name, p)
+	}
+	for name, p := range configured {
+		name = strings.ToLower(name)
+		presets[name] = newPreset(name, p)
+	}
+	return presets
+}
+
+func newPreset(name string, p config.PresetConfig) ConversionPreset {
+	return ConversionPreset{
+		Name:       name,
+		Format:     AudioFormat(p.Format),
+		BitDepth:   p.BitDepth,
+		SampleRate: p.SampleRate,
+		Channels:   p.Channels,
+		Dither:     p.Dither,
+		Bitrate:    p.Bitrate,
+		VBR:        p.VBR,
+	}
+}
+
+// Lossless says whether the preset's format keeps every sample it is given
+func (p ConversionPreset) Lossless() bool {
+	return p.Format != FormatMP3 && p.Format != FormatOpus
+}
+
+// forSource fills in what the preset leaves to the source, whose info is nil when it
+// isn't WAV, AIFF or FLAC, and adjusts what the format can't hold
+func (p ConversionPreset) forSource(info *AudioInfo) ConversionPreset {
+	var bitDepth, sampleRate, channels int
+	if info != nil {
+		bitDepth, sampleRate, channels = info.BitDepth, info.SampleRate, info.Channels
+	}
+	if p.SampleRate == 0 {
+		p.SampleRate = sampleRate
+	}
+	if p.Channels == 0 {
+		p.Channels = channels
+	}
+
+	switch p.Format {
+	case FormatMP3:
+		if p.SampleRate > 48000 {
+			p.SampleRate = 44100
+			if sampleRate%48000 == 0 {
+				p.SampleRate = 48000
+			}
+		}
+		p.Channels = min(p.Channels, 2)
+	case FormatOpus:
+		if !slices.Contains(opusSampleRates, p.SampleRate) {
+			p.SampleRate = 48000 // what libopus runs at inside
+		}
+	case FormatFLAC, FormatALAC:
+		if p.BitDepth == 0 {
+			p.BitDepth = min(bitDepth, 24)
+		}
+	}
+	if p.Lossless() {
+		if p.BitDepth == 0 {
+			p.BitDepth = bitDepth
+		}
+		// a lossy source decodes to floats, as good as 16 bits and more
+		if p.BitDepth == 0 {
+			p.BitDepth = 16
+		}
+		if p.BitDepth > 16 || bitDepth <= 16 {
+			p.Dither = ""
+		} else if p.Dither == "" {
+			p.Dither = defaultDither
+		}
+	} else {
+		p.BitDepth, p.Dither = 0, ""
+		if p.Bitrate == 0 {
+			p.Bitrate = 192
+		}
+	}
+	return p
+}
+
+// encoderArgs are the ffmpeg output options for the preset, once filled in by forSource
+func (p ConversionPreset) encoderArgs() []string {
+	var args []string
+	switch p.Format {
+	case FormatAIFF:
+		args = []string{"-acodec", pcmEncoder(p.BitDepth, true), "-f", "aiff"}
+	case FormatWAV:
+		args = []string{"-acodec", pcmEncoder(p.BitDepth, false), "-f", "wav"}
+	case FormatFLAC:
+		// sweet spot for both speed and compression; 24-bit samples are decoded into
+		// 32-bit ones, which bits_per_raw_sample keeps the FLAC from widening to
+		args = []string{"-acodec", "flac", "-compression_level", "5", "-sample_fmt", "s16"}
+		if p.BitDepth > 16 {
+			args = []string{"-acodec", "flac", "-compression_level", "5", "-sample_fmt", "s32", "-bits_per_raw_sample", strconv.Itoa(p.BitDepth)}
+		}
+	case FormatALAC:
+		args = []string{"-acodec", "alac", "-sample_fmt", "s16p", "-f", "mp4"}
+		if p.BitDepth > 16 {
+			args = []string{"-acodec", "alac", "-sample_fmt", "s32p", "-bits_per_raw_sample", strconv.Itoa(p.BitDepth), "-f", "mp4"}
+		}
+	case FormatMP3:
+		args = []string{"-acodec", "libmp3lame"}
+		if p.VBR {
+			args = append(args, "-q:a", strconv.Itoa(lameQuality(p.Bitrate)))
+		} else {
+			args = append(args, "-b:a", fmt.Sprintf("%dk", p.Bitrate))
+		}
+	case FormatOpus:
+		vbr := "off"
+		if p.VBR {
+			vbr = "on"
+		}
+		args = []string{"-acodec", "libopus", "-b:a", fmt.Sprintf("%dk", p.Bitrate), "-vbr", vbr}
+	}
+	if p.Channels > 0 {
+		args = append(args, "-ac", strconv.Itoa(p.Channels))
+	}
+	return args
+}
+
+// resampleFilter converts the sample rate of audio at sourceRate, 0 when unknown, and
+// dithers down to 16 bits, with resampler. It is empty when neither is needed.
+func (p ConversionPreset) resampleFilter(sourceRate int, resampler string) string {
+	var options []string
+	if p.SampleRate > 0 && p.SampleRate != sourceRate {
+		options = append(options, fmt.Sprintf("osr=%d", p.SampleRate))
+	}
+	if p.Dither != "" && p.Dither != "none" {
+		options = append(options, "osf=s16", "dither_method="+p.Dither)
+	}
+	if len(options) == 0 {
+		return ""
+	}
+	if resampler == "swr" {
+		options = append(options, "filter_size=64", "phase_shift=10")
+	} else {
+		options = append(options, "resampler=soxr", "precision=28")
+	}
+	return "aresample=" + strings.Join(options, ":")
+}
+
+// lameQuality picks the LAME VBR preset averaging closest to bitrate kbps
+func lameQuality(bitrate int) int {
+	best := 0
+	for q, average := range lameQualities {
+		if abs(average-bitrate) < abs(lameQualities[best]-bitrate) {
+			best = q
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Presets lists the conversion presets on offer by name
+func (c *ConversionService) Presets() []ConversionPreset {
+	names := slices.Sorted(maps.Keys(c.presets))
+	presets := make([]ConversionPreset, len(names))
+	for i, name := range names {
+		presets[i] = c.presets[name]
+	}
+	return presets
+}
+
+// Preset finds a conversion preset by name
+func (c *ConversionService) Preset(name string) (ConversionPreset, error) {
+	preset, ok := c.presets[strings.ToLower(name)]
+	if !ok {
+		return ConversionPreset{}, NewValidationError("preset", fmt.Sprintf("%q is not a conversion preset", name))
+	}
+	return preset, nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"vinyl-vault/internal/config"
+)
+
+func TestConversionService_Preset(t *testing.T) {
+	cfg := config.Default()
+	cfg.Conversion.Presets = map[string]config.PresetConfig{
+		"hires": {Format: "flac", BitDepth: 24, SampleRate: 96000},
+		"mp3":   {Format: "mp3", Bitrate: 256},
+	}
+	c := NewConversionServiceWithConfig(cfg)
+
+	if preset, err := c.Preset("HiRes"); err != nil || preset.SampleRate != 96000 {
+		t.Errorf("Preset(HiRes) = %+v, %v; want the configured one", preset, err)
+	}
+	// a configured preset replaces the built-in one of its name
+	if preset, err := c.Preset("mp3"); err != nil || preset.Bitrate != 256 {
+		t.Errorf("Preset(mp3) = %+v, %v; want 256 kbps", preset, err)
+	}
+	var validationErr *ValidationError
+	if _, err := c.Preset("tape"); !errors.As(err, &validationErr) || validationErr.Field != "preset" {
+		t.Errorf("Preset(tape) error = %v, want one on preset", err)
+	}
+
+	var names []string
+	for _, preset := range c.Presets() {
+		names = append(names, preset.Name)
+	}
+	want := []string{"aiff", "alac", "cd", "flac", "hires", "mp3", "mp3-v0", "opus", "wav"}
+	if !slices.Equal(names, want) {
+		t.Errorf("Presets() = %v, want %v", names, want)
+	}
+}
+
+func TestBuildFFmpegArgsPresets(t *testing.T) {
+	c := NewConversionService(t.TempDir())
+	hires := &AudioInfo{Format: "flac", SampleRate: 96000, Channels: 2, BitDepth: 24}
+	cd := &AudioInfo{Format: "wav", SampleRate: 44100, Channels: 2, BitDepth: 16}
+	tests := []struct {
+		name   string
+		preset ConversionPreset
+		info   *AudioInfo
+		want   []string // in order, as one string
+		absent []string
+	}{
+		{
+			// lossless targets match the source unless told otherwise
+			name: "flac matches source", preset: ConversionPreset{Format: FormatFLAC}, info: hires,
+			want:   []string{"-acodec flac -compression_level 5 -sample_fmt s32 -bits_per_raw_sample 24", "-ac 2"},
+			absent: []string{"-af", "aresample"},
+		},
+		{
+			name: "cd from hires", preset: ConversionPreset{Format: FormatFLAC, BitDepth: 16, SampleRate: 44100, Channels: 2}, info: hires,
+			want: []string{"-af aresample=osr=44100:osf=s16:dither_method=triangular_hp:resampler=soxr:precision=28", "-sample_fmt s16"},
+		},
+		{
+			name: "cd from cd", preset: ConversionPreset{Format: FormatFLAC, BitDepth: 16, SampleRate: 44100, Channels: 2}, info: cd,
+			want:   []string{"-sample_fmt s16"},
+			absent: []string{"aresample"},
+		},
+		{
+			name: "no dither", preset: ConversionPreset{Format: FormatWAV, BitDepth: 16, Dither: "none"}, info: hires,
+			want:   []string{"-acodec pcm_s16le -f wav"},
+			absent: []string{"aresample", "dither"},
+		},
+		{
+			name: "alac at 24 bits", preset: ConversionPreset{Format: FormatALAC}, info: &AudioInfo{SampleRate: 192000, Channels: 2, BitDepth: 32},
+			want: []string{"-acodec alac -sample_fmt s32p -bits_per_raw_sample 24 -f mp4"},
+		},
+		{
+			// MP3 tops out at 48 kHz, which 96 kHz halves to
+			name: "mp3 from hires", preset: ConversionPreset{Format: FormatMP3, Bitrate: 320}, info: hires,
+			want: []string{"aresample=osr=48000:resampler=soxr", "-acodec libmp3lame -b:a 320k"},
+		},
+		{
+			name: "mp3 from 88.2k", preset: ConversionPreset{Format: FormatMP3, Bitrate: 320}, info: &AudioInfo{SampleRate: 88200, Channels: 2, BitDepth: 24},
+			want: []string{"aresample=osr=44100"},
+		},
+		{
+			name: "mp3 vbr", preset: ConversionPreset{Format: FormatMP3, Bitrate: 190, VBR: true}, info: cd,
+			want:   []string{"-acodec libmp3lame -q:a 2"},
+			absent: []string{"-b:a", "aresample"},
+		},
+		{
+			name: "opus", preset: ConversionPreset{Format: FormatOpus, Bitrate: 128}, info: cd,
+			want: []string{"aresample=osr=48000", "-acodec libopus -b:a 128k -vbr off"},
+		},
+		{
+			// a lossy source can't be read, so ffmpeg keeps what it decodes to
+			name: "unknown source", preset: ConversionPreset{Format: FormatFLAC}, info: nil,
+			want:   []string{"-sample_fmt s16"},
+			absent: []string{"-ac ", "aresample"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := c.buildFFmpegArgs("in", "out", tt.preset, tt.info, 0, 0, nil)
+			if err != nil {
+				t.Fatalf("buildFFmpegArgs() error = %v", err)
+			}
+			joined := strings.Join(args, " ")
+			for _, want := range tt.want {
+				if !strings.Contains(joined, want) {
+					t.Errorf("buildFFmpegArgs() = %s, want %q", joined, want)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(joined, absent) {
+					t.Errorf("buildFFmpegArgs() = %s, want no %q", joined, absent)
+				}
+			}
+		})
+	}
+
+	t.Run("split track with swr", func(t *testing.T) {
+		c := NewConversionService(t.TempDir())
+		c.resampler = "swr"
+		args, err := c.buildFFmpegArgs("in", "out", ConversionPreset{Format: FormatFLAC, SampleRate: 48000}, hires, 100, 200, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "atrim=start_sample=100:end_sample=200,asetpts=PTS-STARTPTS,aresample=osr=48000:filter_size=64:phase_shift=10"
+		if i := slices.Index(args, "-af"); i < 0 || args[i+1] != want {
+			t.Errorf("buildFFmpegArgs() = %v, want filters %s", args, want)
+		}
+	})
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// QuotaChecker rejects uploads that would push a user over their storage quota
+type QuotaChecker interface {
+	CheckQuota(ctx context.Context, userID uint64, size int64) error
+}
+
+// UsageTracker is what the blob store needs to keep per-user usage up to date
+type UsageTracker interface {
+	QuotaChecker
+	AddUsage(ctx context.Context, userID uint64, delta int64) error
+}
+
+// AlbumUsage is what an album's tracks and cover art take up
+type AlbumUsage struct {
+	AlbumID uint64 `json:"album_id"`
+	Title   string `json:"title"`
+	Tracks  int    `json:"tracks"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// StorageUsage is a user's usage report. Used includes trashed items until they are purged,
+// the breakdowns only cover the live library.
+type StorageUsage struct {
+	Used     int64            `json:"used"`
+	Quota    int64            `json:"quota"` // 0 means unlimited
+	ByAlbum  []AlbumUsage     `json:"by_album"`
+	ByFormat map[string]int64 `json:"by_format"`
+}
+
+type QuotaService struct {
+	userRepository  UserRepository
+	albumRepository AlbumRepository
+	blobRepository  BlobRepository
+	defaultQuota    int64 // applies to users without their own limit, 0 means unlimited
+}
+
+func NewQuotaService(
+	userRepository UserRepository, albumRepository AlbumRepository, blobRepository BlobRepository, defaultQuota int64,
+) *QuotaService {
+	return &QuotaService{
+		userRepository:  userRepository,
+		albumRepository: albumRepository,
+		blobRepository:  blobRepository,
+		defaultQuota:    defaultQuota,
+	}
+}
+
+func (q *QuotaService) CheckQuota(ctx context.Context, userID uint64, size int64) error {
+	user, err := q.userRepository.FindByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+
+	limit := q.quotaFor(user)
+	if limit > 0 && user.StorageUsed+size > limit {
+		return fmt.Errorf("%w: %dMB of %dMB used", ErrQuotaExceeded, user.StorageUsed>>20, limit>>20)
+	}
+	return nil
+}
+
+func (q *QuotaService) AddUsage(ctx context.Context, userID uint64, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+	if err := q.userRepository.AdjustStorageUsed(ctx, userID, delta); err != nil {
+		return fmt.Errorf("failed to update storage usage: %w", err)
+	}
+	return nil
+}
+
+func (q *QuotaService) GetUsage(ctx context.Context, userID uint64) (*StorageUsage, error) {
+	user, err := q.userRepository.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	albums, err := q.albumRepository.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user albums: %w", err)
+	}
+
+	usage := &StorageUsage{
+		Used:     user.StorageUsed,
+		Quota:    q.quotaFor(user),
+		ByAlbum:  make([]AlbumUsage, 0, len(albums)),
+		ByFormat: make(map[string]int64),
+	}
+	for _, album := range albums {
+		albumUsage := AlbumUsage{AlbumID: album.ID, Title: album.Metadata.Album}
+		for _, track := range album.Tracks {
+			if track.Blob == nil {
+				continue
+			}
+			albumUsage.Tracks++
+			albumUsage.Bytes += track.StoredSize()
+			usage.ByFormat[blobFormat(track.Blob)] += track.StoredSize()
+		}
+
+		// the cover is charged like any other reference
+		if album.CoverBlobID != nil {
+			cover, err := q.blobRepository.FindByID(ctx, *album.CoverBlobID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get cover art of album %d: %w", album.ID, err)
+			}
+			albumUsage.Bytes += cover.Size
+			usage.ByFormat[blobFormat(cover)] += cover.Size
+		}
+		usage.ByAlbum = append(usage.ByAlbum, albumUsage)
+	}
+	return usage, nil
+}
+
+// blobFormat names a blob's format by its extension, such as flac or jpg
+func blobFormat(blob *Blob) string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(blob.Path)), ".")
+}
+
+// SetQuota overrides a user's limit (admin only). A nil quota reverts to the instance default.
+func (q *QuotaService) SetQuota(ctx context.Context, adminID, userID uint64, quota *int64) (*User, error) {
+	admin, err := q.userRepository.FindByID(ctx, adminID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	if !admin.IsAdmin {
+		return nil, fmt.Errorf("set storage quotas: %w", ErrAdminOnly)
+	}
+
+	if quota != nil && *quota < 0 {
+		return nil, NewValidationError("quota", "must not be negative")
+	}
+
+	user, err := q.userRepository.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	user.StorageQuota = quota
+
+	if err = q.userRepository.Save(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update quota: %w", err)
+	}
+	return user, nil
+}
+
+func (q *QuotaService) quotaFor(user *User) int64 {
+	if user.StorageQuota != nil {
+		return *user.StorageQuota
+	}
+	return q.defaultQuota
+}
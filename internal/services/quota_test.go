@@ -0,0 +1,92 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"vinyl-vault/internal/services"
+)
+
+func TestQuotaService_CheckQuota(t *testing.T) {
+	custom := int64(100)
+
+	tests := []struct {
+		name         string
+		used         int64
+		quota        *int64
+		defaultQuota int64
+		size         int64
+		wantErr      bool
+	}{
+		{"within default quota", 50, nil, 100, 50, false},
+		{"exceeds default quota", 50, nil, 100, 51, true},
+		{"unlimited default", 1 << 40, nil, 0, 1 << 30, false},
+		{"user quota overrides default", 90, &custom, 0, 20, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			user := f.user(t, "alice")
+			user.StorageQuota = tt.quota
+			if err := f.users.Save(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.users.AdjustStorageUsed(ctx, user.ID, tt.used); err != nil {
+				t.Fatal(err)
+			}
+
+			service := services.NewQuotaService(f.users, f.albums, f.blobs, tt.defaultQuota)
+
+			err := service.CheckQuota(ctx, user.ID, tt.size)
+			if tt.wantErr {
+				if !errors.Is(err, services.ErrQuotaExceeded) {
+					t.Errorf("expected ErrQuotaExceeded, got %v", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestQuotaService_GetUsage(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.user(t, "alice")
+
+	album := f.album(t, user.ID, "Tago Mago")
+	cover := f.blob(t, user.ID, "cover", ".jpg")
+	album.CoverBlobID = &cover.ID
+	if err := f.albums.Save(ctx, album); err != nil {
+		t.Fatal(err)
+	}
+	one, two := f.blob(t, user.ID, "one", ".flac"), f.blob(t, user.ID, "two", ".FLAC")
+	f.track(t, album.ID, 1, one)
+	f.track(t, album.ID, 2, two)
+	f.track(t, album.ID, 3, nil)
+
+	// trashed albums count towards the total only
+	trashed := f.album(t, user.ID, "Ege Bamyasi")
+	f.track(t, trashed.ID, 1, f.blob(t, user.ID, "trashed", ".mp3"))
+	if err := f.albums.Delete(ctx, trashed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := f.quota.GetUsage(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("GetUsage() error = %v", err)
+	}
+
+	if want := int64(len("cover") + len("one") + len("two") + len("trashed")); usage.Used != want {
+		t.Errorf("GetUsage().Used = %d, want %d", usage.Used, want)
+	}
+	want := services.AlbumUsage{AlbumID: album.ID, Title: "Tago Mago", Tracks: 2, Bytes: cover.Size + one.Size + two.Size}
+	if len(usage.ByAlbum) != 1 || usage.ByAlbum[0] != want {
+		t.Errorf("GetUsage().ByAlbum = %+v, want [%+v]", usage.ByAlbum, want)
+	}
+	if len(usage.ByFormat) != 2 || usage.ByFormat["flac"] != one.Size+two.Size || usage.ByFormat["jpg"] != cover.Size {
+		t.Errorf("GetUsage().ByFormat = %v, want flac %d and jpg %d", usage.ByFormat, one.Size+two.Size, cover.Size)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"time"
+	"vinyl-vault/internal/logging"
 )
 
 type RegistrationKey struct {
@@ -47,7 +48,7 @@ func (r *RegistrationKeyService) GenerateKey(ctx context.Context, creatorID uint
 	}
 
 	if !creator.IsAdmin {
-		return nil, fmt.Errorf("unauthorized: only admins can generate registration keys")
+		return nil, fmt.Errorf("generate registration keys: %w", ErrAdminOnly)
 	}
 
 	keyStr, err := generateSecureKey(32)
@@ -66,6 +67,7 @@ func (r *RegistrationKeyService) GenerateKey(ctx context.Context, creatorID uint
 	if err = r.keyRepository.Save(ctx, key); err != nil {
 		return nil, fmt.Errorf("failed to save registration key: %w", err)
 	}
+	logging.FromContext(ctx).Info("registration key generated", "key_id", key.ID, "created_by", creatorID, "expires_at", expiresAt)
 
 	return key, nil
 }
@@ -73,17 +75,20 @@ func (r *RegistrationKeyService) GenerateKey(ctx context.Context, creatorID uint
 func (r *RegistrationKeyService) ValidateKey(ctx context.Context, keyStr string) (*RegistrationKey, error) {
 	key, err := r.keyRepository.FindByKey(ctx, keyStr)
 	if err != nil {
-		return nil, fmt.Errorf("invalid registration key")
+		if IsNotFound(err) {
+			return nil, ErrInvalidKey
+		}
+		return nil, fmt.Errorf("failed to find registration key: %w", err)
 	}
 
 	// Check if already used
 	if key.IsUsed {
-		return nil, fmt.Errorf("registration key has already been used")
+		return nil, ErrKeyAlreadyUsed
 	}
 
 	// Check if expired
 	if time.Now().After(key.ExpiresAt) {
-		return nil, fmt.Errorf("registration key has expired")
+		return nil, ErrKeyExpired
 	}
 
 	return key, nil
@@ -115,7 +120,7 @@ func (r *RegistrationKeyService) GetKeysByCreator(ctx context.Context, creatorID
 	}
 
 	if !creator.IsAdmin {
-		return nil, fmt.Errorf("unauthorized: only admins can view registration keys")
+		return nil, fmt.Errorf("view registration keys: %w", ErrAdminOnly)
 	}
 
 	keys, err := r.keyRepository.FindByCreator(ctx, creatorID)
@@ -134,12 +139,13 @@ func (r *RegistrationKeyService) DeleteKey(ctx context.Context, keyID, adminID u
 	}
 
 	if !admin.IsAdmin {
-		return fmt.Errorf("unauthorized: only admins can delete registration keys")
+		return fmt.Errorf("delete registration keys: %w", ErrAdminOnly)
 	}
 
 	if err = r.keyRepository.Delete(ctx, keyID); err != nil {
 		return fmt.Errorf("failed to delete key: %w", err)
 	}
+	logging.FromContext(ctx).Info("registration key deleted", "key_id", keyID, "admin_id", adminID)
 
 	return nil
 }
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"math"
+	"math/bits"
+	"slices"
+	"time"
+	"vinyl-vault/pkg"
+)
+
+const (
+	// clipRun is how many samples in a row at full scale count as clipping rather than
+	// a peak that happens to reach it
+	clipRun = 3
+
+	// a click is a jump in the second difference of the waveform clickRatio times its
+	// recent level, at least clickFloor, and clicks closer than clickGap count as one
+	clickRatio  = 12.0
+	clickFloor  = 0.02
+	clickGap    = 10 * time.Millisecond
+	clickWindow = 50 * time.Millisecond // how long the recent level averages over
+
+	// spectrumSize is the FFT length of the long-term spectrum the bandwidth is read from
+	spectrumSize = 4096
+	// the bandwidth ends where the spectrum last stands bandwidthMargin dB above the
+	// noise floor, and a cliff falls cliffDrop dB within cliffWidth Hz either side of it
+	bandwidthMargin = 10.0
+	cliffDrop       = 30.0
+	cliffWidth      = 1000
+
+	// the limits past which RipQuality flags a track
+	maxClicksPerMinute  = 10.0
+	maxDCOffset         = 0.001 // -60 dBFS
+	maxChannelImbalance = 1.5   // dB
+	upsampledBandwidth  = 24000 // the Nyquist frequency of a 48 kHz source
+	lossyBandwidthMin   = 11000 // lossy encoders cut off between these at usual bitrates
+	lossyBandwidthMax   = 20500
+)
+
+// ripMeter checks decoded audio, fed to it by Add, for the faults of a bad rip
+type ripMeter struct {
+	sampleRate int
+	channels   int
+	bitDepth   int
+	clipLevel  float64
+
+	frames   int64
+	sums     []float64 // of each channel's samples, for the DC offset
+	squares  []float64 // and of their squares, for the balance
+	clipRuns []int
+	clipped  int64
+	peaks    []truePeakMeter
+	overs    int64
+	usedBits uint32 // every sample ORed together, as 32-bit integers
+
+	prev      [][2]float64 // the two samples before, per channel
+	level     []float64    // the recent mean square of each channel's second difference
+	warmup    int64        // frames before the level is meaningful
+	decay     float64
+	gap       int64
+	lastClick int64
+	clicks    int
+
+	spectrum *spectrumAnalyzer
+	mono     []float64
+	power    []float64
+	total    []float64
+	windows  int
+}
+
+// newRipMeter checks audio of the given format; bitDepth is that of the file, 0 when it
+// has none
+func newRipMeter(sampleRate, channels, bitDepth int) *ripMeter {
+	if bitDepth <= 0 || bitDepth > 24 {
+		bitDepth = 24
+	}
+	window := int64(clickWindow.Seconds() * float64(sampleRate))
+	m := &ripMeter{
+		sampleRate: sampleRate,
+		channels:   channels,
+		bitDepth:   bitDepth,
+		// the largest positive sample is a step short of 1
+		clipLevel: 1 - 1.5/float64(uint32(1)<<(bitDepth-1)),
+		sums:      make([]float64, channels),
+		squares:   make([]float64, channels),
+		clipRuns:  make([]int, channels),
+		prev:      make([][2]float64, channels),
+		level:     make([]float64, channels),
+		warmup:    window,
+		decay:     1 / float64(max(window, 1)),
+		gap:       int64(clickGap.Seconds() * float64(sampleRate)),
+		lastClick: math.MinInt64 / 2,
+		spectrum:  newSpectrumAnalyzer(spectrumSize),
+		mono:      make([]float64, 0, spectrumSize),
+		power:     make([]float64, spectrumSize/2+1),
+		total:     make([]float64, spectrumSize/2+1),
+	}
+	for range channels {
+		m.peaks = append(m.peaks, newTruePeakMeter(sampleRate))
+	}
+	return m
+}
+
+// Add checks interleaved samples, whole frames of them
+func (m *ripMeter) Add(samples []float64) {
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		var mono float64
+		click := false
+		for c, x := range samples[i : i+m.channels] {
+			m.sums[c] += x
+			m.squares[c] += x * x
+			mono += x
+			m.usedBits |= uint32(int32(min(max(math.Round(x*(1<<31)), math.MinInt32), math.MaxInt32)))
+
+			if math.Abs(x) >= m.clipLevel {
+				m.clipRuns[c]++
+				switch {
+				case m.clipRuns[c] == clipRun:
+					m.clipped += clipRun
+				case m.clipRuns[c] > clipRun:
+					m.clipped++
+				}
+			} else {
+				m.clipRuns[c] = 0
+			}
+			if m.peaks[c].add(x) > 1 {
+				m.overs++
+			}
+
+			d := x - 2*m.prev[c][0] + m.prev[c][1]
+			m.prev[c] = [2]float64{x, m.prev[c][0]}
+			if m.frames >= m.warmup && math.Abs(d) > clickFloor && d*d > clickRatio*clickRatio*m.level[c] {
+				click = true
+				// a click must not raise the level it is measured against
+				d = math.Copysign(math.Sqrt(m.level[c]), d)
+			}
+			m.level[c] += (d*d - m.level[c]) * m.decay
+		}
+		if click && m.frames-m.lastClick > m.gap {
+			m.clicks++
+			m.lastClick = m.frames
+		}
+		m.frames++
+
+		m.mono = append(m.mono, mono/float64(m.channels))
+		if len(m.mono) == spectrumSize {
+			m.spectrum.power(m.mono, m.power)
+			for k, p := range m.power {
+				m.total[k] += p
+			}
+			m.windows++
+			m.mono = m.mono[:0]
+		}
+	}
+}
+
+// Quality reports what was found in the audio added so far
+func (m *ripMeter) Quality(at time.Time) *pkg.RipQuality {
+	q := &pkg.RipQuality{
+		ClippedSamples:    m.clipped,
+		InterSamplePeaks:  m.overs,
+		EffectiveBitDepth: m.effectiveBitDepth(),
+		AnalyzedAt:        at,
+	}
+	if m.frames == 0 {
+		return q
+	}
+	if minutes := float64(m.frames) / float64(m.sampleRate) / 60; minutes > 0 {
+		q.ClicksPerMinute = round2(float64(m.clicks) / minutes)
+	}
+	var ac [2]float64
+	for c := range m.channels {
+		mean := m.sums[c] / float64(m.frames)
+		if math.Abs(mean) > math.Abs(q.DCOffset) {
+			q.DCOffset = mean
+		}
+		if c < 2 {
+			ac[c] = m.squares[c]/float64(m.frames) - mean*mean
+		}
+	}
+	q.DCOffset = math.Round(q.DCOffset*1e6) / 1e6
+	if m.channels == 2 && ac[0] > 0 && ac[1] > 0 {
+		q.ChannelImbalance = round2(10 * math.Log10(ac[0]/ac[1]))
+	}
+	bandwidth, cliff := m.bandwidth()
+	q.Bandwidth = bandwidth
+
+	flag := func(found bool, name string) {
+		if found {
+			q.Flags = append(q.Flags, name)
+		}
+	}
+	flag(q.ClippedSamples > 0, pkg.RipClipping)
+	flag(q.InterSamplePeaks > 0, pkg.RipInterSamplePeaks)
+	flag(q.ClicksPerMinute > maxClicksPerMinute, pkg.RipClicks)
+	flag(math.Abs(q.DCOffset) > maxDCOffset, pkg.RipDCOffset)
+	flag(math.Abs(q.ChannelImbalance) > maxChannelImbalance, pkg.RipChannelImbalance)
+	flag(m.bitDepth > 16 && q.EffectiveBitDepth > 0 && q.EffectiveBitDepth <= 16, pkg.RipPaddedBitDepth)
+	flag(cliff && m.sampleRate > 48000 && bandwidth <= upsampledBandwidth, pkg.RipUpsampled)
+	flag(cliff && bandwidth >= lossyBandwidthMin && bandwidth <= lossyBandwidthMax, pkg.RipLossySource)
+	return q
+}
+
+// effectiveBitDepth counts the bits down to the lowest one any sample uses, which
+// is the bit depth the audio was made at when it has been padded out since
+func (m *ripMeter) effectiveBitDepth() int {
+	if m.usedBits == 0 {
+		return 0
+	}
+	return min(32-bits.TrailingZeros32(m.usedBits), m.bitDepth)
+}
+
+// bandwidth finds the highest frequency the long-term spectrum stands clear of its noise
+// floor at, and whether it ends there in a cliff, as the filters of resamplers and
+// lossy encoders leave, rather than rolling off
+func (m *ripMeter) bandwidth() (int, bool) {
+	if m.windows == 0 {
+		return 0, false
+	}
+	// smooth the spectrum over a few bins, so the gaps between harmonics don't pass for the floor
+	const half = 8
+	bins := len(m.total)
+	levels := make([]float64, bins)
+	for k := range bins {
+		var sum float64
+		from, to := max(k-half, 0), min(k+half+1, bins)
+		for _, p := range m.total[from:to] {
+			sum += p
+		}
+		levels[k] = 10 * math.Log10(sum/float64((to-from)*m.windows)+1e-30)
+	}
+
+	binWidth := float64(m.sampleRate) / spectrumSize
+	// the floor is the quietest part of the spectrum above the low bass
+	floor := slices.Min(levels[min(int(1000/binWidth), bins-1):])
+	cutoff := -1
+	for k := bins - 1; k > 0; k-- {
+		if levels[k] > floor+bandwidthMargin {
+			cutoff = k
+			break
+		}
+	}
+	if cutoff < 0 {
+		return 0, false
+	}
+
+	width := int(cliffWidth / binWidth)
+	below, above := levels[max(cutoff-width, 0)], levels[min(cutoff+width, bins-1)]
+	return int(math.Round(float64(cutoff) * binWidth)), below-above >= cliffDrop
+}
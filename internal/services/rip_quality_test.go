@@ -0,0 +1,199 @@
+package services
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+	"vinyl-vault/pkg"
+)
+
+// tones returns seconds of stereo audio with a tone every 250 Hz up to top, over noise
+// 90 dB down, as a stand-in for music with that bandwidth
+func tones(sampleRate int, seconds float64, top float64) []float64 {
+	rng := rand.New(rand.NewPCG(1, 2))
+	var freqs, phases []float64
+	for f := 100.0; f <= top; f += 250 {
+		freqs = append(freqs, 2*math.Pi*f/float64(sampleRate))
+		phases = append(phases, rng.Float64()*2*math.Pi)
+	}
+	gain := 0.5 / float64(len(freqs))
+	n := int(seconds * float64(sampleRate))
+	samples := make([]float64, 0, 2*n)
+	for i := range n {
+		var v float64
+		for k, w := range freqs {
+			v += math.Sin(w*float64(i) + phases[k])
+		}
+		v = v*gain + (rng.Float64()-0.5)*6e-5
+		samples = append(samples, v, v)
+	}
+	return samples
+}
+
+func TestRipMeter(t *testing.T) {
+	quantize := func(samples []float64, bitDepth int) []float64 {
+		scale := float64(int(1) << (bitDepth - 1))
+		for i, v := range samples {
+			samples[i] = math.Round(v*scale) / scale
+		}
+		return samples
+	}
+
+	tests := []struct {
+		name       string
+		sampleRate int
+		bitDepth   int
+		samples    func(rate int) []float64
+		flags      []string
+		check      func(t *testing.T, q *pkg.RipQuality)
+	}{
+		{
+			name: "clean", sampleRate: 48000, bitDepth: 24,
+			samples: func(rate int) []float64 { return sine(rate, 2, -6, 1000, 0) },
+			check: func(t *testing.T, q *pkg.RipQuality) {
+				if q.ClippedSamples != 0 || q.InterSamplePeaks != 0 || q.ClicksPerMinute != 0 || q.EffectiveBitDepth != 24 {
+					t.Errorf("Quality() = %+v, want nothing found at 24 bits", q)
+				}
+			},
+		},
+		{
+			name: "clipping", sampleRate: 48000, bitDepth: 16,
+			samples: func(rate int) []float64 {
+				samples := sine(rate, 1, 6, 1000, 0)
+				for i, v := range samples {
+					samples[i] = min(max(v, -1), 1)
+				}
+				return samples
+			},
+			flags: []string{pkg.RipClipping, pkg.RipInterSamplePeaks},
+			check: func(t *testing.T, q *pkg.RipQuality) {
+				// each channel's 2000 half cycles spend two thirds of their 24 samples at full scale
+				if want := int64(2 * 2000 * 15); q.ClippedSamples < want {
+					t.Errorf("ClippedSamples = %d, want at least %d", q.ClippedSamples, want)
+				}
+			},
+		},
+		{
+			// a quarter of the sample rate sampled 45° from its peaks reads 3 dB low
+			name: "inter-sample peaks", sampleRate: 48000, bitDepth: 24,
+			samples: func(rate int) []float64 { return sine(rate, 1, 1.5, float64(rate)/4, math.Pi/4) },
+			flags:   []string{pkg.RipInterSamplePeaks},
+		},
+		{
+			name: "clicks", sampleRate: 44100, bitDepth: 16,
+			samples: func(rate int) []float64 {
+				samples := sine(rate, 6, -20, 440, 0)
+				for _, at := range []float64{0.5, 2, 3.1, 4.7} {
+					i := 2 * int(at*float64(rate))
+					samples[i] += 0.5
+					samples[i+1] += 0.5
+				}
+				return samples
+			},
+			flags: []string{pkg.RipClicks},
+			check: func(t *testing.T, q *pkg.RipQuality) {
+				if q.ClicksPerMinute != 40 {
+					t.Errorf("ClicksPerMinute = %v, want 40", q.ClicksPerMinute)
+				}
+			},
+		},
+		{
+			name: "dc offset", sampleRate: 44100, bitDepth: 16,
+			samples: func(rate int) []float64 {
+				samples := sine(rate, 1, -20, 1000, 0)
+				for i := range samples {
+					samples[i] += 0.01
+				}
+				return samples
+			},
+			flags: []string{pkg.RipDCOffset},
+			check: func(t *testing.T, q *pkg.RipQuality) {
+				if math.Abs(q.DCOffset-0.01) > 1e-4 {
+					t.Errorf("DCOffset = %v, want 0.01", q.DCOffset)
+				}
+			},
+		},
+		{
+			name: "channel imbalance", sampleRate: 44100, bitDepth: 16,
+			samples: func(rate int) []float64 {
+				samples := sine(rate, 1, -20, 1000, 0)
+				for i := 1; i < len(samples); i += 2 {
+					samples[i] *= math.Pow(10, -3.0/20)
+				}
+				return samples
+			},
+			flags: []string{pkg.RipChannelImbalance},
+			check: func(t *testing.T, q *pkg.RipQuality) {
+				if math.Abs(q.ChannelImbalance-3) > 0.01 {
+					t.Errorf("ChannelImbalance = %v, want 3 dB", q.ChannelImbalance)
+				}
+			},
+		},
+		{
+			name: "padded bit depth", sampleRate: 48000, bitDepth: 24,
+			samples: func(rate int) []float64 { return quantize(sine(rate, 1, -6, 1000, 0), 16) },
+			flags:   []string{pkg.RipPaddedBitDepth},
+			check: func(t *testing.T, q *pkg.RipQuality) {
+				if q.EffectiveBitDepth != 16 {
+					t.Errorf("EffectiveBitDepth = %d, want 16", q.EffectiveBitDepth)
+				}
+			},
+		},
+		{
+			name: "hi-res", sampleRate: 96000, bitDepth: 24,
+			samples: func(rate int) []float64 { return tones(rate, 1, 40000) },
+			check: func(t *testing.T, q *pkg.RipQuality) {
+				if q.Bandwidth < 39000 || q.Bandwidth > 41000 {
+					t.Errorf("Bandwidth = %d, want about 40 kHz", q.Bandwidth)
+				}
+			},
+		},
+		{
+			name: "upsampled", sampleRate: 96000, bitDepth: 24,
+			samples: func(rate int) []float64 { return tones(rate, 1, 21500) },
+			flags:   []string{pkg.RipUpsampled},
+			check: func(t *testing.T, q *pkg.RipQuality) {
+				if q.Bandwidth < 21000 || q.Bandwidth > 22500 {
+					t.Errorf("Bandwidth = %d, want about 21.5 kHz", q.Bandwidth)
+				}
+			},
+		},
+		{
+			name: "lossy source", sampleRate: 44100, bitDepth: 16,
+			samples: func(rate int) []float64 { return tones(rate, 1, 16000) },
+			flags:   []string{pkg.RipLossySource},
+			check: func(t *testing.T, q *pkg.RipQuality) {
+				if q.Bandwidth < 15500 || q.Bandwidth > 17000 {
+					t.Errorf("Bandwidth = %d, want about 16 kHz", q.Bandwidth)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meter := newRipMeter(tt.sampleRate, 2, tt.bitDepth)
+			samples := tt.samples(tt.sampleRate)
+			// in uneven buffers, as a PCMReader hands them over
+			for len(samples) > 0 {
+				n := min(len(samples), 2*1021)
+				meter.Add(samples[:n])
+				samples = samples[n:]
+			}
+
+			at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+			q := meter.Quality(at)
+			if !slices.Equal(q.Flags, tt.flags) {
+				t.Errorf("Quality() Flags = %v, want %v (%+v)", q.Flags, tt.flags, q)
+			}
+			if !q.AnalyzedAt.Equal(at) {
+				t.Errorf("AnalyzedAt = %v, want %v", q.AnalyzedAt, at)
+			}
+			if tt.check != nil {
+				tt.check(t, q)
+			}
+		})
+	}
+}
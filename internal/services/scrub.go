@@ -0,0 +1,408 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"vinyl-vault/internal/logging"
+)
+
+const scrubBatchSize = 100
+
+// orphanGracePeriod is how old a file must be before a scrub calls it an orphan. An
+// upload is renamed into the blob store before its blob record is saved, so a newer
+// file may belong to an upload still in flight.
+const orphanGracePeriod = time.Hour
+
+type ScrubStatus string
+
+const (
+	ScrubRunning   ScrubStatus = "running"
+	ScrubCompleted ScrubStatus = "completed"
+	ScrubFailed    ScrubStatus = "failed"
+)
+
+type ScrubIssueKind string
+
+const (
+	ScrubIssueMissing  ScrubIssueKind = "missing"
+	ScrubIssueMismatch ScrubIssueKind = "checksum_mismatch"
+	ScrubIssueOrphaned ScrubIssueKind = "orphaned"
+)
+
+// ScrubReport is the result of re-hashing every stored file. LastBlobID is the
+// resume cursor: an interrupted scrub picks up after the last verified blob.
+type ScrubReport struct {
+	ID           uint64       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Status       ScrubStatus  `json:"status" gorm:"not null;index"`
+	StartedAt    time.Time    `json:"started_at"`
+	FinishedAt   *time.Time   `json:"finished_at,omitempty"`
+	LastBlobID   uint64       `json:"-"`
+	FilesChecked int          `json:"files_checked"`
+	BytesChecked int64        `json:"bytes_checked"`
+	Missing      int          `json:"missing"`
+	Mismatched   int          `json:"mismatched"`
+	Orphaned     int          `json:"orphaned"`
+	Error        string       `json:"error,omitempty"`
+	Issues       []ScrubIssue `json:"issues" gorm:"foreignKey:ReportID;constraint:OnDelete:CASCADE"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// ScrubIssue is one problem a scrub found. A report lists each path once per kind, so
+// a resumed scrub re-checking the blob it was interrupted on doesn't repeat its issue.
+type ScrubIssue struct {
+	ID           uint64         `json:"id" gorm:"primaryKey;autoIncrement"`
+	ReportID     uint64         `json:"report_id" gorm:"not null;index;uniqueIndex:idx_scrub_issues_report_path,priority:1"`
+	Kind         ScrubIssueKind `json:"kind" gorm:"not null;uniqueIndex:idx_scrub_issues_report_path,priority:3"`
+	BlobID       *uint64        `json:"blob_id,omitempty"`
+	Path         string         `json:"path" gorm:"uniqueIndex:idx_scrub_issues_report_path,priority:2"`
+	ExpectedHash string         `json:"expected_hash,omitempty"`
+	ActualHash   string         `json:"actual_hash,omitempty"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+type ScrubRepository interface {
+	FindLatest(ctx context.Context) (*ScrubReport, error)
+	FindUnfinished(ctx context.Context) (*ScrubReport, error)
+	Save(ctx context.Context, report *ScrubReport) error
+	// AddIssue ignores an issue the report already lists
+	AddIssue(ctx context.Context, issue *ScrubIssue) error
+}
+
+type ScrubService struct {
+	scrubRepository ScrubRepository
+	blobRepository  BlobRepository
+	userRepository  UserRepository
+	fileService     *FileService
+	bytesPerSecond  int64 // 0 disables throttling
+
+	mu      sync.Mutex
+	running bool
+}
+
+func NewScrubService(
+	scrubRepository ScrubRepository, blobRepository BlobRepository, userRepository UserRepository,
+	fileService *FileService, bytesPerSecond int64,
+) *ScrubService {
+	return &ScrubService{
+		scrubRepository: scrubRepository,
+		blobRepository:  blobRepository,
+		userRepository:  userRepository,
+		fileService:     fileService,
+		bytesPerSecond:  bytesPerSecond,
+	}
+}
+
+// StartScheduler runs a scrub every interval until ctx is cancelled.
+// An unfinished scrub from a previous run is resumed immediately.
+func (s *ScrubService) StartScheduler(ctx context.Context, interval time.Duration) {
+	go func() {
+		if _, err := s.scrubRepository.FindUnfinished(ctx); err == nil {
+			s.logRun(ctx)
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.logRun(ctx)
+			}
+		}
+	}()
+}
+
+// StartScrub triggers an on-demand scrub in the background (admin only)
+func (s *ScrubService) StartScrub(ctx context.Context, adminID uint64) error {
+	if err := s.requireAdmin(ctx, adminID); err != nil {
+		return err
+	}
+	if s.isRunning() {
+		return ErrScrubRunning
+	}
+
+	// detached from the request so it outlives it
+	logging.FromContext(ctx).Info("scrub requested", "admin_id", adminID)
+	go s.logRun(context.WithoutCancel(ctx))
+	return nil
+}
+
+// GetLastReport returns the most recent scrub report (admin only)
+func (s *ScrubService) GetLastReport(ctx context.Context, adminID uint64) (*ScrubReport, error) {
+	if err := s.requireAdmin(ctx, adminID); err != nil {
+		return nil, err
+	}
+
+	report, err := s.scrubRepository.FindLatest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scrub report: %w", err)
+	}
+	return report, nil
+}
+
+// logRun runs a background scrub, which has no caller to hand its result to
+func (s *ScrubService) logRun(ctx context.Context) {
+	logger := logging.FromContext(ctx)
+	report, err := s.Run(ctx)
+	switch {
+	case errors.Is(err, ErrScrubRunning):
+		logger.Debug("skipped scrub, one is already running")
+	case err != nil && ctx.Err() != nil:
+		logger.Info("scrub interrupted, it resumes on the next run")
+	case err != nil:
+		logger.Error("scrub failed", "error", err)
+	default:
+		logger.Info("scrub completed", "report_id", report.ID, "files_checked", report.FilesChecked,
+			"missing", report.Missing, "mismatched", report.Mismatched, "orphaned", report.Orphaned)
+	}
+}
+
+// Run verifies every blob against its recorded hash, then looks for orphans.
+func (s *ScrubService) Run(ctx context.Context) (*ScrubReport, error) {
+	if !s.tryStart() {
+		return nil, ErrScrubRunning
+	}
+	defer s.finish()
+
+	report, err := s.scrubRepository.FindUnfinished(ctx)
+	if err != nil {
+		if !errors.Is(err, ErrScrubNotFound) {
+			return nil, fmt.Errorf("failed to load scrub state: %w", err)
+		}
+		report = &ScrubReport{Status: ScrubRunning, StartedAt: time.Now()}
+		if err = s.scrubRepository.Save(ctx, report); err != nil {
+			return nil, fmt.Errorf("failed to create scrub report: %w", err)
+		}
+	}
+
+	if err = s.verifyBlobs(ctx, report); err == nil {
+		err = s.findOrphans(ctx, report)
+	}
+
+	if err != nil {
+		// a cancelled scrub stays "running" so the next run resumes it
+		if ctx.Err() != nil {
+			return report, err
+		}
+		report.Status = ScrubFailed
+		report.Error = err.Error()
+	} else {
+		report.Status = ScrubCompleted
+	}
+
+	now := time.Now()
+	report.FinishedAt = &now
+	if saveErr := s.scrubRepository.Save(context.WithoutCancel(ctx), report); saveErr != nil {
+		return report, fmt.Errorf("failed to save scrub report: %w", saveErr)
+	}
+	return report, err
+}
+
+func (s *ScrubService) verifyBlobs(ctx context.Context, report *ScrubReport) error {
+	for {
+		blobs, err := s.blobRepository.FindAfterID(ctx, report.LastBlobID, scrubBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(blobs) == 0 {
+			return nil
+		}
+
+		for _, blob := range blobs {
+			if err = s.verifyBlob(ctx, report, blob); err != nil {
+				return err
+			}
+
+			// checkpoint after each blob so an interrupted scrub resumes without
+			// verifying any twice
+			report.LastBlobID = blob.ID
+			if err = s.scrubRepository.Save(ctx, report); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *ScrubService) verifyBlob(ctx context.Context, report *ScrubReport, blob *Blob) error {
+	fullPath := s.fileService.GetFullPath(blob.Path)
+
+	file, err := os.Open(fullPath)
+	if os.IsNotExist(err) {
+		report.Missing++
+		return s.addIssue(ctx, report, ScrubIssueMissing, &blob.ID, blob.Path, blob.Hash, "")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", blob.Path, err)
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	n, err := io.Copy(hasher, newThrottledReader(ctx, file, s.bytesPerSecond))
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", blob.Path, err)
+	}
+
+	report.FilesChecked++
+	report.BytesChecked += n
+
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != blob.Hash {
+		report.Mismatched++
+		return s.addIssue(ctx, report, ScrubIssueMismatch, &blob.ID, blob.Path, blob.Hash, actual)
+	}
+	return nil
+}
+
+// findOrphans reports blob records nothing references and files on disk with no record,
+// leaving out files written within orphanGracePeriod
+func (s *ScrubService) findOrphans(ctx context.Context, report *ScrubReport) error {
+	unreferenced, err := s.blobRepository.FindOrphaned(ctx)
+	if err != nil {
+		return err
+	}
+	for _, blob := range unreferenced {
+		report.Orphaned++
+		if err = s.addIssue(ctx, report, ScrubIssueOrphaned, &blob.ID, blob.Path, blob.Hash, ""); err != nil {
+			return err
+		}
+	}
+
+	files, err := s.fileService.ListBlobFiles()
+	if err != nil {
+		return err
+	}
+	for _, fullPath := range files {
+		info, err := os.Stat(fullPath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if time.Since(info.ModTime()) < orphanGracePeriod {
+			continue
+		}
+
+		base := filepath.Base(fullPath)
+		hash := strings.TrimSuffix(base, filepath.Ext(base))
+
+		// the same content under another name, such as the upload a FLAC blob was made
+		// from, is no blob's file either
+		blob, err := s.blobRepository.FindByHash(ctx, hash)
+		if err == nil && s.fileService.GetFullPath(blob.Path) == fullPath {
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrBlobNotFound) {
+			return err
+		}
+
+		relativePath, relErr := s.fileService.GetRelativePath(fullPath)
+		if relErr != nil {
+			relativePath = fullPath
+		}
+		report.Orphaned++
+		if err = s.addIssue(ctx, report, ScrubIssueOrphaned, nil, relativePath, "", ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ScrubService) addIssue(
+	ctx context.Context, report *ScrubReport, kind ScrubIssueKind, blobID *uint64, path, expected, actual string,
+) error {
+	issue := &ScrubIssue{
+		ReportID:     report.ID,
+		Kind:         kind,
+		BlobID:       blobID,
+		Path:         path,
+		ExpectedHash: expected,
+		ActualHash:   actual,
+	}
+	if err := s.scrubRepository.AddIssue(ctx, issue); err != nil {
+		return fmt.Errorf("failed to record scrub issue: %w", err)
+	}
+	return nil
+}
+
+func (s *ScrubService) requireAdmin(ctx context.Context, userID uint64) error {
+	user, err := s.userRepository.FindByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("user not found: %w", err)
+	}
+	if !user.IsAdmin {
+		return ErrAdminOnly
+	}
+	return nil
+}
+
+func (s *ScrubService) tryStart() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return false
+	}
+	s.running = true
+	return true
+}
+
+func (s *ScrubService) finish() {
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+}
+
+func (s *ScrubService) isRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+// throttledReader caps read throughput so a scrub doesn't starve streaming of IO
+type throttledReader struct {
+	ctx            context.Context
+	r              io.Reader
+	bytesPerSecond int64
+	start          time.Time
+	read           int64
+}
+
+func newThrottledReader(ctx context.Context, r io.Reader, bytesPerSecond int64) io.Reader {
+	if bytesPerSecond <= 0 {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, bytesPerSecond: bytesPerSecond, start: time.Now()}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if err := t.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// never read more than a tenth of a second's budget at once
+	if limit := t.bytesPerSecond / 10; limit > 0 && int64(len(p)) > limit {
+		p = p[:limit]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	expected := time.Duration(float64(t.read) / float64(t.bytesPerSecond) * float64(time.Second))
+	if wait := expected - time.Since(t.start); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		}
+	}
+	return n, err
+}
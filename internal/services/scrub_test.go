@@ -0,0 +1,216 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"vinyl-vault/internal/services"
+)
+
+func TestScrubService_Run(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.user(t, "alice")
+	album := f.album(t, user.ID, "Ege Bamyasi")
+
+	good := f.blob(t, user.ID, "good", ".flac")
+	missing := f.blob(t, user.ID, "missing", ".flac")
+	tampered := f.blob(t, user.ID, "tampered", ".flac")
+	unreferenced := f.blob(t, user.ID, "unreferenced", ".jpg")
+	for i, blob := range []*services.Blob{good, missing, tampered} {
+		f.track(t, album.ID, i+1, blob)
+	}
+	if err := os.Remove(f.files.GetFullPath(missing.Path)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(f.files.GetFullPath(tampered.Path), []byte("bit rot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stray, err := f.files.WriteBlob(strings.NewReader("stray"), ".mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	strayPath, err := f.files.GetRelativePath(stray.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+	if err = os.Chtimes(stray.Path, lastWeek, lastWeek); err != nil {
+		t.Fatal(err)
+	}
+	// a file this new may be an upload whose blob record isn't saved yet
+	if _, err = f.files.WriteBlob(strings.NewReader("in flight"), ".mp3"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := services.NewScrubService(f.scrubs, f.blobs, f.users, f.files, 0).Run(ctx)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if report.Status != services.ScrubCompleted || report.FinishedAt == nil {
+		t.Errorf("Run() status = %s, finished %v; want completed", report.Status, report.FinishedAt)
+	}
+	if report.FilesChecked != 3 || report.BytesChecked != int64(len("good")+len("bit rot")+len("unreferenced")) {
+		t.Errorf("Run() checked %d files, %d bytes; want 3 files, %d bytes",
+			report.FilesChecked, report.BytesChecked, len("good")+len("bit rot")+len("unreferenced"))
+	}
+	if report.Missing != 1 || report.Mismatched != 1 || report.Orphaned != 2 {
+		t.Errorf("Run() = %d missing, %d mismatched, %d orphaned; want 1, 1, 2",
+			report.Missing, report.Mismatched, report.Orphaned)
+	}
+
+	latest, err := f.scrubs.FindLatest(ctx)
+	if err != nil {
+		t.Fatalf("FindLatest() error = %v", err)
+	}
+	want := []string{
+		"missing " + missing.Path,
+		"checksum_mismatch " + tampered.Path,
+		"orphaned " + unreferenced.Path,
+		"orphaned " + strayPath,
+	}
+	if got := issues(latest); !slices.Equal(got, want) {
+		t.Errorf("FindLatest().Issues = %v, want %v", got, want)
+	}
+	for _, issue := range latest.Issues {
+		if issue.Kind == services.ScrubIssueMismatch && (issue.ExpectedHash != tampered.Hash || issue.ActualHash == tampered.Hash) {
+			t.Errorf("mismatch issue hashes = %s, %s; want expected %s and the actual one", issue.ExpectedHash, issue.ActualHash, tampered.Hash)
+		}
+	}
+}
+
+func TestScrubService_RunCheckpointsEachBlob(t *testing.T) {
+	f := newFixture(t)
+	user := f.user(t, "alice")
+	album := f.album(t, user.ID, "Tago Mago")
+	var blobIDs []uint64
+	for i, content := range []string{"one", "two", "three"} {
+		blob := f.blob(t, user.ID, content, ".flac")
+		f.track(t, album.ID, i+1, blob)
+		blobIDs = append(blobIDs, blob.ID)
+	}
+
+	scrubs := &checkpointRecorder{ScrubRepository: f.scrubs}
+	if _, err := services.NewScrubService(scrubs, f.blobs, f.users, f.files, 0).Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// the report is created, saved after every blob, then finished
+	want := append(append([]uint64{0}, blobIDs...), blobIDs[2])
+	if !slices.Equal(scrubs.checkpoints, want) {
+		t.Errorf("Run() saved the report at blobs %v, want %v", scrubs.checkpoints, want)
+	}
+}
+
+func TestScrubService_RunResumes(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.user(t, "alice")
+	album := f.album(t, user.ID, "Future Days")
+
+	verified := f.blob(t, user.ID, "verified", ".flac")
+	missing := f.blob(t, user.ID, "missing", ".flac")
+	unchecked := f.blob(t, user.ID, "unchecked", ".flac")
+	for i, blob := range []*services.Blob{verified, missing, unchecked} {
+		f.track(t, album.ID, i+1, blob)
+	}
+	if err := os.Remove(f.files.GetFullPath(missing.Path)); err != nil {
+		t.Fatal(err)
+	}
+	// a change after its check goes unnoticed until the next scrub
+	if err := os.WriteFile(f.files.GetFullPath(verified.Path), []byte("bit rot"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// interrupted after recording the missing blob but before checkpointing it
+	interrupted := &services.ScrubReport{
+		Status: services.ScrubRunning, StartedAt: time.Now().Add(-time.Hour),
+		LastBlobID: verified.ID, FilesChecked: 1, BytesChecked: int64(len("verified")),
+	}
+	if err := f.scrubs.Save(ctx, interrupted); err != nil {
+		t.Fatal(err)
+	}
+	err := f.scrubs.AddIssue(ctx, &services.ScrubIssue{
+		ReportID: interrupted.ID, Kind: services.ScrubIssueMissing, BlobID: &missing.ID, Path: missing.Path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := services.NewScrubService(f.scrubs, f.blobs, f.users, f.files, 0).Run(ctx)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if report.ID != interrupted.ID || report.Status != services.ScrubCompleted {
+		t.Errorf("Run() = report %d %s, want report %d completed", report.ID, report.Status, interrupted.ID)
+	}
+	if report.FilesChecked != 2 || report.Missing != 1 || report.Mismatched != 0 {
+		t.Errorf("Run() = %d checked, %d missing, %d mismatched; want 2, 1, 0",
+			report.FilesChecked, report.Missing, report.Mismatched)
+	}
+	latest, err := f.scrubs.FindLatest(ctx)
+	if err != nil {
+		t.Fatalf("FindLatest() error = %v", err)
+	}
+	if got, want := issues(latest), []string{"missing " + missing.Path}; !slices.Equal(got, want) {
+		t.Errorf("FindLatest().Issues = %v, want %v", got, want)
+	}
+}
+
+func TestScrubService_RunThrottled(t *testing.T) {
+	f := newFixture(t)
+	user := f.user(t, "alice")
+	album := f.album(t, user.ID, "Soon Over Babaluma")
+	f.track(t, album.ID, 1, f.blob(t, user.ID, strings.Repeat("x", 4000), ".flac"))
+
+	scrubService := services.NewScrubService(f.scrubs, f.blobs, f.users, f.files, 20000)
+
+	t.Run("reads at the configured rate", func(t *testing.T) {
+		start := time.Now()
+		if _, err := scrubService.Run(context.Background()); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		// 4000 bytes at 20000 bytes per second
+		if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+			t.Errorf("Run() took %v, want about 200ms", elapsed)
+		}
+	})
+
+	t.Run("a cancelled scrub is left to resume", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		report, err := scrubService.Run(ctx)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Run() error = %v, want context.Canceled", err)
+		}
+		if unfinished, err := f.scrubs.FindUnfinished(context.Background()); err != nil || unfinished.ID != report.ID {
+			t.Errorf("FindUnfinished() = %+v, %v; want report %d", unfinished, err, report.ID)
+		}
+	})
+}
+
+// checkpointRecorder notes the resume cursor of every saved report
+type checkpointRecorder struct {
+	services.ScrubRepository
+	checkpoints []uint64
+}
+
+func (r *checkpointRecorder) Save(ctx context.Context, report *services.ScrubReport) error {
+	r.checkpoints = append(r.checkpoints, report.LastBlobID)
+	return r.ScrubRepository.Save(ctx, report)
+}
+
+func issues(report *services.ScrubReport) []string {
+	var issues []string
+	for _, issue := range report.Issues {
+		issues = append(issues, string(issue.Kind)+" "+issue.Path)
+	}
+	return issues
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// AlbumQuery filters a user's albums. Every word of Text has to appear, ignoring case, in
+// one of the album's fields: artist, title, label, country, catalog number, barcode,
+// pressing plant, matrix etchings, edition notes, genres, styles, track titles or credited
+// names. Catalog numbers, barcodes and etchings also match with spaces and dashes left out.
+// Genre and Style must equal one of the album's, and Credit must appear in a credited name.
+type AlbumQuery struct {
+	Text   string
+	Genre  string
+	Style  string
+	Credit string
+}
+
+// SearchAlbums returns the user's albums matching query, in the order of GetAlbumsByUser.
+// Albums are matched here rather than in the repository, as lists and credits are stored
+// as JSON that the databases would search differently.
+func (a *AlbumService) SearchAlbums(ctx context.Context, userID uint64, query AlbumQuery) ([]*Album, error) {
+	if strings.TrimSpace(query.Text+query.Genre+query.Style+query.Credit) == "" {
+		return nil, NewValidationError("q", "give some text, a genre, a style or a credit to search for")
+	}
+	albums, err := a.albumRepository.FindByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search albums: %w", err)
+	}
+
+	matches := make([]*Album, 0)
+	for _, album := range albums {
+		if query.matches(album) {
+			matches = append(matches, album)
+		}
+	}
+	return matches, nil
+}
+
+func (q AlbumQuery) matches(album *Album) bool {
+	metadata := &album.Metadata
+	if q.Genre != "" && !containsFold(metadata.Genres, q.Genre) {
+		return false
+	}
+	if q.Style != "" && !containsFold(metadata.Styles, q.Style) {
+		return false
+	}
+	if q.Credit != "" && !slices.ContainsFunc(creditedNames(album), func(name string) bool {
+		return strings.Contains(strings.ToLower(name), strings.ToLower(strings.TrimSpace(q.Credit)))
+	}) {
+		return false
+	}
+
+	fields := []string{metadata.Artist, metadata.Album, metadata.PressingPlant, metadata.EditionNotes}
+	if metadata.Label != nil {
+		fields = append(fields, *metadata.Label)
+	}
+	if metadata.Country != nil {
+		fields = append(fields, *metadata.Country)
+	}
+	fields = append(fields, metadata.Genres...)
+	fields = append(fields, metadata.Styles...)
+	for _, track := range album.Tracks {
+		fields = append(fields, track.Title)
+	}
+	fields = append(fields, creditedNames(album)...)
+	codes := []string{metadata.CatalogNumber, metadata.Barcode}
+	for _, matrix := range metadata.Matrix {
+		codes = append(codes, matrix.Etching)
+	}
+
+	for _, word := range strings.Fields(strings.ToLower(q.Text)) {
+		compact := compactCode(word)
+		found := slices.ContainsFunc(fields, func(field string) bool {
+			return strings.Contains(strings.ToLower(field), word)
+		}) || compact != "" && slices.ContainsFunc(codes, func(code string) bool {
+			return strings.Contains(compactCode(code), compact)
+		})
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func creditedNames(album *Album) []string {
+	var names []string
+	for _, track := range album.Tracks {
+		for _, credit := range track.Credits {
+			names = append(names, credit.Name)
+		}
+	}
+	return names
+}
+
+func containsFold(values []string, value string) bool {
+	return slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, strings.TrimSpace(value)) })
+}
+
+// compactCode lowercases a catalog number, barcode or etching and drops what people
+// write differently, so "SHVL 798" matches "shvl-798"
+func compactCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '-' || r == '.' || r == '/' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, code)
+}
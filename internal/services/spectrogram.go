@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"vinyl-vault/internal/config"
+	"vinyl-vault/internal/logging"
+)
+
+// SpectrogramScale lays out the frequency axis of a spectrogram
+type SpectrogramScale string
+
+const (
+	ScaleLog    SpectrogramScale = "log" // 20 Hz to Nyquist, each octave the same height
+	ScaleLinear SpectrogramScale = "linear"
+)
+
+const (
+	minFFTSize = 256
+	maxFFTSize = 32768
+
+	spectrogramMinFreq = 20.0   // Hz at the bottom of a log axis
+	spectrogramFloor   = -120.0 // dBFS drawn black; 0 dBFS is white
+)
+
+// spectrogramPalette runs from silence to full scale
+var spectrogramPalette = []color.RGBA{
+	{0, 0, 0, 255},
+	{40, 10, 90, 255},
+	{150, 20, 120, 255},
+	{230, 80, 40, 255},
+	{255, 200, 40, 255},
+	{255, 255, 255, 255},
+}
+
+// SpectrogramOptions choose how a spectrogram is drawn; zero values take the
+// service's defaults
+type SpectrogramOptions struct {
+	FFTSize int
+	Scale   SpectrogramScale
+}
+
+// ParseSpectrogramOptions reads the fft_size and scale parameters of a spectrogram
+// request, either of which may be empty
+func ParseSpectrogramOptions(fftSize, scale string) (SpectrogramOptions, error) {
+	var opts SpectrogramOptions
+	if fftSize != "" {
+		n, err := strconv.Atoi(fftSize)
+		if err != nil || n < minFFTSize || n > maxFFTSize || n&(n-1) != 0 {
+			return opts, NewValidationError("fft_size", fmt.Sprintf("must be a power of two from %d to %d", minFFTSize, maxFFTSize))
+		}
+		opts.FFTSize = n
+	}
+	switch opts.Scale = SpectrogramScale(strings.ToLower(scale)); opts.Scale {
+	case "", ScaleLog, ScaleLinear:
+		return opts, nil
+	}
+	return opts, NewValidationError("scale", "must be log or linear")
+}
+
+// SpectrogramService draws spectrograms of tracks as PNGs, keeping each in the cache
+// dir so it is only drawn once. The images are named after the blob's content, so
+// they never go stale, and the cache can be cleared at any time.
+type SpectrogramService struct {
+	fileService       *FileService
+	conversionService *ConversionService
+	cacheDir          string
+	fftSize           int
+	width             int
+	height            int
+}
+
+func NewSpectrogramService(fileService *FileService, conversionService *ConversionService, cacheDir string) *SpectrogramService {
+	return &SpectrogramService{
+		fileService:       fileService,
+		conversionService: conversionService,
+		cacheDir:          filepath.Join(cacheDir, "spectrograms"),
+		fftSize:           4096,
+		width:             1024,
+		height:            512,
+	}
+}
+
+func NewSpectrogramServiceWithConfig(cfg *config.Config, fileService *FileService, conversionService *ConversionService) *SpectrogramService {
+	return &SpectrogramService{
+		fileService:       fileService,
+		conversionService: conversionService,
+		cacheDir:          filepath.Join(cfg.Storage.CachePath(), "spectrograms"),
+		fftSize:           cfg.Spectrogram.FFTSize,
+		width:             cfg.Spectrogram.Width,
+		height:            cfg.Spectrogram.Height,
+	}
+}
+
+// Render returns the path of the track's spectrogram, drawing it if it isn't cached
+func (s *SpectrogramService) Render(ctx context.Context, track *Track, opts SpectrogramOptions) (string, error) {
+	if track.IsStub() || track.Blob == nil {
+		return "", fmt.Errorf("track %d has no audio: %w", track.ID, ErrFileNotFound)
+	}
+	if opts.FFTSize == 0 {
+		opts.FFTSize = s.fftSize
+	}
+	if opts.Scale == "" {
+		opts.Scale = ScaleLog
+	}
+
+	name := fmt.Sprintf("%s-%d-%d-%d-%s-%dx%d.png", track.Blob.Hash, track.StartSample, track.EndSample,
+		opts.FFTSize, opts.Scale, s.width, s.height)
+	path := filepath.Join(s.cacheDir, name)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	pcm, err := s.conversionService.OpenPCM(ctx, s.fileService.GetFullPath(track.Blob.Path), track.StartSample, track.EndSample)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode track %d: %w", track.ID, err)
+	}
+	defer pcm.Close()
+	if pcm.Channels <= 0 || pcm.SampleRate <= 0 {
+		return "", fmt.Errorf("track %d has %d channels at %d Hz", track.ID, pcm.Channels, pcm.SampleRate)
+	}
+	sg := newSpectrogram(pcm.SampleRate, pcm.Channels, opts.FFTSize, s.width, s.height, opts.Scale)
+	if err = pcm.feed(sg.Add); err != nil {
+		return "", fmt.Errorf("failed to decode track %d: %w", track.ID, err)
+	}
+
+	// written aside and renamed into place, so a request drawing the same image at the
+	// same time never serves half of one
+	if err = os.MkdirAll(s.cacheDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create spectrogram cache: %w", err)
+	}
+	file, err := os.CreateTemp(s.cacheDir, "*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create spectrogram: %w", err)
+	}
+	defer os.Remove(file.Name())
+	err = png.Encode(file, sg.Image())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write spectrogram: %w", err)
+	}
+	logging.FromContext(ctx).Info("spectrogram drawn", "track_id", track.ID, "fft_size", opts.FFTSize, "scale", opts.Scale)
+	return path, nil
+}
+
+// spectrogram draws the audio fed to it by Add. It keeps at most twice its width in
+// columns, averaging neighbours together when more arrive, so it needs no idea of
+// the length of the audio beforehand.
+type spectrogram struct {
+	channels int
+	width    int
+	spectrum *spectrumAnalyzer
+	hop      int       // samples between the starts of FFT frames, which overlap by half
+	frame    []float64 // the mono samples of the frame being filled
+	power    []float64
+	rows     [][2]int // the bins of each row, from the bottom
+
+	columns   [][]float32 // the power of each row, oldest column first
+	column    []float64   // the sums of the column being filled
+	spectra   int         // summed into column
+	perColumn int         // spectra to a column
+}
+
+func newSpectrogram(sampleRate, channels, fftSize, width, height int, scale SpectrogramScale) *spectrogram {
+	sg := &spectrogram{
+		channels:  channels,
+		width:     width,
+		spectrum:  newSpectrumAnalyzer(fftSize),
+		hop:       fftSize / 2,
+		frame:     make([]float64, 0, fftSize),
+		power:     make([]float64, fftSize/2+1),
+		column:    make([]float64, height),
+		perColumn: 1,
+	}
+
+	nyquist := float64(sampleRate) / 2
+	binWidth := float64(sampleRate) / float64(fftSize)
+	bins := fftSize/2 + 1
+	for r := range height {
+		lo, hi := float64(r)/float64(height), float64(r+1)/float64(height)
+		if scale == ScaleLog {
+			lo = spectrogramMinFreq * math.Pow(nyquist/spectrogramMinFreq, lo)
+			hi = spectrogramMinFreq * math.Pow(nyquist/spectrogramMinFreq, hi)
+		} else {
+			lo, hi = lo*nyquist, hi*nyquist
+		}
+		from := min(int(math.Round(lo/binWidth)), bins-1)
+		to := min(max(int(math.Round(hi/binWidth)), from+1), bins)
+		sg.rows = append(sg.rows, [2]int{from, to})
+	}
+	return sg
+}
+
+// Add draws interleaved samples, whole frames of them
+func (sg *spectrogram) Add(samples []float64) {
+	for i := 0; i+sg.channels <= len(samples); i += sg.channels {
+		var mono float64
+		for _, x := range samples[i : i+sg.channels] {
+			mono += x
+		}
+		sg.frame = append(sg.frame, mono/float64(sg.channels))
+		if len(sg.frame) == cap(sg.frame) {
+			sg.addFrame()
+			sg.frame = sg.frame[:copy(sg.frame, sg.frame[sg.hop:])]
+		}
+	}
+}
+
+// addFrame sums the spectrum of the full frame into the column being filled
+func (sg *spectrogram) addFrame() {
+	sg.spectrum.power(sg.frame, sg.power)
+	// the loudest bin of each row, so that tones show up however many bins a row spans
+	for r, bins := range sg.rows {
+		sg.column[r] += slices.Max(sg.power[bins[0]:bins[1]])
+	}
+	if sg.spectra++; sg.spectra == sg.perColumn {
+		sg.endColumn()
+	}
+}
+
+func (sg *spectrogram) endColumn() {
+	column := make([]float32, len(sg.column))
+	for r, sum := range sg.column {
+		column[r] = float32(sum / float64(sg.spectra))
+		sg.column[r] = 0
+	}
+	sg.columns = append(sg.columns, column)
+	sg.spectra = 0
+
+	if len(sg.columns) == 2*sg.width {
+		for i := range sg.width {
+			a, b := sg.columns[2*i], sg.columns[2*i+1]
+			for r := range a {
+				a[r] = (a[r] + b[r]) / 2
+			}
+			sg.columns[i] = a
+		}
+		sg.columns = sg.columns[:sg.width]
+		sg.perColumn *= 2
+	}
+}
+
+// Image draws what was added, time running left to right over the full width and
+// frequency upwards
+func (sg *spectrogram) Image() image.Image {
+	// audio shorter than a frame is drawn from that one frame, padded with silence
+	if len(sg.columns) == 0 && sg.spectra == 0 && len(sg.frame) > 0 {
+		n := len(sg.frame)
+		sg.frame = sg.frame[:cap(sg.frame)]
+		clear(sg.frame[n:])
+		sg.addFrame()
+	}
+	if sg.spectra > 0 {
+		sg.endColumn()
+	}
+
+	height := len(sg.rows)
+	img := image.NewRGBA(image.Rect(0, 0, sg.width, height))
+	n := len(sg.columns)
+	if n == 0 {
+		return img
+	}
+	level := make([]float64, height)
+	for x := range sg.width {
+		from := x * n / sg.width
+		to := max((x+1)*n/sg.width, from+1)
+		clear(level)
+		for _, column := range sg.columns[from:to] {
+			for r, p := range column {
+				level[r] += float64(p)
+			}
+		}
+		for r, sum := range level {
+			img.SetRGBA(x, height-1-r, spectrogramColor(sum/float64(to-from)))
+		}
+	}
+	return img
+}
+
+// spectrogramColor picks the colour of power, 1 being that of a full-scale sine
+func spectrogramColor(power float64) color.RGBA {
+	db := 10 * math.Log10(power+1e-30)
+	t := min(max((db-spectrogramFloor)/-spectrogramFloor, 0), 1) * float64(len(spectrogramPalette)-1)
+	i := min(int(t), len(spectrogramPalette)-2)
+	a, b, f := spectrogramPalette[i], spectrogramPalette[i+1], t-float64(i)
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*f))
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"vinyl-vault/internal/services/audiotest"
+)
+
+// brightness is the sum of a pixel's channels
+func brightness(img image.Image, x, y int) int {
+	r, g, b, _ := img.At(x, y).RGBA()
+	return int(r>>8 + g>>8 + b>>8)
+}
+
+// spectrogramRow is the y of the row frequency is drawn in
+func spectrogramRow(sampleRate, height int, scale SpectrogramScale, frequency float64) int {
+	nyquist := float64(sampleRate) / 2
+	position := frequency / nyquist
+	if scale == ScaleLog {
+		position = math.Log(frequency/spectrogramMinFreq) / math.Log(nyquist/spectrogramMinFreq)
+	}
+	return height - 1 - int(position*float64(height))
+}
+
+func TestParseSpectrogramOptions(t *testing.T) {
+	tests := []struct {
+		fftSize, scale string
+		want           SpectrogramOptions
+		field          string
+	}{
+		{"", "", SpectrogramOptions{}, ""},
+		{"1024", "LINEAR", SpectrogramOptions{FFTSize: 1024, Scale: ScaleLinear}, ""},
+		{"32768", "log", SpectrogramOptions{FFTSize: 32768, Scale: ScaleLog}, ""},
+		{"1000", "", SpectrogramOptions{}, "fft_size"},
+		{"128", "", SpectrogramOptions{}, "fft_size"},
+		{"65536", "", SpectrogramOptions{}, "fft_size"},
+		{"", "mel", SpectrogramOptions{}, "scale"},
+	}
+	for _, tt := range tests {
+		got, err := ParseSpectrogramOptions(tt.fftSize, tt.scale)
+		var validationErr *ValidationError
+		switch {
+		case tt.field != "" && (!errors.As(err, &validationErr) || validationErr.Field != tt.field):
+			t.Errorf("ParseSpectrogramOptions(%q, %q) error = %v, want one on %s", tt.fftSize, tt.scale, err, tt.field)
+		case tt.field == "" && (err != nil || got != tt.want):
+			t.Errorf("ParseSpectrogramOptions(%q, %q) = %+v, %v; want %+v", tt.fftSize, tt.scale, got, err, tt.want)
+		}
+	}
+}
+
+func TestSpectrogram(t *testing.T) {
+	const width, height = 200, 256
+	tests := []struct {
+		name       string
+		sampleRate int
+		fftSize    int
+		scale      SpectrogramScale
+		samples    func(rate int) []float64
+		bright     []float64 // frequencies drawn bright all along
+		dark       []float64 // and dark
+	}{
+		{
+			name: "sine log", sampleRate: 48000, fftSize: 4096, scale: ScaleLog,
+			samples: func(rate int) []float64 { return sine(rate, 3, -6, 1000, 0) },
+			bright:  []float64{1000},
+			dark:    []float64{100, 5000, 20000},
+		},
+		{
+			name: "sine linear", sampleRate: 48000, fftSize: 1024, scale: ScaleLinear,
+			samples: func(rate int) []float64 { return sine(rate, 3, -6, 12000, 0) },
+			bright:  []float64{12000},
+			dark:    []float64{3000, 20000},
+		},
+		{
+			// the cutoff of a lossy source, which is what the images are looked at for
+			name: "cutoff", sampleRate: 44100, fftSize: 2048, scale: ScaleLinear,
+			samples: func(rate int) []float64 { return tones(rate, 2, 16000) },
+			bright:  []float64{2000, 10000, 15500},
+			dark:    []float64{17500, 21000},
+		},
+		{
+			name: "shorter than a frame", sampleRate: 44100, fftSize: 8192, scale: ScaleLog,
+			samples: func(rate int) []float64 { return sine(rate, 0.1, -6, 1000, 0) },
+			bright:  []float64{1000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sg := newSpectrogram(tt.sampleRate, 2, tt.fftSize, width, height, tt.scale)
+			samples := tt.samples(tt.sampleRate)
+			for len(samples) > 0 {
+				n := min(len(samples), 2*1021)
+				sg.Add(samples[:n])
+				samples = samples[n:]
+			}
+			img := sg.Image()
+			if size := img.Bounds().Size(); size != image.Pt(width, height) {
+				t.Fatalf("Image() size = %v, want %dx%d", size, width, height)
+			}
+
+			for _, x := range []int{0, width / 2, width - 1} {
+				for _, f := range tt.bright {
+					if b := brightness(img, x, spectrogramRow(tt.sampleRate, height, tt.scale, f)); b < 150 {
+						t.Errorf("%g Hz at x = %d has brightness %d, want it bright", f, x, b)
+					}
+				}
+				for _, f := range tt.dark {
+					if b := brightness(img, x, spectrogramRow(tt.sampleRate, height, tt.scale, f)); b > 100 {
+						t.Errorf("%g Hz at x = %d has brightness %d, want it dark", f, x, b)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSpectrogramService_Render(t *testing.T) {
+	dir := t.TempDir()
+	fileService := NewFileService(dir, filepath.Join(dir, "covers"), filepath.Join(dir, "audio"))
+	cd := audiotest.Stereo16(44100)
+	audiotest.WriteFile(t, filepath.Join(dir, "track.wav"), audiotest.WAV(cd, 2*44100, audiotest.Sine(cd, 1000, -6)))
+	service := NewSpectrogramService(fileService, NewConversionService(dir), filepath.Join(dir, "cache"))
+	track := &Track{ID: 1, Title: "Sine", BlobID: new(uint64), Blob: &Blob{Hash: "0123abcd", Path: "track.wav"}}
+
+	path, err := service.Render(context.Background(), track, SpectrogramOptions{})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := png.DecodeConfig(file)
+	file.Close()
+	if err != nil || config.Width != 1024 || config.Height != 512 {
+		t.Errorf("Render() drew %+v, %v; want a 1024x512 PNG", config, err)
+	}
+
+	// served from the cache, which no longer needs the audio
+	if err = os.Remove(filepath.Join(dir, "track.wav")); err != nil {
+		t.Fatal(err)
+	}
+	if cached, err := service.Render(context.Background(), track, SpectrogramOptions{}); err != nil || cached != path {
+		t.Errorf("Render() again = %q, %v; want the cached %q", cached, err, path)
+	}
+	if _, err = service.Render(context.Background(), track, SpectrogramOptions{FFTSize: 1024}); err == nil {
+		t.Error("Render() with another FFT size = nil error, want it drawn again from the missing audio")
+	}
+
+	if _, err = service.Render(context.Background(), &Track{ID: 2, Title: "Stub"}, SpectrogramOptions{}); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("Render() of a stub error = %v, want ErrFileNotFound", err)
+	}
+}
@@ -0,0 +1,441 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+	"vinyl-vault/internal/logging"
+)
+
+// SplitPoint marks where a track begins in a side-long recording. It ends where
+// the next one begins, the last at the end of the recording.
+type SplitPoint struct {
+	Title string
+	Start time.Duration
+}
+
+type SplitOptions struct {
+	DiscNumber       int    // 0 is the first disc
+	Side             string // the side the recording is of, e.g. A
+	FirstTrackNumber int    // 0 continues after the last track on the side
+	Materialize      bool   // cut each track into a file of its own instead of referencing ranges
+}
+
+// SplitService turns one recording of a whole vinyl side into several tracks, and
+// cuts those tracks back out of it for playback and download
+type SplitService struct {
+	trackRepository   TrackRepository
+	albumRepository   AlbumRepository
+	blobService       *BlobService
+	fileService       *FileService
+	conversionService *ConversionService
+	analysisQueue     AnalysisQueue
+}
+
+func NewSplitService(
+	trackRepository TrackRepository, albumRepository AlbumRepository,
+	blobService *BlobService, fileService *FileService, conversionService *ConversionService,
+) *SplitService {
+	return &SplitService{
+		trackRepository:   trackRepository,
+		albumRepository:   albumRepository,
+		blobService:       blobService,
+		fileService:       fileService,
+		conversionService: conversionService,
+	}
+}
+
+// SetAnalysisQueue has the tracks of each split analyzed once they are saved
+func (s *SplitService) SetAnalysisQueue(queue AnalysisQueue) {
+	s.analysisQueue = queue
+}
+
+// trackRange is a span of samples [start, end) and the track it becomes
+type trackRange struct {
+	title      string
+	start, end int64
+}
+
+// Split creates a track per point on the album, all referencing the recording in blob.
+// It takes over the caller's reference to blob, releasing it on failure.
+func (s *SplitService) Split(
+	ctx context.Context, userID, albumID uint64, blob *Blob, points []SplitPoint, opts SplitOptions,
+) (tracks []*Track, err error) {
+	// once the tracks reference the recording, releasing them releases it
+	handedOver := false
+	defer func() {
+		if err != nil && !handedOver {
+			s.blobService.ReleaseBlob(context.WithoutCancel(ctx), userID, blob.ID)
+		}
+	}()
+
+	album, err := s.albumRepository.FindByID(ctx, albumID)
+	if err != nil {
+		return nil, fmt.Errorf("album not found: %w", err)
+	}
+	if album.UserID != userID {
+		return nil, fmt.Errorf("album %d: %w", albumID, ErrNotOwner)
+	}
+
+	path := s.fileService.GetFullPath(blob.Path)
+	info, err := ReadAudioInfo(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFormat, err)
+	}
+	ranges, err := splitRanges(info, points)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkPosition(album, &opts.DiscNumber, &opts.Side); err != nil {
+		return nil, err
+	}
+	number := opts.FirstTrackNumber
+	if number <= 0 {
+		for _, track := range album.Tracks {
+			if track.DiscNumber == opts.DiscNumber && track.Side == opts.Side {
+				number = max(number, track.TrackNumber)
+			}
+		}
+		number++
+	}
+
+	if opts.Materialize {
+		tracks, err = s.materialize(ctx, userID, path, info, ranges)
+	} else {
+		tracks, err = s.reference(ctx, blob, info, ranges)
+		handedOver = err == nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, track := range tracks {
+		track.AlbumID = albumID
+		track.DiscNumber = opts.DiscNumber
+		track.Side = opts.Side
+		track.TrackNumber = number + i
+		if err = s.trackRepository.Save(ctx, track); err != nil {
+			s.discard(ctx, userID, tracks, i)
+			return nil, fmt.Errorf("failed to create track: %w", err)
+		}
+	}
+
+	logging.FromContext(ctx).Info("recording split into tracks",
+		"album_id", albumID, "blob_id", blob.ID, "tracks", len(tracks), "materialized", opts.Materialize)
+	if opts.Materialize {
+		// the tracks have files of their own now, and the recording is no longer needed
+		if releaseErr := s.blobService.ReleaseBlob(ctx, userID, blob.ID); releaseErr != nil {
+			logging.FromContext(ctx).Warn("failed to release split recording", "blob_id", blob.ID, "error", releaseErr)
+		}
+	}
+	for _, track := range tracks {
+		enqueueAnalysis(s.analysisQueue, track.ID)
+	}
+	return tracks, nil
+}
+
+// splitRanges checks the points against the recording and converts them to sample ranges
+func splitRanges(info *AudioInfo, points []SplitPoint) ([]trackRange, error) {
+	if len(points) == 0 {
+		return nil, NewValidationError("points", "at least one split point is required")
+	}
+	if info.SampleRate <= 0 || info.Samples <= 0 {
+		return nil, NewValidationError("audio_file", "recording has no samples")
+	}
+
+	ranges := make([]trackRange, len(points))
+	for i, point := range points {
+		start := samplesAt(point.Start, info.SampleRate)
+		if start >= info.Samples {
+			return nil, NewValidationError("points", fmt.Sprintf("track %d starts after the recording ends", i+1))
+		}
+		if i > 0 && start <= ranges[i-1].start {
+			return nil, NewValidationError("points", fmt.Sprintf("track %d does not start after track %d", i+1, i))
+		}
+		title := point.Title
+		if title == "" {
+			title = fmt.Sprintf("Track %d", i+1)
+		}
+		ranges[i] = trackRange{title: title, start: start}
+		if i > 0 {
+			ranges[i-1].end = start
+		}
+	}
+	ranges[len(ranges)-1].end = info.Samples
+	return ranges, nil
+}
+
+// samplesAt converts a time to a sample offset, rounding to the nearest sample so
+// that CUE times, which are exact in samples at every common rate, land exactly
+func samplesAt(d time.Duration, sampleRate int) int64 {
+	return (int64(d)*int64(sampleRate) + int64(time.Second)/2) / int64(time.Second)
+}
+
+// reference makes tracks that play ranges of the recording. The upload was charged
+// once, so each track carries its share of that charge, and together they hold one
+// blob reference each.
+func (s *SplitService) reference(ctx context.Context, blob *Blob, info *AudioInfo, ranges []trackRange) ([]*Track, error) {
+	if len(ranges) == 1 && ranges[0].start == 0 {
+		return []*Track{{
+			Title: ranges[0].title, BlobID: &blob.ID, Blob: blob,
+			Duration: info.Duration(0, info.Samples), AudioQuality: info.Quality(),
+		}}, nil
+	}
+
+	if err := s.blobService.Retain(ctx, blob.ID, len(ranges)-1); err != nil {
+		return nil, err
+	}
+
+	tracks := make([]*Track, len(ranges))
+	for i, r := range ranges {
+		// shares are measured from the start of the file to the end, so they add up to the blob
+		from, to := r.start, r.end
+		if i == 0 {
+			from = 0
+		}
+		tracks[i] = &Track{
+			Title:        r.title,
+			BlobID:       &blob.ID,
+			Blob:         blob,
+			Duration:     info.Duration(r.start, r.end),
+			AudioQuality: info.Quality(),
+			StartSample:  r.start,
+			EndSample:    r.end,
+			BlobShare:    blob.Size*to/info.Samples - blob.Size*from/info.Samples,
+		}
+	}
+	return tracks, nil
+}
+
+// materialize cuts each range into a file of its own in the blob store
+func (s *SplitService) materialize(ctx context.Context, userID uint64, path string, info *AudioInfo, ranges []trackRange) ([]*Track, error) {
+	tracks := make([]*Track, 0, len(ranges))
+	for _, r := range ranges {
+		blob, err := s.storeRange(ctx, userID, path, info, r.start, r.end)
+		if err != nil {
+			s.discard(ctx, userID, tracks, 0)
+			return nil, err
+		}
+		tracks = append(tracks, &Track{
+			Title:        r.title,
+			BlobID:       &blob.ID,
+			Blob:         blob,
+			Duration:     info.Duration(r.start, r.end),
+			AudioQuality: info.Quality(),
+		})
+	}
+	return tracks, nil
+}
+
+// storeRange writes the samples [start, end) of the recording to the blob store. The
+// pieces replace the recording they were cut from, so they are not checked against
+// the quota a second time.
+func (s *SplitService) storeRange(ctx context.Context, userID uint64, path string, info *AudioInfo, start, end int64) (*Blob, error) {
+	audio, err := s.openRange(ctx, path, info, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer audio.Close()
+
+	result, err := s.fileService.WriteBlob(audio, filepath.Ext(path))
+	if err != nil {
+		return nil, err
+	}
+	return s.blobService.Acquire(ctx, userID, result)
+}
+
+// discard undoes a failed split: it deletes the tracks saved before the first unsaved
+// one and releases the audio of them all
+func (s *SplitService) discard(ctx context.Context, userID uint64, tracks []*Track, saved int) {
+	ctx = context.WithoutCancel(ctx)
+	for i, track := range tracks {
+		if i < saved {
+			s.trackRepository.Purge(ctx, track.ID)
+		}
+		releaseTrackAudio(ctx, s.blobService, userID, track)
+	}
+}
+
+// OpenTrackAudio cuts a split track out of its recording
+func (s *SplitService) OpenTrackAudio(ctx context.Context, track *Track) (*TrackAudio, error) {
+	if !track.IsSplit() || track.Blob == nil {
+		return nil, fmt.Errorf("track %d is not part of a split recording", track.ID)
+	}
+	path := s.fileService.GetFullPath(track.Blob.Path)
+	if !s.fileService.FileExists(path) {
+		return nil, ErrFileNotFound
+	}
+	info, err := ReadAudioInfo(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", track.Blob.Path, err)
+	}
+	if track.EndSample > info.Samples || track.StartSample >= track.EndSample {
+		return nil, fmt.Errorf("track %d range %d-%d is outside its recording of %d samples",
+			track.ID, track.StartSample, track.EndSample, info.Samples)
+	}
+	return s.openRange(ctx, path, info, track.StartSample, track.EndSample)
+}
+
+// OpenDownload opens a track, split or whole, with tags written in. A file that can't
+// be tagged is served as it is; a download without tags beats none.
+func (s *SplitService) OpenDownload(ctx context.Context, track *Track, tags *Tags) (*TrackAudio, error) {
+	audio, err := s.openTrack(ctx, track)
+	if err != nil {
+		return nil, err
+	}
+	tagged, err := TagAudio(audio, tags)
+	if err != nil {
+		logging.FromContext(ctx).Warn("serving track without tags", "track_id", track.ID, "error", err)
+		return audio, nil
+	}
+	return tagged, nil
+}
+
+// OpenConverted opens a track, split or whole, converted by ffmpeg into a temp file as
+// preset says, with tags written in where TagAudio can
+func (s *SplitService) OpenConverted(ctx context.Context, track *Track, preset ConversionPreset, tags *Tags) (*TrackAudio, error) {
+	if track.Blob == nil {
+		return nil, ErrFileNotFound
+	}
+	path := s.fileService.GetFullPath(track.Blob.Path)
+	if !s.fileService.FileExists(path) {
+		return nil, ErrFileNotFound
+	}
+	var replayGain *ReplayGain
+	if tags != nil {
+		replayGain = tags.ReplayGain
+	}
+	tempPath, err := s.conversionService.ConvertAudio(ctx, path, track.StartSample, track.EndSample, preset, replayGain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert track %d to %s: %w", track.ID, preset.Name, err)
+	}
+	audio, err := s.openTempFile(tempPath, filepath.Ext(tempPath))
+	if err != nil || tags == nil {
+		return audio, err
+	}
+	tagged, err := TagAudio(audio, tags)
+	if err != nil {
+		logging.FromContext(ctx).Warn("serving converted track without tags", "track_id", track.ID, "error", err)
+		return audio, nil
+	}
+	return tagged, nil
+}
+
+// OpenOriginal opens a track, split or whole, as it was uploaded, without tags. Audio
+// that was stored as FLAC is rebuilt into a temp file first; anything else is the
+// stored file.
+func (s *SplitService) OpenOriginal(ctx context.Context, track *Track) (*TrackAudio, error) {
+	if track.Blob == nil || track.Blob.Source == nil {
+		return s.openTrack(ctx, track)
+	}
+	path := s.fileService.GetFullPath(track.Blob.Path)
+	if !s.fileService.FileExists(path) {
+		return nil, ErrFileNotFound
+	}
+	source := track.Blob.Source
+	tempPath, err := s.conversionService.RebuildSource(ctx, path, source, track.Blob.SourceHash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rebuild track %d: %w", track.ID, err)
+	}
+	if !track.IsSplit() {
+		return s.openTempFile(tempPath, source.Ext)
+	}
+
+	info, err := ReadAudioInfo(tempPath)
+	if err == nil && (info.pcm == nil || track.EndSample > info.Samples || track.StartSample >= track.EndSample) {
+		err = fmt.Errorf("track %d range %d-%d can't be cut from its recording", track.ID, track.StartSample, track.EndSample)
+	}
+	var audio *TrackAudio
+	if err == nil {
+		audio, err = openPCMRange(tempPath, info.pcm, track.StartSample, track.EndSample, source.Ext)
+	}
+	if err != nil {
+		s.conversionService.CleanupTempFile(tempPath)
+		return nil, err
+	}
+	closeFile := audio.close
+	audio.close = func() error {
+		err := closeFile()
+		s.conversionService.CleanupTempFile(tempPath)
+		return err
+	}
+	return audio, nil
+}
+
+// OpenNormalized opens a track, split or whole, adjusted by its ReplayGain for mode. WAV
+// and AIFF samples are scaled as they are read; anything else is scaled by ffmpeg into
+// a temp FLAC file. A track that has not been measured is served as it is.
+func (s *SplitService) OpenNormalized(ctx context.Context, album *Album, track *Track, mode Normalization) (*TrackAudio, error) {
+	var gain float64
+	if replayGain := NewReplayGain(album, track); replayGain != nil {
+		gain = replayGain.Gain(mode)
+	}
+	audio, err := s.openTrack(ctx, track)
+	if err != nil || gain == 0 {
+		return audio, err
+	}
+	normalized, err := applyGain(audio, gain)
+	if err == nil {
+		return normalized, nil
+	}
+	audio.Close()
+	if !errors.Is(err, errNotPCM) {
+		return nil, err
+	}
+
+	path := s.fileService.GetFullPath(track.Blob.Path)
+	tempPath, err := s.conversionService.Normalize(ctx, path, track.StartSample, track.EndSample, gain)
+	if err != nil {
+		return nil, err
+	}
+	return s.openTempFile(tempPath, ".flac")
+}
+
+// openTrack opens the audio of a track as it is stored, cut out of its recording if split
+func (s *SplitService) openTrack(ctx context.Context, track *Track) (*TrackAudio, error) {
+	if track.IsSplit() {
+		return s.OpenTrackAudio(ctx, track)
+	}
+	return s.fileService.OpenTrackFile(track)
+}
+
+// openRange reads WAV and AIFF frames in place, and has ffmpeg cut anything else into a temp file
+func (s *SplitService) openRange(ctx context.Context, path string, info *AudioInfo, start, end int64) (*TrackAudio, error) {
+	ext := filepath.Ext(path)
+	if info.pcm != nil {
+		return openPCMRange(path, info.pcm, start, end, ext)
+	}
+
+	tempPath, err := s.conversionService.ExtractRange(ctx, path, start, end, info.BitDepth)
+	if err != nil {
+		return nil, err
+	}
+	return s.openTempFile(tempPath, ext)
+}
+
+// openTempFile serves a file ffmpeg wrote, removing it once closed
+func (s *SplitService) openTempFile(tempPath, ext string) (*TrackAudio, error) {
+	file, err := os.Open(tempPath)
+	if err != nil {
+		s.conversionService.CleanupTempFile(tempPath)
+		return nil, err
+	}
+	size, err := file.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		s.conversionService.CleanupTempFile(tempPath)
+		return nil, err
+	}
+	return newTrackAudio(file, size, ext, func() error {
+		file.Close()
+		return s.conversionService.CleanupTempFile(tempPath)
+	}), nil
+}
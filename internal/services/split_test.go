@@ -0,0 +1,164 @@
+package services
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"vinyl-vault/internal/services/audiotest"
+)
+
+func TestParseCueSheet(t *testing.T) {
+	cue := "\ufeffREM GENRE Krautrock\r\n" +
+		`PERFORMER "Can"
+TITLE "Tago Mago"
+FILE "side a.aiff" WAVE
+  TRACK 01 AUDIO
+    TITLE "Paperhouse"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Mushroom"
+    INDEX 00 07:25:70
+    INDEX 01 07:28:15
+`
+	sheet, err := ParseCueSheet(strings.NewReader(cue))
+	if err != nil {
+		t.Fatalf("ParseCueSheet() error = %v", err)
+	}
+	if sheet.Performer != "Can" || sheet.Title != "Tago Mago" || sheet.File != "side a.aiff" {
+		t.Errorf("ParseCueSheet() = %q, %q, %q", sheet.Performer, sheet.Title, sheet.File)
+	}
+	if len(sheet.Tracks) != 2 {
+		t.Fatalf("ParseCueSheet() found %d tracks, want 2", len(sheet.Tracks))
+	}
+	// the pregap INDEX 00 is ignored, 15 frames are 1/5 s
+	want := 7*time.Minute + 28*time.Second + 200*time.Millisecond
+	if track := sheet.Tracks[1]; track.Title != "Mushroom" || track.Start != want {
+		t.Errorf("track 2 = %q at %v, want Mushroom at %v", track.Title, track.Start, want)
+	}
+
+	for name, cue := range map[string]string{
+		"no tracks":      "FILE \"a.wav\" WAVE\n",
+		"no index":       "FILE \"a.wav\" WAVE\nTRACK 01 AUDIO\nTRACK 02 AUDIO\nINDEX 01 00:00:00\n",
+		"two files":      "FILE \"a.wav\" WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:00\nFILE \"b.wav\" WAVE\n",
+		"frames over 74": "FILE \"a.wav\" WAVE\nTRACK 01 AUDIO\nINDEX 01 00:00:75\n",
+	} {
+		if _, err := ParseCueSheet(strings.NewReader(cue)); !IsValidation(err) {
+			t.Errorf("ParseCueSheet() with %s error = %v, want a validation error", name, err)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"4:32", 4*time.Minute + 32*time.Second},
+		{"4:32.5", 4*time.Minute + 32500*time.Millisecond},
+		{"04:32:15", 4*time.Minute + 32200*time.Millisecond},
+		{"90.25", 90250 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got, err := ParseTimestamp(tt.in); err != nil || got != tt.want {
+			t.Errorf("ParseTimestamp(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "4:60", "-1", "a:10"} {
+		if _, err := ParseTimestamp(in); err == nil {
+			t.Errorf("ParseTimestamp(%q) succeeded", in)
+		}
+	}
+}
+
+func TestOpenPCMRange(t *testing.T) {
+	dir := t.TempDir()
+	wav := filepath.Join(dir, "side.wav")
+	audiotest.WriteFile(t, wav, audiotest.WAV(audiotest.Stereo16(8000), 1000, audiotest.Ramp))
+	aiff := filepath.Join(dir, "side.aiff")
+	audiotest.WriteFile(t, aiff, audiotest.AIFF(audiotest.Stereo16(44100), 1000, audiotest.Ramp, nil))
+
+	for _, tt := range []struct {
+		path       string
+		order      binary.ByteOrder
+		sampleRate int
+	}{
+		{wav, binary.LittleEndian, 8000},
+		{aiff, binary.BigEndian, 44100},
+	} {
+		t.Run(filepath.Ext(tt.path), func(t *testing.T) {
+			info, err := ReadAudioInfo(tt.path)
+			if err != nil {
+				t.Fatalf("ReadAudioInfo() error = %v", err)
+			}
+			if info.SampleRate != tt.sampleRate || info.Channels != 2 || info.BitDepth != 16 || info.Samples != 1000 {
+				t.Fatalf("ReadAudioInfo() = %+v", info)
+			}
+
+			audio, err := openPCMRange(tt.path, info.pcm, 250, 600, filepath.Ext(tt.path))
+			if err != nil {
+				t.Fatalf("openPCMRange() error = %v", err)
+			}
+			defer audio.Close()
+			cut, err := io.ReadAll(audio)
+			if err != nil || int64(len(cut)) != audio.Size {
+				t.Fatalf("read %d bytes, %v; want %d", len(cut), err, audio.Size)
+			}
+
+			// the cut is a valid file of its own, starting on frame 250
+			out := filepath.Join(t.TempDir(), "cut"+filepath.Ext(tt.path))
+			os.WriteFile(out, cut, 0644)
+			cutInfo, err := ReadAudioInfo(out)
+			if err != nil || cutInfo.Samples != 350 {
+				t.Fatalf("cut has %v samples, %v; want 350", cutInfo, err)
+			}
+			frames := cut[cutInfo.pcm.dataOffset:]
+			if first := tt.order.Uint16(frames); first != 250 {
+				t.Errorf("cut starts on frame %d, want 250", first)
+			}
+			if last := tt.order.Uint16(frames[len(frames)-4:]); last != 599 {
+				t.Errorf("cut ends on frame %d, want 599", last)
+			}
+
+			// seeking lands in the right place, as Range requests need
+			if _, err = audio.Seek(cutInfo.pcm.dataOffset+4, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			var frame [2]byte
+			io.ReadFull(audio, frame[:])
+			if got := tt.order.Uint16(frame[:]); got != 251 {
+				t.Errorf("frame after seeking = %d, want 251", got)
+			}
+		})
+	}
+}
+
+func TestSplitRanges(t *testing.T) {
+	info := &AudioInfo{SampleRate: 44100, Samples: 44100 * 60}
+	ranges, err := splitRanges(info, []SplitPoint{
+		{Title: "One", Start: 0},
+		{Start: 20*time.Second + 200*time.Millisecond},
+	})
+	if err != nil {
+		t.Fatalf("splitRanges() error = %v", err)
+	}
+	if ranges[0].end != 44100*20+8820 || ranges[1].start != ranges[0].end || ranges[1].end != info.Samples {
+		t.Errorf("splitRanges() = %+v", ranges)
+	}
+	if ranges[1].title != "Track 2" {
+		t.Errorf("untitled track = %q, want Track 2", ranges[1].title)
+	}
+
+	for name, points := range map[string][]SplitPoint{
+		"none":         nil,
+		"out of order": {{Start: 10 * time.Second}, {Start: 5 * time.Second}},
+		"past the end": {{Start: 0}, {Start: 2 * time.Minute}},
+	} {
+		if _, err = splitRanges(info, points); !IsValidation(err) {
+			t.Errorf("splitRanges() with %s error = %v, want a validation error", name, err)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxFLACBlock is the largest FLAC metadata block, whose length has 24 bits
+const maxFLACBlock = 1<<24 - 1
+
+// Picture is cover art to embed in downloads
+type Picture struct {
+	MIME string
+	Data []byte
+}
+
+// Tags describe a track in the files it is downloaded as
+type Tags struct {
+	Artist      string
+	Album       string
+	Title       string
+	TrackNumber int // in play order on the disc, counting sides as one
+	TrackTotal  int
+	DiscNumber  int
+	DiscTotal   int
+	Position    string // on the release, such as B2; empty on releases without sides
+	Date        string
+	Label       string
+	Cover       *Picture
+	ReplayGain  *ReplayGain // written when set
+}
+
+// NewTags takes the tags of track from its album, whose tracks are in play order
+func NewTags(album *Album, track *Track, cover *Picture) *Tags {
+	tags := &Tags{
+		Artist:     album.Metadata.Artist,
+		Album:      album.Metadata.Album,
+		Title:      track.Title,
+		DiscNumber: track.DiscNumber,
+		DiscTotal:  len(album.Media),
+		Date:       album.Metadata.ReleaseDate,
+		Cover:      cover,
+	}
+	if track.Side != "" {
+		tags.Position = track.Position()
+	}
+	if album.Metadata.Label != nil {
+		tags.Label = *album.Metadata.Label
+	}
+	for i := range album.Tracks {
+		other := &album.Tracks[i]
+		tags.DiscTotal = max(tags.DiscTotal, other.DiscNumber)
+		if other.DiscNumber != track.DiscNumber {
+			continue
+		}
+		tags.TrackTotal++
+		if CompareTracks(other, track) <= 0 {
+			tags.TrackNumber++
+		}
+	}
+	return tags
+}
+
+// TagAudio presents audio with tags written in: ID3v2.4 at the start of MP3 files,
+// Vorbis comments and a PICTURE block in FLAC files, and an ID3 chunk in WAV and AIFF
+// files. Tags already there are replaced. The audio is neither re-encoded nor copied;
+// the result reads it in place, and closing it closes audio. Other formats are
+// returned as they are.
+func TagAudio(audio *TrackAudio, tags *Tags) (*TrackAudio, error) {
+	var parts concatReaderAt
+	var err error
+	switch strings.ToLower(audio.Ext) {
+	case ".mp3":
+		parts, err = tagMP3(audio, tags)
+	case ".flac":
+		parts, err = tagFLAC(audio, tags)
+	case ".wav":
+		parts, err = tagChunks(audio, tags, binary.LittleEndian, "RIFF", "id3 ")
+	case ".aiff", ".aif":
+		parts, err = tagChunks(audio, tags, binary.BigEndian, "FORM", "ID3 ")
+	default:
+		return audio, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newTrackAudio(parts, parts.size(), audio.Ext, audio.close), nil
+}
+
+func bytesPart(b []byte) sizedReaderAt {
+	return sizedReaderAt{r: bytes.NewReader(b), n: int64(len(b))}
+}
+
+// tagMP3 puts a new ID3v2 tag in place of the ones at the start of the file. An ID3v1
+// tag at the end is left alone; players prefer the ID3v2 one.
+func tagMP3(audio *TrackAudio, tags *Tags) (concatReaderAt, error) {
+	offset := int64(0)
+	for {
+		var header [10]byte
+		if _, err := audio.ReadAt(header[:], offset); err != nil || string(header[:3]) != "ID3" {
+			break
+		}
+		size := int64(syncsafe(header[6:10])) + 10
+		if header[5]&0x10 != 0 { // footer
+			size += 10
+		}
+		if offset+size > audio.Size {
+			return nil, fmt.Errorf("MP3 file has a truncated ID3 tag")
+		}
+		offset += size
+	}
+	return concatReaderAt{
+		bytesPart(id3Tag(tags)),
+		{r: audio, n: audio.Size - offset, offset: offset},
+	}, nil
+}
+
+// tagChunks rewrites a RIFF (WAV) or FORM (AIFF) file without its ID3 chunks and with
+// a new one at the end, where taggers put it
+func tagChunks(audio *TrackAudio, tags *Tags, order binary.ByteOrder, form, id3ID string) (concatReaderAt, error) {
+	var header [12]byte
+	if _, err := audio.ReadAt(header[:], 0); err != nil || string(header[:4]) != form {
+		return nil, fmt.Errorf("not a %s file", form)
+	}
+
+	parts := concatReaderAt{bytesPart(nil)} // the header, once the size is known
+	offset := int64(12)
+	for offset+8 <= audio.Size {
+		var chunk [8]byte
+		if _, err := audio.ReadAt(chunk[:], offset); err != nil {
+			return nil, err
+		}
+		size := int64(order.Uint32(chunk[4:]))
+		end := min(offset+8+size+size%2, audio.Size)
+		if !strings.EqualFold(string(chunk[:4]), id3ID) {
+			parts = append(parts, sizedReaderAt{r: audio, n: end - offset, offset: offset})
+		}
+		offset = end
+	}
+
+	tag := id3Tag(tags)
+	chunk := make([]byte, 8, 8+len(tag)+1)
+	copy(chunk, id3ID)
+	order.PutUint32(chunk[4:], uint32(len(tag)))
+	chunk = append(chunk, tag...)
+	if len(tag)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	parts = append(parts, bytesPart(chunk))
+
+	size := parts.size() + 12 - 8
+	if size > 1<<32-1 {
+		return nil, fmt.Errorf("%s file is too large to tag", form)
+	}
+	order.PutUint32(header[4:], uint32(size))
+	parts[0] = bytesPart(header[:])
+	return parts, nil
+}
+
+// tagFLAC rebuilds the metadata blocks: those describing the stream are kept, padding
+// and pictures dropped, and the Vorbis comments replaced, keeping fields we don't write
+func tagFLAC(audio *TrackAudio, tags *Tags) (concatReaderAt, error) {
+	var magic [4]byte
+	if _, err := audio.ReadAt(magic[:], 0); err != nil || string(magic[:]) != "fLaC" {
+		return nil, fmt.Errorf("not a FLAC file")
+	}
+
+	parts := concatReaderAt{bytesPart(magic[:])}
+	vendor, kept := "vinyl-vault", []string(nil)
+	offset := int64(4)
+	for last := false; !last; {
+		var header [4]byte
+		if _, err := audio.ReadAt(header[:], offset); err != nil {
+			return nil, fmt.Errorf("FLAC file ends in its metadata: %w", err)
+		}
+		last = header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		size := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+		if offset+4+size > audio.Size {
+			return nil, fmt.Errorf("FLAC file has a truncated metadata block")
+		}
+
+		switch blockType {
+		case 1, 6: // padding, picture
+		case 4: // Vorbis comments
+			block := make([]byte, size)
+			if _, err := audio.ReadAt(block, offset+4); err != nil {
+				return nil, err
+			}
+			vendor, kept = readVorbisComments(block)
+		default:
+			header[0] &= 0x7f
+			parts = append(parts, bytesPart(slices.Clone(header[:])), sizedReaderAt{r: audio, n: size, offset: offset + 4})
+		}
+		offset += 4 + size
+	}
+
+	comments := vorbisComments(tags)
+	for _, comment := range kept {
+		name, _, _ := strings.Cut(comment, "=")
+		if !slices.ContainsFunc(comments, func(c string) bool { return strings.HasPrefix(c, strings.ToUpper(name)+"=") }) {
+			comments = append(comments, comment)
+		}
+	}
+	blocks := [][]byte{flacBlock(4, vorbisCommentBlock(vendor, comments))}
+	if tags.Cover != nil {
+		if picture := flacPicture(tags.Cover); len(picture) <= maxFLACBlock {
+			blocks = append(blocks, flacBlock(6, picture))
+		}
+	}
+	blocks[len(blocks)-1][0] |= 0x80
+	for _, block := range blocks {
+		parts = append(parts, bytesPart(block))
+	}
+	return append(parts, sizedReaderAt{r: audio, n: audio.Size - offset, offset: offset}), nil
+}
+
+func flacBlock(blockType byte, body []byte) []byte {
+	return append([]byte{blockType, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// vorbisComments are the tags as NAME=value fields
+func vorbisComments(tags *Tags) []string {
+	var comments []string
+	add := func(name, value string) {
+		if value != "" {
+			comments = append(comments, name+"="+value)
+		}
+	}
+	add("ARTIST", tags.Artist)
+	add("ALBUM", tags.Album)
+	add("TITLE", tags.Title)
+	add("TRACKNUMBER", itoa(tags.TrackNumber))
+	add("TRACKTOTAL", itoa(tags.TrackTotal))
+	add("DISCNUMBER", itoa(tags.DiscNumber))
+	add("DISCTOTAL", itoa(tags.DiscTotal))
+	add("VINYLTRACK", tags.Position)
+	add("DATE", tags.Date)
+	add("LABEL", tags.Label)
+	if tags.ReplayGain != nil {
+		for _, field := range tags.ReplayGain.Fields() {
+			add(field[0], field[1])
+		}
+	}
+	return comments
+}
+
+// readVorbisComments returns the vendor string and fields of a Vorbis comment block
+func readVorbisComments(block []byte) (string, []string) {
+	next := func() (string, bool) {
+		if len(block) < 4 {
+			return "", false
+		}
+		n := int(binary.LittleEndian.Uint32(block))
+		if n > len(block)-4 {
+			return "", false
+		}
+		s := string(block[4 : 4+n])
+		block = block[4+n:]
+		return s, true
+	}
+	vendor, ok := next()
+	if !ok || len(block) < 4 {
+		return "vinyl-vault", nil
+	}
+	count := int(binary.LittleEndian.Uint32(block))
+	block = block[4:]
+	var comments []string
+	for range count {
+		comment, ok := next()
+		if !ok {
+			break
+		}
+		comments = append(comments, comment)
+	}
+	return vendor, comments
+}
+
+func vorbisCommentBlock(vendor string, comments []string) []byte {
+	var buf bytes.Buffer
+	writeString := func(s string) {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+	writeString(vendor)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(comments)))
+	for _, comment := range comments {
+		writeString(comment)
+	}
+	return buf.Bytes()
+}
+
+// flacPicture is the body of a PICTURE block holding the front cover
+func flacPicture(cover *Picture) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(3)) // front cover
+	binary.Write(&buf, binary.BigEndian, uint32(len(cover.MIME)))
+	buf.WriteString(cover.MIME)
+	// no description; width, height, depth and colors are optional and left at 0
+	buf.Write(make([]byte, 4+16))
+	binary.Write(&buf, binary.BigEndian, uint32(len(cover.Data)))
+	buf.Write(cover.Data)
+	return buf.Bytes()
+}
+
+// id3Tag is an ID3v2.4 tag with UTF-8 text frames
+func id3Tag(tags *Tags) []byte {
+	var frames bytes.Buffer
+	frame := func(id string, body []byte) {
+		frames.WriteString(id)
+		frames.Write(putSyncsafe(len(body)))
+		frames.Write([]byte{0, 0})
+		frames.Write(body)
+	}
+	text := func(id, value string) {
+		if value != "" {
+			frame(id, append([]byte{3}, value...))
+		}
+	}
+	text("TPE1", tags.Artist)
+	text("TALB", tags.Album)
+	text("TIT2", tags.Title)
+	text("TRCK", ofTotal(tags.TrackNumber, tags.TrackTotal))
+	text("TPOS", ofTotal(tags.DiscNumber, tags.DiscTotal))
+	text("TDRC", tags.Date)
+	text("TPUB", tags.Label)
+	userText := func(description, value string) {
+		frame("TXXX", append([]byte("\x03"+description+"\x00"), value...))
+	}
+	if tags.Position != "" {
+		userText("VINYLTRACK", tags.Position)
+	}
+	if tags.ReplayGain != nil {
+		for _, field := range tags.ReplayGain.Fields() {
+			userText(field[0], field[1])
+		}
+	}
+	if tags.Cover != nil {
+		body := append([]byte{3}, tags.Cover.MIME...)
+		body = append(body, 0, 3, 0) // end of MIME, front cover, empty description
+		frame("APIC", append(body, tags.Cover.Data...))
+	}
+
+	header := append([]byte{'I', 'D', '3', 4, 0, 0}, putSyncsafe(frames.Len())...)
+	return append(header, frames.Bytes()...)
+}
+
+// ofTotal formats a track or disc number as ID3 wants it, such as 3/8
+func ofTotal(n, total int) string {
+	switch {
+	case n == 0:
+		return ""
+	case total == 0:
+		return strconv.Itoa(n)
+	}
+	return fmt.Sprintf("%d/%d", n, total)
+}
+
+func itoa(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// syncsafe decodes the 28-bit integers of ID3v2 headers, 7 bits to a byte
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+func putSyncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"vinyl-vault/internal/services/audiotest"
+	"vinyl-vault/pkg"
+)
+
+var testTags = &Tags{
+	Artist: "Can", Album: "Tago Mago", Title: "Mushroom",
+	TrackNumber: 2, TrackTotal: 3, DiscNumber: 1, DiscTotal: 2, Position: "A2",
+	Date: "1971", Label: "United Artists",
+	Cover: &Picture{MIME: "image/png", Data: []byte("\x89PNG cover")},
+}
+
+func bytesAudio(data []byte, ext string) *TrackAudio {
+	return newTrackAudio(bytes.NewReader(data), int64(len(data)), ext, func() error { return nil })
+}
+
+func tagBytes(t *testing.T, data []byte, ext string) []byte {
+	t.Helper()
+	tagged, err := TagAudio(bytesAudio(data, ext), testTags)
+	if err != nil {
+		t.Fatalf("TagAudio() error = %v", err)
+	}
+	out, err := io.ReadAll(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(out)) != tagged.Size {
+		t.Errorf("read %d bytes, Size = %d", len(out), tagged.Size)
+	}
+	return out
+}
+
+// readID3 returns the text of an ID3v2.4 tag's frames, and the tag's length
+func readID3(t *testing.T, tag []byte) (map[string]string, int) {
+	t.Helper()
+	if len(tag) < 10 || string(tag[:3]) != "ID3" || tag[3] != 4 {
+		t.Fatalf("no ID3v2.4 tag in %q", tag[:min(len(tag), 10)])
+	}
+	end := 10 + int(syncsafe(tag[6:10]))
+	frames := map[string]string{}
+	for i := 10; i+10 <= end; {
+		size := int(syncsafe(tag[i+4 : i+8]))
+		frames[string(tag[i:i+4])] = string(tag[i+11 : i+10+size])
+		i += 10 + size
+	}
+	return frames, end
+}
+
+func checkID3(t *testing.T, frames map[string]string) {
+	t.Helper()
+	for id, want := range map[string]string{
+		"TPE1": "Can", "TALB": "Tago Mago", "TIT2": "Mushroom", "TRCK": "2/3", "TPOS": "1/2",
+		"TDRC": "1971", "TPUB": "United Artists", "TXXX": "VINYLTRACK\x00A2",
+		"APIC": "image/png\x00\x03\x00\x89PNG cover",
+	} {
+		if frames[id] != want {
+			t.Errorf("%s = %q, want %q", id, frames[id], want)
+		}
+	}
+}
+
+func TestTagAudio_PCM(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range []struct {
+		ext      string
+		original []byte
+		order    binary.ByteOrder
+		id3ID    string
+	}{
+		{".wav", audiotest.WAV(audiotest.Stereo16(44100), 1000, audiotest.Ramp), binary.LittleEndian, "id3 "},
+		{".aiff", audiotest.AIFF(audiotest.Stereo16(44100), 1000, audiotest.Ramp, nil), binary.BigEndian, "ID3 "},
+	} {
+		t.Run(tt.ext, func(t *testing.T) {
+			original := tt.original
+
+			// tagging twice leaves a single tag
+			out := tagBytes(t, tagBytes(t, original, tt.ext), tt.ext)
+			if size := tt.order.Uint32(out[4:8]); int(size) != len(out)-8 {
+				t.Errorf("form size = %d, want %d", size, len(out)-8)
+			}
+			if !bytes.HasPrefix(out[12:], original[12:]) {
+				t.Error("tagged file does not start with the original chunks")
+			}
+			rest := out[len(original):]
+			if string(rest[:4]) != tt.id3ID || bytes.Count(out, []byte(tt.id3ID)) != 1 {
+				t.Fatalf("want one %q chunk after the original chunks, got %q", tt.id3ID, rest[:4])
+			}
+			frames, _ := readID3(t, rest[8:])
+			checkID3(t, frames)
+
+			tagged := filepath.Join(dir, "tagged"+tt.ext)
+			if err := os.WriteFile(tagged, out, 0644); err != nil {
+				t.Fatal(err)
+			}
+			info, err := ReadAudioInfo(tagged)
+			if err != nil || info.Samples != 1000 {
+				t.Errorf("ReadAudioInfo(tagged) = %+v, %v", info, err)
+			}
+		})
+	}
+}
+
+func TestTagAudio_MP3(t *testing.T) {
+	frames := []byte("\xff\xfb\x90\x64 mpeg frames")
+	old := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x0bTIT2\x00\x00\x00\x01\x00\x00\x00"), frames...)
+
+	out := tagBytes(t, old, ".MP3")
+	tag, end := readID3(t, out)
+	checkID3(t, tag)
+	if !bytes.Equal(out[end:], frames) {
+		t.Errorf("audio after the tag = %q, want the frames without the old tag", out[end:])
+	}
+}
+
+func TestTagAudio_FLAC(t *testing.T) {
+	block := func(blockType byte, last bool, body []byte) []byte {
+		if last {
+			blockType |= 0x80
+		}
+		return flacBlock(blockType, body)
+	}
+	streamInfo := bytes.Repeat([]byte{7}, 34)
+	frames := []byte("\xff\xf8 flac frames")
+	var original []byte
+	original = append(original, "fLaC"...)
+	original = append(original, block(0, false, streamInfo)...)
+	original = append(original, block(4, false, vorbisCommentBlock("reference libFLAC 1.4.3", []string{"artist=Old", "COMMENT=ripped at 24/96"}))...)
+	original = append(original, block(6, false, flacPicture(&Picture{MIME: "image/jpeg", Data: []byte("old")}))...)
+	original = append(original, block(1, true, make([]byte, 100))...)
+	original = append(original, frames...)
+
+	out := tagBytes(t, original, ".flac")
+	if string(out[:4]) != "fLaC" {
+		t.Fatal("tagged file does not start with fLaC")
+	}
+	var types []byte
+	var comments []string
+	var vendor string
+	var picture []byte
+	offset := 4
+	for last := false; !last; {
+		header := out[offset : offset+4]
+		last = header[0]&0x80 != 0
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		body := out[offset+4 : offset+4+size]
+		types = append(types, header[0]&0x7f)
+		switch header[0] & 0x7f {
+		case 0:
+			if !bytes.Equal(body, streamInfo) {
+				t.Error("STREAMINFO changed")
+			}
+		case 4:
+			vendor, comments = readVorbisComments(body)
+		case 6:
+			picture = body
+		}
+		offset += 4 + size
+	}
+	if !bytes.Equal(types, []byte{0, 4, 6}) {
+		t.Errorf("block types = %v, want STREAMINFO, VORBIS_COMMENT, PICTURE", types)
+	}
+	if !bytes.Equal(out[offset:], frames) {
+		t.Errorf("frames = %q, want %q", out[offset:], frames)
+	}
+	if vendor != "reference libFLAC 1.4.3" {
+		t.Errorf("vendor = %q, want the original kept", vendor)
+	}
+	want := "ARTIST=Can,ALBUM=Tago Mago,TITLE=Mushroom,TRACKNUMBER=2,TRACKTOTAL=3,DISCNUMBER=1,DISCTOTAL=2," +
+		"VINYLTRACK=A2,DATE=1971,LABEL=United Artists,COMMENT=ripped at 24/96"
+	if got := strings.Join(comments, ","); got != want {
+		t.Errorf("comments = %s, want %s", got, want)
+	}
+	if !bytes.Equal(picture, flacPicture(testTags.Cover)) {
+		t.Error("PICTURE block does not hold the cover")
+	}
+}
+
+func TestTagAudio_Unsupported(t *testing.T) {
+	audio := bytesAudio([]byte("ftyp"), ".m4a")
+	if tagged, err := TagAudio(audio, testTags); err != nil || tagged != audio {
+		t.Errorf("TagAudio(.m4a) = %v, %v, want it as it was", tagged, err)
+	}
+	if _, err := TagAudio(bytesAudio([]byte("not a flac"), ".flac"), testTags); err == nil {
+		t.Error("TagAudio() of a broken FLAC file succeeded")
+	}
+}
+
+func TestNewTags(t *testing.T) {
+	label := "Harvest"
+	album := &Album{
+		Metadata: pkg.Metadata{Artist: "Pink Floyd", Album: "Ummagumma", ReleaseDate: "1969-11-07", Label: &label},
+		Media:    []Medium{{Number: 1}, {Number: 2}},
+		Tracks: []Track{
+			{DiscNumber: 1, Side: "A", TrackNumber: 1, Title: "Astronomy Domine"},
+			{DiscNumber: 1, Side: "B", TrackNumber: 1, Title: "Set the Controls"},
+			{DiscNumber: 2, Side: "C", TrackNumber: 1, Title: "Sysyphus"},
+			{DiscNumber: 1, Side: "A", TrackNumber: 2, Title: "Careful with That Axe, Eugene"},
+		},
+	}
+	tags := NewTags(album, &album.Tracks[1], nil)
+	if tags.TrackNumber != 3 || tags.TrackTotal != 3 || tags.DiscNumber != 1 || tags.DiscTotal != 2 ||
+		tags.Position != "B1" || tags.Label != "Harvest" || tags.Date != "1969-11-07" {
+		t.Errorf("NewTags() = %+v", tags)
+	}
+}
+
+func TestTagAudio_ReplayGain(t *testing.T) {
+	tags := *testTags
+	tags.ReplayGain = &ReplayGain{TrackGain: -6, TrackPeak: 0.5}
+
+	comments := strings.Join(vorbisComments(&tags), ",")
+	if !strings.Contains(comments, "REPLAYGAIN_TRACK_GAIN=-6.00 dB,REPLAYGAIN_TRACK_PEAK=0.500000") {
+		t.Errorf("comments = %s, want the track gain and peak", comments)
+	}
+	if strings.Contains(comments, "REPLAYGAIN_ALBUM") {
+		t.Errorf("comments = %s, want no album gain before the album is measured", comments)
+	}
+	tag := id3Tag(&tags)
+	for _, want := range []string{"REPLAYGAIN_TRACK_GAIN\x00-6.00 dB", "REPLAYGAIN_TRACK_PEAK\x000.500000"} {
+		if !bytes.Contains(tag, []byte(want)) {
+			t.Errorf("ID3 tag has no TXXX %q", want)
+		}
+	}
+}
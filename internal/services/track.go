@@ -1,74 +1,254 @@
 package services
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"vinyl-vault/internal/logging"
 	"vinyl-vault/pkg"
+
+	"gorm.io/gorm"
 )
 
 type Track struct {
 	ID           uint64           `json:"id" gorm:"primaryKey;autoIncrement"`
 	AlbumID      uint64           `json:"album_id" gorm:"not null"`
-	TrackNumber  int              `json:"track_number" gorm:"not null"`
+	DiscNumber   int              `json:"disc_number" gorm:"not null"`    // 1 for the first disc
+	Side         string           `json:"side,omitempty" gorm:"not null"` // A, B, AA...; empty on releases without sides
+	TrackNumber  int              `json:"track_number" gorm:"not null"`   // on the side, or the disc when there are none
 	Title        string           `json:"title" gorm:"not null"`
 	Duration     pkg.Duration     `json:"duration"`
-	FilePath     string           `json:"file_path" gorm:"not null"`
+	BlobID       *uint64          `json:"blob_id,omitempty" gorm:"index"` // nil on a stub, whose audio is yet to come
+	Blob         *Blob            `json:"blob,omitempty" gorm:"foreignKey:BlobID;constraint:OnDelete:RESTRICT"`
 	AudioQuality pkg.AudioQuality `json:"audio_quality" gorm:"embedded;embeddedPrefix:audio_"`
-	CreatedAt    time.Time        `json:"created_at"`
-	UpdatedAt    time.Time        `json:"updated_at"`
+	RipQuality   *pkg.RipQuality  `json:"rip_quality,omitempty" gorm:"serializer:json"` // nil until analyzed
+	Credits      []pkg.Credit     `json:"credits,omitempty" gorm:"serializer:json"`
+	// A track cut from a side-long recording plays the samples [StartSample, EndSample)
+	// of its blob, and BlobShare of the blob's bytes count against the owner's quota.
+	// EndSample is 0 when the track is the whole file.
+	StartSample int64          `json:"start_sample,omitempty" gorm:"not null;default:0"`
+	EndSample   int64          `json:"end_sample,omitempty" gorm:"not null;default:0"`
+	BlobShare   int64          `json:"-" gorm:"not null;default:0"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+
+	// Loudness is measured in the background once the audio is stored; LoudnessBlocks
+	// keep what it was measured from for the album's measurement
+	Loudness       Loudness        `json:"loudness,omitzero" gorm:"embedded;embeddedPrefix:loudness_"`
+	LoudnessBlocks *LoudnessBlocks `json:"-" gorm:"serializer:json"`
 }
 
 type TrackRepository interface {
 	FindByID(ctx context.Context, id uint64) (*Track, error)
 	FindByAlbumID(ctx context.Context, albumID uint64) ([]*Track, error)
 	Save(ctx context.Context, track *Track) error
+	// Delete moves the track to the trash, Purge removes it for good
 	Delete(ctx context.Context, id uint64) error
+
+	FindByIDWithDeleted(ctx context.Context, id uint64) (*Track, error)
+	// FindDeletedByUserID returns trashed tracks whose album is not itself trashed
+	FindDeletedByUserID(ctx context.Context, userID uint64) ([]*Track, error)
+	FindDeletedBefore(ctx context.Context, cutoff time.Time) ([]*Track, error)
+	Restore(ctx context.Context, id uint64) error
+	Purge(ctx context.Context, id uint64) error
+
+	// Count returns the number of tracks outside the trash
+	Count(ctx context.Context) (int64, error)
 }
 
-type FileDeleter interface {
-	DeleteAudioFile(filePath string) error
+// TrackPosition is where a new track goes on its album
+type TrackPosition struct {
+	DiscNumber  int // 0 is the first disc
+	Side        string
+	TrackNumber int
+}
+
+// sidePattern matches side labels: A to Z, and doubled letters like the AA side of a single
+var sidePattern = regexp.MustCompile(`^[A-Z]{1,2}$`)
+
+// Position is the track's label on the release: A1, B2... with sides, else its number
+func (t *Track) Position() string {
+	if t.Side == "" {
+		return strconv.Itoa(t.TrackNumber)
+	}
+	return t.Side + strconv.Itoa(t.TrackNumber)
+}
+
+// CompareTracks orders tracks the way a release plays: by disc, then side (A before
+// B before AA), then number on the side. Ties go to the older track.
+func CompareTracks(a, b *Track) int {
+	return cmp.Or(
+		cmp.Compare(a.DiscNumber, b.DiscNumber),
+		cmp.Compare(len(a.Side), len(b.Side)),
+		strings.Compare(a.Side, b.Side),
+		cmp.Compare(a.TrackNumber, b.TrackNumber),
+		cmp.Compare(a.ID, b.ID),
+	)
+}
+
+// checkPosition normalizes a track position and checks it against the album's media
+func checkPosition(album *Album, disc *int, side *string) error {
+	if *disc == 0 {
+		*disc = 1
+	}
+	*side = strings.ToUpper(strings.TrimSpace(*side))
+
+	var errs ValidationErrors
+	if *disc < 0 {
+		errs = append(errs, NewValidationError("disc_number", "must be 1 or more"))
+	} else if len(album.Media) > 0 && album.Medium(*disc) == nil {
+		errs = append(errs, NewValidationError("disc_number", fmt.Sprintf("album has no disc %d", *disc)))
+	}
+	if *side != "" && !sidePattern.MatchString(*side) {
+		errs = append(errs, NewValidationError("side", "must be one or two letters, such as A or AA"))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateCredits checks roles and names, tidying both in place
+func validateCredits(credits []pkg.Credit) error {
+	for i := range credits {
+		credit := &credits[i]
+		credit.Role = strings.ToLower(strings.TrimSpace(credit.Role))
+		credit.Name = strings.TrimSpace(credit.Name)
+		credit.Detail = strings.TrimSpace(credit.Detail)
+		switch {
+		case !slices.Contains(pkg.CreditRoles, credit.Role):
+			return NewValidationError("credits", fmt.Sprintf("role must be one of %s", strings.Join(pkg.CreditRoles, ", ")))
+		case credit.Name == "":
+			return NewValidationError("credits", "every credit needs a name")
+		}
+	}
+	return nil
+}
+
+// IsStub reports whether the track is a tracklist entry without audio
+func (t *Track) IsStub() bool {
+	return t.BlobID == nil
+}
+
+// stubAt returns the album's stub at the position, or nil
+func (a *Album) stubAt(position TrackPosition) *Track {
+	for i := range a.Tracks {
+		track := &a.Tracks[i]
+		if track.IsStub() && track.DiscNumber == position.DiscNumber && track.Side == position.Side &&
+			track.TrackNumber == position.TrackNumber {
+			return track
+		}
+	}
+	return nil
+}
+
+// IsSplit reports whether the track is a range of a longer recording rather than a whole file
+func (t *Track) IsSplit() bool {
+	return t.EndSample > 0
+}
+
+// StoredSize is what the track counts for in its owner's storage usage
+func (t *Track) StoredSize() int64 {
+	if t.IsSplit() {
+		return t.BlobShare
+	}
+	if t.Blob == nil {
+		return 0
+	}
+	return t.Blob.Size
+}
+
+type BlobReleaser interface {
+	ReleaseBlob(ctx context.Context, ownerID, id uint64) error
+	// ReleaseBlobShare drops a reference that was charged share bytes instead of the whole blob
+	ReleaseBlobShare(ctx context.Context, ownerID, id uint64, share int64) error
+}
+
+// releaseTrackAudio drops the track's reference to its audio, crediting back what it was charged
+func releaseTrackAudio(ctx context.Context, blobService BlobReleaser, ownerID uint64, track *Track) error {
+	switch {
+	case track.IsStub():
+		return nil
+	case track.IsSplit():
+		return blobService.ReleaseBlobShare(ctx, ownerID, *track.BlobID, track.BlobShare)
+	}
+	return blobService.ReleaseBlob(ctx, ownerID, *track.BlobID)
 }
 
 type TrackService struct {
 	trackRepository TrackRepository
 	albumRepository AlbumRepository
-	fileService     FileDeleter
+	blobService     BlobReleaser
+	analysisQueue   AnalysisQueue
 }
 
-func NewTrackService(trackRepository TrackRepository, albumRepository AlbumRepository, fileService FileDeleter) *TrackService {
+func NewTrackService(trackRepository TrackRepository, albumRepository AlbumRepository, blobService BlobReleaser) *TrackService {
 	return &TrackService{
 		trackRepository: trackRepository,
 		albumRepository: albumRepository,
-		fileService:     fileService,
+		blobService:     blobService,
 	}
 }
 
-// CreateTrack just saves metadata into new track
+// SetAnalysisQueue has new tracks analyzed once they are saved
+func (t *TrackService) SetAnalysisQueue(queue AnalysisQueue) {
+	t.analysisQueue = queue
+}
+
+// CreateTrack saves a track playing the given blob. A stub at the same position, as
+// left by applying a release, gets the audio instead, keeping its credits.
 func (t *TrackService) CreateTrack(
-	ctx context.Context, userID, albumID uint64, trackNumber int, title string,
-	duration pkg.Duration, filePath string, audioQuality pkg.AudioQuality) (*Track, error) {
+	ctx context.Context, userID, albumID uint64, position TrackPosition, title string,
+	duration pkg.Duration, blobID uint64, audioQuality pkg.AudioQuality) (*Track, error) {
 
 	album, err := t.albumRepository.FindByID(ctx, albumID)
 	if err != nil {
 		return nil, fmt.Errorf("album not found: %w", err)
 	}
 	if album.UserID != userID {
-		return nil, fmt.Errorf("unauthorized: you don't own this album")
+		return nil, fmt.Errorf("album %d: %w", albumID, ErrNotOwner)
+	}
+	if err = checkPosition(album, &position.DiscNumber, &position.Side); err != nil {
+		return nil, err
+	}
+
+	if stub := album.stubAt(position); stub != nil {
+		stub.BlobID = &blobID
+		stub.AudioQuality = audioQuality
+		if title != "" {
+			stub.Title = title
+		}
+		if duration != 0 {
+			stub.Duration = duration
+		}
+		if err = t.trackRepository.Save(ctx, stub); err != nil {
+			return nil, fmt.Errorf("failed to fill track stub: %w", err)
+		}
+		enqueueAnalysis(t.analysisQueue, stub.ID)
+		return stub, nil
 	}
 
 	track := &Track{
 		AlbumID:      albumID,
-		TrackNumber:  trackNumber,
+		DiscNumber:   position.DiscNumber,
+		Side:         position.Side,
+		TrackNumber:  position.TrackNumber,
 		Title:        title,
 		Duration:     duration,
-		FilePath:     filePath,
+		BlobID:       &blobID,
 		AudioQuality: audioQuality,
 	}
 	if err = t.trackRepository.Save(ctx, track); err != nil {
 		return nil, fmt.Errorf("failed to create track: %w", err)
 	}
+	enqueueAnalysis(t.analysisQueue, track.ID)
 	return track, nil
 }
 
@@ -92,8 +272,14 @@ func (t *TrackService) GetTracksByAlbum(ctx context.Context, albumID uint64) ([]
 
 func (t *TrackService) UpdateTrack(
 	ctx context.Context, userID, trackID uint64,
-	trackNumber *int, title *string, duration *int, audioQuality *pkg.AudioQuality,
+	discNumber *int, side *string, trackNumber *int, title *string, duration *int, audioQuality *pkg.AudioQuality,
+	credits []pkg.Credit,
 ) (*Track, error) {
+	if credits != nil {
+		if err := validateCredits(credits); err != nil {
+			return nil, err
+		}
+	}
 
 	track, err := t.trackRepository.FindByID(ctx, trackID)
 	if err != nil {
@@ -105,9 +291,20 @@ func (t *TrackService) UpdateTrack(
 		return nil, fmt.Errorf("album not found: %w", err)
 	}
 	if album.UserID != userID {
-		return nil, fmt.Errorf("unauthorized: you don't own this track's album")
+		return nil, fmt.Errorf("track %d: %w", trackID, ErrNotOwner)
 	}
 
+	if discNumber != nil {
+		track.DiscNumber = *discNumber
+	}
+	if side != nil {
+		track.Side = *side
+	}
+	if discNumber != nil || side != nil {
+		if err = checkPosition(album, &track.DiscNumber, &track.Side); err != nil {
+			return nil, err
+		}
+	}
 	if trackNumber != nil {
 		track.TrackNumber = *trackNumber
 	}
@@ -120,6 +317,9 @@ func (t *TrackService) UpdateTrack(
 	if audioQuality != nil {
 		track.AudioQuality = *audioQuality
 	}
+	if credits != nil {
+		track.Credits = credits
+	}
 
 	if err = t.trackRepository.Save(ctx, track); err != nil {
 		return nil, fmt.Errorf("failed to update track: %w", err)
@@ -138,11 +338,13 @@ func (t *TrackService) DeleteTrack(ctx context.Context, userID, trackID uint64)
 		return fmt.Errorf("album not found: %w", err)
 	}
 	if album.UserID != userID {
-		return fmt.Errorf("unauthorized: you don't own this track's album")
+		return fmt.Errorf("track %d: %w", trackID, ErrNotOwner)
 	}
 
+	// soft delete: the audio stays on disk until the track is purged from the trash
 	if err = t.trackRepository.Delete(ctx, trackID); err != nil {
 		return fmt.Errorf("failed to delete track: %w", err)
 	}
+	logging.FromContext(ctx).Info("track moved to trash", "track_id", trackID, "album_id", track.AlbumID, "user_id", userID)
 	return nil
 }
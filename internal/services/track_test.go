@@ -1,167 +1,83 @@
-package services
+package services_test
 
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
 	"strings"
 	"testing"
+	"vinyl-vault/internal/services"
 	"vinyl-vault/pkg"
 )
 
-type mockTrackRepository struct {
-	tracks            map[uint64]*Track
-	findByIDFunc      func(ctx context.Context, id uint64) (*Track, error)
-	findByAlbumIDFunc func(ctx context.Context, albumID uint64) ([]*Track, error)
-	saveFunc          func(ctx context.Context, track *Track) error
-	deleteFunc        func(ctx context.Context, id uint64) error
+// failingTracks fails to list an album's tracks, like a database that went away
+type failingTracks struct {
+	services.TrackRepository
 }
 
-func (m *mockTrackRepository) FindByID(ctx context.Context, id uint64) (*Track, error) {
-	if m.findByIDFunc != nil {
-		return m.findByIDFunc(ctx, id)
-	}
-	track, exists := m.tracks[id]
-	if !exists {
-		return nil, errors.New("track not found")
-	}
-	return track, nil
-}
-
-func (m *mockTrackRepository) FindByAlbumID(ctx context.Context, albumID uint64) ([]*Track, error) {
-	if m.findByAlbumIDFunc != nil {
-		return m.findByAlbumIDFunc(ctx, albumID)
-	}
-	var tracks []*Track
-	for _, track := range m.tracks {
-		if track.AlbumID == albumID {
-			tracks = append(tracks, track)
-		}
-	}
-	return tracks, nil
-}
-
-func (m *mockTrackRepository) Save(ctx context.Context, track *Track) error {
-	if m.saveFunc != nil {
-		return m.saveFunc(ctx, track)
-	}
-	if track.ID == 0 {
-		track.ID = uint64(len(m.tracks) + 1)
-	}
-	m.tracks[track.ID] = track
-	return nil
-}
-
-func (m *mockTrackRepository) Delete(ctx context.Context, id uint64) error {
-	if m.deleteFunc != nil {
-		return m.deleteFunc(ctx, id)
-	}
-	delete(m.tracks, id)
-	return nil
-}
-
-type mockAlbumRepository struct {
-	albums       map[uint64]*Album
-	findByIDFunc func(ctx context.Context, id uint64) (*Album, error)
-}
-
-func (m *mockAlbumRepository) FindByID(ctx context.Context, id uint64) (*Album, error) {
-	if m.findByIDFunc != nil {
-		return m.findByIDFunc(ctx, id)
-	}
-	album, exists := m.albums[id]
-	if !exists {
-		return nil, errors.New("album not found")
-	}
-	return album, nil
-}
-
-func (m *mockAlbumRepository) FindByUserID(ctx context.Context, userID uint64) ([]*Album, error) {
-	return nil, nil
-}
-
-func (m *mockAlbumRepository) FindByArtist(ctx context.Context, artist string) ([]*Album, error) {
-	return nil, nil
-}
-
-func (m *mockAlbumRepository) Save(ctx context.Context, album *Album) error {
-	return nil
-}
-
-func (m *mockAlbumRepository) Delete(ctx context.Context, id uint64) error {
-	return nil
-}
-
-type mockFileDeleter struct {
-	deleteAudioFileFunc func(filePath string) error
-}
-
-func (m *mockFileDeleter) DeleteAudioFile(filePath string) error {
-	if m.deleteAudioFileFunc != nil {
-		return m.deleteAudioFileFunc(filePath)
-	}
-	return nil
+func (failingTracks) FindByAlbumID(ctx context.Context, albumID uint64) ([]*services.Track, error) {
+	return nil, errors.New("database error")
 }
 
 func TestTrackService_CreateTrack(t *testing.T) {
-
 	tests := []struct {
 		name        string
-		userID      uint64
-		albumID     uint64
-		trackNumber int
+		asOther     bool // created by a user who doesn't own the album
+		noAlbum     bool
+		media       []services.Medium
+		position    services.TrackPosition
 		title       string
 		duration    pkg.Duration
-		filePath    string
-		setupMocks  func(*mockTrackRepository, *mockAlbumRepository)
 		wantErr     bool
 		errContains string
+		errIs       error
 	}{
 		{
-			name:        "successful track creation",
-			userID:      1,
-			albumID:     1,
-			trackNumber: 1,
+			name:     "successful track creation",
+			position: services.TrackPosition{TrackNumber: 1},
+			title:    "Test Track",
+			duration: pkg.Duration(180),
+		},
+		{
+			name:     "unauthorized - user doesn't own album",
+			asOther:  true,
+			position: services.TrackPosition{TrackNumber: 1},
+			title:    "Test Track",
+			duration: pkg.Duration(180),
+			wantErr:  true,
+			errIs:    services.ErrNotOwner,
+		},
+		{
+			name:     "vinyl position",
+			media:    []services.Medium{{Number: 1}, {Number: 2}},
+			position: services.TrackPosition{DiscNumber: 2, Side: "c", TrackNumber: 1},
+			title:    "Test Track",
+			duration: pkg.Duration(180),
+		},
+		{
+			name:        "disc the album doesn't have",
+			media:       []services.Medium{{Number: 1}, {Number: 2}},
+			position:    services.TrackPosition{DiscNumber: 3, TrackNumber: 1},
 			title:       "Test Track",
 			duration:    pkg.Duration(180),
-			filePath:    "/uploads/track.flac",
-			setupMocks: func(trackRepo *mockTrackRepository, albumRepo *mockAlbumRepository) {
-				albumRepo.albums[1] = &Album{
-					ID:     1,
-					UserID: 1,
-				}
-			},
-			wantErr: false,
+			wantErr:     true,
+			errContains: "no disc 3",
 		},
-
 		{
-			name:        "unauthorized - user doesn't own album",
-			userID:      2,
-			albumID:     1,
-			trackNumber: 1,
+			name:        "invalid side",
+			position:    services.TrackPosition{Side: "Side A", TrackNumber: 1},
 			title:       "Test Track",
 			duration:    pkg.Duration(180),
-			filePath:    "/uploads/track.flac",
-			setupMocks: func(trackRepo *mockTrackRepository, albumRepo *mockAlbumRepository) {
-				albumRepo.albums[1] = &Album{
-					ID:     1,
-					UserID: 1,
-				}
-			},
 			wantErr:     true,
-			errContains: "unauthorized",
+			errContains: "side",
 		},
-
 		{
 			name:        "album not found",
-			userID:      1,
-			albumID:     999,
-			trackNumber: 1,
+			noAlbum:     true,
+			position:    services.TrackPosition{TrackNumber: 1},
 			title:       "Test Track",
 			duration:    pkg.Duration(180),
-			filePath:    "/uploads/track.flac",
-			setupMocks: func(trackRepo *mockTrackRepository, albumRepo *mockAlbumRepository) {
-				// No album setup
-			},
 			wantErr:     true,
 			errContains: "album not found",
 		},
@@ -169,25 +85,35 @@ func TestTrackService_CreateTrack(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			owner, other := f.user(t, "alice"), f.user(t, "bob")
+			album := f.album(t, owner.ID, "Tago Mago")
+			if tt.media != nil {
+				album.Media = tt.media
+				if err := f.albums.Save(context.Background(), album); err != nil {
+					t.Fatal(err)
+				}
+			}
+			blob := f.blob(t, owner.ID, "audio", ".flac")
 
-			trackRepo := &mockTrackRepository{tracks: make(map[uint64]*Track)}
-			albumRepo := &mockAlbumRepository{albums: make(map[uint64]*Album)}
-			fileService := &mockFileDeleter{}
-
-			if tt.setupMocks != nil {
-				tt.setupMocks(trackRepo, albumRepo)
+			userID, albumID := owner.ID, album.ID
+			if tt.asOther {
+				userID = other.ID
+			}
+			if tt.noAlbum {
+				albumID = 999
 			}
 
-			service := NewTrackService(trackRepo, albumRepo, fileService)
+			service := services.NewTrackService(f.tracks, f.albums, f.blobService)
 
 			track, err := service.CreateTrack(
 				context.Background(),
-				tt.userID,
-				tt.albumID,
-				tt.trackNumber,
+				userID,
+				albumID,
+				tt.position,
 				tt.title,
 				tt.duration,
-				tt.filePath,
+				blob.ID,
 				pkg.AudioQuality{},
 			)
 
@@ -199,6 +125,9 @@ func TestTrackService_CreateTrack(t *testing.T) {
 				if tt.errContains != "" && !strings.Contains(err.Error(), tt.errContains) {
 					t.Errorf("expected error to contain '%s', got '%s'", tt.errContains, err.Error())
 				}
+				if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+					t.Errorf("expected error to wrap %v, got %v", tt.errIs, err)
+				}
 			} else {
 				if err != nil {
 					t.Errorf("unexpected error: %v", err)
@@ -208,37 +137,32 @@ func TestTrackService_CreateTrack(t *testing.T) {
 					t.Errorf("expected track to be created")
 					return
 				}
-				if track != nil && track.Title != tt.title {
+				if track.Title != tt.title {
 					t.Errorf("expected title '%s', got '%s'", tt.title, track.Title)
 				}
+				if want := max(tt.position.DiscNumber, 1); track.DiscNumber != want || track.Side != strings.ToUpper(tt.position.Side) {
+					t.Errorf("expected disc %d side %q, got disc %d side %q",
+						want, strings.ToUpper(tt.position.Side), track.DiscNumber, track.Side)
+				}
 			}
 		})
 	}
 }
 
 func TestTrackService_GetTrack(t *testing.T) {
-	trackRepo := &mockTrackRepository{
-		tracks: map[uint64]*Track{
-			1: {
-				ID:          1,
-				AlbumID:     1,
-				TrackNumber: 1,
-				Title:       "Test Track",
-			},
-		},
-	}
-	albumRepo := &mockAlbumRepository{albums: make(map[uint64]*Album)}
-	fileService := &mockFileDeleter{}
+	f := newFixture(t)
+	owner := f.user(t, "alice")
+	saved := f.track(t, f.album(t, owner.ID, "Tago Mago").ID, 1, nil)
 
-	service := NewTrackService(trackRepo, albumRepo, fileService)
+	service := services.NewTrackService(f.tracks, f.albums, f.blobService)
 
 	t.Run("get existing track", func(t *testing.T) {
-		track, err := service.GetTrack(context.Background(), 1)
+		track, err := service.GetTrack(context.Background(), saved.ID)
 		if err != nil {
-			t.Errorf("unexpected error: %v", err)
+			t.Fatalf("unexpected error: %v", err)
 		}
-		if track.ID != 1 {
-			t.Errorf("expected track ID 1, got %d", track.ID)
+		if track.ID != saved.ID {
+			t.Errorf("expected track ID %d, got %d", saved.ID, track.ID)
 		}
 	})
 
@@ -253,110 +177,41 @@ func TestTrackService_GetTrack(t *testing.T) {
 func TestTrackService_GetTracksByAlbum(t *testing.T) {
 	tests := []struct {
 		name        string
-		albumID     uint64
-		setupMocks  func(*mockTrackRepository, *mockAlbumRepository)
-		wantCount   int
+		albums      [][]int // the track numbers of each album, in the order they are added
+		album       int     // the album to list
+		failing     bool
+		wantNumbers []int
 		wantErr     bool
 		errContains string
 	}{
 		{
-			name:    "get tracks for album with multiple tracks",
-			albumID: 1,
-			setupMocks: func(trackRepo *mockTrackRepository, albumRepo *mockAlbumRepository) {
-				trackRepo.tracks[1] = &Track{
-					ID:          1,
-					AlbumID:     1,
-					TrackNumber: 1,
-					Title:       "Track 1",
-				}
-				trackRepo.tracks[2] = &Track{
-					ID:          2,
-					AlbumID:     1,
-					TrackNumber: 2,
-					Title:       "Track 2",
-				}
-				trackRepo.tracks[3] = &Track{
-					ID:          3,
-					AlbumID:     1,
-					TrackNumber: 3,
-					Title:       "Track 3",
-				}
-				// Track from different album - should not be returned
-				trackRepo.tracks[4] = &Track{
-					ID:          4,
-					AlbumID:     2,
-					TrackNumber: 1,
-					Title:       "Different Album Track",
-				}
-			},
-			wantCount: 3,
-			wantErr:   false,
+			name:        "get tracks for album with multiple tracks",
+			albums:      [][]int{{1, 2, 3}, {1}},
+			album:       0,
+			wantNumbers: []int{1, 2, 3},
 		},
 		{
-			name:    "get tracks for album with one track",
-			albumID: 2,
-			setupMocks: func(trackRepo *mockTrackRepository, albumRepo *mockAlbumRepository) {
-				trackRepo.tracks[1] = &Track{
-					ID:          1,
-					AlbumID:     2,
-					TrackNumber: 1,
-					Title:       "Single Track",
-				}
-			},
-			wantCount: 1,
-			wantErr:   false,
+			name:        "get tracks for album with one track",
+			albums:      [][]int{{}, {1}},
+			album:       1,
+			wantNumbers: []int{1},
 		},
 		{
-			name:    "get tracks for album with no tracks",
-			albumID: 3,
-			setupMocks: func(trackRepo *mockTrackRepository, albumRepo *mockAlbumRepository) {
-				// No tracks for album 3
-				trackRepo.tracks[1] = &Track{
-					ID:          1,
-					AlbumID:     1,
-					TrackNumber: 1,
-					Title:       "Other Album Track",
-				}
-			},
-			wantCount: 0,
-			wantErr:   false,
+			name:   "get tracks for album with no tracks",
+			albums: [][]int{{1}, {}},
+			album:  1,
 		},
 		{
-			name:    "tracks with same album ID but different track numbers",
-			albumID: 5,
-			setupMocks: func(trackRepo *mockTrackRepository, albumRepo *mockAlbumRepository) {
-				trackRepo.tracks[10] = &Track{
-					ID:          10,
-					AlbumID:     5,
-					TrackNumber: 3, // Out of order
-					Title:       "Track 3",
-				}
-				trackRepo.tracks[11] = &Track{
-					ID:          11,
-					AlbumID:     5,
-					TrackNumber: 1,
-					Title:       "Track 1",
-				}
-				trackRepo.tracks[12] = &Track{
-					ID:          12,
-					AlbumID:     5,
-					TrackNumber: 2,
-					Title:       "Track 2",
-				}
-			},
-			wantCount: 3,
-			wantErr:   false,
+			name:        "tracks added out of order",
+			albums:      [][]int{{3, 1, 2}},
+			album:       0,
+			wantNumbers: []int{1, 2, 3},
 		},
 		{
-			name:    "repository error",
-			albumID: 999,
-			setupMocks: func(trackRepo *mockTrackRepository, albumRepo *mockAlbumRepository) {
-
-				trackRepo.findByAlbumIDFunc = func(ctx context.Context, albumID uint64) ([]*Track, error) {
-					return nil, errors.New("database error")
-				}
-			},
-			wantCount:   0,
+			name:        "repository error",
+			albums:      [][]int{{1}},
+			album:       0,
+			failing:     true,
 			wantErr:     true,
 			errContains: "failed to get tracks",
 		},
@@ -364,17 +219,24 @@ func TestTrackService_GetTracksByAlbum(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			trackRepo := &mockTrackRepository{tracks: make(map[uint64]*Track)}
-			albumRepo := &mockAlbumRepository{albums: make(map[uint64]*Album)}
-			fileService := &mockFileDeleter{}
-
-			if tt.setupMocks != nil {
-				tt.setupMocks(trackRepo, albumRepo)
+			f := newFixture(t)
+			owner := f.user(t, "alice")
+			var albumIDs []uint64
+			for i, numbers := range tt.albums {
+				album := f.album(t, owner.ID, fmt.Sprintf("Album %d", i+1))
+				for _, number := range numbers {
+					f.track(t, album.ID, number, nil)
+				}
+				albumIDs = append(albumIDs, album.ID)
 			}
 
-			service := NewTrackService(trackRepo, albumRepo, fileService)
+			var trackRepo services.TrackRepository = f.tracks
+			if tt.failing {
+				trackRepo = failingTracks{f.tracks}
+			}
+			service := services.NewTrackService(trackRepo, f.albums, f.blobService)
 
-			tracks, err := service.GetTracksByAlbum(context.Background(), tt.albumID)
+			tracks, err := service.GetTracksByAlbum(context.Background(), albumIDs[tt.album])
 
 			if tt.wantErr {
 				if err == nil {
@@ -386,26 +248,19 @@ func TestTrackService_GetTracksByAlbum(t *testing.T) {
 				}
 				return
 			}
-
 			if err != nil {
-				t.Errorf("unexpected error: %v", err)
-				return
-			}
-
-			if len(tracks) != tt.wantCount {
-				t.Errorf("expected %d tracks, got %d", tt.wantCount, len(tracks))
+				t.Fatalf("unexpected error: %v", err)
 			}
 
+			var numbers []int
 			for i, track := range tracks {
-				if track.AlbumID != tt.albumID {
-					t.Errorf("track %d has albumID %d, expected %d", i, track.AlbumID, tt.albumID)
+				if track.AlbumID != albumIDs[tt.album] {
+					t.Errorf("track %d has albumID %d, expected %d", i, track.AlbumID, albumIDs[tt.album])
 				}
+				numbers = append(numbers, track.TrackNumber)
 			}
-
-			if tt.wantCount > 0 && len(tracks) > 0 {
-				if tracks[0].Title == "" {
-					t.Errorf("first track has empty title")
-				}
+			if !slices.Equal(numbers, tt.wantNumbers) {
+				t.Errorf("expected tracks %v, got %v", tt.wantNumbers, numbers)
 			}
 		})
 	}
@@ -417,72 +272,62 @@ func TestTrackService_UpdateTrack(t *testing.T) {
 
 	tests := []struct {
 		name        string
-		trackID     uint64
-		userID      uint64
+		asOther     bool // updated by a user who doesn't own the album
 		title       *string
 		trackNumber *int
-		setupMocks  func(*mockTrackRepository, *mockAlbumRepository)
+		credits     []pkg.Credit
 		wantErr     bool
 		errContains string
+		errIs       error
 	}{
 		{
 			name:        "successful update",
-			trackID:     1,
-			userID:      1,
 			title:       &newTitle,
 			trackNumber: &newTrackNumber,
-			setupMocks: func(trackRepo *mockTrackRepository, albumRepo *mockAlbumRepository) {
-				trackRepo.tracks[1] = &Track{
-					ID:          1,
-					AlbumID:     1,
-					TrackNumber: 1,
-					Title:       "Old Title",
-				}
-				albumRepo.albums[1] = &Album{
-					ID:     1,
-					UserID: 1,
-				}
-			},
-			wantErr: false,
 		},
 		{
 			name:    "unauthorized update",
-			trackID: 1,
-			userID:  2,
+			asOther: true,
 			title:   &newTitle,
-			setupMocks: func(trackRepo *mockTrackRepository, albumRepo *mockAlbumRepository) {
-				trackRepo.tracks[1] = &Track{
-					ID:      1,
-					AlbumID: 1,
-				}
-				albumRepo.albums[1] = &Album{
-					ID:     1,
-					UserID: 1, // Different user, unauthorized
-				}
-			},
+			wantErr: true,
+			errIs:   services.ErrNotOwner,
+		},
+		{
+			name:    "credits",
+			credits: []pkg.Credit{{Role: " Performer", Name: "Jaki Liebezeit ", Detail: "drums"}},
+		},
+		{
+			name:        "credit with an unknown role",
+			credits:     []pkg.Credit{{Role: "tea boy", Name: "Malcolm Mooney"}},
 			wantErr:     true,
-			errContains: "unauthorized",
+			errContains: "role must be one of",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			trackRepo := &mockTrackRepository{tracks: make(map[uint64]*Track)}
-			albumRepo := &mockAlbumRepository{albums: make(map[uint64]*Album)}
-			fileService := &mockFileDeleter{}
+			f := newFixture(t)
+			owner, other := f.user(t, "alice"), f.user(t, "bob")
+			saved := f.track(t, f.album(t, owner.ID, "Tago Mago").ID, 1, nil)
 
-			tt.setupMocks(trackRepo, albumRepo)
+			userID := owner.ID
+			if tt.asOther {
+				userID = other.ID
+			}
 
-			service := NewTrackService(trackRepo, albumRepo, fileService)
+			service := services.NewTrackService(f.tracks, f.albums, f.blobService)
 
 			track, err := service.UpdateTrack(
 				context.Background(),
-				tt.userID,
-				tt.trackID,
+				userID,
+				saved.ID,
+				nil,
+				nil,
 				tt.trackNumber,
 				tt.title,
 				nil,
 				nil,
+				tt.credits,
 			)
 
 			if tt.wantErr {
@@ -493,13 +338,28 @@ func TestTrackService_UpdateTrack(t *testing.T) {
 				if tt.errContains != "" && !strings.Contains(err.Error(), tt.errContains) {
 					t.Errorf("expected error to contain '%s', got '%s'", tt.errContains, err.Error())
 				}
-			} else {
-				if err != nil {
-					t.Errorf("unexpected error: %v", err)
-					return
+				if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+					t.Errorf("expected error to wrap %v, got %v", tt.errIs, err)
 				}
-				if tt.title != nil && track.Title != *tt.title {
-					t.Errorf("expected title '%s', got '%s'", *tt.title, track.Title)
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			stored, err := f.tracks.FindByID(context.Background(), saved.ID)
+			if err != nil {
+				t.Fatalf("FindByID() error = %v", err)
+			}
+			for _, got := range []*services.Track{track, stored} {
+				if tt.title != nil && got.Title != *tt.title {
+					t.Errorf("expected title '%s', got '%s'", *tt.title, got.Title)
+				}
+				if tt.trackNumber != nil && got.TrackNumber != *tt.trackNumber {
+					t.Errorf("expected track number %d, got %d", *tt.trackNumber, got.TrackNumber)
+				}
+				if tt.credits != nil && (len(got.Credits) != 1 || got.Credits[0] != (pkg.Credit{Role: "performer", Name: "Jaki Liebezeit", Detail: "drums"})) {
+					t.Errorf("expected the credit tidied, got %+v", got.Credits)
 				}
 			}
 		})
@@ -509,68 +369,79 @@ func TestTrackService_UpdateTrack(t *testing.T) {
 func TestTrackService_DeleteTrack(t *testing.T) {
 	tests := []struct {
 		name        string
-		trackID     uint64
-		userID      uint64
-		setupMocks  func(*mockTrackRepository, *mockAlbumRepository)
+		asOther     bool // deleted by a user who doesn't own the album
 		wantErr     bool
-		errContains string
+		errIs       error
+		wantTrashed bool
 	}{
 		{
-			name:    "successful delete",
-			trackID: 1,
-			userID:  1,
-			setupMocks: func(trackRepo *mockTrackRepository, albumRepo *mockAlbumRepository) {
-				trackRepo.tracks[1] = &Track{
-					ID:      1,
-					AlbumID: 1,
-				}
-				albumRepo.albums[1] = &Album{
-					ID:     1,
-					UserID: 1,
-				}
-			},
-			wantErr: false,
+			name:        "successful delete",
+			wantTrashed: true,
 		},
 		{
 			name:    "unauthorized delete",
-			trackID: 1,
-			userID:  2,
-			setupMocks: func(trackRepo *mockTrackRepository, albumRepo *mockAlbumRepository) {
-				trackRepo.tracks[1] = &Track{
-					ID:      1,
-					AlbumID: 1,
-				}
-				albumRepo.albums[1] = &Album{
-					ID:     1,
-					UserID: 1,
-				}
-			},
-			wantErr:     true,
-			errContains: "unauthorized",
+			asOther: true,
+			wantErr: true,
+			errIs:   services.ErrNotOwner,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			trackRepo := &mockTrackRepository{tracks: make(map[uint64]*Track)}
-			albumRepo := &mockAlbumRepository{albums: make(map[uint64]*Album)}
-			fileService := &mockFileDeleter{}
-
-			tt.setupMocks(trackRepo, albumRepo)
+			ctx := context.Background()
+			f := newFixture(t)
+			owner, other := f.user(t, "alice"), f.user(t, "bob")
+			blob := f.blob(t, owner.ID, "audio", ".flac")
+			saved := f.track(t, f.album(t, owner.ID, "Tago Mago").ID, 1, blob)
+
+			userID := owner.ID
+			if tt.asOther {
+				userID = other.ID
+			}
 
-			service := NewTrackService(trackRepo, albumRepo, fileService)
+			service := services.NewTrackService(f.tracks, f.albums, f.blobService)
 
-			err := service.DeleteTrack(context.Background(), tt.userID, tt.trackID)
+			err := service.DeleteTrack(ctx, userID, saved.ID)
 
 			if tt.wantErr {
 				if err == nil {
 					t.Errorf("expected error but got none")
 				}
-			} else {
-				if err != nil {
-					t.Errorf("unexpected error: %v", err)
+				if tt.errIs != nil && !errors.Is(err, tt.errIs) {
+					t.Errorf("expected error to wrap %v, got %v", tt.errIs, err)
 				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if _, err = f.tracks.FindByID(ctx, saved.ID); errors.Is(err, services.ErrTrackNotFound) != tt.wantTrashed {
+				t.Errorf("FindByID() after delete error = %v, want trashed %v", err, tt.wantTrashed)
+			}
+			// deleting only trashes the track, its audio must survive until purge
+			if stored, err := f.blobs.FindByID(ctx, blob.ID); err != nil || stored.RefCount != 1 {
+				t.Errorf("blob after delete = %+v, %v; want it still referenced once", stored, err)
 			}
 		})
 	}
 }
+
+func TestCompareTracks(t *testing.T) {
+	tracks := []*services.Track{
+		{ID: 1, DiscNumber: 2, Side: "C", TrackNumber: 1},
+		{ID: 2, DiscNumber: 1, Side: "AA", TrackNumber: 1},
+		{ID: 3, DiscNumber: 1, Side: "B", TrackNumber: 2},
+		{ID: 4, DiscNumber: 1, Side: "A", TrackNumber: 10},
+		{ID: 5, DiscNumber: 1, Side: "B", TrackNumber: 1},
+		{ID: 6, DiscNumber: 1, Side: "A", TrackNumber: 2},
+	}
+	slices.SortFunc(tracks, services.CompareTracks)
+
+	var positions []string
+	for _, track := range tracks {
+		positions = append(positions, fmt.Sprintf("%d-%s", track.DiscNumber, track.Position()))
+	}
+	want := []string{"1-A2", "1-A10", "1-B1", "1-B2", "1-AA1", "2-C1"}
+	if !slices.Equal(positions, want) {
+		t.Errorf("sorted tracks = %v, want %v", positions, want)
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"vinyl-vault/internal/logging"
+)
+
+// Trash lists what a user has deleted but not yet purged
+type Trash struct {
+	Albums []*Album `json:"albums"`
+	Tracks []*Track `json:"tracks"`
+}
+
+type TrashService struct {
+	albumRepository AlbumRepository
+	trackRepository TrackRepository
+	blobService     BlobReleaser
+	retention       time.Duration // 0 keeps trashed items until purged by hand
+}
+
+func NewTrashService(
+	albumRepository AlbumRepository, trackRepository TrackRepository, blobService BlobReleaser, retention time.Duration,
+) *TrashService {
+	return &TrashService{
+		albumRepository: albumRepository,
+		trackRepository: trackRepository,
+		blobService:     blobService,
+		retention:       retention,
+	}
+}
+
+func (t *TrashService) GetTrash(ctx context.Context, userID uint64) (*Trash, error) {
+	albums, err := t.albumRepository.FindDeletedByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trashed albums: %w", err)
+	}
+
+	tracks, err := t.trackRepository.FindDeletedByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trashed tracks: %w", err)
+	}
+	return &Trash{Albums: albums, Tracks: tracks}, nil
+}
+
+func (t *TrashService) RestoreAlbum(ctx context.Context, userID, albumID uint64) error {
+	if _, err := t.findTrashedAlbum(ctx, userID, albumID); err != nil {
+		return err
+	}
+
+	if err := t.albumRepository.Restore(ctx, albumID); err != nil {
+		return fmt.Errorf("failed to restore album: %w", err)
+	}
+	return nil
+}
+
+func (t *TrashService) RestoreTrack(ctx context.Context, userID, trackID uint64) error {
+	track, err := t.findTrashedTrack(ctx, userID, trackID)
+	if err != nil {
+		return err
+	}
+
+	// restoring into a trashed album would leave the track invisible
+	if _, err = t.albumRepository.FindByID(ctx, track.AlbumID); err != nil {
+		return fmt.Errorf("restore the album first: %w", err)
+	}
+
+	if err = t.trackRepository.Restore(ctx, trackID); err != nil {
+		return fmt.Errorf("failed to restore track: %w", err)
+	}
+	return nil
+}
+
+func (t *TrashService) PurgeAlbum(ctx context.Context, userID, albumID uint64) error {
+	album, err := t.findTrashedAlbum(ctx, userID, albumID)
+	if err != nil {
+		return err
+	}
+	return t.purgeAlbum(ctx, album)
+}
+
+func (t *TrashService) PurgeTrack(ctx context.Context, userID, trackID uint64) error {
+	track, err := t.findTrashedTrack(ctx, userID, trackID)
+	if err != nil {
+		return err
+	}
+	return t.purgeTrack(ctx, userID, track)
+}
+
+// PurgeExpired permanently removes everything that has been in the trash longer than the retention period
+func (t *TrashService) PurgeExpired(ctx context.Context) (int, error) {
+	if t.retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-t.retention)
+	purged := 0
+
+	albums, err := t.albumRepository.FindDeletedBefore(ctx, cutoff)
+	if err != nil {
+		return purged, fmt.Errorf("failed to find expired albums: %w", err)
+	}
+	for _, album := range albums {
+		full, err := t.albumRepository.FindByIDWithDeleted(ctx, album.ID)
+		if err != nil {
+			return purged, fmt.Errorf("failed to load album %d: %w", album.ID, err)
+		}
+		if err = t.purgeAlbum(ctx, full); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	tracks, err := t.trackRepository.FindDeletedBefore(ctx, cutoff)
+	if err != nil {
+		return purged, fmt.Errorf("failed to find expired tracks: %w", err)
+	}
+	for _, track := range tracks {
+		album, err := t.albumRepository.FindByIDWithDeleted(ctx, track.AlbumID)
+		if err != nil {
+			return purged, fmt.Errorf("failed to load album %d: %w", track.AlbumID, err)
+		}
+		if err = t.purgeTrack(ctx, album.UserID, track); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// StartPurger runs PurgeExpired every interval until ctx is cancelled
+func (t *TrashService) StartPurger(ctx context.Context, interval time.Duration) {
+	if t.retention <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				purged, err := t.PurgeExpired(ctx)
+				if err != nil {
+					logging.FromContext(ctx).Error("failed to purge expired trash", "purged", purged, "error", err)
+				} else if purged > 0 {
+					logging.FromContext(ctx).Info("purged expired trash", "purged", purged)
+				}
+			}
+		}
+	}()
+}
+
+func (t *TrashService) purgeAlbum(ctx context.Context, album *Album) error {
+	if err := t.albumRepository.Purge(ctx, album.ID); err != nil {
+		return fmt.Errorf("failed to purge album: %w", err)
+	}
+
+	logger := logging.FromContext(ctx)
+	logger.Info("album purged", "album_id", album.ID, "user_id", album.UserID, "tracks", len(album.Tracks))
+
+	// the cascade removed the track rows; media goes once nothing else references it
+	for _, track := range album.Tracks {
+		if err := releaseTrackAudio(ctx, t.blobService, album.UserID, &track); err != nil {
+			logger.Warn("failed to release purged track's audio", "blob_id", track.BlobID, "error", err)
+		}
+	}
+	if album.CoverBlobID != nil {
+		if err := t.blobService.ReleaseBlob(ctx, album.UserID, *album.CoverBlobID); err != nil {
+			logger.Warn("failed to release purged album's cover", "blob_id", *album.CoverBlobID, "error", err)
+		}
+	}
+	return nil
+}
+
+func (t *TrashService) purgeTrack(ctx context.Context, ownerID uint64, track *Track) error {
+	if err := t.trackRepository.Purge(ctx, track.ID); err != nil {
+		return fmt.Errorf("failed to purge track: %w", err)
+	}
+	logging.FromContext(ctx).Info("track purged", "track_id", track.ID, "user_id", ownerID)
+	if err := releaseTrackAudio(ctx, t.blobService, ownerID, track); err != nil {
+		return fmt.Errorf("failed to release audio file: %w", err)
+	}
+	return nil
+}
+
+func (t *TrashService) findTrashedAlbum(ctx context.Context, userID, albumID uint64) (*Album, error) {
+	album, err := t.albumRepository.FindByIDWithDeleted(ctx, albumID)
+	if err != nil {
+		return nil, fmt.Errorf("album not found: %w", err)
+	}
+	if album.UserID != userID {
+		return nil, fmt.Errorf("album %d: %w", albumID, ErrNotOwner)
+	}
+	if !album.DeletedAt.Valid {
+		return nil, fmt.Errorf("album is not in the trash: %w", ErrAlbumNotFound)
+	}
+	return album, nil
+}
+
+func (t *TrashService) findTrashedTrack(ctx context.Context, userID, trackID uint64) (*Track, error) {
+	track, err := t.trackRepository.FindByIDWithDeleted(ctx, trackID)
+	if err != nil {
+		return nil, fmt.Errorf("track not found: %w", err)
+	}
+	if !track.DeletedAt.Valid {
+		return nil, fmt.Errorf("track is not in the trash: %w", ErrTrackNotFound)
+	}
+
+	album, err := t.albumRepository.FindByIDWithDeleted(ctx, track.AlbumID)
+	if err != nil {
+		return nil, fmt.Errorf("album not found: %w", err)
+	}
+	if album.UserID != userID {
+		return nil, fmt.Errorf("track %d: %w", trackID, ErrNotOwner)
+	}
+	return track, nil
+}
@@ -0,0 +1,339 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"vinyl-vault/internal/services"
+
+	"gorm.io/gorm"
+)
+
+// trashTrack moves the track to the trash as of at
+func (f *fixture) trashTrack(t *testing.T, track *services.Track, at time.Time) {
+	t.Helper()
+	track.DeletedAt = gorm.DeletedAt{Time: at, Valid: true}
+	if err := f.tracks.Save(context.Background(), track); err != nil {
+		t.Fatalf("trashing track: %v", err)
+	}
+}
+
+// trashAlbum moves the album to the trash as of at
+func (f *fixture) trashAlbum(t *testing.T, album *services.Album, at time.Time) {
+	t.Helper()
+	album.DeletedAt = gorm.DeletedAt{Time: at, Valid: true}
+	if err := f.albums.Save(context.Background(), album); err != nil {
+		t.Fatalf("trashing album: %v", err)
+	}
+}
+
+// expectBlobGone checks that the blob's row and file were both deleted
+func (f *fixture) expectBlobGone(t *testing.T, blob *services.Blob) {
+	t.Helper()
+	if _, err := f.blobs.FindByID(context.Background(), blob.ID); !errors.Is(err, services.ErrBlobNotFound) {
+		t.Errorf("FindByID(%d) error = %v, want ErrBlobNotFound", blob.ID, err)
+	}
+	if _, err := os.Stat(f.files.GetFullPath(blob.Path)); !os.IsNotExist(err) {
+		t.Errorf("blob file %s still exists, stat error = %v", blob.Path, err)
+	}
+}
+
+func TestTrashService_PurgeTrack(t *testing.T) {
+	tests := []struct {
+		name         string
+		asOther      bool // purged by a user who doesn't own the album
+		stub         bool
+		notTrashed   bool
+		wantErr      bool
+		wantReleased bool
+	}{
+		{
+			name:         "purge trashed track releases its audio",
+			wantReleased: true,
+		},
+		{
+			name: "purge trashed stub releases nothing",
+			stub: true,
+		},
+		{
+			name:       "track not in trash",
+			notTrashed: true,
+			wantErr:    true,
+		},
+		{
+			name:    "unauthorized purge",
+			asOther: true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			owner, other := f.user(t, "alice"), f.user(t, "bob")
+			album := f.album(t, owner.ID, "Tago Mago")
+			blob := f.blob(t, owner.ID, "audio", ".flac")
+			f.track(t, album.ID, 1, blob) // keeps the blob referenced once the track lets go
+			var audio *services.Blob
+			if !tt.stub {
+				audio = f.blob(t, owner.ID, "audio", ".flac")
+			}
+			track := f.track(t, album.ID, 2, audio)
+			if !tt.notTrashed {
+				if err := f.tracks.Delete(ctx, track.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			userID := owner.ID
+			if tt.asOther {
+				userID = other.ID
+			}
+
+			service := services.NewTrashService(f.albums, f.tracks, f.blobService, 0)
+
+			err := service.PurgeTrack(ctx, userID, track.ID)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error but got none")
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			wantRefs := 2
+			if tt.stub {
+				wantRefs = 1
+			}
+			if tt.wantReleased {
+				wantRefs--
+			}
+			if stored, err := f.blobs.FindByID(ctx, blob.ID); err != nil || stored.RefCount != wantRefs {
+				t.Errorf("blob after purge = %+v, %v; want %d references", stored, err, wantRefs)
+			}
+			if _, err = f.tracks.FindByIDWithDeleted(ctx, track.ID); errors.Is(err, services.ErrTrackNotFound) == tt.wantErr {
+				t.Errorf("FindByIDWithDeleted() after purge error = %v, want purged %v", err, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTrashService_RestoreTrack(t *testing.T) {
+	tests := []struct {
+		name         string
+		asOther      bool // restored by a user who doesn't own the album
+		notTrashed   bool
+		albumTrashed bool
+		errIs        error
+		errContains  string
+	}{
+		{name: "restore trashed track"},
+		{name: "track not in trash", notTrashed: true, errIs: services.ErrTrackNotFound},
+		{name: "unauthorized restore", asOther: true, errIs: services.ErrNotOwner},
+		{name: "album in the trash too", albumTrashed: true, errIs: services.ErrAlbumNotFound, errContains: "restore the album first"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			owner, other := f.user(t, "alice"), f.user(t, "bob")
+			album := f.album(t, owner.ID, "Tago Mago")
+			track := f.track(t, album.ID, 1, f.blob(t, owner.ID, "audio", ".flac"))
+			if !tt.notTrashed {
+				f.trashTrack(t, track, time.Now())
+			}
+			if tt.albumTrashed {
+				f.trashAlbum(t, album, time.Now())
+			}
+
+			userID := owner.ID
+			if tt.asOther {
+				userID = other.ID
+			}
+
+			service := services.NewTrashService(f.albums, f.tracks, f.blobService, 0)
+
+			err := service.RestoreTrack(ctx, userID, track.ID)
+			if tt.errIs != nil {
+				if !errors.Is(err, tt.errIs) || !strings.Contains(err.Error(), tt.errContains) {
+					t.Errorf("RestoreTrack() error = %v, want %v containing %q", err, tt.errIs, tt.errContains)
+				}
+				if stored, err := f.tracks.FindByIDWithDeleted(ctx, track.ID); err != nil || stored.DeletedAt.Valid == tt.notTrashed {
+					t.Errorf("track after a failed restore = %+v, %v; want it left as it was", stored, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RestoreTrack() error = %v", err)
+			}
+			if _, err = f.tracks.FindByID(ctx, track.ID); err != nil {
+				t.Errorf("FindByID() after restore error = %v", err)
+			}
+		})
+	}
+}
+
+func TestTrashService_RestoreAlbum(t *testing.T) {
+	tests := []struct {
+		name       string
+		asOther    bool // restored by a user who doesn't own the album
+		notTrashed bool
+		errIs      error
+	}{
+		{name: "restore trashed album"},
+		{name: "album not in trash", notTrashed: true, errIs: services.ErrAlbumNotFound},
+		{name: "unauthorized restore", asOther: true, errIs: services.ErrNotOwner},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			f := newFixture(t)
+			owner, other := f.user(t, "alice"), f.user(t, "bob")
+			album := f.album(t, owner.ID, "Tago Mago")
+			f.track(t, album.ID, 1, f.blob(t, owner.ID, "audio", ".flac"))
+			if !tt.notTrashed {
+				f.trashAlbum(t, album, time.Now())
+			}
+
+			userID := owner.ID
+			if tt.asOther {
+				userID = other.ID
+			}
+
+			service := services.NewTrashService(f.albums, f.tracks, f.blobService, 0)
+
+			err := service.RestoreAlbum(ctx, userID, album.ID)
+			if tt.errIs != nil {
+				if !errors.Is(err, tt.errIs) {
+					t.Errorf("RestoreAlbum() error = %v, want %v", err, tt.errIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RestoreAlbum() error = %v", err)
+			}
+			restored, err := f.albums.FindByID(ctx, album.ID)
+			if err != nil {
+				t.Fatalf("FindByID() after restore error = %v", err)
+			}
+			if len(restored.Tracks) != 1 {
+				t.Errorf("restored album has %d tracks, want 1", len(restored.Tracks))
+			}
+		})
+	}
+}
+
+func TestTrashService_PurgeAlbum(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	owner, other := f.user(t, "alice"), f.user(t, "bob")
+
+	album := f.album(t, owner.ID, "Tago Mago")
+	cover := f.blob(t, owner.ID, "cover", ".jpg")
+	album.CoverBlobID = &cover.ID
+	if err := f.albums.Save(ctx, album); err != nil {
+		t.Fatal(err)
+	}
+	audio := f.blob(t, owner.ID, "audio", ".flac")
+	shared := f.blob(t, owner.ID, "shared", ".flac")
+	f.track(t, album.ID, 1, audio)
+	f.track(t, album.ID, 2, shared)
+	f.track(t, album.ID, 3, nil)
+	trashedAudio := f.blob(t, owner.ID, "trashed", ".flac")
+	trashed := f.track(t, album.ID, 4, trashedAudio)
+	f.trashTrack(t, trashed, time.Now())
+
+	// the same content on another album keeps its blob
+	f.track(t, f.album(t, owner.ID, "Ege Bamyasi").ID, 1, f.blob(t, owner.ID, "shared", ".flac"))
+
+	service := services.NewTrashService(f.albums, f.tracks, f.blobService, 0)
+
+	if err := service.PurgeAlbum(ctx, owner.ID, album.ID); !errors.Is(err, services.ErrAlbumNotFound) {
+		t.Errorf("PurgeAlbum() of an album not in the trash error = %v, want ErrAlbumNotFound", err)
+	}
+	f.trashAlbum(t, album, time.Now())
+	if err := service.PurgeAlbum(ctx, other.ID, album.ID); !errors.Is(err, services.ErrNotOwner) {
+		t.Errorf("PurgeAlbum() by another user error = %v, want ErrNotOwner", err)
+	}
+
+	if err := service.PurgeAlbum(ctx, owner.ID, album.ID); err != nil {
+		t.Fatalf("PurgeAlbum() error = %v", err)
+	}
+
+	if _, err := f.albums.FindByIDWithDeleted(ctx, album.ID); !errors.Is(err, services.ErrAlbumNotFound) {
+		t.Errorf("FindByIDWithDeleted() after purge error = %v, want ErrAlbumNotFound", err)
+	}
+	if _, err := f.tracks.FindByIDWithDeleted(ctx, trashed.ID); !errors.Is(err, services.ErrTrackNotFound) {
+		t.Errorf("FindByIDWithDeleted() of its trashed track error = %v, want ErrTrackNotFound", err)
+	}
+	for _, blob := range []*services.Blob{cover, audio, trashedAudio} {
+		f.expectBlobGone(t, blob)
+	}
+	if stored, err := f.blobs.FindByID(ctx, shared.ID); err != nil || stored.RefCount != 1 {
+		t.Errorf("shared blob after purge = %+v, %v; want 1 reference left", stored, err)
+	}
+	if user, err := f.users.FindByID(ctx, owner.ID); err != nil || user.StorageUsed != shared.Size {
+		t.Errorf("storage used after purge = %d, %v; want %d for the shared blob", user.StorageUsed, err, shared.Size)
+	}
+}
+
+func TestTrashService_PurgeExpired(t *testing.T) {
+	ctx := context.Background()
+	retention := 30 * 24 * time.Hour
+	expired, kept := time.Now().Add(-retention-time.Hour), time.Now().Add(-retention+time.Hour)
+
+	f := newFixture(t)
+	owner := f.user(t, "alice")
+
+	expiredAlbum := f.album(t, owner.ID, "Tago Mago")
+	expiredAlbumAudio := f.blob(t, owner.ID, "tago mago", ".flac")
+	f.track(t, expiredAlbum.ID, 1, expiredAlbumAudio)
+	f.trashAlbum(t, expiredAlbum, expired)
+
+	keptAlbum := f.album(t, owner.ID, "Ege Bamyasi")
+	f.track(t, keptAlbum.ID, 1, f.blob(t, owner.ID, "ege bamyasi", ".flac"))
+	f.trashAlbum(t, keptAlbum, kept)
+
+	live := f.album(t, owner.ID, "Future Days")
+	expiredTrackAudio := f.blob(t, owner.ID, "moonshake", ".flac")
+	expiredTrack := f.track(t, live.ID, 1, expiredTrackAudio)
+	f.trashTrack(t, expiredTrack, expired)
+	keptTrack := f.track(t, live.ID, 2, f.blob(t, owner.ID, "spray", ".flac"))
+	f.trashTrack(t, keptTrack, kept)
+	liveTrack := f.track(t, live.ID, 3, f.blob(t, owner.ID, "bel air", ".flac"))
+
+	if purged, err := services.NewTrashService(f.albums, f.tracks, f.blobService, 0).PurgeExpired(ctx); err != nil || purged != 0 {
+		t.Errorf("PurgeExpired() without retention = %d, %v; want nothing purged", purged, err)
+	}
+
+	purged, err := services.NewTrashService(f.albums, f.tracks, f.blobService, retention).PurgeExpired(ctx)
+	if err != nil || purged != 2 {
+		t.Fatalf("PurgeExpired() = %d, %v; want 2", purged, err)
+	}
+
+	if _, err = f.albums.FindByIDWithDeleted(ctx, expiredAlbum.ID); !errors.Is(err, services.ErrAlbumNotFound) {
+		t.Errorf("album trashed past retention: FindByIDWithDeleted() error = %v, want ErrAlbumNotFound", err)
+	}
+	if _, err = f.albums.FindByIDWithDeleted(ctx, keptAlbum.ID); err != nil {
+		t.Errorf("album trashed within retention: FindByIDWithDeleted() error = %v", err)
+	}
+	if _, err = f.tracks.FindByIDWithDeleted(ctx, expiredTrack.ID); !errors.Is(err, services.ErrTrackNotFound) {
+		t.Errorf("track trashed past retention: FindByIDWithDeleted() error = %v, want ErrTrackNotFound", err)
+	}
+	for _, track := range []*services.Track{keptTrack, liveTrack} {
+		if _, err = f.tracks.FindByIDWithDeleted(ctx, track.ID); err != nil {
+			t.Errorf("track %d: FindByIDWithDeleted() error = %v", track.TrackNumber, err)
+		}
+	}
+	f.expectBlobGone(t, expiredAlbumAudio)
+	f.expectBlobGone(t, expiredTrackAudio)
+	if _, err = f.blobs.FindByID(ctx, *keptTrack.BlobID); err != nil {
+		t.Errorf("blob of the track within retention: FindByID() error = %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/mail"
 	"time"
+	"vinyl-vault/internal/logging"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -12,13 +13,18 @@ import (
 const passwordMinLength = 8
 
 type User struct {
-	ID           uint64    `json:"id" gorm:"primaryKey;autoIncrement"`
-	Username     string    `json:"username" gorm:"uniqueIndex;not null"`
-	Email        string    `json:"email" gorm:"uniqueIndex;not null"`
-	IsAdmin      bool      `json:"is_admin" gorm:"default:false"`
-	PasswordHash string    `json:"-" gorm:"not null"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           uint64 `json:"id" gorm:"primaryKey;autoIncrement"`
+	Username     string `json:"username" gorm:"uniqueIndex;not null"`
+	Email        string `json:"email" gorm:"uniqueIndex;not null"`
+	IsAdmin      bool   `json:"is_admin" gorm:"default:false"`
+	PasswordHash string `json:"-" gorm:"not null"`
+	StorageQuota *int64 `json:"storage_quota,omitempty"` // bytes, nil uses the instance default
+	StorageUsed  int64  `json:"storage_used" gorm:"not null;default:0"`
+	// ConversionPreset names the preset downloads are converted with when they don't
+	// ask for one; empty downloads tracks as they are stored
+	ConversionPreset string    `json:"conversion_preset,omitempty" gorm:"size:64;not null;default:''"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
 type UserRepository interface {
@@ -27,30 +33,46 @@ type UserRepository interface {
 	FindByEmail(ctx context.Context, email string) (*User, error)
 	Save(ctx context.Context, user *User) error
 	Delete(ctx context.Context, id uint64) error
+	// AdjustStorageUsed atomically adds delta bytes to the user's storage usage
+	AdjustStorageUsed(ctx context.Context, id uint64, delta int64) error
+	Count(ctx context.Context) (int64, error)
 }
 
 type UserService struct {
-	userRepository UserRepository
+	userRepository    UserRepository
+	passwordCost      int
+	conversionService *ConversionService
 }
 
 func NewUserService(userRepository UserRepository) *UserService {
 	return &UserService{
 		userRepository: userRepository,
+		passwordCost:   bcrypt.DefaultCost,
 	}
 }
 
+// SetPasswordCost sets the bcrypt cost for newly hashed passwords; existing hashes keep theirs
+func (u *UserService) SetPasswordCost(cost int) {
+	u.passwordCost = cost
+}
+
+// SetConversionService lets users pick the conversion preset their downloads default to
+func (u *UserService) SetConversionService(conversionService *ConversionService) {
+	u.conversionService = conversionService
+}
+
 func (u *UserService) Register(ctx context.Context, username, email, password string) (*User, error) {
 
 	// validate email
 	if !isEmailValid(email) {
-		return nil, fmt.Errorf("invalid email")
+		return nil, NewValidationError("email", "is not a valid email address")
 	}
 	// validate password length
 	if len(password) < passwordMinLength {
-		return nil, fmt.Errorf("password needs at least 8 characters")
+		return nil, NewValidationError("password", "must be at least 8 characters")
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), u.passwordCost)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -63,18 +85,24 @@ func (u *UserService) Register(ctx context.Context, username, email, password st
 	if err = u.userRepository.Save(ctx, user); err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
+	logging.FromContext(ctx).Info("user registered", "user_id", user.ID, "username", user.Username)
 	return user, nil
 }
 
 func (u *UserService) Login(ctx context.Context, username, password string) (*User, error) {
 	user, err := u.userRepository.FindByUsername(ctx, username)
 	if err != nil {
-		return nil, fmt.Errorf("invalid credentials")
+		if IsNotFound(err) {
+			logging.FromContext(ctx).Warn("failed login", "username", username, "reason", "unknown user")
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to find user: %w", err)
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
 	if err != nil {
-		return nil, fmt.Errorf("invalid credentials")
+		logging.FromContext(ctx).Warn("failed login", "username", username, "reason", "wrong password")
+		return nil, ErrInvalidCredentials
 	}
 	return user, nil
 }
@@ -108,7 +136,7 @@ func (u *UserService) UpdateEmail(ctx context.Context, id uint64, email string)
 
 	// validate new email
 	if !isEmailValid(email) {
-		return nil, fmt.Errorf("invalid new email")
+		return nil, NewValidationError("email", "is not a valid email address")
 	}
 
 	user.Email = email
@@ -119,6 +147,31 @@ func (u *UserService) UpdateEmail(ctx context.Context, id uint64, email string)
 	return user, nil
 }
 
+// UpdateConversionPreset sets the preset the user's downloads are converted with by
+// default; an empty name downloads tracks as they are stored again
+func (u *UserService) UpdateConversionPreset(ctx context.Context, id uint64, name string) (*User, error) {
+	if name != "" {
+		if u.conversionService == nil {
+			return nil, NewValidationError("preset", "conversion presets are not available")
+		}
+		preset, err := u.conversionService.Preset(name)
+		if err != nil {
+			return nil, err
+		}
+		name = preset.Name
+	}
+	user, err := u.userRepository.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	user.ConversionPreset = name
+
+	if err = u.userRepository.Save(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update conversion preset: %w", err)
+	}
+	return user, nil
+}
+
 func (u *UserService) ChangePassword(ctx context.Context, id uint64, oldPassword, newPassword string) error {
 	user, err := u.userRepository.FindByID(ctx, id)
 	if err != nil {
@@ -126,14 +179,15 @@ func (u *UserService) ChangePassword(ctx context.Context, id uint64, oldPassword
 	}
 
 	if err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword)); err != nil {
-		return fmt.Errorf("incorrect current password")
+		logging.FromContext(ctx).Warn("failed password change", "user_id", id, "reason", "wrong current password")
+		return fmt.Errorf("incorrect current password: %w", ErrInvalidCredentials)
 	}
 
 	if len(newPassword) < passwordMinLength {
-		return fmt.Errorf("password needs at least 8 characters")
+		return NewValidationError("new_password", "must be at least 8 characters")
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), u.passwordCost)
 	if err != nil {
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -154,6 +208,7 @@ func (u *UserService) DeleteUser(ctx context.Context, id uint64) error {
 	if err := u.userRepository.Delete(ctx, id); err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
+	logging.FromContext(ctx).Info("user deleted", "user_id", id)
 	return nil
 }
 
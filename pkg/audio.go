@@ -1,5 +1,7 @@
 package pkg
 
+import "time"
+
 type AudioQuality struct {
 	Format     string `json:"format"`
 	Bitrate    int    `json:"bitrate"`
@@ -7,3 +9,30 @@ type AudioQuality struct {
 	BitDepth   int    `json:"bitDepth"`
 	Channels   int    `json:"channels"`
 }
+
+// RipQuality is what analyzing a track's decoded audio found, beside the AudioQuality
+// its file claims. Flags names the problems found, from the Rip constants; none is a
+// clean rip.
+type RipQuality struct {
+	ClippedSamples    int64     `json:"clipped_samples"`     // in runs of three or more at full scale
+	InterSamplePeaks  int64     `json:"inter_sample_peaks"`  // samples where the waveform between them passes full scale
+	ClicksPerMinute   float64   `json:"clicks_per_minute"`   // clicks and pops
+	DCOffset          float64   `json:"dc_offset"`           // of the channel furthest off, 1 being full scale
+	ChannelImbalance  float64   `json:"channel_imbalance"`   // dB the left channel is louder than the right by
+	Bandwidth         int       `json:"bandwidth"`           // Hz, where the spectrum falls to the noise floor
+	EffectiveBitDepth int       `json:"effective_bit_depth"` // bits the samples actually use
+	Flags             []string  `json:"flags,omitempty"`
+	AnalyzedAt        time.Time `json:"analyzed_at"`
+}
+
+// The problems RipQuality.Flags can name
+const (
+	RipClipping         = "clipping"
+	RipInterSamplePeaks = "inter_sample_peaks"
+	RipClicks           = "clicks"
+	RipDCOffset         = "dc_offset"
+	RipChannelImbalance = "channel_imbalance"
+	RipPaddedBitDepth   = "padded_bit_depth" // e.g. 16-bit audio in a 24-bit file
+	RipUpsampled        = "upsampled"        // nothing above what a 44.1 or 48 kHz source holds
+	RipLossySource      = "lossy_source"     // the brick-wall cutoff of a lossy encoder
+)
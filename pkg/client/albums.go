@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"vinyl-vault/pkg"
+)
+
+// ErrCoverArtRejected is returned with the album when it was created but its cover art was not stored
+var ErrCoverArtRejected = errors.New("album created but cover art failed")
+
+// CreateAlbum creates an album of the given media, with cover art when cover is not nil.
+// Without media the album is a single disc.
+func (c *Client) CreateAlbum(ctx context.Context, metadata pkg.Metadata, media []Medium, cover *Upload) (*Album, error) {
+	fields, err := albumForm(metadata, media, cover)
+	if err != nil {
+		return nil, err
+	}
+
+	// a rejected cover turns the album into {"album": ..., "warning": ...}
+	var raw json.RawMessage
+	if err = c.doMultipart(ctx, http.MethodPost, "/album", fields, &raw); err != nil {
+		return nil, err
+	}
+	var wrapped struct {
+		Album   *Album `json:"album"`
+		Warning string `json:"warning"`
+	}
+	if err = json.Unmarshal(raw, &wrapped); err == nil && wrapped.Album != nil {
+		return wrapped.Album, fmt.Errorf("%w: %s", ErrCoverArtRejected, wrapped.Warning)
+	}
+
+	var album Album
+	if err = json.Unmarshal(raw, &album); err != nil {
+		return nil, fmt.Errorf("failed to decode POST /album response: %w", err)
+	}
+	return &album, nil
+}
+
+func (c *Client) Album(ctx context.Context, id uint64) (*Album, error) {
+	var out Album
+	if err := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/album/%d", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// MyAlbums lists the albums owned by the current user
+func (c *Client) MyAlbums(ctx context.Context) ([]Album, error) {
+	var out []Album
+	if err := c.doJSON(ctx, http.MethodGet, "/albums/me", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// UpdateAlbum replaces the album's metadata, its media unless media is nil, and its
+// cover art when cover is not nil
+func (c *Client) UpdateAlbum(ctx context.Context, id uint64, metadata pkg.Metadata, media []Medium, cover *Upload) (*Album, error) {
+	fields, err := albumForm(metadata, media, cover)
+	if err != nil {
+		return nil, err
+	}
+	var out Album
+	if err = c.doMultipart(ctx, http.MethodPut, fmt.Sprintf("/album/%d", id), fields, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateCredits replaces the credits of the album's tracks listed in credits, by track
+// ID, leaving the rest of the album as it is
+func (c *Client) UpdateCredits(ctx context.Context, album *Album, credits map[uint64][]pkg.Credit) (*Album, error) {
+	fields, err := albumForm(album.Metadata, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	field, err := jsonField("credits", credits)
+	if err != nil {
+		return nil, err
+	}
+	var out Album
+	if err = c.doMultipart(ctx, http.MethodPut, fmt.Sprintf("/album/%d", album.ID), append(fields, field), &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// SearchAlbums finds the current user's albums matching every field of query that is set
+func (c *Client) SearchAlbums(ctx context.Context, query AlbumQuery) ([]Album, error) {
+	params := url.Values{}
+	for name, value := range map[string]string{"q": query.Text, "genre": query.Genre, "style": query.Style, "credit": query.Credit} {
+		if value != "" {
+			params.Set(name, value)
+		}
+	}
+	var out []Album
+	if err := c.doJSON(ctx, http.MethodGet, "/albums/search?"+params.Encode(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ExportAlbum exports the album's metadata
+func (c *Client) ExportAlbum(ctx context.Context, id uint64) (*Export, error) {
+	var out Export
+	if err := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/album/%d/export", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ExportAlbums exports the metadata of all the current user's albums
+func (c *Client) ExportAlbums(ctx context.Context) (*Export, error) {
+	var out Export
+	if err := c.doJSON(ctx, http.MethodGet, "/albums/me/export", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AnalyzeAlbum queues the album's tracks for loudness analysis on the server, and
+// returns how many were queued. Album and tracks carry the results once it is done.
+func (c *Client) AnalyzeAlbum(ctx context.Context, id uint64) (int, error) {
+	var out struct {
+		Queued int `json:"queued"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, fmt.Sprintf("/album/%d/analyze", id), nil, &out); err != nil {
+		return 0, err
+	}
+	return out.Queued, nil
+}
+
+// DeleteAlbum moves the album to the trash
+func (c *Client) DeleteAlbum(ctx context.Context, id uint64) error {
+	return c.doJSON(ctx, http.MethodDelete, fmt.Sprintf("/album/%d", id), nil, nil)
+}
+
+func albumForm(metadata pkg.Metadata, media []Medium, cover *Upload) ([]formField, error) {
+	field, err := jsonField("metadata", metadata)
+	if err != nil {
+		return nil, err
+	}
+	fields := []formField{field}
+	if media != nil {
+		if field, err = jsonField("media", media); err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	if cover != nil {
+		fields = append(fields, formField{name: "cover_art", file: cover})
+	}
+	return fields, nil
+}
@@ -0,0 +1,279 @@
+// Package client is a typed Go client for the vinyl-vault REST API described in api/openapi.json.
+//
+// Log in with a session, which the client keeps in its cookie jar:
+//
+//	c, err := client.New("https://vault.example.com")
+//	user, err := c.Login(ctx, "alice", "secret")
+//
+// or pass a bearer token with WithToken, for deployments that authenticate API
+// clients at a reverse proxy. Uploads are streamed from an io.Reader and downloads
+// are returned unread, so large files never have to fit in memory.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+)
+
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends requests through httpClient. Session auth needs its Jar;
+// New adds one when it has none.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken sends token as a bearer token on every request
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: scheme must be http or https", baseURL)
+	}
+
+	c := &Client{baseURL: u, httpClient: &http.Client{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.httpClient.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		copied := *c.httpClient
+		copied.Jar = jar
+		c.httpClient = &copied
+	}
+	return c, nil
+}
+
+// Error is a failed request, decoded from the server's problem details
+type Error struct {
+	StatusCode int
+	Title      string       `json:"title"`
+	Code       string       `json:"code"`
+	Detail     string       `json:"detail"`
+	Errors     []FieldError `json:"errors"`
+	RequestID  string       `json:"request_id"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, e.Code)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	for _, field := range e.Errors {
+		msg += fmt.Sprintf("; %s %s", field.Field, field.Message)
+	}
+	return msg
+}
+
+// IsCode reports whether err is an API error with the given code, e.g. "album_not_found"
+func IsCode(err error, code string) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// Upload is a file sent in a multipart request
+type Upload struct {
+	Filename string
+	Body     io.Reader
+}
+
+// Download is an unread file response. The caller must close Body.
+type Download struct {
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64 // -1 when unknown
+	Filename      string
+	Partial       bool // the server answered a Range request with 206
+}
+
+func (c *Client) url(path string) string {
+	return c.baseURL.String() + path
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// send performs req and turns error statuses into *Error
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if json.Unmarshal(data, apiErr) != nil || apiErr.Code == "" {
+		apiErr.Code = "http_error"
+		apiErr.Detail = strings.TrimSpace(string(data))
+	}
+	return nil, apiErr
+}
+
+// doJSON sends in as a JSON body, when not nil, and decodes the response into out, when not nil
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return c.decode(req, out)
+}
+
+func (c *Client) decode(req *http.Request, out any) error {
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s %s response: %w", req.Method, req.URL.Path, err)
+	}
+	return nil
+}
+
+// formField is a multipart part: a plain value, a JSON-encoded value or a file
+type formField struct {
+	name  string
+	value string
+	file  *Upload
+}
+
+// doMultipart streams the fields as multipart/form-data, without buffering file contents
+func (c *Client) doMultipart(ctx context.Context, method, path string, fields []formField, out any) error {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeForm(writer, fields))
+	}()
+
+	req, err := c.newRequest(ctx, method, path, pr)
+	if err != nil {
+		pr.Close()
+		return err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	err = c.decode(req, out)
+	pr.Close() // unblocks the writer if the server answered before reading everything
+	return err
+}
+
+func writeForm(writer *multipart.Writer, fields []formField) error {
+	for _, field := range fields {
+		if field.file == nil {
+			if err := writer.WriteField(field.name, field.value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		part, err := writer.CreateFormFile(field.name, field.file.Filename)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(part, field.file.Body); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", field.file.Filename, err)
+		}
+	}
+	return writer.Close()
+}
+
+func jsonField(name string, value any) (formField, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return formField{}, err
+	}
+	return formField{name: name, value: string(data)}, nil
+}
+
+// download opens a file response; rangeStart > 0 asks for the rest of the file from that offset
+func (c *Client) download(ctx context.Context, path string, rangeStart int64) (*Download, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Del("Accept")
+	if rangeStart > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", rangeStart))
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	download := &Download{
+		Body:          resp.Body,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+		Partial:       resp.StatusCode == http.StatusPartialContent,
+	}
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		download.Filename = params["filename"]
+	}
+	return download, nil
+}
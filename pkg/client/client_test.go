@@ -0,0 +1,807 @@
+package client
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"vinyl-vault/internal/handlers"
+	"vinyl-vault/internal/repositories/memory"
+	"vinyl-vault/internal/services"
+	"vinyl-vault/internal/services/audiotest"
+	"vinyl-vault/pkg"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestServer runs the real handlers on in-memory repositories and returns a
+// registration key for a new account
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+
+	store := memory.NewStore()
+	users := memory.NewUserRepository(store)
+	albums := memory.NewAlbumRepository(store)
+	tracks := memory.NewTrackRepository(store)
+
+	dir := t.TempDir()
+	fileService := services.NewFileService(dir, filepath.Join(dir, "covers"), filepath.Join(dir, "audio"))
+	if err := fileService.EnsureDirectoriesExist(); err != nil {
+		t.Fatal(err)
+	}
+	conversionService := services.NewConversionService(dir)
+	blobService := services.NewBlobService(memory.NewBlobRepository(store), fileService, nil)
+	// there is no ffmpeg to test with, so uploads are kept as they are
+	blobService.SetFLACIngest(conversionService)
+	albumService := services.NewAlbumService(albums, tracks, blobService)
+	trackService := services.NewTrackService(tracks, albums, blobService)
+	userService := services.NewUserService(users)
+	userService.SetPasswordCost(bcrypt.MinCost)
+	userService.SetConversionService(conversionService)
+	keyService := services.NewRegistrationKeyService(memory.NewRegistrationKeyRepository(store), users)
+
+	admin, err := userService.Register(ctx, "admin", "admin@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin.IsAdmin = true
+	if err = users.Save(ctx, admin); err != nil {
+		t.Fatal(err)
+	}
+	key, err := keyService.GenerateKey(ctx, admin.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(sessions.Sessions("vinylvault_session", cookie.NewStore([]byte("test-secret"))))
+	router.Use(func(c *gin.Context) {
+		if userID := sessions.Default(c).Get("user_id"); userID != nil {
+			c.Set("user_id", userID)
+		}
+	})
+	handlers.NewUserHandler(userService, keyService, services.NewQuotaService(users, albums, memory.NewBlobRepository(store), 0)).RegisterUserRoutes(router)
+	splitService := services.NewSplitService(tracks, albums, blobService, fileService, conversionService)
+	group := router.Group("")
+	handlers.NewAlbumHandler(albumService, fileService, blobService, splitService).RegisterAlbumRoutes(group)
+	handlers.NewTrackHandler(trackService, fileService, blobService, splitService).RegisterTrackRoutes(group)
+	handlers.NewFileHandler(fileService, trackService, albumService, splitService, userService, conversionService).RegisterFileRoutes(group)
+	analysisService := services.NewAnalysisService(tracks, albums, fileService, conversionService)
+	handlers.NewAnalysisHandler(analysisService).RegisterAnalysisRoutes(group)
+	spectrogramService := services.NewSpectrogramService(fileService, conversionService, filepath.Join(dir, "cache"))
+	handlers.NewSpectrogramHandler(trackService, albumService, spectrogramService).RegisterSpectrogramRoutes(group)
+	releaseDir := filepath.Join(dir, "releases")
+	if err = os.MkdirAll(releaseDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(releaseDir, "can.json"), []byte(releaseFixture), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	lookupService := services.NewLookupService(albums, tracks, services.NewFileProvider(releaseDir))
+	handlers.NewLookupHandler(lookupService).RegisterLookupRoutes(group)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, key.Key
+}
+
+// releaseFixture is what the file provider of the test server finds
+const releaseFixture = `{
+  "version": 1,
+  "exported_at": "2026-01-01T00:00:00Z",
+  "releases": [{
+    "artist": "Can", "title": "Ege Bamyasi", "format": "LP", "label": "United Artists",
+    "catalog_number": "UAS 29 414", "barcode": "5016025610389", "genres": ["Rock"],
+    "media": [{"number": 1, "format": "12\"", "speed": 33}],
+    "tracks": [
+      {"position": "A1", "disc_number": 1, "side": "A", "track_number": 1, "title": "Pinch", "duration": 570},
+      {"position": "A2", "disc_number": 1, "side": "A", "track_number": 2, "title": "Sing Swan Song", "duration": 288},
+      {"position": "B1", "disc_number": 1, "side": "B", "track_number": 1, "title": "Vitamin C", "duration": 211,
+       "credits": [{"role": "performer", "name": "Damo Suzuki", "detail": "vocals"}]}
+    ]
+  }]
+}`
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	server, key := newTestServer(t)
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.Register(ctx, RegisterRequest{RegistrationKey: key, Username: "alice", Email: "alice@example.com", Password: "password"}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if _, err = c.Login(ctx, "alice", "password"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	me, err := c.CurrentUser(ctx)
+	if err != nil || me.Username != "alice" {
+		t.Fatalf("CurrentUser() = %+v, %v; want alice", me, err)
+	}
+
+	album, err := c.CreateAlbum(ctx, pkg.Metadata{Artist: "Can", Album: "Tago Mago", Format: "LP"}, nil,
+		&Upload{Filename: "cover.jpg", Body: bytes.NewReader([]byte("jpeg"))})
+	if err != nil {
+		t.Fatalf("CreateAlbum() error = %v", err)
+	}
+	if album.CoverBlobID == nil {
+		t.Error("CreateAlbum() stored no cover art")
+	}
+
+	audio := []byte("not really flac, but the extension is what counts")
+	sum := sha256.Sum256(audio)
+	track := CreateTrackRequest{AlbumID: album.ID, TrackNumber: 1, Title: "Paperhouse", Duration: 448, SHA256: hex.EncodeToString(sum[:])}
+	first, err := c.CreateTrack(ctx, track, &Upload{Filename: "paperhouse.flac", Body: bytes.NewReader(audio)})
+	if err != nil {
+		t.Fatalf("CreateTrack() with upload error = %v", err)
+	}
+
+	// the same content again needs no upload
+	track.TrackNumber, track.Title = 2, "Paperhouse (again)"
+	second, err := c.CreateTrack(ctx, track, nil)
+	if err != nil {
+		t.Fatalf("CreateTrack() by hash error = %v", err)
+	}
+	if second.BlobID != first.BlobID {
+		t.Errorf("CreateTrack() by hash used blob %d, want %d", second.BlobID, first.BlobID)
+	}
+
+	// another user has to upload the content to get it
+	admin, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = admin.Login(ctx, "admin", "password"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	adminAlbum, err := admin.CreateAlbum(ctx, pkg.Metadata{Artist: "Can", Album: "Monster Movie", Format: "LP"}, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateAlbum() error = %v", err)
+	}
+	if _, err = admin.CreateTrack(ctx, CreateTrackRequest{AlbumID: adminAlbum.ID, TrackNumber: 1, Title: "Father Cannot Yell", SHA256: track.SHA256}, nil); !isMissingAudio(err) {
+		t.Errorf("CreateTrack() by another user's hash error = %v, want audio_file required", err)
+	}
+
+	stream, err := c.StreamTrack(ctx, first.ID, 4)
+	if err != nil {
+		t.Fatalf("StreamTrack() error = %v", err)
+	}
+	got, _ := io.ReadAll(stream.Body)
+	stream.Body.Close()
+	if !stream.Partial || !bytes.Equal(got, audio[4:]) {
+		t.Errorf("StreamTrack() from 4 = partial %v, %q; want %q", stream.Partial, got, audio[4:])
+	}
+
+	download, err := c.DownloadTrack(ctx, first.ID)
+	if err != nil {
+		t.Fatalf("DownloadTrack() error = %v", err)
+	}
+	download.Body.Close()
+	if download.Filename != "Paperhouse.flac" {
+		t.Errorf("DownloadTrack() filename = %q, want Paperhouse.flac", download.Filename)
+	}
+
+	if _, err = c.Album(ctx, 999); !IsCode(err, "album_not_found") {
+		t.Errorf("Album() of a missing album error = %v, want album_not_found", err)
+	}
+
+	if err = c.Logout(ctx); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	var apiErr *Error
+	if _, err = c.CurrentUser(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("CurrentUser() after Logout error = %v, want 401", err)
+	}
+}
+
+func TestWithToken(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		w.Write([]byte(`{"user": {"id": 1}}`))
+	}))
+	defer server.Close()
+
+	c, err := New(server.URL, WithToken("t0ken"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.CurrentUser(context.Background()); err != nil {
+		t.Fatalf("CurrentUser() error = %v", err)
+	}
+	if authorization != "Bearer t0ken" {
+		t.Errorf("Authorization = %q, want Bearer t0ken", authorization)
+	}
+}
+
+// wavFile is a 16-bit stereo WAV at 8 kHz whose every frame holds its own index
+func TestMediaAndSides(t *testing.T) {
+	ctx := context.Background()
+	server, key := newTestServer(t)
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Register(ctx, RegisterRequest{RegistrationKey: key, Username: "alice", Email: "alice@example.com", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Login(ctx, "alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	album, err := c.CreateAlbum(ctx, pkg.Metadata{Artist: "Can", Album: "Tago Mago", Format: "2xLP"},
+		[]Medium{{Number: 1, Format: "12\"", Speed: 33}, {Number: 2, Format: "12\"", Speed: 33}}, nil)
+	if err != nil {
+		t.Fatalf("CreateAlbum() error = %v", err)
+	}
+	if len(album.Media) != 2 || album.Media[1].Number != 2 {
+		t.Fatalf("CreateAlbum() media = %+v, want two discs", album.Media)
+	}
+
+	positions := []CreateTrackRequest{
+		{DiscNumber: 2, Side: "c", TrackNumber: 1, Title: "Aumgn"},
+		{DiscNumber: 1, Side: "B", TrackNumber: 1, Title: "Halleluhwah"},
+		{DiscNumber: 1, Side: "A", TrackNumber: 1, Title: "Paperhouse"},
+	}
+	for _, track := range positions {
+		track.AlbumID = album.ID
+		audio := []byte(track.Title)
+		if _, err = c.CreateTrack(ctx, track, &Upload{Filename: "track.flac", Body: bytes.NewReader(audio)}); err != nil {
+			t.Fatalf("CreateTrack(%s) error = %v", track.Title, err)
+		}
+	}
+	if _, err = c.CreateTrack(ctx, CreateTrackRequest{AlbumID: album.ID, DiscNumber: 3, TrackNumber: 1, Title: "Bring Me Coffee or Tea"},
+		&Upload{Filename: "track.flac", Body: bytes.NewReader([]byte("tea"))}); !IsCode(err, "validation_failed") {
+		t.Errorf("CreateTrack() on a third disc error = %v, want validation_failed", err)
+	}
+
+	album, err = c.Album(ctx, album.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, track := range album.Tracks {
+		order = append(order, track.Position())
+	}
+	if strings.Join(order, " ") != "A1 B1 C1" {
+		t.Errorf("Album() tracks = %v, want A1 B1 C1", order)
+	}
+
+	download, err := c.DownloadAlbum(ctx, album.ID)
+	if err != nil {
+		t.Fatalf("DownloadAlbum() error = %v", err)
+	}
+	archive, _ := io.ReadAll(download.Body)
+	download.Body.Close()
+	zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("DownloadAlbum() is not a zip: %v", err)
+	}
+	var names []string
+	for _, file := range zipReader.File {
+		names = append(names, file.Name)
+	}
+	if want := "1-A1_Paperhouse.flac 1-B1_Halleluhwah.flac 2-C1_Aumgn.flac"; strings.Join(names, " ") != want {
+		t.Errorf("DownloadAlbum() entries = %v, want %s", names, want)
+	}
+
+	// dropping a disc that still has tracks is refused
+	if _, err = c.UpdateAlbum(ctx, album.ID, album.Metadata, album.Media[:1], nil); !IsCode(err, "validation_failed") {
+		t.Errorf("UpdateAlbum() dropping a disc in use error = %v, want validation_failed", err)
+	}
+}
+
+func TestReleaseDetails(t *testing.T) {
+	ctx := context.Background()
+	server, key := newTestServer(t)
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Register(ctx, RegisterRequest{RegistrationKey: key, Username: "alice", Email: "alice@example.com", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Login(ctx, "alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := pkg.Metadata{
+		Artist: "Can", Album: "Tago Mago", Format: "2xLP",
+		CatalogNumber: "UAS 29 211/12 X", Barcode: "5 016025 610372", PressingPlant: "Optimal Media",
+		Matrix:       []pkg.Matrix{{Side: "a", Etching: "UAS 29211 A-1"}},
+		EditionNotes: "Gatefold",
+		Genres:       []string{"Rock", " rock "},
+		Styles:       []string{"Krautrock"},
+	}
+	album, err := c.CreateAlbum(ctx, metadata, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateAlbum() error = %v", err)
+	}
+	if album.Metadata.Matrix[0].Side != "A" || len(album.Metadata.Genres) != 1 {
+		t.Errorf("CreateAlbum() metadata = %+v, want the side upper case and one genre", album.Metadata)
+	}
+	track, err := c.CreateTrack(ctx, CreateTrackRequest{AlbumID: album.ID, Side: "A", TrackNumber: 1, Title: "Paperhouse"},
+		&Upload{Filename: "paperhouse.flac", Body: bytes.NewReader([]byte("flac"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad := metadata
+	bad.Barcode = "not a barcode"
+	if _, err = c.UpdateAlbum(ctx, album.ID, bad, nil, nil); !IsCode(err, "validation_failed") {
+		t.Errorf("UpdateAlbum() with a bad barcode error = %v, want validation_failed", err)
+	}
+
+	credits := map[uint64][]pkg.Credit{track.ID: {
+		{Role: "performer", Name: "Jaki Liebezeit", Detail: "drums"},
+		{Role: "producer", Name: "Holger Czukay"},
+	}}
+	album, err = c.UpdateCredits(ctx, album, credits)
+	if err != nil {
+		t.Fatalf("UpdateCredits() error = %v", err)
+	}
+	if len(album.Tracks) != 1 || len(album.Tracks[0].Credits) != 2 || album.Metadata.PressingPlant != "Optimal Media" {
+		t.Errorf("UpdateCredits() = %+v, want the credits and the metadata kept", album)
+	}
+	if _, err = c.UpdateCredits(ctx, album, map[uint64][]pkg.Credit{999: nil}); !IsCode(err, "validation_failed") {
+		t.Errorf("UpdateCredits() of another album's track error = %v, want validation_failed", err)
+	}
+
+	for _, query := range []AlbumQuery{
+		{Text: "uas 2921112x"},
+		{Text: "5016025610372"},
+		{Text: "can gatefold"},
+		{Genre: "ROCK", Style: "krautrock"},
+		{Credit: "liebezeit"},
+	} {
+		found, err := c.SearchAlbums(ctx, query)
+		if err != nil || len(found) != 1 || found[0].ID != album.ID {
+			t.Errorf("SearchAlbums(%+v) = %d albums, %v; want Tago Mago", query, len(found), err)
+		}
+	}
+	if found, err := c.SearchAlbums(ctx, AlbumQuery{Text: "can neu"}); err != nil || len(found) != 0 {
+		t.Errorf("SearchAlbums(can neu) = %d albums, %v; want none", len(found), err)
+	}
+	if _, err = c.SearchAlbums(ctx, AlbumQuery{}); !IsCode(err, "validation_failed") {
+		t.Errorf("SearchAlbums() of nothing error = %v, want validation_failed", err)
+	}
+
+	export, err := c.ExportAlbums(ctx)
+	if err != nil {
+		t.Fatalf("ExportAlbums() error = %v", err)
+	}
+	if export.Version != 1 || len(export.Releases) != 1 {
+		t.Fatalf("ExportAlbums() = %+v, want version 1 with one release", export)
+	}
+	release := export.Releases[0]
+	if release.Title != "Tago Mago" || release.CatalogNumber != "UAS 29 211/12 X" || len(release.Media) != 1 ||
+		len(release.Tracks) != 1 || release.Tracks[0].Position != "A1" || len(release.Tracks[0].Credits) != 2 {
+		t.Errorf("ExportAlbums() release = %+v", release)
+	}
+	if single, err := c.ExportAlbum(ctx, album.ID); err != nil || len(single.Releases) != 1 {
+		t.Errorf("ExportAlbum() = %+v, %v; want the one release", single, err)
+	}
+}
+
+func TestReleaseLookup(t *testing.T) {
+	ctx := context.Background()
+	server, key := newTestServer(t)
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Register(ctx, RegisterRequest{RegistrationKey: key, Username: "alice", Email: "alice@example.com", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Login(ctx, "alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	if providers, err := c.ReleaseProviders(ctx); err != nil || len(providers) != 1 || providers[0] != "file" {
+		t.Errorf("ReleaseProviders() = %v, %v; want [file]", providers, err)
+	}
+	if _, err = c.SearchReleases(ctx, ReleaseQuery{}); !IsCode(err, "validation_failed") {
+		t.Errorf("SearchReleases() without a query error = %v, want validation_failed", err)
+	}
+	candidates, err := c.SearchReleases(ctx, ReleaseQuery{Barcode: "5 016025 610389"})
+	if err != nil {
+		t.Fatalf("SearchReleases() error = %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].Metadata.Album != "Ege Bamyasi" || len(candidates[0].Tracks) != 3 {
+		t.Fatalf("SearchReleases() = %+v, want Ege Bamyasi with its tracklist", candidates)
+	}
+	missing := ReleaseCandidate{Provider: "file", ID: "can.json#1"}
+	if _, err = c.ApplyRelease(ctx, 0, &missing); !IsCode(err, "release_not_found") {
+		t.Errorf("ApplyRelease() of a missing release error = %v, want release_not_found", err)
+	}
+
+	album, err := c.ApplyRelease(ctx, 0, &candidates[0])
+	if err != nil {
+		t.Fatalf("ApplyRelease() error = %v", err)
+	}
+	if album.Metadata.CatalogNumber != "UAS 29 414" || len(album.Media) != 1 || len(album.Tracks) != 3 {
+		t.Fatalf("ApplyRelease() = %+v, want the release's details and 3 stubs", album)
+	}
+	stub := album.Tracks[2]
+	if !stub.IsStub() || stub.Position() != "B1" || stub.Credits[0].Name != "Damo Suzuki" {
+		t.Errorf("stub = %+v, want B1 with its credits and no audio", stub)
+	}
+
+	track, err := c.CreateTrack(ctx, CreateTrackRequest{AlbumID: album.ID, Side: "B", TrackNumber: 1, Title: "Vitamin C"},
+		&Upload{Filename: "vitamin-c.flac", Body: bytes.NewReader([]byte("flac"))})
+	if err != nil {
+		t.Fatalf("CreateTrack() at a stub error = %v", err)
+	}
+	if track.ID != stub.ID || track.IsStub() || track.Title != "Vitamin C" || len(track.Credits) != 1 {
+		t.Errorf("CreateTrack() = %+v, want stub %d filled with audio", track, stub.ID)
+	}
+
+	// applying again keeps the audio and adds no tracks
+	album, err = c.ApplyRelease(ctx, album.ID, &candidates[0])
+	if err != nil {
+		t.Fatalf("ApplyRelease() again error = %v", err)
+	}
+	if len(album.Tracks) != 3 || album.Tracks[2].IsStub() {
+		t.Errorf("ApplyRelease() again = %+v", album.Tracks)
+	}
+}
+
+// lowRate keeps the audio the tests upload small
+var lowRate = audiotest.Stereo16(8000)
+
+func TestSplitTracks(t *testing.T) {
+	ctx := context.Background()
+	server, key := newTestServer(t)
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Register(ctx, RegisterRequest{RegistrationKey: key, Username: "alice", Email: "alice@example.com", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Login(ctx, "alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	album, err := c.CreateAlbum(ctx, pkg.Metadata{Artist: "Can", Album: "Tago Mago", Format: "LP"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	side := audiotest.WAV(lowRate, 24000, audiotest.Ramp)
+	tracks, err := c.SplitTracks(ctx, SplitTracksRequest{
+		AlbumID: album.ID,
+		Points:  []SplitPoint{{Title: "Paperhouse", Start: "0:00"}, {Title: "Mushroom", Start: "1.5"}},
+	}, &Upload{Filename: "side a.wav", Body: bytes.NewReader(side)})
+	if err != nil {
+		t.Fatalf("SplitTracks() error = %v", err)
+	}
+	if len(tracks) != 2 || tracks[1].TrackNumber != 2 || tracks[1].StartSample != 12000 || tracks[1].EndSample != 24000 {
+		t.Fatalf("SplitTracks() = %+v", tracks)
+	}
+	if tracks[0].BlobID != tracks[1].BlobID {
+		t.Errorf("split tracks use blobs %d and %d, want one shared recording", tracks[0].BlobID, tracks[1].BlobID)
+	}
+
+	// the second track is a WAV of its own, starting on frame 12000
+	stream, err := c.StreamTrack(ctx, tracks[1].ID, 0)
+	if err != nil {
+		t.Fatalf("StreamTrack() error = %v", err)
+	}
+	got, _ := io.ReadAll(stream.Body)
+	stream.Body.Close()
+	if len(got) != 44+12000*4 || binary.LittleEndian.Uint32(got[40:]) != 12000*4 || binary.LittleEndian.Uint16(got[44:]) != 12000 {
+		t.Fatalf("StreamTrack() returned %d bytes, want a 12000 frame WAV starting on frame 12000", len(got))
+	}
+	stream, err = c.StreamTrack(ctx, tracks[1].ID, 48)
+	if err != nil {
+		t.Fatalf("StreamTrack() from 48 error = %v", err)
+	}
+	rest, _ := io.ReadAll(stream.Body)
+	stream.Body.Close()
+	if !stream.Partial || !bytes.Equal(rest, got[48:]) {
+		t.Errorf("StreamTrack() from 48 = partial %v, %d bytes; want the rest of the track", stream.Partial, len(rest))
+	}
+
+	download, err := c.DownloadAlbum(ctx, album.ID)
+	if err != nil {
+		t.Fatalf("DownloadAlbum() error = %v", err)
+	}
+	archive, _ := io.ReadAll(download.Body)
+	download.Body.Close()
+	zipReader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("DownloadAlbum() is not a zip: %v", err)
+	}
+	if len(zipReader.File) != 2 {
+		t.Fatalf("DownloadAlbum() zip holds %d files, want both tracks cut", len(zipReader.File))
+	}
+	// the cut as streamed, tagged with an ID3 chunk at the end
+	entry, err := zipReader.File[1].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged, _ := io.ReadAll(entry)
+	entry.Close()
+	if len(tagged) <= len(got) || !bytes.Equal(tagged[12:len(got)], got[12:]) || string(tagged[len(got):len(got)+4]) != "id3 " ||
+		!bytes.Contains(tagged, []byte("Mushroom")) {
+		t.Errorf("DownloadAlbum() second track has %d bytes, want the cut followed by its tags", len(tagged))
+	}
+
+	// the recording is counted once, however many tracks it is split into
+	usage, err := c.StorageUsage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage.ByAlbum) != 1 || usage.ByAlbum[0].Bytes != int64(len(side)) {
+		t.Errorf("StorageUsage() = %+v, want the recording's %d bytes", usage.ByAlbum, len(side))
+	}
+
+	// a CUE sheet for a recording the server already has, cut into files of their own
+	sum := sha256.Sum256(side)
+	cue := "FILE \"side a.wav\" WAVE\n  TRACK 01 AUDIO\n    TITLE \"Halleluhwah\"\n    INDEX 01 00:00:00\n" +
+		"  TRACK 02 AUDIO\n    TITLE \"Aumgn\"\n    INDEX 01 00:02:00\n"
+	materialized, err := c.SplitTracks(ctx, SplitTracksRequest{
+		AlbumID: album.ID, SHA256: hex.EncodeToString(sum[:]), CueSheet: cue, Materialize: true,
+	}, nil)
+	if err != nil {
+		t.Fatalf("SplitTracks() materialized error = %v", err)
+	}
+	if len(materialized) != 2 || materialized[0].TrackNumber != 3 || materialized[1].Title != "Aumgn" ||
+		materialized[1].EndSample != 0 || materialized[1].BlobID == tracks[1].BlobID {
+		t.Errorf("SplitTracks() materialized = %+v", materialized)
+	}
+
+	if _, err = c.SplitTracks(ctx, SplitTracksRequest{AlbumID: album.ID, SHA256: hex.EncodeToString(sum[:])}, nil); !IsCode(err, "validation_failed") {
+		t.Errorf("SplitTracks() without points error = %v, want validation_failed", err)
+	}
+}
+
+func TestLoudness(t *testing.T) {
+	ctx := context.Background()
+	server, key := newTestServer(t)
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Register(ctx, RegisterRequest{RegistrationKey: key, Username: "alice", Email: "alice@example.com", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Login(ctx, "alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	album, err := c.CreateAlbum(ctx, pkg.Metadata{Artist: "Can", Album: "Future Days", Format: "LP"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio := audiotest.WAV(lowRate, 5*8000, audiotest.Sine(lowRate, 1000, -20))
+	track, err := c.CreateTrack(ctx, CreateTrackRequest{AlbumID: album.ID, TrackNumber: 1, Title: "Moonshake"},
+		&Upload{Filename: "moonshake.wav", Body: bytes.NewReader(audio)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.Loudness != nil {
+		t.Errorf("new track Loudness = %+v, want none before analysis", track.Loudness)
+	}
+
+	// until the track is measured, normalizing leaves it as it is
+	stream, err := c.StreamTrackNormalized(ctx, track.ID, 0, NormalizeTrack)
+	if err != nil {
+		t.Fatalf("StreamTrackNormalized() error = %v", err)
+	}
+	got, _ := io.ReadAll(stream.Body)
+	stream.Body.Close()
+	if !bytes.Equal(got, audio) {
+		t.Errorf("StreamTrackNormalized() before analysis returned %d bytes, want the file as stored", len(got))
+	}
+
+	analyzed, err := c.AnalyzeTrack(ctx, track.ID)
+	if err != nil {
+		t.Fatalf("AnalyzeTrack() error = %v", err)
+	}
+	if analyzed.Loudness == nil || math.Abs(analyzed.Loudness.Integrated+20) > 0.5 || math.Abs(analyzed.Loudness.TruePeak+20) > 0.5 {
+		t.Fatalf("AnalyzeTrack() Loudness = %+v, want about -20 LUFS and -20 dBTP", analyzed.Loudness)
+	}
+	if analyzed.RipQuality == nil || analyzed.RipQuality.AnalyzedAt.IsZero() {
+		t.Errorf("AnalyzeTrack() RipQuality = %+v, want the rip checked", analyzed.RipQuality)
+	}
+	if album, err = c.Album(ctx, album.ID); err != nil || album.Loudness == nil || album.Loudness.Integrated != analyzed.Loudness.Integrated {
+		t.Errorf("Album() Loudness = %+v, %v; want that of its one track", album.Loudness, err)
+	}
+
+	// ReplayGain brings the track up to -18 LUFS, scaling the samples as they are served
+	stream, err = c.StreamTrackNormalized(ctx, track.ID, 0, NormalizeAlbum)
+	if err != nil {
+		t.Fatalf("StreamTrackNormalized() error = %v", err)
+	}
+	normalized, _ := io.ReadAll(stream.Body)
+	stream.Body.Close()
+	if len(normalized) != len(audio) || !bytes.Equal(normalized[:44], audio[:44]) {
+		t.Fatalf("StreamTrackNormalized() returned %d bytes, want a WAV of %d", len(normalized), len(audio))
+	}
+	factor := math.Pow(10, (-18-analyzed.Loudness.Integrated)/20)
+	for _, at := range []int{44 + 4*2, 44 + 4*10000} {
+		original, scaled := int16(binary.LittleEndian.Uint16(audio[at:])), int16(binary.LittleEndian.Uint16(normalized[at:]))
+		if want := float64(original) * factor; math.Abs(float64(scaled)-want) > 40 {
+			t.Errorf("sample at %d = %d, want %d scaled by %.3f", at, scaled, original, factor)
+		}
+	}
+	stream, err = c.StreamTrackNormalized(ctx, track.ID, 45, NormalizeTrack)
+	if err != nil {
+		t.Fatalf("StreamTrackNormalized() from 45 error = %v", err)
+	}
+	rest, _ := io.ReadAll(stream.Body)
+	stream.Body.Close()
+	if !stream.Partial || !bytes.Equal(rest, normalized[45:]) {
+		t.Errorf("StreamTrackNormalized() from 45 = partial %v, %d bytes; want the rest of the track", stream.Partial, len(rest))
+	}
+	if _, err = c.StreamTrackNormalized(ctx, track.ID, 0, "loud"); !IsCode(err, "validation_failed") {
+		t.Errorf("StreamTrackNormalized(loud) error = %v, want validation_failed", err)
+	}
+
+	download, err := c.DownloadTrackWithReplayGain(ctx, track.ID)
+	if err != nil {
+		t.Fatalf("DownloadTrackWithReplayGain() error = %v", err)
+	}
+	tagged, _ := io.ReadAll(download.Body)
+	download.Body.Close()
+	if !bytes.Contains(tagged, []byte("REPLAYGAIN_TRACK_GAIN")) || !bytes.Contains(tagged, []byte("REPLAYGAIN_ALBUM_GAIN")) {
+		t.Error("DownloadTrackWithReplayGain() has no ReplayGain tags")
+	}
+	download, err = c.DownloadTrack(ctx, track.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, _ := io.ReadAll(download.Body)
+	download.Body.Close()
+	if bytes.Contains(plain, []byte("REPLAYGAIN")) {
+		t.Error("DownloadTrack() has ReplayGain tags without asking for them")
+	}
+	download, err = c.DownloadTrackOriginal(ctx, track.ID)
+	if err != nil {
+		t.Fatalf("DownloadTrackOriginal() error = %v", err)
+	}
+	original, _ := io.ReadAll(download.Body)
+	download.Body.Close()
+	if !bytes.Equal(original, audio) || download.Filename != "Moonshake.wav" || track.Blob.SourceHash != "" {
+		t.Errorf("DownloadTrackOriginal() = %d bytes named %q, want the WAV as uploaded", len(original), download.Filename)
+	}
+
+	if queued, err := c.AnalyzeAlbum(ctx, album.ID); err != nil || queued != 1 {
+		t.Errorf("AnalyzeAlbum() = %d, %v; want 1 track queued", queued, err)
+	}
+}
+
+func TestSpectrogram(t *testing.T) {
+	ctx := context.Background()
+	server, key := newTestServer(t)
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Register(ctx, RegisterRequest{RegistrationKey: key, Username: "alice", Email: "alice@example.com", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Login(ctx, "alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	album, err := c.CreateAlbum(ctx, pkg.Metadata{Artist: "Can", Album: "Future Days", Format: "LP"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	track, err := c.CreateTrack(ctx, CreateTrackRequest{AlbumID: album.ID, TrackNumber: 1, Title: "Moonshake"},
+		&Upload{Filename: "moonshake.wav", Body: bytes.NewReader(audiotest.WAV(lowRate, 2*8000, audiotest.Sine(lowRate, 1000, -20)))})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, scale := range []string{"", ScaleLinear} {
+		download, err := c.Spectrogram(ctx, track.ID, 1024, scale)
+		if err != nil {
+			t.Fatalf("Spectrogram(%q) error = %v", scale, err)
+		}
+		img, err := png.Decode(download.Body)
+		download.Body.Close()
+		if err != nil || download.ContentType != "image/png" || download.Filename != "Moonshake.png" {
+			t.Errorf("Spectrogram(%q) = %s %q, %v; want Moonshake.png", scale, download.ContentType, download.Filename, err)
+		} else if size := img.Bounds().Size(); size.X != 1024 || size.Y != 512 {
+			t.Errorf("Spectrogram(%q) size = %v, want the default 1024x512", scale, size)
+		}
+	}
+
+	var apiErr *Error
+	if _, err = c.Spectrogram(ctx, track.ID, 1000, ""); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Spectrogram() with an FFT size that isn't a power of two error = %v, want 400", err)
+	}
+}
+
+func TestConversionPresets(t *testing.T) {
+	ctx := context.Background()
+	server, key := newTestServer(t)
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Register(ctx, RegisterRequest{RegistrationKey: key, Username: "alice", Email: "alice@example.com", Password: "password"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Login(ctx, "alice", "password"); err != nil {
+		t.Fatal(err)
+	}
+	album, err := c.CreateAlbum(ctx, pkg.Metadata{Artist: "Can", Album: "Future Days", Format: "LP"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audio := audiotest.WAV(lowRate, 1*8000, audiotest.Sine(lowRate, 1000, -20))
+	track, err := c.CreateTrack(ctx, CreateTrackRequest{AlbumID: album.ID, TrackNumber: 1, Title: "Moonshake"},
+		&Upload{Filename: "moonshake.wav", Body: bytes.NewReader(audio)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	presets, err := c.ConversionPresets(ctx)
+	if err != nil {
+		t.Fatalf("ConversionPresets() error = %v", err)
+	}
+	i := slices.IndexFunc(presets, func(p ConversionPreset) bool { return p.Name == "cd" })
+	if i < 0 || presets[i].BitDepth != 16 || presets[i].SampleRate != 44100 {
+		t.Errorf("ConversionPresets() = %+v, want CD quality among them", presets)
+	}
+
+	if _, err = c.SetConversionPreset(ctx, "tape"); !IsCode(err, "validation_failed") {
+		t.Errorf("SetConversionPreset(tape) error = %v, want validation_failed", err)
+	}
+	user, err := c.SetConversionPreset(ctx, "CD")
+	if err != nil || user.ConversionPreset != "cd" {
+		t.Fatalf("SetConversionPreset(CD) = %+v, %v; want the cd preset", user, err)
+	}
+	if user, err = c.CurrentUser(ctx); err != nil || user.ConversionPreset != "cd" {
+		t.Errorf("CurrentUser() = %+v, %v; want the cd preset kept", user, err)
+	}
+
+	// the default converts downloads, which takes ffmpeg; none downloads the stored file
+	if _, err = c.DownloadTrack(ctx, track.ID); !IsCode(err, "conversion_unavailable") {
+		t.Errorf("DownloadTrack() with a default preset error = %v, want conversion_unavailable without ffmpeg", err)
+	}
+	if _, err = c.DownloadTrackWithPreset(ctx, track.ID, "opus", true); !IsCode(err, "conversion_unavailable") {
+		t.Errorf("DownloadTrackWithPreset(opus) error = %v, want conversion_unavailable without ffmpeg", err)
+	}
+	if _, err = c.DownloadTrackWithPreset(ctx, track.ID, "tape", false); !IsCode(err, "validation_failed") {
+		t.Errorf("DownloadTrackWithPreset(tape) error = %v, want validation_failed", err)
+	}
+	download, err := c.DownloadTrackWithPreset(ctx, track.ID, "none", false)
+	if err != nil {
+		t.Fatalf("DownloadTrackWithPreset(none) error = %v", err)
+	}
+	stored, _ := io.ReadAll(download.Body)
+	download.Body.Close()
+	if !bytes.Equal(stored[8:44], audio[8:44]) || download.Filename != "Moonshake.wav" {
+		t.Errorf("DownloadTrackWithPreset(none) = %d bytes named %q, want the stored WAV", len(stored), download.Filename)
+	}
+
+	if user, err = c.SetConversionPreset(ctx, ""); err != nil || user.ConversionPreset != "" {
+		t.Fatalf("SetConversionPreset(\"\") = %+v, %v; want no default", user, err)
+	}
+	if download, err = c.DownloadTrack(ctx, track.ID); err != nil {
+		t.Fatalf("DownloadTrack() without a default error = %v", err)
+	}
+	download.Body.Close()
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// StreamTrack opens a track's audio for playback, from offset bytes in when offset > 0
+func (c *Client) StreamTrack(ctx context.Context, id uint64, offset int64) (*Download, error) {
+	return c.download(ctx, fmt.Sprintf("/track/%d/stream", id), offset)
+}
+
+// StreamTrackNormalized streams a track adjusted by its ReplayGain, NormalizeTrack or
+// NormalizeAlbum. Tracks that have not been analyzed play as stored.
+func (c *Client) StreamTrackNormalized(ctx context.Context, id uint64, offset int64, mode string) (*Download, error) {
+	return c.download(ctx, fmt.Sprintf("/track/%d/stream?normalize=%s", id, url.QueryEscape(mode)), offset)
+}
+
+// Spectrogram opens a PNG spectrogram of a track. fftSize 0 and scale "" take the
+// server's defaults; the first request for an image waits while the track is decoded.
+func (c *Client) Spectrogram(ctx context.Context, id uint64, fftSize int, scale string) (*Download, error) {
+	params := url.Values{}
+	if fftSize > 0 {
+		params.Set("fft_size", strconv.Itoa(fftSize))
+	}
+	if scale != "" {
+		params.Set("scale", scale)
+	}
+	path := fmt.Sprintf("/track/%d/spectrogram", id)
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	return c.download(ctx, path, 0)
+}
+
+// DownloadTrack opens a track's audio file; Filename carries the server's suggested name
+func (c *Client) DownloadTrack(ctx context.Context, id uint64) (*Download, error) {
+	return c.download(ctx, fmt.Sprintf("/track/%d/download", id), 0)
+}
+
+// DownloadTrackWithReplayGain is DownloadTrack with ReplayGain tags written in too
+func (c *Client) DownloadTrackWithReplayGain(ctx context.Context, id uint64) (*Download, error) {
+	return c.download(ctx, fmt.Sprintf("/track/%d/download?replaygain=true", id), 0)
+}
+
+// DownloadTrackWithPreset is DownloadTrack converted with the named preset, which
+// takes as long as converting the track, and with ReplayGain tags if replayGain.
+// "none" downloads the stored file whatever the user's default.
+func (c *Client) DownloadTrackWithPreset(ctx context.Context, id uint64, preset string, replayGain bool) (*Download, error) {
+	params := url.Values{"preset": {preset}}
+	if replayGain {
+		params.Set("replaygain", "true")
+	}
+	return c.download(ctx, fmt.Sprintf("/track/%d/download?%s", id, params.Encode()), 0)
+}
+
+// ConversionPresets lists the presets downloads can be converted with
+func (c *Client) ConversionPresets(ctx context.Context) ([]ConversionPreset, error) {
+	var out struct {
+		Presets []ConversionPreset `json:"presets"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/conversion/presets", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Presets, nil
+}
+
+// DownloadTrackOriginal opens a track's audio as it was uploaded, without the album's
+// tags, rebuilding it byte for byte if the server stored it as FLAC
+func (c *Client) DownloadTrackOriginal(ctx context.Context, id uint64) (*Download, error) {
+	return c.download(ctx, fmt.Sprintf("/track/%d/download?original=true", id), 0)
+}
+
+// DownloadAlbum opens a zip of all the album's tracks
+func (c *Client) DownloadAlbum(ctx context.Context, id uint64) (*Download, error) {
+	return c.download(ctx, fmt.Sprintf("/album/%d/download", id), 0)
+}
+
+// DownloadAlbumWithReplayGain is DownloadAlbum with ReplayGain tags written in too
+func (c *Client) DownloadAlbumWithReplayGain(ctx context.Context, id uint64) (*Download, error) {
+	return c.download(ctx, fmt.Sprintf("/album/%d/download?replaygain=true", id), 0)
+}
+
+func (c *Client) CoverArt(ctx context.Context, albumID uint64) (*Download, error) {
+	return c.download(ctx, fmt.Sprintf("/album/%d/cover", albumID), 0)
+}
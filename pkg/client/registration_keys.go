@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type GeneratedKey struct {
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GenerateKey creates a one-time registration key valid for the given number of hours (admin only)
+func (c *Client) GenerateKey(ctx context.Context, expirationHours int) (*GeneratedKey, error) {
+	in := map[string]int{"expiration_hours": expirationHours}
+	var out GeneratedKey
+	if err := c.doJSON(ctx, http.MethodPost, "/admin/registration-key", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RegistrationKeys lists the keys created by the current admin
+func (c *Client) RegistrationKeys(ctx context.Context) ([]RegistrationKey, error) {
+	var out struct {
+		Keys []RegistrationKey `json:"keys"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/admin/registration-keys", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Keys, nil
+}
+
+func (c *Client) DeleteKey(ctx context.Context, id uint64) error {
+	return c.doJSON(ctx, http.MethodDelete, fmt.Sprintf("/admin/registration-key/%d", id), nil, nil)
+}
+
+// ValidateKey checks a registration key and returns when it expires
+func (c *Client) ValidateKey(ctx context.Context, key string) (time.Time, error) {
+	var out struct {
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := c.doJSON(ctx, http.MethodPost, "/validate-key", map[string]string{"key": key}, &out); err != nil {
+		return time.Time{}, err
+	}
+	return out.ExpiresAt, nil
+}
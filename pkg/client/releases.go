@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// ReleaseProviders lists the metadata providers the server looks releases up with
+func (c *Client) ReleaseProviders(ctx context.Context) ([]string, error) {
+	var out struct {
+		Providers []string `json:"providers"`
+	}
+	if err := c.doJSON(ctx, http.MethodGet, "/releases/providers", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Providers, nil
+}
+
+// SearchReleases looks up releases matching query, with their tracklists
+func (c *Client) SearchReleases(ctx context.Context, query ReleaseQuery) ([]ReleaseCandidate, error) {
+	params := url.Values{}
+	for name, value := range map[string]string{
+		"barcode": query.Barcode, "catalog_number": query.CatalogNumber,
+		"artist": query.Artist, "title": query.Title, "provider": query.Provider,
+	} {
+		if value != "" {
+			params.Set(name, value)
+		}
+	}
+	var out []ReleaseCandidate
+	if err := c.doJSON(ctx, http.MethodGet, "/releases/search?"+params.Encode(), nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ApplyRelease fills the album in from a release found by SearchReleases, or creates an
+// album from it when albumID is 0. Positions of the tracklist the album has no track at
+// get stubs, which CreateTrack at the same position fills with audio.
+func (c *Client) ApplyRelease(ctx context.Context, albumID uint64, release *ReleaseCandidate) (*Album, error) {
+	in := map[string]any{"provider": release.Provider, "id": release.ID}
+	if albumID != 0 {
+		in["album_id"] = albumID
+	}
+	var out Album
+	if err := c.doJSON(ctx, http.MethodPost, "/releases/apply", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// CreateTrack adds a track, uploading audio. With req.SHA256 set the server is asked
+// first whether the user already stores that content, and the upload is skipped if so;
+// audio may then be nil.
+func (c *Client) CreateTrack(ctx context.Context, req CreateTrackRequest, audio *Upload) (*Track, error) {
+	var out Track
+	if req.SHA256 != "" {
+		err := c.doJSON(ctx, http.MethodPost, "/track", req, &out)
+		if err == nil {
+			return &out, nil
+		}
+		if audio == nil || !isMissingAudio(err) {
+			return nil, err
+		}
+	}
+	if audio == nil {
+		return nil, fmt.Errorf("no audio to upload for track %q", req.Title)
+	}
+
+	quality, err := jsonField("audio_quality", req.AudioQuality)
+	if err != nil {
+		return nil, err
+	}
+	fields := []formField{
+		{name: "album_id", value: strconv.FormatUint(req.AlbumID, 10)},
+		{name: "disc_number", value: strconv.Itoa(req.DiscNumber)},
+		{name: "side", value: req.Side},
+		{name: "track_number", value: strconv.Itoa(req.TrackNumber)},
+		{name: "title", value: req.Title},
+		{name: "duration", value: strconv.FormatUint(uint64(req.Duration), 10)},
+		quality,
+		{name: "audio_file", file: audio},
+	}
+	if err = c.doMultipart(ctx, http.MethodPost, "/track", fields, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// isMissingAudio tells the server's "unknown hash, send the file" answer apart from other failures
+func isMissingAudio(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != "validation_failed" {
+		return false
+	}
+	for _, field := range apiErr.Errors {
+		if field.Field == "audio_file" {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitTracks creates tracks from a side-long recording, uploading it unless
+// req.SHA256 names content the user already stores
+func (c *Client) SplitTracks(ctx context.Context, req SplitTracksRequest, audio *Upload) ([]Track, error) {
+	fields := []formField{
+		{name: "album_id", value: strconv.FormatUint(req.AlbumID, 10)},
+		{name: "disc_number", value: strconv.Itoa(req.DiscNumber)},
+		{name: "side", value: req.Side},
+		{name: "first_track_number", value: strconv.Itoa(req.FirstTrackNumber)},
+		{name: "materialize", value: strconv.FormatBool(req.Materialize)},
+	}
+	if req.CueSheet != "" {
+		fields = append(fields, formField{name: "cue_sheet", value: req.CueSheet})
+	}
+	if len(req.Points) > 0 {
+		points, err := jsonField("points", req.Points)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, points)
+	}
+
+	var out []Track
+	if req.SHA256 != "" {
+		err := c.doMultipart(ctx, http.MethodPost, "/track/split", append(fields, formField{name: "sha256", value: req.SHA256}), &out)
+		if err == nil {
+			return out, nil
+		}
+		if audio == nil || !isMissingAudio(err) {
+			return nil, err
+		}
+	}
+	if audio == nil {
+		return nil, fmt.Errorf("no recording to upload for album %d", req.AlbumID)
+	}
+	if err := c.doMultipart(ctx, http.MethodPost, "/track/split", append(fields, formField{name: "audio_file", file: audio}), &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) Track(ctx context.Context, id uint64) (*Track, error) {
+	var out Track
+	if err := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/track/%d", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateTrack(ctx context.Context, id uint64, req UpdateTrackRequest) (*Track, error) {
+	var out Track
+	if err := c.doJSON(ctx, http.MethodPut, fmt.Sprintf("/track/%d", id), req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AnalyzeTrack measures a track's loudness, and returns it with the result
+func (c *Client) AnalyzeTrack(ctx context.Context, id uint64) (*Track, error) {
+	var out Track
+	if err := c.doJSON(ctx, http.MethodPost, fmt.Sprintf("/track/%d/analyze", id), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteTrack moves the track to the trash
+func (c *Client) DeleteTrack(ctx context.Context, id uint64) error {
+	return c.doJSON(ctx, http.MethodDelete, fmt.Sprintf("/track/%d", id), nil, nil)
+}
@@ -0,0 +1,34 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Trash lists the current user's trashed albums and tracks
+func (c *Client) Trash(ctx context.Context) (*Trash, error) {
+	var out Trash
+	if err := c.doJSON(ctx, http.MethodGet, "/trash", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) RestoreAlbum(ctx context.Context, id uint64) error {
+	return c.doJSON(ctx, http.MethodPost, fmt.Sprintf("/trash/album/%d/restore", id), nil, nil)
+}
+
+func (c *Client) RestoreTrack(ctx context.Context, id uint64) error {
+	return c.doJSON(ctx, http.MethodPost, fmt.Sprintf("/trash/track/%d/restore", id), nil, nil)
+}
+
+// PurgeAlbum permanently deletes a trashed album and its media
+func (c *Client) PurgeAlbum(ctx context.Context, id uint64) error {
+	return c.doJSON(ctx, http.MethodDelete, fmt.Sprintf("/trash/album/%d", id), nil, nil)
+}
+
+// PurgeTrack permanently deletes a trashed track and its media
+func (c *Client) PurgeTrack(ctx context.Context, id uint64) error {
+	return c.doJSON(ctx, http.MethodDelete, fmt.Sprintf("/trash/track/%d", id), nil, nil)
+}
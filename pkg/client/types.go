@@ -0,0 +1,267 @@
+package client
+
+import (
+	"strconv"
+	"time"
+	"vinyl-vault/pkg"
+)
+
+type User struct {
+	ID           uint64 `json:"id"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	IsAdmin      bool   `json:"is_admin"`
+	StorageQuota *int64 `json:"storage_quota,omitempty"` // bytes, nil uses the instance default
+	StorageUsed  int64  `json:"storage_used"`
+	// ConversionPreset names the preset downloads default to, empty for the stored file
+	ConversionPreset string    `json:"conversion_preset,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type Album struct {
+	ID          uint64       `json:"id"`
+	UserID      uint64       `json:"user_id"`
+	Metadata    pkg.Metadata `json:"metadata"`
+	CoverBlobID *uint64      `json:"cover_blob_id,omitempty"`
+	Media       []Medium     `json:"media"`
+	Tracks      []Track      `json:"tracks"`             // in play order
+	Loudness    *Loudness    `json:"loudness,omitempty"` // of its analyzed tracks together
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	DeletedAt   *time.Time   `json:"deleted_at,omitempty"`
+}
+
+// Medium is one disc of a release
+type Medium struct {
+	Number int    `json:"number"`           // 1 for the first disc
+	Format string `json:"format,omitempty"` // 12", 10", 7"...
+	Speed  int    `json:"speed,omitempty"`  // RPM, 33 standing for 33⅓
+}
+
+type Track struct {
+	ID           uint64           `json:"id"`
+	AlbumID      uint64           `json:"album_id"`
+	DiscNumber   int              `json:"disc_number"`
+	Side         string           `json:"side,omitempty"` // A, B, AA...; empty on releases without sides
+	TrackNumber  int              `json:"track_number"`   // on the side, or the disc when there are none
+	Title        string           `json:"title"`
+	Duration     pkg.Duration     `json:"duration"`
+	BlobID       uint64           `json:"blob_id,omitempty"` // 0 on a stub, see IsStub
+	Blob         *Blob            `json:"blob,omitempty"`
+	AudioQuality pkg.AudioQuality `json:"audio_quality"`
+	RipQuality   *pkg.RipQuality  `json:"rip_quality,omitempty"` // what analyzing the audio found; nil until then
+	Loudness     *Loudness        `json:"loudness,omitempty"`    // nil until the track is analyzed
+	Credits      []pkg.Credit     `json:"credits,omitempty"`
+	StartSample  int64            `json:"start_sample,omitempty"` // set on tracks split out of a longer recording
+	EndSample    int64            `json:"end_sample,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+	DeletedAt    *time.Time       `json:"deleted_at,omitempty"`
+}
+
+// Loudness is an EBU R128 measurement of a track or album
+type Loudness struct {
+	Integrated float64   `json:"integrated"` // LUFS
+	TruePeak   float64   `json:"true_peak"`  // dBTP
+	Range      float64   `json:"range"`      // LU
+	AnalyzedAt time.Time `json:"analyzed_at"`
+}
+
+// Normalizations for StreamTrackNormalized
+const (
+	NormalizeTrack = "track"
+	NormalizeAlbum = "album" // the track gain until the album has been measured
+)
+
+// Frequency scales for Spectrogram
+const (
+	ScaleLog    = "log" // each octave the same height, the server's default
+	ScaleLinear = "linear"
+)
+
+// IsStub reports whether the track comes from a release lookup and has no audio yet
+func (t *Track) IsStub() bool {
+	return t.BlobID == 0
+}
+
+// Position is the track's label on the release: A1, B2... with sides, else its number
+func (t *Track) Position() string {
+	if t.Side == "" {
+		return strconv.Itoa(t.TrackNumber)
+	}
+	return t.Side + strconv.Itoa(t.TrackNumber)
+}
+
+// AlbumQuery searches the current user's albums; see SearchAlbums
+type AlbumQuery struct {
+	Text   string // words that must all appear in the album's metadata, track titles or credits
+	Genre  string
+	Style  string
+	Credit string // part of a name credited on a track
+}
+
+// Export is album metadata in the format of the server's /export.schema.json
+type Export struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Releases   []ExportRelease `json:"releases"`
+}
+
+type ExportRelease struct {
+	Artist        string        `json:"artist"`
+	Title         string        `json:"title"`
+	Format        string        `json:"format"`
+	ReleaseDate   string        `json:"release_date,omitempty"`
+	Label         string        `json:"label,omitempty"`
+	Country       string        `json:"country,omitempty"`
+	CatalogNumber string        `json:"catalog_number,omitempty"`
+	Barcode       string        `json:"barcode,omitempty"`
+	PressingPlant string        `json:"pressing_plant,omitempty"`
+	Matrix        []pkg.Matrix  `json:"matrix,omitempty"`
+	EditionNotes  string        `json:"edition_notes,omitempty"`
+	Genres        []string      `json:"genres,omitempty"`
+	Styles        []string      `json:"styles,omitempty"`
+	Media         []Medium      `json:"media"`
+	Tracks        []ExportTrack `json:"tracks"` // in play order
+}
+
+type ExportTrack struct {
+	Position    string       `json:"position"`
+	DiscNumber  int          `json:"disc_number"`
+	Side        string       `json:"side,omitempty"`
+	TrackNumber int          `json:"track_number"`
+	Title       string       `json:"title"`
+	Duration    pkg.Duration `json:"duration,omitempty"`
+	Credits     []pkg.Credit `json:"credits,omitempty"`
+}
+
+// ReleaseQuery looks releases up with the server's metadata providers; every field set
+// has to match
+type ReleaseQuery struct {
+	Barcode       string
+	CatalogNumber string
+	Artist        string
+	Title         string
+	Provider      string // only ask this provider; empty asks them all
+}
+
+// ReleaseCandidate is a release a provider found, to apply to an album with ApplyRelease
+type ReleaseCandidate struct {
+	Provider  string           `json:"provider"`
+	ID        string           `json:"id"`
+	Metadata  pkg.Metadata     `json:"metadata"`
+	Media     []Medium         `json:"media,omitempty"`
+	Tracks    []CandidateTrack `json:"tracks"`
+	CoverURLs []string         `json:"cover_urls,omitempty"` // front first; fetch one and send it as cover art
+}
+
+type CandidateTrack struct {
+	DiscNumber  int          `json:"disc_number"`
+	Side        string       `json:"side,omitempty"`
+	TrackNumber int          `json:"track_number"`
+	Title       string       `json:"title"`
+	Duration    pkg.Duration `json:"duration,omitempty"`
+	Credits     []pkg.Credit `json:"credits,omitempty"`
+}
+
+type Blob struct {
+	ID         uint64 `json:"id"`
+	Hash       string `json:"hash"` // hex SHA-256 of the content
+	Size       int64  `json:"size"`
+	RefCount   int    `json:"ref_count"`
+	SourceHash string `json:"source_hash,omitempty"` // of the AIFF or WAV upload, when it is stored as FLAC
+}
+
+// ConversionPreset is a way the server converts downloads; zero values match the
+// source track
+type ConversionPreset struct {
+	Name       string `json:"name"`
+	Format     string `json:"format"`
+	BitDepth   int    `json:"bit_depth,omitempty"`
+	SampleRate int    `json:"sample_rate,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+	Dither     string `json:"dither,omitempty"`
+	Bitrate    int    `json:"bitrate,omitempty"` // kbps
+	VBR        bool   `json:"vbr,omitempty"`
+}
+
+type RegistrationKey struct {
+	ID        uint64     `json:"id"`
+	Key       string     `json:"key"`
+	CreatedBy uint64     `json:"created_by"`
+	UsedBy    *uint64    `json:"used_by,omitempty"`
+	IsUsed    bool       `json:"is_used"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type AlbumUsage struct {
+	AlbumID uint64 `json:"album_id"`
+	Title   string `json:"title"`
+	Tracks  int    `json:"tracks"`
+	Bytes   int64  `json:"bytes"`
+}
+
+type StorageUsage struct {
+	Used     int64            `json:"used"`
+	Quota    int64            `json:"quota"` // 0 means unlimited
+	ByAlbum  []AlbumUsage     `json:"by_album"`
+	ByFormat map[string]int64 `json:"by_format"`
+}
+
+type Trash struct {
+	Albums []Album `json:"albums"`
+	Tracks []Track `json:"tracks"`
+}
+
+type RegisterRequest struct {
+	RegistrationKey string `json:"registration_key"`
+	Username        string `json:"username"`
+	Email           string `json:"email"`
+	Password        string `json:"password"`
+}
+
+// CreateTrackRequest describes a new track. When SHA256 matches content the user
+// already stores, CreateTrack sends no audio.
+type CreateTrackRequest struct {
+	AlbumID      uint64           `json:"album_id"`
+	DiscNumber   int              `json:"disc_number,omitempty"` // 0 is the first disc
+	Side         string           `json:"side,omitempty"`
+	TrackNumber  int              `json:"track_number"`
+	Title        string           `json:"title"`
+	Duration     pkg.Duration     `json:"duration"`
+	AudioQuality pkg.AudioQuality `json:"audio_quality"`
+	SHA256       string           `json:"sha256,omitempty"`
+}
+
+// SplitTracksRequest splits one recording of a whole side into tracks starting at
+// the times of either CueSheet or Points
+type SplitTracksRequest struct {
+	AlbumID          uint64
+	SHA256           string // skips the upload if the user already stores the recording
+	CueSheet         string
+	Points           []SplitPoint
+	DiscNumber       int    // of the recording, 0 being the first disc
+	Side             string // of the recording, e.g. A
+	FirstTrackNumber int    // 0 continues after the last track on the side
+	Materialize      bool   // store each track as a file of its own instead of a range of the recording
+}
+
+// SplitPoint is where a track starts, as m:ss, m:ss.fff, CUE-style mm:ss:ff or seconds
+type SplitPoint struct {
+	Title string `json:"title"`
+	Start string `json:"start"`
+}
+
+// UpdateTrackRequest changes only the fields that are set
+type UpdateTrackRequest struct {
+	DiscNumber   *int              `json:"disc_number,omitempty"`
+	Side         *string           `json:"side,omitempty"`
+	TrackNumber  *int              `json:"track_number,omitempty"`
+	Title        *string           `json:"title,omitempty"`
+	Duration     *int              `json:"duration,omitempty"`
+	AudioQuality *pkg.AudioQuality `json:"audio_quality,omitempty"`
+	Credits      []pkg.Credit      `json:"credits,omitempty"` // replaces them; an empty slice clears them
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type userEnvelope struct {
+	User *User `json:"user"`
+}
+
+// Register creates an account with a registration key. It does not log in.
+func (c *Client) Register(ctx context.Context, req RegisterRequest) (*User, error) {
+	var out userEnvelope
+	if err := c.doJSON(ctx, http.MethodPost, "/register", req, &out); err != nil {
+		return nil, err
+	}
+	return out.User, nil
+}
+
+// Login starts a session; later requests carry its cookie
+func (c *Client) Login(ctx context.Context, username, password string) (*User, error) {
+	in := map[string]string{"username": username, "password": password}
+	var out userEnvelope
+	if err := c.doJSON(ctx, http.MethodPost, "/login", in, &out); err != nil {
+		return nil, err
+	}
+	return out.User, nil
+}
+
+func (c *Client) Logout(ctx context.Context) error {
+	return c.doJSON(ctx, http.MethodPost, "/logout", nil, nil)
+}
+
+func (c *Client) CurrentUser(ctx context.Context) (*User, error) {
+	var out userEnvelope
+	if err := c.doJSON(ctx, http.MethodGet, "/user/me", nil, &out); err != nil {
+		return nil, err
+	}
+	return out.User, nil
+}
+
+func (c *Client) StorageUsage(ctx context.Context) (*StorageUsage, error) {
+	var out StorageUsage
+	if err := c.doJSON(ctx, http.MethodGet, "/user/me/usage", nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (c *Client) UpdateUsername(ctx context.Context, username string) (*User, error) {
+	var out userEnvelope
+	if err := c.doJSON(ctx, http.MethodPut, "/user/username", map[string]string{"username": username}, &out); err != nil {
+		return nil, err
+	}
+	return out.User, nil
+}
+
+func (c *Client) UpdateEmail(ctx context.Context, email string) (*User, error) {
+	var out userEnvelope
+	if err := c.doJSON(ctx, http.MethodPut, "/user/email", map[string]string{"email": email}, &out); err != nil {
+		return nil, err
+	}
+	return out.User, nil
+}
+
+// SetConversionPreset sets the preset the user's downloads are converted with by
+// default; "" downloads tracks as they are stored again
+func (c *Client) SetConversionPreset(ctx context.Context, preset string) (*User, error) {
+	var out userEnvelope
+	if err := c.doJSON(ctx, http.MethodPut, "/user/conversion-preset", map[string]string{"preset": preset}, &out); err != nil {
+		return nil, err
+	}
+	return out.User, nil
+}
+
+func (c *Client) ChangePassword(ctx context.Context, oldPassword, newPassword string) error {
+	in := map[string]string{"old_password": oldPassword, "new_password": newPassword}
+	return c.doJSON(ctx, http.MethodPut, "/user/password", in, nil)
+}
+
+// DeleteAccount deletes the current user and ends the session
+func (c *Client) DeleteAccount(ctx context.Context) error {
+	return c.doJSON(ctx, http.MethodDelete, "/user", nil, nil)
+}
+
+// SetQuota overrides a user's storage quota in bytes; nil reverts to the instance default (admin only)
+func (c *Client) SetQuota(ctx context.Context, userID uint64, quota *int64) (*User, error) {
+	in := map[string]*int64{"quota": quota}
+	var out userEnvelope
+	if err := c.doJSON(ctx, http.MethodPut, fmt.Sprintf("/admin/user/%d/quota", userID), in, &out); err != nil {
+		return nil, err
+	}
+	return out.User, nil
+}
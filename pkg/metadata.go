@@ -6,16 +6,39 @@ import (
 )
 
 type Metadata struct {
-	Artist       string   `json:"artist" gorm:"column:artist"`
-	Album        string   `json:"album" gorm:"column:album"`
-	Format       string   `json:"format" gorm:"column:format"`
-	ReleaseDate  string   `json:"release_date" gorm:"column:release_date"`
-	Label        *string  `json:"label,omitempty" gorm:"column:label"`
-	Country      *string  `json:"country,omitempty" gorm:"column:country"`
-	Length       Duration `json:"length" gorm:"column:length"`
-	CoverArtPath string   `json:"cover_art_path" gorm:"column:cover_art_path"`
+	Artist        string   `json:"artist" gorm:"column:artist"`
+	Album         string   `json:"album" gorm:"column:album"`
+	Format        string   `json:"format" gorm:"column:format"`
+	ReleaseDate   string   `json:"release_date" gorm:"column:release_date"`
+	Label         *string  `json:"label,omitempty" gorm:"column:label"`
+	Country       *string  `json:"country,omitempty" gorm:"column:country"`
+	CatalogNumber string   `json:"catalog_number,omitempty" gorm:"column:catalog_number;not null;default:''"`
+	Barcode       string   `json:"barcode,omitempty" gorm:"column:barcode;not null;default:''"`
+	PressingPlant string   `json:"pressing_plant,omitempty" gorm:"column:pressing_plant;not null;default:''"`
+	Matrix        []Matrix `json:"matrix,omitempty" gorm:"column:matrix;serializer:json"`
+	EditionNotes  string   `json:"edition_notes,omitempty" gorm:"column:edition_notes;not null;default:''"`
+	Genres        []string `json:"genres,omitempty" gorm:"column:genres;serializer:json"`
+	Styles        []string `json:"styles,omitempty" gorm:"column:styles;serializer:json"`
+	Length        Duration `json:"length" gorm:"column:length"`
+	CoverArtPath  string   `json:"cover_art_path" gorm:"column:cover_art_path"`
 }
 
+// Matrix is what is etched or stamped in the runout groove of one side
+type Matrix struct {
+	Side    string `json:"side"`
+	Etching string `json:"etching"`
+}
+
+// Credit names someone who worked on a track, in one of the CreditRoles
+type Credit struct {
+	Role   string `json:"role"`
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"` // e.g. the instrument a performer plays
+}
+
+// CreditRoles are the roles a Credit can have
+var CreditRoles = []string{"performer", "producer", "engineer", "composer"}
+
 type Duration uint
 
 func (d Duration) ToTime() time.Duration {